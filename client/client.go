@@ -151,13 +151,16 @@ type Sender struct {
 }
 
 type GithubRepository struct {
-	ID             int    `json:"id"`
-	FullName       string `json:"full_name"`
-	Private        bool   `json:"private"`
-	Branch         string `json:"branch"`
-	InstallationID int    `json:"installationID"`
-	TreenqID       string `json:"treenqID"`
-	Status         string `json:"status"`
+	ID                    int    `json:"id"`
+	FullName              string `json:"full_name"`
+	Private               bool   `json:"private"`
+	Branch                string `json:"branch"`
+	InstallationID        int    `json:"installationID"`
+	TreenqID              string `json:"treenqID"`
+	Status                string `json:"status"`
+	ClusterID             string `json:"clusterID"`
+	Protected             bool   `json:"protected"`
+	RestartOnSecretChange bool   `json:"restartOnSecretChange"`
 }
 
 func (c *Client) GithubWebhook(ctx context.Context, req GithubWebhookRequest) error {
@@ -188,6 +191,50 @@ func (c *Client) GithubWebhook(ctx context.Context, req GithubWebhookRequest) er
 	return nil
 }
 
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type RefreshTokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+func (c *Client) RefreshToken(ctx context.Context, req RefreshTokenRequest) (RefreshTokenResponse, error) {
+	var res RefreshTokenResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/refreshToken", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call refreshToken: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode refreshToken response: %w", err)
+	}
+
+	return res, nil
+}
+
 func (c *Client) Logout(ctx context.Context) error {
 	body := bytes.NewBuffer(nil)
 
@@ -212,6 +259,122 @@ func (c *Client) Logout(ctx context.Context) error {
 	return nil
 }
 
+type GetSessionsResponse struct {
+	Sessions []Session `json:"sessions"`
+}
+
+type Session struct {
+	ID               string    `json:"id"`
+	UserAgent        string    `json:"userAgent"`
+	IP               string    `json:"ip"`
+	CreatedAt        time.Time `json:"createdAt"`
+	RefreshedAt      time.Time `json:"refreshedAt,omitzero"`
+	ExpiresAt        time.Time `json:"expiresAt"`
+	Current          bool      `json:"current"`
+	UserID           string    `json:"-"`
+	CurrentWorkspace string    `json:"-"`
+	RefreshTokenHash string    `json:"-"`
+	User             UserInfo  `json:"-"`
+}
+
+type UserInfo struct {
+	ID               string   `json:"id"`
+	Email            string   `json:"email"`
+	DisplayName      string   `json:"displayName"`
+	CurrentWorkspace string   `json:"currentWorkspace"`
+	Workspaces       []string `json:"workspaces"`
+	Provider         string   `json:"-"`
+	Subject          string   `json:"-"`
+	Login            string   `json:"-"`
+}
+
+func (c *Client) GetSessions(ctx context.Context) (GetSessionsResponse, error) {
+	var res GetSessionsResponse
+
+	body := bytes.NewBuffer(nil)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/getSessions", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call getSessions: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode getSessions response: %w", err)
+	}
+
+	return res, nil
+}
+
+type RevokeSessionRequest struct {
+	SessionID string `json:"sessionID"`
+}
+
+func (c *Client) RevokeSession(ctx context.Context, req RevokeSessionRequest) error {
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/revokeSession", body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return fmt.Errorf("failed to call revokeSession: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *Client) RevokeAllSessions(ctx context.Context) error {
+	body := bytes.NewBuffer(nil)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/revokeAllSessions", body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return fmt.Errorf("failed to call revokeAllSessions: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 type InfoResponse struct {
 	Version string `json:"version"`
 }
@@ -247,22 +410,2145 @@ func (c *Client) Info(ctx context.Context) (InfoResponse, error) {
 	return res, nil
 }
 
-type GetProfileResponse struct {
-	UserInfo UserInfo `json:"userInfo"`
+type GetProfileResponse struct {
+	UserInfo UserInfo `json:"userInfo"`
+}
+
+func (c *Client) GetProfile(ctx context.Context) (GetProfileResponse, error) {
+	var res GetProfileResponse
+
+	body := bytes.NewBuffer(nil)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/getProfile", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call getProfile: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode getProfile response: %w", err)
+	}
+
+	return res, nil
+}
+
+type WorkspaceRequest struct {
+	Name string `json:"name"`
+}
+
+type WorkspaceResponse struct {
+	Workspace Workspace `json:"workspace"`
+	Token     string    `json:"token"`
+}
+
+type Workspace struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	GithubOrgName string `json:"githubOrgName,omitempty"`
+	Role          string `json:"role"`
+	Personal      bool   `json:"personal"`
+	Namespace     string `json:"-"`
+}
+
+func (c *Client) CreateWorkspace(ctx context.Context, req WorkspaceRequest) (WorkspaceResponse, error) {
+	var res WorkspaceResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/createWorkspace", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call createWorkspace: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode createWorkspace response: %w", err)
+	}
+
+	return res, nil
+}
+
+type GetWorkspacesResponse struct {
+	Workspaces []Workspace `json:"workspaces"`
+}
+
+func (c *Client) GetWorkspaces(ctx context.Context) (GetWorkspacesResponse, error) {
+	var res GetWorkspacesResponse
+
+	body := bytes.NewBuffer(nil)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/getWorkspaces", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call getWorkspaces: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode getWorkspaces response: %w", err)
+	}
+
+	return res, nil
+}
+
+type SwitchWorkspaceRequest struct {
+	WorkspaceID string `json:"workspaceID"`
+}
+
+func (c *Client) SwitchWorkspace(ctx context.Context, req SwitchWorkspaceRequest) (WorkspaceResponse, error) {
+	var res WorkspaceResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/switchWorkspace", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call switchWorkspace: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode switchWorkspace response: %w", err)
+	}
+
+	return res, nil
+}
+
+func (c *Client) RenameWorkspace(ctx context.Context, req WorkspaceRequest) error {
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/renameWorkspace", body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return fmt.Errorf("failed to call renameWorkspace: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *Client) RemoveWorkspace(ctx context.Context) (WorkspaceResponse, error) {
+	var res WorkspaceResponse
+
+	body := bytes.NewBuffer(nil)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/removeWorkspace", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call removeWorkspace: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode removeWorkspace response: %w", err)
+	}
+
+	return res, nil
+}
+
+type GetReposResponse struct {
+	Installation bool               `json:"installation"`
+	Repos        []GithubRepository `json:"repos"`
+}
+
+func (c *Client) GetRepos(ctx context.Context) (GetReposResponse, error) {
+	var res GetReposResponse
+
+	body := bytes.NewBuffer(nil)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/getRepos", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call getRepos: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode getRepos response: %w", err)
+	}
+
+	return res, nil
+}
+
+type GetBranchesRequest struct {
+	RepoName string `json:"repoName"`
+}
+
+type GetBranchesResopnse struct {
+	Branches []string `json:"branches"`
+}
+
+func (c *Client) GetBranches(ctx context.Context, req GetBranchesRequest) (GetBranchesResopnse, error) {
+	var res GetBranchesResopnse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/getBranches", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call getBranches: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode getBranches response: %w", err)
+	}
+
+	return res, nil
+}
+
+func (c *Client) SyncGithubApp(ctx context.Context) (GetReposResponse, error) {
+	var res GetReposResponse
+
+	body := bytes.NewBuffer(nil)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/syncGithubApp", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call syncGithubApp: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode syncGithubApp response: %w", err)
+	}
+
+	return res, nil
+}
+
+type ConnectBranchRequest struct {
+	RepoID string `json:"repoID"`
+	Branch string `json:"branch"`
+}
+
+type ConnectBranchResponse struct {
+	Repo GithubRepository `json:"repo"`
+}
+
+func (c *Client) ConnectRepoBranch(ctx context.Context, req ConnectBranchRequest) (ConnectBranchResponse, error) {
+	var res ConnectBranchResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/connectRepoBranch", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call connectRepoBranch: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode connectRepoBranch response: %w", err)
+	}
+
+	return res, nil
+}
+
+type SetRepoProtectionRequest struct {
+	RepoID    string `json:"repoID"`
+	Protected bool   `json:"protected"`
+}
+
+func (c *Client) SetRepoProtection(ctx context.Context, req SetRepoProtectionRequest) error {
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/setRepoProtection", body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return fmt.Errorf("failed to call setRepoProtection: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+type SetRepoSecretRestartRequest struct {
+	RepoID  string `json:"repoID"`
+	Restart bool   `json:"restart"`
+}
+
+func (c *Client) SetRepoSecretRestart(ctx context.Context, req SetRepoSecretRestartRequest) error {
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/setRepoSecretRestart", body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return fmt.Errorf("failed to call setRepoSecretRestart: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+type DeployRequest struct {
+	RepoID           string `json:"repoID"`
+	Environment      string `json:"environment"`
+	FromDeploymentID string `json:"fromDeploymentID"`
+	Branch           string `json:"branch"`
+	Sha              string `json:"sha"`
+	Tag              string `json:"tag"`
+	Image            string `json:"image"`
+}
+
+type GetDeploymentResponse struct {
+	Deployment AppDeployment `json:"deployment"`
+}
+
+type AppDeployment struct {
+	ID               string         `json:"id"`
+	FromDeploymentID string         `json:"fromDeploymentID"`
+	RepoID           string         `json:"repoID"`
+	Environment      string         `json:"environment"`
+	Space            Space          `json:"space"`
+	Sha              string         `json:"sha"`
+	Branch           string         `json:"branch"`
+	CommitMessage    string         `json:"commitMessage"`
+	BuildTag         string         `json:"buildTag"`
+	Image            string         `json:"image"`
+	ImageDigest      string         `json:"imageDigest"`
+	UserDisplayName  string         `json:"userDisplayName"`
+	UserID           string         `json:"userID,omitempty"`
+	CreatedAt        time.Time      `json:"createdAt"`
+	UpdatedAt        time.Time      `json:"updatedAt"`
+	Status           string         `json:"status"`
+	ApprovedBy       string         `json:"approvedBy,omitempty"`
+	ApprovedAt       time.Time      `json:"approvedAt,omitzero"`
+	SecretVersions   map[string]int `json:"secretVersions,omitempty"`
+}
+
+type Space struct {
+	Service Service
+}
+
+type Service struct {
+	Name                string              `json:"name"`
+	ReleaseOn           ReleaseOn           `json:"releaseOn"`
+	DockerfilePath      string              `json:"dockerfilePath"`
+	DockerContext       string              `json:"dockerContext"`
+	RuntimeEnvs         map[string]string   `json:"runtimeEnvs"`
+	RequiredSecrets     []string            `json:"requiredSecrets"`
+	HttpPort            int                 `json:"httpPort"`
+	Replicas            int                 `json:"replicas"`
+	ComputationResource ComputationResource `json:"computationResource"`
+}
+
+type ReleaseOn struct {
+	Branch    string
+	TagPrefix string
+}
+
+type ComputationResource struct {
+	CpuUnits   int `json:"cpuUnits"`
+	MemoryMibs int `json:"memoryMibs"`
+	DiskGibs   int `json:"diskGibs"`
+}
+
+func (c *Client) Deploy(ctx context.Context, req DeployRequest) (GetDeploymentResponse, error) {
+	var res GetDeploymentResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/deploy", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call deploy: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode deploy response: %w", err)
+	}
+
+	return res, nil
+}
+
+type PlanDeploymentRequest struct {
+	RepoID      string `json:"repoID"`
+	Environment string `json:"environment"`
+	Branch      string `json:"branch"`
+	Sha         string `json:"sha"`
+}
+
+type PlanDeploymentResponse struct {
+	Sha            string         `json:"sha"`
+	Space          Space          `json:"space"`
+	Plan           DeploymentPlan `json:"plan"`
+	MissingSecrets []string       `json:"missingSecrets"`
+}
+
+type DeploymentPlan struct {
+	Added   []ObjectDiff `json:"added"`
+	Changed []ObjectDiff `json:"changed"`
+	Removed []ObjectDiff `json:"removed"`
+}
+
+type ObjectDiff struct {
+	Kind      string      `json:"kind"`
+	Namespace string      `json:"namespace"`
+	Name      string      `json:"name"`
+	Fields    []FieldDiff `json:"fields"`
+}
+
+type FieldDiff struct {
+	Path    string      `json:"path"`
+	Change  string      `json:"change"`
+	Old     interface{} `json:"old,omitempty"`
+	New     interface{} `json:"new,omitempty"`
+	Pending bool        `json:"pending,omitempty"`
+}
+
+func (c *Client) PlanDeployment(ctx context.Context, req PlanDeploymentRequest) (PlanDeploymentResponse, error) {
+	var res PlanDeploymentResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/planDeployment", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call planDeployment: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode planDeployment response: %w", err)
+	}
+
+	return res, nil
+}
+
+type PromoteDeploymentRequest struct {
+	DeploymentID string `json:"deploymentID"`
+	Environment  string `json:"environment"`
+	Namespace    string `json:"namespace"`
+}
+
+func (c *Client) PromoteDeployment(ctx context.Context, req PromoteDeploymentRequest) (GetDeploymentResponse, error) {
+	var res GetDeploymentResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/promoteDeployment", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call promoteDeployment: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode promoteDeployment response: %w", err)
+	}
+
+	return res, nil
+}
+
+type ApproveDeploymentRequest struct {
+	DeploymentID string `json:"deploymentID"`
+}
+
+func (c *Client) ApproveDeployment(ctx context.Context, req ApproveDeploymentRequest) (GetDeploymentResponse, error) {
+	var res GetDeploymentResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/approveDeployment", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call approveDeployment: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode approveDeployment response: %w", err)
+	}
+
+	return res, nil
+}
+
+type GetDeploymentRequest struct {
+	DeploymentID string `json:"deploymentID"`
+}
+
+func (c *Client) GetDeployment(ctx context.Context, req GetDeploymentRequest) (GetDeploymentResponse, error) {
+	var res GetDeploymentResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/getDeployment", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call getDeployment: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode getDeployment response: %w", err)
+	}
+
+	return res, nil
+}
+
+type GetBuildProgressRequest struct {
+	DeploymentID string
+}
+
+type GetBuildProgressResponse struct {
+	Message ProgressMessage `json:"message"`
+}
+
+type ProgressMessage struct {
+	ID         int64         `json:"id,omitempty"`
+	Payload    string        `json:"payload"`
+	Level      slog.Level    `json:"level"`
+	Final      bool          `json:"final"`
+	Timestamp  time.Time     `json:"timestamp"`
+	Deployment AppDeployment `json:"deployment,omitzero"`
+	ErrorCode  string        `json:"errorCode,omitempty"`
+	Pod        string        `json:"pod,omitempty"`
+}
+
+func (c *Client) GetBuildProgress(ctx context.Context, req GetBuildProgressRequest) (GetBuildProgressResponse, error) {
+	var res GetBuildProgressResponse
+
+	q := make(url.Values)
+	q.Set("deploymentID", req.DeploymentID)
+
+	r, err := http.NewRequest("GET", c.baseUrl+"/getBuildProgress?"+q.Encode(), nil)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call getBuildProgress: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode getBuildProgress response: %w", err)
+	}
+
+	return res, nil
+}
+
+type GetLogsRequest struct {
+	RepoID      string
+	Environment string
+}
+
+type GetLogsResponse struct {
+	Message ProgressMessage `json:"message"`
+}
+
+func (c *Client) GetLogs(ctx context.Context, req GetLogsRequest) (GetLogsResponse, error) {
+	var res GetLogsResponse
+
+	q := make(url.Values)
+	q.Set("repoID", req.RepoID)
+	q.Set("environment", req.Environment)
+
+	r, err := http.NewRequest("GET", c.baseUrl+"/getLogs?"+q.Encode(), nil)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call getLogs: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode getLogs response: %w", err)
+	}
+
+	return res, nil
+}
+
+type SearchBuildLogsRequest struct {
+	Query        string    `json:"query"`
+	RepoID       string    `json:"repoID"`
+	DeploymentID string    `json:"deploymentID"`
+	Since        time.Time `json:"since,omitzero"`
+	Until        time.Time `json:"until,omitzero"`
+	Cursor       string    `json:"cursor"`
+	Limit        int       `json:"limit"`
+}
+
+type SearchBuildLogsResponse struct {
+	Logs       []BuildLog `json:"logs"`
+	NextCursor string     `json:"nextCursor"`
+}
+
+type BuildLog struct {
+	ID           int64         `json:"id"`
+	DeploymentID string        `json:"deploymentID"`
+	RepoID       string        `json:"repoID,omitempty"`
+	Environment  string        `json:"environment,omitempty"`
+	Payload      string        `json:"payload"`
+	Level        slog.Level    `json:"level"`
+	Final        bool          `json:"final,omitempty"`
+	ErrorCode    string        `json:"errorCode,omitempty"`
+	CreatedAt    time.Time     `json:"createdAt"`
+	Deployment   AppDeployment `json:"-"`
+}
+
+func (c *Client) SearchBuildLogs(ctx context.Context, req SearchBuildLogsRequest) (SearchBuildLogsResponse, error) {
+	var res SearchBuildLogsResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/searchBuildLogs", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call searchBuildLogs: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode searchBuildLogs response: %w", err)
+	}
+
+	return res, nil
+}
+
+type DownloadBuildLogsRequest struct {
+	DeploymentID string
+}
+
+func (c *Client) DownloadBuildLogs(ctx context.Context, req DownloadBuildLogsRequest) error {
+	q := make(url.Values)
+	q.Set("deploymentID", req.DeploymentID)
+
+	r, err := http.NewRequest("GET", c.baseUrl+"/downloadBuildLogs?"+q.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return fmt.Errorf("failed to call downloadBuildLogs: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+type GetDeploymentsRequest struct {
+	RepoID string `json:"repoID"`
+}
+
+type GetDeploymentsResponse struct {
+	Deployments []AppDeployment `json:"deployments"`
+}
+
+func (c *Client) GetDeployments(ctx context.Context, req GetDeploymentsRequest) (GetDeploymentsResponse, error) {
+	var res GetDeploymentsResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/getDeployments", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call getDeployments: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode getDeployments response: %w", err)
+	}
+
+	return res, nil
+}
+
+type SetSecretRequest struct {
+	RepoID      string `json:"repoID"`
+	Environment string `json:"environment"`
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+}
+
+type SecretChangeResponse struct {
+	Deployment AppDeployment `json:"deployment,omitzero"`
+}
+
+func (c *Client) SetSecret(ctx context.Context, req SetSecretRequest) (SecretChangeResponse, error) {
+	var res SecretChangeResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/setSecret", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call setSecret: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode setSecret response: %w", err)
+	}
+
+	return res, nil
+}
+
+type GetSecretsRequest struct {
+	RepoID      string `json:"repoID"`
+	Environment string `json:"environment"`
+}
+
+type GetSecretsResponse struct {
+	Keys []string `json:"keys"`
+}
+
+func (c *Client) GetSecrets(ctx context.Context, req GetSecretsRequest) (GetSecretsResponse, error) {
+	var res GetSecretsResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/getSecrets", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call getSecrets: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode getSecrets response: %w", err)
+	}
+
+	return res, nil
+}
+
+type RevealSecretRequest struct {
+	RepoID      string `json:"repoID"`
+	Environment string `json:"environment"`
+	Key         string `json:"key"`
+}
+
+type RevealSecretResponse struct {
+	Value string `json:"value"`
+}
+
+func (c *Client) RevealSecret(ctx context.Context, req RevealSecretRequest) (RevealSecretResponse, error) {
+	var res RevealSecretResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/revealSecret", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call revealSecret: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode revealSecret response: %w", err)
+	}
+
+	return res, nil
+}
+
+type RemoveSecretRequest struct {
+	RepoID      string `json:"repoID"`
+	Environment string `json:"environment"`
+	Key         string `json:"key"`
+}
+
+func (c *Client) RemoveSecret(ctx context.Context, req RemoveSecretRequest) (SecretChangeResponse, error) {
+	var res SecretChangeResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/removeSecret", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call removeSecret: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode removeSecret response: %w", err)
+	}
+
+	return res, nil
+}
+
+type GetSecretVersionsRequest struct {
+	RepoID      string `json:"repoID"`
+	Environment string `json:"environment"`
+	Key         string `json:"key"`
+}
+
+type GetSecretVersionsResponse struct {
+	Versions []SecretVersion `json:"versions"`
+}
+
+type SecretVersion struct {
+	ID          string    `json:"id"`
+	RepoID      string    `json:"repoID"`
+	Environment string    `json:"environment"`
+	Key         string    `json:"key"`
+	Version     int       `json:"version"`
+	Value       []uint8   `json:"-"`
+	FromVersion int       `json:"fromVersion,omitempty"`
+	AuthorID    string    `json:"authorID"`
+	AuthorName  string    `json:"authorName"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+func (c *Client) GetSecretVersions(ctx context.Context, req GetSecretVersionsRequest) (GetSecretVersionsResponse, error) {
+	var res GetSecretVersionsResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/getSecretVersions", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call getSecretVersions: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode getSecretVersions response: %w", err)
+	}
+
+	return res, nil
+}
+
+type RollbackSecretRequest struct {
+	RepoID      string `json:"repoID"`
+	Environment string `json:"environment"`
+	Key         string `json:"key"`
+	Version     int    `json:"version"`
+}
+
+type RollbackSecretResponse struct {
+	Version    SecretVersion `json:"version"`
+	Deployment AppDeployment `json:"deployment,omitzero"`
+}
+
+func (c *Client) RollbackSecret(ctx context.Context, req RollbackSecretRequest) (RollbackSecretResponse, error) {
+	var res RollbackSecretResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/rollbackSecret", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call rollbackSecret: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode rollbackSecret response: %w", err)
+	}
+
+	return res, nil
+}
+
+type ImportSecretsRequest struct {
+	RepoID      string `json:"repoID"`
+	Environment string `json:"environment"`
+	Format      string `json:"format"`
+	Content     string `json:"content"`
+	DryRun      bool   `json:"dryRun"`
+}
+
+type ImportSecretsResponse struct {
+	Added      []string      `json:"added"`
+	Changed    []string      `json:"changed"`
+	Unchanged  []string      `json:"unchanged"`
+	Deployment AppDeployment `json:"deployment,omitzero"`
+}
+
+func (c *Client) ImportSecrets(ctx context.Context, req ImportSecretsRequest) (ImportSecretsResponse, error) {
+	var res ImportSecretsResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/importSecrets", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call importSecrets: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode importSecrets response: %w", err)
+	}
+
+	return res, nil
+}
+
+type ExportSecretsRequest struct {
+	RepoID      string `json:"repoID"`
+	Environment string `json:"environment"`
+	Format      string `json:"format"`
+}
+
+type ExportSecretsResponse struct {
+	Content string `json:"content"`
+}
+
+func (c *Client) ExportSecrets(ctx context.Context, req ExportSecretsRequest) (ExportSecretsResponse, error) {
+	var res ExportSecretsResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/exportSecrets", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call exportSecrets: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode exportSecrets response: %w", err)
+	}
+
+	return res, nil
+}
+
+type CreateSecretGroupRequest struct {
+	Name string `json:"name"`
+}
+
+type SecretGroupResponse struct {
+	Group SecretGroup `json:"group"`
+}
+
+type SecretGroup struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Keys      []string  `json:"keys"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (c *Client) CreateSecretGroup(ctx context.Context, req CreateSecretGroupRequest) (SecretGroupResponse, error) {
+	var res SecretGroupResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/createSecretGroup", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call createSecretGroup: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode createSecretGroup response: %w", err)
+	}
+
+	return res, nil
+}
+
+type GetSecretGroupsResponse struct {
+	Groups []SecretGroup `json:"groups"`
+}
+
+func (c *Client) GetSecretGroups(ctx context.Context) (GetSecretGroupsResponse, error) {
+	var res GetSecretGroupsResponse
+
+	body := bytes.NewBuffer(nil)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/getSecretGroups", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call getSecretGroups: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode getSecretGroups response: %w", err)
+	}
+
+	return res, nil
+}
+
+type RemoveSecretGroupRequest struct {
+	ID string `json:"id"`
+}
+
+func (c *Client) RemoveSecretGroup(ctx context.Context, req RemoveSecretGroupRequest) error {
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/removeSecretGroup", body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return fmt.Errorf("failed to call removeSecretGroup: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+type SetGroupSecretRequest struct {
+	GroupID string `json:"groupID"`
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+}
+
+func (c *Client) SetGroupSecret(ctx context.Context, req SetGroupSecretRequest) error {
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/setGroupSecret", body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return fmt.Errorf("failed to call setGroupSecret: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+type RemoveGroupSecretRequest struct {
+	GroupID string `json:"groupID"`
+	Key     string `json:"key"`
+}
+
+func (c *Client) RemoveGroupSecret(ctx context.Context, req RemoveGroupSecretRequest) error {
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/removeGroupSecret", body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return fmt.Errorf("failed to call removeGroupSecret: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+type SecretGroupAttachmentRequest struct {
+	RepoID      string `json:"repoID"`
+	Environment string `json:"environment"`
+	GroupID     string `json:"groupID"`
+}
+
+func (c *Client) AttachSecretGroup(ctx context.Context, req SecretGroupAttachmentRequest) error {
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/attachSecretGroup", body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return fmt.Errorf("failed to call attachSecretGroup: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *Client) DetachSecretGroup(ctx context.Context, req SecretGroupAttachmentRequest) error {
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/detachSecretGroup", body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return fmt.Errorf("failed to call detachSecretGroup: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+type GetAppEnvRequest struct {
+	RepoID      string `json:"repoID"`
+	Environment string `json:"environment"`
+}
+
+type GetAppEnvResponse struct {
+	Groups []SecretGroup `json:"groups"`
+	Envs   []EnvSource   `json:"envs"`
+}
+
+type EnvSource struct {
+	Name       string `json:"name"`
+	Source     string `json:"source"`
+	Key        string `json:"key,omitempty"`
+	GroupID    string `json:"groupID,omitempty"`
+	Group      string `json:"group,omitempty"`
+	Value      string `json:"value,omitempty"`
+	Overridden bool   `json:"overridden"`
+}
+
+func (c *Client) GetAppEnv(ctx context.Context, req GetAppEnvRequest) (GetAppEnvResponse, error) {
+	var res GetAppEnvResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/getAppEnv", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call getAppEnv: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode getAppEnv response: %w", err)
+	}
+
+	return res, nil
+}
+
+type GetWorkloadStatsRequest struct {
+	RepoID      string `json:"repoID"`
+	Environment string `json:"environment"`
+}
+
+type GetWorkloadStatsResponse struct {
+	WorkloadStats WorkloadStats `json:"workloadStats"`
+}
+
+type WorkloadStats struct {
+	Name          string        `json:"name"`
+	Replicas      Replicas      `json:"replicas"`
+	Versions      []VersionInfo `json:"versions"`
+	OverallStatus string        `json:"overallStatus"`
+}
+
+type Replicas struct {
+	Desired int `json:"desired"`
+	Running int `json:"running"`
+	Pending int `json:"pending"`
+	Failed  int `json:"failed"`
+}
+
+type VersionInfo struct {
+	Version  string      `json:"version"`
+	Replicas ReplicaInfo `json:"replicas"`
+}
+
+type ReplicaInfo struct {
+	Running int `json:"running"`
+	Pending int `json:"pending"`
+	Failed  int `json:"failed"`
+}
+
+func (c *Client) GetWorkloadStats(ctx context.Context, req GetWorkloadStatsRequest) (GetWorkloadStatsResponse, error) {
+	var res GetWorkloadStatsResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/getWorkloadStats", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call getWorkloadStats: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode getWorkloadStats response: %w", err)
+	}
+
+	return res, nil
+}
+
+type CreateEnvironmentRequest struct {
+	RepoID           string         `json:"repoID"`
+	Name             string         `json:"name"`
+	Branch           string         `json:"branch"`
+	TagPrefix        string         `json:"tagPrefix"`
+	Overrides        SpaceOverrides `json:"overrides"`
+	RequiredApprover string         `json:"requiredApprover"`
+	Protected        bool           `json:"protected"`
+}
+
+type EnvironmentResponse struct {
+	Environment Environment `json:"environment"`
+}
+
+type SpaceOverrides struct {
+	Replicas            int                 `json:"replicas"`
+	RuntimeEnvs         map[string]string   `json:"runtimeEnvs"`
+	ComputationResource ComputationResource `json:"computationResource"`
+}
+
+type Environment struct {
+	ID               string         `json:"id"`
+	RepoID           string         `json:"repoID"`
+	Name             string         `json:"name"`
+	Branch           string         `json:"branch"`
+	TagPrefix        string         `json:"tagPrefix"`
+	Overrides        SpaceOverrides `json:"overrides"`
+	RequiredApprover string         `json:"requiredApprover"`
+	Protected        bool           `json:"protected"`
+	Namespace        string         `json:"namespace"`
+	URL              string         `json:"url"`
+	CreatedAt        time.Time      `json:"createdAt"`
+	WorkspaceID      string         `json:"-"`
+}
+
+func (c *Client) CreateEnvironment(ctx context.Context, req CreateEnvironmentRequest) (EnvironmentResponse, error) {
+	var res EnvironmentResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/createEnvironment", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call createEnvironment: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode createEnvironment response: %w", err)
+	}
+
+	return res, nil
+}
+
+type GetEnvironmentsRequest struct {
+	RepoID string `json:"repoID"`
+}
+
+type GetEnvironmentsResponse struct {
+	Environments []Environment `json:"environments"`
+}
+
+func (c *Client) GetEnvironments(ctx context.Context, req GetEnvironmentsRequest) (GetEnvironmentsResponse, error) {
+	var res GetEnvironmentsResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/getEnvironments", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call getEnvironments: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode getEnvironments response: %w", err)
+	}
+
+	return res, nil
+}
+
+type UpdateEnvironmentRequest struct {
+	RepoID           string         `json:"repoID"`
+	Name             string         `json:"name"`
+	Branch           string         `json:"branch"`
+	TagPrefix        string         `json:"tagPrefix"`
+	Overrides        SpaceOverrides `json:"overrides"`
+	RequiredApprover string         `json:"requiredApprover"`
+	Protected        bool           `json:"protected"`
+}
+
+func (c *Client) UpdateEnvironment(ctx context.Context, req UpdateEnvironmentRequest) (EnvironmentResponse, error) {
+	var res EnvironmentResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/updateEnvironment", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call updateEnvironment: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode updateEnvironment response: %w", err)
+	}
+
+	return res, nil
+}
+
+type RemoveEnvironmentRequest struct {
+	RepoID string `json:"repoID"`
+	Name   string `json:"name"`
+}
+
+func (c *Client) RemoveEnvironment(ctx context.Context, req RemoveEnvironmentRequest) error {
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/removeEnvironment", body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return fmt.Errorf("failed to call removeEnvironment: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+type AddClusterRequest struct {
+	Name       string `json:"name"`
+	KubeConfig string `json:"kubeConfig"`
+}
+
+type AddClusterResponse struct {
+	Cluster Cluster `json:"cluster"`
+}
+
+type Cluster struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	CreatedAt  time.Time `json:"createdAt"`
+	KubeConfig []uint8   `json:"-"`
+}
+
+func (c *Client) AddCluster(ctx context.Context, req AddClusterRequest) (AddClusterResponse, error) {
+	var res AddClusterResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/addCluster", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call addCluster: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode addCluster response: %w", err)
+	}
+
+	return res, nil
+}
+
+type GetClustersResponse struct {
+	Clusters []Cluster `json:"clusters"`
+}
+
+func (c *Client) GetClusters(ctx context.Context) (GetClustersResponse, error) {
+	var res GetClustersResponse
+
+	body := bytes.NewBuffer(nil)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/getClusters", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call getClusters: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode getClusters response: %w", err)
+	}
+
+	return res, nil
+}
+
+type RemoveClusterRequest struct {
+	ClusterID string `json:"clusterID"`
+}
+
+func (c *Client) RemoveCluster(ctx context.Context, req RemoveClusterRequest) error {
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/removeCluster", body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return fmt.Errorf("failed to call removeCluster: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+type SetRepoClusterRequest struct {
+	RepoID    string `json:"repoID"`
+	ClusterID string `json:"clusterID"`
+}
+
+func (c *Client) SetRepoCluster(ctx context.Context, req SetRepoClusterRequest) error {
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/setRepoCluster", body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return fmt.Errorf("failed to call setRepoCluster: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+type CheckClusterRequest struct {
+	ClusterID string `json:"clusterID"`
+}
+
+type CheckClusterResponse struct {
+	Reachable bool   `json:"reachable"`
+	Version   string `json:"version"`
+	Error     string `json:"error"`
+}
+
+func (c *Client) CheckCluster(ctx context.Context, req CheckClusterRequest) (CheckClusterResponse, error) {
+	var res CheckClusterResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/checkCluster", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call checkCluster: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode checkCluster response: %w", err)
+	}
+
+	return res, nil
+}
+
+type SetRegistryCredentialsRequest struct {
+	Registry string `json:"registry"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func (c *Client) SetRegistryCredentials(ctx context.Context, req SetRegistryCredentialsRequest) error {
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/setRegistryCredentials", body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return fmt.Errorf("failed to call setRegistryCredentials: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+type GetRegistryCredentialsResponse struct {
+	Credentials []RegistryCredentials `json:"credentials"`
 }
 
-type UserInfo struct {
-	ID          string `json:"id"`
-	Email       string `json:"email"`
-	DisplayName string `json:"displayName"`
+type RegistryCredentials struct {
+	Registry string `json:"registry"`
+	Username string `json:"username"`
+	Password string `json:"password,omitempty"`
 }
 
-func (c *Client) GetProfile(ctx context.Context) (GetProfileResponse, error) {
-	var res GetProfileResponse
+func (c *Client) GetRegistryCredentials(ctx context.Context) (GetRegistryCredentialsResponse, error) {
+	var res GetRegistryCredentialsResponse
 
 	body := bytes.NewBuffer(nil)
 
-	r, err := http.NewRequest("POST", c.baseUrl+"/getProfile", body)
+	r, err := http.NewRequest("POST", c.baseUrl+"/getRegistryCredentials", body)
 	if err != nil {
 		return res, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -271,7 +2557,7 @@ func (c *Client) GetProfile(ctx context.Context) (GetProfileResponse, error) {
 
 	resp, err := c.client.Do(r)
 	if err != nil {
-		return res, fmt.Errorf("failed to call getProfile: %w", err)
+		return res, fmt.Errorf("failed to call getRegistryCredentials: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -282,58 +2568,69 @@ func (c *Client) GetProfile(ctx context.Context) (GetProfileResponse, error) {
 
 	err = json.NewDecoder(resp.Body).Decode(&res)
 	if err != nil {
-		return res, fmt.Errorf("failed to decode getProfile response: %w", err)
+		return res, fmt.Errorf("failed to decode getRegistryCredentials response: %w", err)
 	}
 
 	return res, nil
 }
 
-type GetReposResponse struct {
-	Installation bool               `json:"installation"`
-	Repos        []GithubRepository `json:"repos"`
+type RemoveRegistryCredentialsRequest struct {
+	Registry string `json:"registry"`
 }
 
-func (c *Client) GetRepos(ctx context.Context) (GetReposResponse, error) {
-	var res GetReposResponse
-
-	body := bytes.NewBuffer(nil)
+func (c *Client) RemoveRegistryCredentials(ctx context.Context, req RemoveRegistryCredentialsRequest) error {
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
 
-	r, err := http.NewRequest("POST", c.baseUrl+"/getRepos", body)
+	r, err := http.NewRequest("POST", c.baseUrl+"/removeRegistryCredentials", body)
 	if err != nil {
-		return res, fmt.Errorf("failed to create request: %w", err)
+		return fmt.Errorf("failed to create request: %w", err)
 	}
 	r = r.WithContext(ctx)
 	r.Header = c.headers
 
 	resp, err := c.client.Do(r)
 	if err != nil {
-		return res, fmt.Errorf("failed to call getRepos: %w", err)
+		return fmt.Errorf("failed to call removeRegistryCredentials: %w", err)
 	}
 	defer resp.Body.Close()
 
 	err = HandleErr(resp)
 	if err != nil {
-		return res, err
+		return err
 	}
 
-	err = json.NewDecoder(resp.Body).Decode(&res)
-	if err != nil {
-		return res, fmt.Errorf("failed to decode getRepos response: %w", err)
-	}
+	return nil
+}
 
-	return res, nil
+type SetSecretStoreRequest struct {
+	Kind            string `json:"kind"`
+	VaultAddress    string `json:"vaultAddress"`
+	VaultMount      string `json:"vaultMount"`
+	VaultPathPrefix string `json:"vaultPathPrefix"`
+	VaultRole       string `json:"vaultRole"`
+	VaultToken      string `json:"vaultToken"`
 }
 
-type GetBranchesRequest struct {
-	RepoName string `json:"repoName"`
+type GetSecretStoreResponse struct {
+	Store WorkspaceSecretStore `json:"store"`
 }
 
-type GetBranchesResopnse struct {
-	Branches []string `json:"branches"`
+type WorkspaceSecretStore struct {
+	Kind            string    `json:"kind"`
+	VaultAddress    string    `json:"vaultAddress,omitempty"`
+	VaultMount      string    `json:"vaultMount,omitempty"`
+	VaultPathPrefix string    `json:"vaultPathPrefix,omitempty"`
+	VaultRole       string    `json:"vaultRole,omitempty"`
+	VaultToken      []uint8   `json:"-"`
+	UpdatedAt       time.Time `json:"updatedAt,omitzero"`
 }
 
-func (c *Client) GetBranches(ctx context.Context, req GetBranchesRequest) (GetBranchesResopnse, error) {
-	var res GetBranchesResopnse
+func (c *Client) SetSecretStore(ctx context.Context, req SetSecretStoreRequest) (GetSecretStoreResponse, error) {
+	var res GetSecretStoreResponse
 
 	bodyBytes, err := json.Marshal(req)
 	if err != nil {
@@ -341,7 +2638,7 @@ func (c *Client) GetBranches(ctx context.Context, req GetBranchesRequest) (GetBr
 	}
 	body := bytes.NewBuffer(bodyBytes)
 
-	r, err := http.NewRequest("POST", c.baseUrl+"/getBranches", body)
+	r, err := http.NewRequest("POST", c.baseUrl+"/setSecretStore", body)
 	if err != nil {
 		return res, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -350,7 +2647,7 @@ func (c *Client) GetBranches(ctx context.Context, req GetBranchesRequest) (GetBr
 
 	resp, err := c.client.Do(r)
 	if err != nil {
-		return res, fmt.Errorf("failed to call getBranches: %w", err)
+		return res, fmt.Errorf("failed to call setSecretStore: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -361,18 +2658,18 @@ func (c *Client) GetBranches(ctx context.Context, req GetBranchesRequest) (GetBr
 
 	err = json.NewDecoder(resp.Body).Decode(&res)
 	if err != nil {
-		return res, fmt.Errorf("failed to decode getBranches response: %w", err)
+		return res, fmt.Errorf("failed to decode setSecretStore response: %w", err)
 	}
 
 	return res, nil
 }
 
-func (c *Client) SyncGithubApp(ctx context.Context) (GetReposResponse, error) {
-	var res GetReposResponse
+func (c *Client) GetSecretStore(ctx context.Context) (GetSecretStoreResponse, error) {
+	var res GetSecretStoreResponse
 
 	body := bytes.NewBuffer(nil)
 
-	r, err := http.NewRequest("POST", c.baseUrl+"/syncGithubApp", body)
+	r, err := http.NewRequest("POST", c.baseUrl+"/getSecretStore", body)
 	if err != nil {
 		return res, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -381,7 +2678,7 @@ func (c *Client) SyncGithubApp(ctx context.Context) (GetReposResponse, error) {
 
 	resp, err := c.client.Do(r)
 	if err != nil {
-		return res, fmt.Errorf("failed to call syncGithubApp: %w", err)
+		return res, fmt.Errorf("failed to call getSecretStore: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -392,23 +2689,37 @@ func (c *Client) SyncGithubApp(ctx context.Context) (GetReposResponse, error) {
 
 	err = json.NewDecoder(resp.Body).Decode(&res)
 	if err != nil {
-		return res, fmt.Errorf("failed to decode syncGithubApp response: %w", err)
+		return res, fmt.Errorf("failed to decode getSecretStore response: %w", err)
 	}
 
 	return res, nil
 }
 
-type ConnectBranchRequest struct {
-	RepoID string `json:"repoID"`
-	Branch string `json:"branch"`
+type InviteMemberRequest struct {
+	Email       string `json:"email"`
+	GithubLogin string `json:"githubLogin"`
+	Role        string `json:"role"`
 }
 
-type ConnectBranchResponse struct {
-	Repo GithubRepository `json:"repo"`
+type InviteMemberResponse struct {
+	Invitation Invitation `json:"invitation"`
+	Token      string     `json:"token"`
 }
 
-func (c *Client) ConnectRepoBranch(ctx context.Context, req ConnectBranchRequest) (ConnectBranchResponse, error) {
-	var res ConnectBranchResponse
+type Invitation struct {
+	ID          string    `json:"id"`
+	Email       string    `json:"email"`
+	GithubLogin string    `json:"githubLogin"`
+	Role        string    `json:"role"`
+	InvitedBy   string    `json:"invitedBy"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+	CreatedAt   time.Time `json:"createdAt"`
+	WorkspaceID string    `json:"-"`
+	AcceptedAt  time.Time `json:"-"`
+}
+
+func (c *Client) InviteMember(ctx context.Context, req InviteMemberRequest) (InviteMemberResponse, error) {
+	var res InviteMemberResponse
 
 	bodyBytes, err := json.Marshal(req)
 	if err != nil {
@@ -416,7 +2727,7 @@ func (c *Client) ConnectRepoBranch(ctx context.Context, req ConnectBranchRequest
 	}
 	body := bytes.NewBuffer(bodyBytes)
 
-	r, err := http.NewRequest("POST", c.baseUrl+"/connectRepoBranch", body)
+	r, err := http.NewRequest("POST", c.baseUrl+"/inviteMember", body)
 	if err != nil {
 		return res, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -425,7 +2736,7 @@ func (c *Client) ConnectRepoBranch(ctx context.Context, req ConnectBranchRequest
 
 	resp, err := c.client.Do(r)
 	if err != nil {
-		return res, fmt.Errorf("failed to call connectRepoBranch: %w", err)
+		return res, fmt.Errorf("failed to call inviteMember: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -436,67 +2747,23 @@ func (c *Client) ConnectRepoBranch(ctx context.Context, req ConnectBranchRequest
 
 	err = json.NewDecoder(resp.Body).Decode(&res)
 	if err != nil {
-		return res, fmt.Errorf("failed to decode connectRepoBranch response: %w", err)
+		return res, fmt.Errorf("failed to decode inviteMember response: %w", err)
 	}
 
 	return res, nil
 }
 
-type DeployRequest struct {
-	RepoID           string `json:"repoID"`
-	FromDeploymentID string `json:"fromDeploymentID"`
-	Branch           string `json:"branch"`
-	Sha              string `json:"sha"`
-	Tag              string `json:"tag"`
-}
-
-type GetDeploymentResponse struct {
-	Deployment AppDeployment `json:"deployment"`
-}
-
-type AppDeployment struct {
-	ID               string    `json:"id"`
-	FromDeploymentID string    `json:"fromDeploymentID"`
-	RepoID           string    `json:"repoID"`
-	Space            Space     `json:"space"`
-	Sha              string    `json:"sha"`
-	Branch           string    `json:"branch"`
-	CommitMessage    string    `json:"commitMessage"`
-	BuildTag         string    `json:"buildTag"`
-	UserDisplayName  string    `json:"userDisplayName"`
-	CreatedAt        time.Time `json:"createdAt"`
-	UpdatedAt        time.Time `json:"updatedAt"`
-	Status           string    `json:"status"`
-}
-
-type Space struct {
-	Service Service
-}
-
-type Service struct {
-	Name                string              `json:"name"`
-	ReleaseOn           ReleaseOn           `json:"releaseOn"`
-	DockerfilePath      string              `json:"dockerfilePath"`
-	DockerContext       string              `json:"dockerContext"`
-	RuntimeEnvs         map[string]string   `json:"runtimeEnvs"`
-	HttpPort            int                 `json:"httpPort"`
-	Replicas            int                 `json:"replicas"`
-	ComputationResource ComputationResource `json:"computationResource"`
-}
-
-type ReleaseOn struct {
-	Branch    string
-	TagPrefix string
+type AcceptInvitationRequest struct {
+	Token string `json:"token"`
 }
 
-type ComputationResource struct {
-	CpuUnits   int `json:"cpuUnits"`
-	MemoryMibs int `json:"memoryMibs"`
-	DiskGibs   int `json:"diskGibs"`
+type AcceptInvitationResponse struct {
+	Workspace Workspace `json:"workspace"`
+	Token     string    `json:"token"`
 }
 
-func (c *Client) Deploy(ctx context.Context, req DeployRequest) (GetDeploymentResponse, error) {
-	var res GetDeploymentResponse
+func (c *Client) AcceptInvitation(ctx context.Context, req AcceptInvitationRequest) (AcceptInvitationResponse, error) {
+	var res AcceptInvitationResponse
 
 	bodyBytes, err := json.Marshal(req)
 	if err != nil {
@@ -504,7 +2771,7 @@ func (c *Client) Deploy(ctx context.Context, req DeployRequest) (GetDeploymentRe
 	}
 	body := bytes.NewBuffer(bodyBytes)
 
-	r, err := http.NewRequest("POST", c.baseUrl+"/deploy", body)
+	r, err := http.NewRequest("POST", c.baseUrl+"/acceptInvitation", body)
 	if err != nil {
 		return res, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -513,7 +2780,7 @@ func (c *Client) Deploy(ctx context.Context, req DeployRequest) (GetDeploymentRe
 
 	resp, err := c.client.Do(r)
 	if err != nil {
-		return res, fmt.Errorf("failed to call deploy: %w", err)
+		return res, fmt.Errorf("failed to call acceptInvitation: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -524,26 +2791,31 @@ func (c *Client) Deploy(ctx context.Context, req DeployRequest) (GetDeploymentRe
 
 	err = json.NewDecoder(resp.Body).Decode(&res)
 	if err != nil {
-		return res, fmt.Errorf("failed to decode deploy response: %w", err)
+		return res, fmt.Errorf("failed to decode acceptInvitation response: %w", err)
 	}
 
 	return res, nil
 }
 
-type GetDeploymentRequest struct {
-	DeploymentID string `json:"deploymentID"`
+type GetMembersResponse struct {
+	Members     []Member     `json:"members"`
+	Invitations []Invitation `json:"invitations"`
 }
 
-func (c *Client) GetDeployment(ctx context.Context, req GetDeploymentRequest) (GetDeploymentResponse, error) {
-	var res GetDeploymentResponse
+type Member struct {
+	UserID      string    `json:"userID"`
+	Email       string    `json:"email"`
+	DisplayName string    `json:"displayName"`
+	Role        string    `json:"role"`
+	JoinedAt    time.Time `json:"joinedAt"`
+}
 
-	bodyBytes, err := json.Marshal(req)
-	if err != nil {
-		return res, fmt.Errorf("failed to marshal request: %w", err)
-	}
-	body := bytes.NewBuffer(bodyBytes)
+func (c *Client) GetMembers(ctx context.Context) (GetMembersResponse, error) {
+	var res GetMembersResponse
 
-	r, err := http.NewRequest("POST", c.baseUrl+"/getDeployment", body)
+	body := bytes.NewBuffer(nil)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/getMembers", body)
 	if err != nil {
 		return res, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -552,7 +2824,7 @@ func (c *Client) GetDeployment(ctx context.Context, req GetDeploymentRequest) (G
 
 	resp, err := c.client.Do(r)
 	if err != nil {
-		return res, fmt.Errorf("failed to call getDeployment: %w", err)
+		return res, fmt.Errorf("failed to call getMembers: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -563,111 +2835,103 @@ func (c *Client) GetDeployment(ctx context.Context, req GetDeploymentRequest) (G
 
 	err = json.NewDecoder(resp.Body).Decode(&res)
 	if err != nil {
-		return res, fmt.Errorf("failed to decode getDeployment response: %w", err)
+		return res, fmt.Errorf("failed to decode getMembers response: %w", err)
 	}
 
 	return res, nil
 }
 
-type GetBuildProgressRequest struct {
-	DeploymentID string
-}
-
-type GetBuildProgressResponse struct {
-	Message ProgressMessage `json:"message"`
-}
-
-type ProgressMessage struct {
-	Payload    string        `json:"payload"`
-	Level      slog.Level    `json:"level"`
-	Final      bool          `json:"final"`
-	Timestamp  time.Time     `json:"timestamp"`
-	Deployment AppDeployment `json:"deployment,omitzero"`
-	ErrorCode  string        `json:"errorCode,omitempty"`
+type UpdateMemberRoleRequest struct {
+	UserID string `json:"userID"`
+	Role   string `json:"role"`
 }
 
-func (c *Client) GetBuildProgress(ctx context.Context, req GetBuildProgressRequest) (GetBuildProgressResponse, error) {
-	var res GetBuildProgressResponse
-
-	q := make(url.Values)
-	q.Set("deploymentID", req.DeploymentID)
+func (c *Client) UpdateMemberRole(ctx context.Context, req UpdateMemberRoleRequest) error {
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
 
-	r, err := http.NewRequest("GET", c.baseUrl+"/getBuildProgress?"+q.Encode(), nil)
+	r, err := http.NewRequest("POST", c.baseUrl+"/updateMemberRole", body)
 	if err != nil {
-		return res, fmt.Errorf("failed to create request: %w", err)
+		return fmt.Errorf("failed to create request: %w", err)
 	}
 	r = r.WithContext(ctx)
 	r.Header = c.headers
 
 	resp, err := c.client.Do(r)
 	if err != nil {
-		return res, fmt.Errorf("failed to call getBuildProgress: %w", err)
+		return fmt.Errorf("failed to call updateMemberRole: %w", err)
 	}
 	defer resp.Body.Close()
 
 	err = HandleErr(resp)
 	if err != nil {
-		return res, err
-	}
-
-	err = json.NewDecoder(resp.Body).Decode(&res)
-	if err != nil {
-		return res, fmt.Errorf("failed to decode getBuildProgress response: %w", err)
+		return err
 	}
 
-	return res, nil
-}
-
-type GetLogsRequest struct {
-	RepoID string
+	return nil
 }
 
-type GetLogsResponse struct {
-	Message ProgressMessage `json:"message"`
+type RemoveMemberRequest struct {
+	UserID string `json:"userID"`
 }
 
-func (c *Client) GetLogs(ctx context.Context, req GetLogsRequest) (GetLogsResponse, error) {
-	var res GetLogsResponse
-
-	q := make(url.Values)
-	q.Set("repoID", req.RepoID)
+func (c *Client) RemoveMember(ctx context.Context, req RemoveMemberRequest) error {
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
 
-	r, err := http.NewRequest("GET", c.baseUrl+"/getLogs?"+q.Encode(), nil)
+	r, err := http.NewRequest("POST", c.baseUrl+"/removeMember", body)
 	if err != nil {
-		return res, fmt.Errorf("failed to create request: %w", err)
+		return fmt.Errorf("failed to create request: %w", err)
 	}
 	r = r.WithContext(ctx)
 	r.Header = c.headers
 
 	resp, err := c.client.Do(r)
 	if err != nil {
-		return res, fmt.Errorf("failed to call getLogs: %w", err)
+		return fmt.Errorf("failed to call removeMember: %w", err)
 	}
 	defer resp.Body.Close()
 
 	err = HandleErr(resp)
 	if err != nil {
-		return res, err
+		return err
 	}
 
-	err = json.NewDecoder(resp.Body).Decode(&res)
-	if err != nil {
-		return res, fmt.Errorf("failed to decode getLogs response: %w", err)
-	}
+	return nil
+}
 
-	return res, nil
+type CreateApiTokenRequest struct {
+	Name       string    `json:"name"`
+	Operations []string  `json:"operations"`
+	ExpiresAt  time.Time `json:"expiresAt,omitzero"`
 }
 
-type GetDeploymentsRequest struct {
-	RepoID string `json:"repoID"`
+type CreateApiTokenResponse struct {
+	ApiToken ApiToken `json:"apiToken"`
+	Token    string   `json:"token"`
 }
 
-type GetDeploymentsResponse struct {
-	Deployments []AppDeployment `json:"deployments"`
+type ApiToken struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Operations  []string  `json:"operations"`
+	ExpiresAt   time.Time `json:"expiresAt,omitzero"`
+	LastUsedAt  time.Time `json:"lastUsedAt,omitzero"`
+	CreatedAt   time.Time `json:"createdAt"`
+	WorkspaceID string    `json:"-"`
+	UserID      string    `json:"-"`
+	TokenHash   string    `json:"-"`
+	User        UserInfo  `json:"-"`
 }
 
-func (c *Client) GetDeployments(ctx context.Context, req GetDeploymentsRequest) (GetDeploymentsResponse, error) {
-	var res GetDeploymentsResponse
+func (c *Client) CreateApiToken(ctx context.Context, req CreateApiTokenRequest) (CreateApiTokenResponse, error) {
+	var res CreateApiTokenResponse
 
 	bodyBytes, err := json.Marshal(req)
 	if err != nil {
@@ -675,7 +2939,7 @@ func (c *Client) GetDeployments(ctx context.Context, req GetDeploymentsRequest)
 	}
 	body := bytes.NewBuffer(bodyBytes)
 
-	r, err := http.NewRequest("POST", c.baseUrl+"/getDeployments", body)
+	r, err := http.NewRequest("POST", c.baseUrl+"/createApiToken", body)
 	if err != nil {
 		return res, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -684,7 +2948,7 @@ func (c *Client) GetDeployments(ctx context.Context, req GetDeploymentsRequest)
 
 	resp, err := c.client.Do(r)
 	if err != nil {
-		return res, fmt.Errorf("failed to call getDeployments: %w", err)
+		return res, fmt.Errorf("failed to call createApiToken: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -695,100 +2959,110 @@ func (c *Client) GetDeployments(ctx context.Context, req GetDeploymentsRequest)
 
 	err = json.NewDecoder(resp.Body).Decode(&res)
 	if err != nil {
-		return res, fmt.Errorf("failed to decode getDeployments response: %w", err)
+		return res, fmt.Errorf("failed to decode createApiToken response: %w", err)
 	}
 
 	return res, nil
 }
 
-type SetSecretRequest struct {
-	RepoID string `json:"repoID"`
-	Key    string `json:"key"`
-	Value  string `json:"value"`
+type GetApiTokensResponse struct {
+	ApiTokens []ApiToken `json:"apiTokens"`
 }
 
-func (c *Client) SetSecret(ctx context.Context, req SetSecretRequest) error {
-	bodyBytes, err := json.Marshal(req)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
-	}
-	body := bytes.NewBuffer(bodyBytes)
+func (c *Client) GetApiTokens(ctx context.Context) (GetApiTokensResponse, error) {
+	var res GetApiTokensResponse
 
-	r, err := http.NewRequest("POST", c.baseUrl+"/setSecret", body)
+	body := bytes.NewBuffer(nil)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/getApiTokens", body)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return res, fmt.Errorf("failed to create request: %w", err)
 	}
 	r = r.WithContext(ctx)
 	r.Header = c.headers
 
 	resp, err := c.client.Do(r)
 	if err != nil {
-		return fmt.Errorf("failed to call setSecret: %w", err)
+		return res, fmt.Errorf("failed to call getApiTokens: %w", err)
 	}
 	defer resp.Body.Close()
 
 	err = HandleErr(resp)
 	if err != nil {
-		return err
+		return res, err
 	}
 
-	return nil
-}
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode getApiTokens response: %w", err)
+	}
 
-type GetSecretsRequest struct {
-	RepoID string `json:"repoID"`
+	return res, nil
 }
 
-type GetSecretsResponse struct {
-	Keys []string `json:"keys"`
+type RevokeApiTokenRequest struct {
+	ID string `json:"id"`
 }
 
-func (c *Client) GetSecrets(ctx context.Context, req GetSecretsRequest) (GetSecretsResponse, error) {
-	var res GetSecretsResponse
-
+func (c *Client) RevokeApiToken(ctx context.Context, req RevokeApiTokenRequest) error {
 	bodyBytes, err := json.Marshal(req)
 	if err != nil {
-		return res, fmt.Errorf("failed to marshal request: %w", err)
+		return fmt.Errorf("failed to marshal request: %w", err)
 	}
 	body := bytes.NewBuffer(bodyBytes)
 
-	r, err := http.NewRequest("POST", c.baseUrl+"/getSecrets", body)
+	r, err := http.NewRequest("POST", c.baseUrl+"/revokeApiToken", body)
 	if err != nil {
-		return res, fmt.Errorf("failed to create request: %w", err)
+		return fmt.Errorf("failed to create request: %w", err)
 	}
 	r = r.WithContext(ctx)
 	r.Header = c.headers
 
 	resp, err := c.client.Do(r)
 	if err != nil {
-		return res, fmt.Errorf("failed to call getSecrets: %w", err)
+		return fmt.Errorf("failed to call revokeApiToken: %w", err)
 	}
 	defer resp.Body.Close()
 
 	err = HandleErr(resp)
 	if err != nil {
-		return res, err
+		return err
 	}
 
-	err = json.NewDecoder(resp.Body).Decode(&res)
-	if err != nil {
-		return res, fmt.Errorf("failed to decode getSecrets response: %w", err)
-	}
+	return nil
+}
 
-	return res, nil
+type GetAuditLogRequest struct {
+	Action  string    `json:"action"`
+	ActorID string    `json:"actorID"`
+	RepoID  string    `json:"repoID"`
+	Since   time.Time `json:"since,omitzero"`
+	Until   time.Time `json:"until,omitzero"`
+	Cursor  string    `json:"cursor"`
+	Limit   int       `json:"limit"`
 }
 
-type RevealSecretRequest struct {
-	RepoID string `json:"repoID"`
-	Key    string `json:"key"`
+type GetAuditLogResponse struct {
+	Events     []AuditEvent `json:"events"`
+	NextCursor string       `json:"nextCursor"`
 }
 
-type RevealSecretResponse struct {
-	Value string `json:"value"`
+type AuditEvent struct {
+	ID          string            `json:"id"`
+	WorkspaceID string            `json:"workspaceID"`
+	ActorID     string            `json:"actorID"`
+	ActorName   string            `json:"actorName"`
+	ApiTokenID  string            `json:"apiTokenID,omitempty"`
+	Action      string            `json:"action"`
+	Target      map[string]string `json:"target"`
+	Status      int               `json:"status"`
+	IP          string            `json:"ip"`
+	UserAgent   string            `json:"userAgent"`
+	CreatedAt   time.Time         `json:"createdAt"`
 }
 
-func (c *Client) RevealSecret(ctx context.Context, req RevealSecretRequest) (RevealSecretResponse, error) {
-	var res RevealSecretResponse
+func (c *Client) GetAuditLog(ctx context.Context, req GetAuditLogRequest) (GetAuditLogResponse, error) {
+	var res GetAuditLogResponse
 
 	bodyBytes, err := json.Marshal(req)
 	if err != nil {
@@ -796,7 +3070,7 @@ func (c *Client) RevealSecret(ctx context.Context, req RevealSecretRequest) (Rev
 	}
 	body := bytes.NewBuffer(bodyBytes)
 
-	r, err := http.NewRequest("POST", c.baseUrl+"/revealSecret", body)
+	r, err := http.NewRequest("POST", c.baseUrl+"/getAuditLog", body)
 	if err != nil {
 		return res, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -805,7 +3079,7 @@ func (c *Client) RevealSecret(ctx context.Context, req RevealSecretRequest) (Rev
 
 	resp, err := c.client.Do(r)
 	if err != nil {
-		return res, fmt.Errorf("failed to call revealSecret: %w", err)
+		return res, fmt.Errorf("failed to call getAuditLog: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -816,25 +3090,29 @@ func (c *Client) RevealSecret(ctx context.Context, req RevealSecretRequest) (Rev
 
 	err = json.NewDecoder(resp.Body).Decode(&res)
 	if err != nil {
-		return res, fmt.Errorf("failed to decode revealSecret response: %w", err)
+		return res, fmt.Errorf("failed to decode getAuditLog response: %w", err)
 	}
 
 	return res, nil
 }
 
-type RemoveSecretRequest struct {
-	RepoID string `json:"repoID"`
-	Key    string `json:"key"`
+type ExportAuditLogRequest struct {
+	Action  string
+	ActorID string
+	RepoID  string
+	Since   string
+	Until   string
 }
 
-func (c *Client) RemoveSecret(ctx context.Context, req RemoveSecretRequest) error {
-	bodyBytes, err := json.Marshal(req)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
-	}
-	body := bytes.NewBuffer(bodyBytes)
+func (c *Client) ExportAuditLog(ctx context.Context, req ExportAuditLogRequest) error {
+	q := make(url.Values)
+	q.Set("action", req.Action)
+	q.Set("actorID", req.ActorID)
+	q.Set("repoID", req.RepoID)
+	q.Set("since", req.Since)
+	q.Set("until", req.Until)
 
-	r, err := http.NewRequest("POST", c.baseUrl+"/removeSecret", body)
+	r, err := http.NewRequest("GET", c.baseUrl+"/exportAuditLog?"+q.Encode(), nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
@@ -843,7 +3121,7 @@ func (c *Client) RemoveSecret(ctx context.Context, req RemoveSecretRequest) erro
 
 	resp, err := c.client.Do(r)
 	if err != nil {
-		return fmt.Errorf("failed to call removeSecret: %w", err)
+		return fmt.Errorf("failed to call exportAuditLog: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -0,0 +1,99 @@
+package e2e
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/treenq/treenq/client"
+)
+
+func TestApiTokens(t *testing.T) {
+	clearDatabase()
+
+	user := client.UserInfo{ID: xid.New().String(), Email: "test@mail.com", DisplayName: "testing"}
+	userToken, err := createUser(user)
+	require.NoError(t, err, "user must be created")
+	apiClient := client.NewClient("http://localhost:8000", http.DefaultClient, map[string]string{
+		"Authorization": "Bearer " + userToken,
+	})
+
+	ctx := context.Background()
+	var e *client.Error
+
+	_, err = apiClient.CreateApiToken(ctx, client.CreateApiTokenRequest{Name: "ci"})
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "OPERATIONS_REQUIRED", e.Code)
+	_, err = apiClient.CreateApiToken(ctx, client.CreateApiTokenRequest{Name: "ci", Operations: []string{"getSecrets"}, ExpiresAt: time.Now().Add(-time.Hour)})
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "INVALID_EXPIRATION", e.Code)
+
+	created, err := apiClient.CreateApiToken(ctx, client.CreateApiTokenRequest{
+		Name:       "ci",
+		Operations: []string{"getSecrets", "getApiTokens", "createApiToken"},
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, created.Token)
+	assert.Equal(t, "ci", created.ApiToken.Name)
+	assert.True(t, created.ApiToken.LastUsedAt.IsZero())
+
+	tokenClient := client.NewClient("http://localhost:8000", http.DefaultClient, map[string]string{
+		"Authorization": "Bearer " + created.Token,
+	})
+	_, err = tokenClient.GetSecrets(ctx, client.GetSecretsRequest{RepoID: xid.New().String()})
+	require.NoError(t, err)
+
+	// the operations out of the token scope are forbidden
+	_, err = tokenClient.GetRepos(ctx)
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "FORBIDDEN", e.Code)
+	// a token can't issue tokens even if the operation is in its scope
+	_, err = tokenClient.CreateApiToken(ctx, client.CreateApiTokenRequest{Name: "another", Operations: []string{"deploy"}})
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "API_TOKEN_NOT_ALLOWED", e.Code)
+
+	tokens, err := tokenClient.GetApiTokens(ctx)
+	require.NoError(t, err)
+	require.Len(t, tokens.ApiTokens, 1)
+	assert.Equal(t, created.ApiToken.ID, tokens.ApiTokens[0].ID)
+	assert.Equal(t, []string{"getSecrets", "getApiTokens", "createApiToken"}, tokens.ApiTokens[0].Operations)
+	assert.False(t, tokens.ApiTokens[0].LastUsedAt.IsZero())
+
+	err = apiClient.RevokeApiToken(ctx, client.RevokeApiTokenRequest{ID: created.ApiToken.ID})
+	require.NoError(t, err)
+	err = apiClient.RevokeApiToken(ctx, client.RevokeApiTokenRequest{ID: created.ApiToken.ID})
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "API_TOKEN_NOT_FOUND", e.Code)
+
+	_, err = tokenClient.GetSecrets(ctx, client.GetSecretsRequest{RepoID: xid.New().String()})
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "UNAUTHORIZED", e.Code)
+}
+
+func TestApiTokenLimitedByRole(t *testing.T) {
+	clearDatabase()
+
+	owner := client.UserInfo{ID: xid.New().String(), Email: "owner@mail.com", DisplayName: "owner"}
+	_, err := createUser(owner)
+	require.NoError(t, err, "owner must be created")
+	developer := client.UserInfo{ID: xid.New().String(), Email: "developer@mail.com", DisplayName: "developer"}
+	developerToken, err := addWorkspaceMember(owner.ID, developer, "developer")
+	require.NoError(t, err, "developer must be added")
+
+	ctx := context.Background()
+	created, err := client.NewClient("http://localhost:8000", http.DefaultClient, map[string]string{
+		"Authorization": "Bearer " + developerToken,
+	}).CreateApiToken(ctx, client.CreateApiTokenRequest{Name: "ci", Operations: []string{"addCluster"}})
+	require.NoError(t, err)
+
+	_, err = client.NewClient("http://localhost:8000", http.DefaultClient, map[string]string{
+		"Authorization": "Bearer " + created.Token,
+	}).AddCluster(ctx, client.AddClusterRequest{})
+	var e *client.Error
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "FORBIDDEN", e.Code)
+}
@@ -0,0 +1,119 @@
+package e2e
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/treenq/treenq/client"
+)
+
+func TestAuditLog(t *testing.T) {
+	clearDatabase()
+
+	owner := client.UserInfo{ID: xid.New().String(), Email: "owner@mail.com", DisplayName: "owner"}
+	ownerToken, err := createUser(owner)
+	require.NoError(t, err, "owner must be created")
+	apiClient := client.NewClient("http://localhost:8000", http.DefaultClient, map[string]string{
+		"Authorization": "Bearer " + ownerToken,
+	})
+	viewer := client.UserInfo{ID: xid.New().String(), Email: "viewer@mail.com", DisplayName: "viewer"}
+	viewerToken, err := addWorkspaceMember(owner.ID, viewer, "viewer")
+	require.NoError(t, err, "viewer must be added")
+	viewerClient := client.NewClient("http://localhost:8000", http.DefaultClient, map[string]string{
+		"Authorization": "Bearer " + viewerToken,
+	})
+
+	ctx := context.Background()
+	var e *client.Error
+
+	created, err := apiClient.CreateApiToken(ctx, client.CreateApiTokenRequest{Name: "ci", Operations: []string{"deploy"}})
+	require.NoError(t, err)
+	repoID := xid.New().String()
+	err = apiClient.SetRepoProtection(ctx, client.SetRepoProtectionRequest{RepoID: repoID, Protected: true})
+	require.ErrorAs(t, err, &e)
+	err = apiClient.RevokeApiToken(ctx, client.RevokeApiTokenRequest{ID: created.ApiToken.ID})
+	require.NoError(t, err)
+	// the reads are not recorded
+	_, err = apiClient.GetApiTokens(ctx)
+	require.NoError(t, err)
+
+	log, err := apiClient.GetAuditLog(ctx, client.GetAuditLogRequest{})
+	require.NoError(t, err)
+	require.Len(t, log.Events, 3)
+	assert.Empty(t, log.NextCursor)
+	assert.Equal(t, "revokeApiToken", log.Events[0].Action)
+	assert.Equal(t, map[string]string{"id": created.ApiToken.ID}, log.Events[0].Target)
+	assert.Equal(t, "setRepoProtection", log.Events[1].Action)
+	assert.Equal(t, map[string]string{"repoID": repoID, "protected": "true"}, log.Events[1].Target)
+	assert.Equal(t, http.StatusBadRequest, log.Events[1].Status, "the failed attempts are recorded")
+	assert.Equal(t, "createApiToken", log.Events[2].Action)
+	assert.Equal(t, map[string]string{"name": "ci"}, log.Events[2].Target)
+	for _, event := range log.Events {
+		assert.Equal(t, owner.ID, event.WorkspaceID)
+		assert.Equal(t, owner.ID, event.ActorID)
+		assert.Equal(t, owner.DisplayName, event.ActorName)
+	}
+
+	// filters and pages
+	log, err = apiClient.GetAuditLog(ctx, client.GetAuditLogRequest{RepoID: repoID})
+	require.NoError(t, err)
+	require.Len(t, log.Events, 1)
+	assert.Equal(t, "setRepoProtection", log.Events[0].Action)
+	log, err = apiClient.GetAuditLog(ctx, client.GetAuditLogRequest{Action: "createApiToken", ActorID: owner.ID})
+	require.NoError(t, err)
+	require.Len(t, log.Events, 1)
+	page, err := apiClient.GetAuditLog(ctx, client.GetAuditLogRequest{Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, page.Events, 2)
+	require.NotEmpty(t, page.NextCursor)
+	page, err = apiClient.GetAuditLog(ctx, client.GetAuditLogRequest{Limit: 2, Cursor: page.NextCursor})
+	require.NoError(t, err)
+	require.Len(t, page.Events, 1)
+	assert.Equal(t, "createApiToken", page.Events[0].Action)
+
+	// json lines export
+	r, err := http.NewRequest(http.MethodGet, "http://localhost:8000/exportAuditLog?action=createApiToken", nil)
+	require.NoError(t, err)
+	r.Header.Set("Authorization", "Bearer "+ownerToken)
+	resp, err := http.DefaultClient.Do(r)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+	var exported []client.AuditEvent
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var event client.AuditEvent
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		exported = append(exported, event)
+	}
+	require.Len(t, exported, 1)
+	assert.Equal(t, "createApiToken", exported[0].Action)
+
+	_, err = viewerClient.GetAuditLog(ctx, client.GetAuditLogRequest{})
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "FORBIDDEN", e.Code)
+
+	// the forbidden attempts are recorded too,
+	// the client address isn't taken from a forwarded header of an untrusted client
+	err = client.NewClient("http://localhost:8000", http.DefaultClient, map[string]string{
+		"Authorization":   "Bearer " + viewerToken,
+		"X-Forwarded-For": "203.0.113.7",
+	}).SetRepoProtection(ctx, client.SetRepoProtectionRequest{RepoID: repoID, Protected: false})
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "FORBIDDEN", e.Code)
+	log, err = apiClient.GetAuditLog(ctx, client.GetAuditLogRequest{ActorID: viewer.ID})
+	require.NoError(t, err)
+	require.Len(t, log.Events, 1)
+	assert.Equal(t, "setRepoProtection", log.Events[0].Action)
+	assert.Equal(t, http.StatusForbidden, log.Events[0].Status)
+	assert.Equal(t, viewer.DisplayName, log.Events[0].ActorName)
+	assert.NotEmpty(t, log.Events[0].IP)
+	assert.NotEqual(t, "203.0.113.7", log.Events[0].IP, "a forwarded address must be trusted only from a trusted proxy")
+}
@@ -0,0 +1,101 @@
+package e2e
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/treenq/treenq/client"
+)
+
+// unreachableKubeConfig points to a closed port, a cluster is saved without connecting to it
+const unreachableKubeConfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: staging
+  cluster:
+    server: https://127.0.0.1:1
+contexts:
+- name: staging
+  context:
+    cluster: staging
+    user: staging
+current-context: staging
+users:
+- name: staging
+  user:
+    token: token
+`
+
+func TestClusters(t *testing.T) {
+	clearDatabase()
+
+	owner := client.UserInfo{ID: xid.New().String(), Email: "owner@mail.com", DisplayName: "owner"}
+	ownerToken, err := createUser(owner)
+	require.NoError(t, err, "owner must be created")
+	apiClient := client.NewClient("http://localhost:8000", http.DefaultClient, map[string]string{
+		"Authorization": "Bearer " + ownerToken,
+	})
+	viewer := client.UserInfo{ID: xid.New().String(), Email: "viewer@mail.com", DisplayName: "viewer"}
+	viewerToken, err := addWorkspaceMember(owner.ID, viewer, "viewer")
+	require.NoError(t, err, "viewer must be added")
+	viewerClient := client.NewClient("http://localhost:8000", http.DefaultClient, map[string]string{
+		"Authorization": "Bearer " + viewerToken,
+	})
+
+	ctx := context.Background()
+	var e *client.Error
+
+	_, err = apiClient.AddCluster(ctx, client.AddClusterRequest{Name: "staging"})
+	require.Equal(t, &client.Error{Code: "INVALID_CLUSTER"}, err)
+	added, err := apiClient.AddCluster(ctx, client.AddClusterRequest{Name: "staging", KubeConfig: unreachableKubeConfig})
+	require.NoError(t, err, "cluster must be added")
+	assert.NotEmpty(t, added.Cluster.ID)
+	assert.Equal(t, "staging", added.Cluster.Name)
+	_, err = apiClient.AddCluster(ctx, client.AddClusterRequest{Name: "staging", KubeConfig: unreachableKubeConfig})
+	require.Equal(t, &client.Error{Code: "CLUSTER_EXISTS"}, err, "a cluster must not be replaced")
+
+	_, err = viewerClient.AddCluster(ctx, client.AddClusterRequest{Name: "viewer", KubeConfig: unreachableKubeConfig})
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "FORBIDDEN", e.Code, "a viewer can't add the clusters")
+
+	clusters, err := viewerClient.GetClusters(ctx)
+	require.NoError(t, err, "a viewer can see the clusters")
+	require.Len(t, clusters.Clusters, 1)
+	assert.Equal(t, added.Cluster.ID, clusters.Clusters[0].ID)
+	assert.Equal(t, "staging", clusters.Clusters[0].Name)
+
+	checked, err := apiClient.CheckCluster(ctx, client.CheckClusterRequest{ClusterID: added.Cluster.ID})
+	require.NoError(t, err)
+	assert.False(t, checked.Reachable)
+	assert.NotEmpty(t, checked.Error)
+	_, err = apiClient.CheckCluster(ctx, client.CheckClusterRequest{ClusterID: xid.New().String()})
+	require.Equal(t, &client.Error{Code: "CLUSTER_NOT_FOUND"}, err)
+
+	// a repo without secrets is moved to the cluster without connecting to it
+	repoID := xid.New().String()
+	_, err = db.Exec("INSERT INTO installedRepos (id, githubId, fullName, private, installationId, workspaceId, status, branch) VALUES ($1, 1, 'owner/app', false, 1, $2, 'active', 'main')", repoID, owner.ID)
+	require.NoError(t, err)
+	err = apiClient.SetRepoCluster(ctx, client.SetRepoClusterRequest{RepoID: xid.New().String(), ClusterID: added.Cluster.ID})
+	require.Equal(t, &client.Error{Code: "REPO_NOT_FOUND"}, err)
+	err = apiClient.SetRepoCluster(ctx, client.SetRepoClusterRequest{RepoID: repoID, ClusterID: xid.New().String()})
+	require.Equal(t, &client.Error{Code: "CLUSTER_NOT_FOUND"}, err)
+	err = apiClient.SetRepoCluster(ctx, client.SetRepoClusterRequest{RepoID: repoID, ClusterID: added.Cluster.ID})
+	require.NoError(t, err, "repo must be moved to the cluster")
+
+	err = apiClient.RemoveCluster(ctx, client.RemoveClusterRequest{ClusterID: added.Cluster.ID})
+	require.Equal(t, &client.Error{Code: "CLUSTER_IN_USE"}, err)
+	err = apiClient.SetRepoCluster(ctx, client.SetRepoClusterRequest{RepoID: repoID})
+	require.NoError(t, err, "repo must be moved back to the default cluster")
+	err = apiClient.RemoveCluster(ctx, client.RemoveClusterRequest{ClusterID: added.Cluster.ID})
+	require.NoError(t, err, "cluster must be removed")
+	err = apiClient.RemoveCluster(ctx, client.RemoveClusterRequest{ClusterID: added.Cluster.ID})
+	require.Equal(t, &client.Error{Code: "CLUSTER_NOT_FOUND"}, err)
+
+	clusters, err = apiClient.GetClusters(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, clusters.Clusters)
+}
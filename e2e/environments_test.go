@@ -0,0 +1,121 @@
+package e2e
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/treenq/treenq/client"
+)
+
+func TestEnvironments(t *testing.T) {
+	clearDatabase()
+
+	owner := client.UserInfo{ID: xid.New().String(), Email: "owner@mail.com", DisplayName: "owner"}
+	ownerToken, err := createUser(owner)
+	require.NoError(t, err, "owner must be created")
+	apiClient := client.NewClient("http://localhost:8000", http.DefaultClient, map[string]string{
+		"Authorization": "Bearer " + ownerToken,
+	})
+	viewer := client.UserInfo{ID: xid.New().String(), Email: "viewer@mail.com", DisplayName: "viewer"}
+	viewerToken, err := addWorkspaceMember(owner.ID, viewer, "viewer")
+	require.NoError(t, err, "viewer must be added")
+	viewerClient := client.NewClient("http://localhost:8000", http.DefaultClient, map[string]string{
+		"Authorization": "Bearer " + viewerToken,
+	})
+
+	ctx := context.Background()
+	var e *client.Error
+
+	repoID := xid.New().String()
+	_, err = db.Exec("INSERT INTO installedRepos (id, githubId, fullName, private, installationId, workspaceId, status, branch) VALUES ($1, 1, 'owner/app', false, 1, $2, 'active', 'main')", repoID, owner.ID)
+	require.NoError(t, err)
+
+	_, err = apiClient.CreateEnvironment(ctx, client.CreateEnvironmentRequest{RepoID: repoID, Name: "Staging"})
+	require.Equal(t, &client.Error{Code: "INVALID_ENVIRONMENT_NAME"}, err)
+	_, err = apiClient.CreateEnvironment(ctx, client.CreateEnvironmentRequest{RepoID: repoID, Name: "staging", Branch: "develop", TagPrefix: "v"})
+	require.Equal(t, &client.Error{Code: "ONLY_BRANCH_OR_TAG_PREFIX_ALLOWED"}, err)
+	_, err = apiClient.CreateEnvironment(ctx, client.CreateEnvironmentRequest{RepoID: xid.New().String(), Name: "staging"})
+	require.Equal(t, &client.Error{Code: "REPO_NOT_FOUND"}, err)
+	_, err = apiClient.CreateEnvironment(ctx, client.CreateEnvironmentRequest{RepoID: repoID, Name: "staging", RequiredApprover: viewer.ID})
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "INVALID_REQUIRED_APPROVER", e.Code, "a viewer can't approve the deployments")
+
+	created, err := apiClient.CreateEnvironment(ctx, client.CreateEnvironmentRequest{
+		RepoID:           repoID,
+		Name:             "staging",
+		Branch:           "develop",
+		Overrides:        client.SpaceOverrides{Replicas: 2, RuntimeEnvs: map[string]string{"MODE": "staging"}},
+		RequiredApprover: owner.ID,
+	})
+	require.NoError(t, err, "environment must be created")
+	assert.NotEmpty(t, created.Environment.ID)
+	assert.Equal(t, repoID, created.Environment.RepoID)
+	assert.Equal(t, "staging", created.Environment.Name)
+	assert.Equal(t, "develop", created.Environment.Branch)
+	assert.Equal(t, 2, created.Environment.Overrides.Replicas)
+	assert.Equal(t, map[string]string{"MODE": "staging"}, created.Environment.Overrides.RuntimeEnvs)
+	assert.Equal(t, owner.ID, created.Environment.RequiredApprover)
+	assert.NotEmpty(t, created.Environment.Namespace)
+	assert.NotEmpty(t, created.Environment.URL)
+
+	_, err = apiClient.CreateEnvironment(ctx, client.CreateEnvironmentRequest{RepoID: repoID, Name: "staging"})
+	require.Equal(t, &client.Error{Code: "ENVIRONMENT_ALREADY_EXISTS"}, err)
+	_, err = viewerClient.CreateEnvironment(ctx, client.CreateEnvironmentRequest{RepoID: repoID, Name: "preview"})
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "FORBIDDEN", e.Code, "a viewer can't create the environments")
+
+	envs, err := viewerClient.GetEnvironments(ctx, client.GetEnvironmentsRequest{RepoID: repoID})
+	require.NoError(t, err, "a viewer can see the environments")
+	require.Len(t, envs.Environments, 1)
+	assert.Equal(t, created.Environment.ID, envs.Environments[0].ID)
+	assert.Equal(t, created.Environment.Namespace, envs.Environments[0].Namespace)
+	_, err = apiClient.GetEnvironments(ctx, client.GetEnvironmentsRequest{RepoID: xid.New().String()})
+	require.Equal(t, &client.Error{Code: "REPO_NOT_FOUND"}, err)
+
+	_, err = apiClient.UpdateEnvironment(ctx, client.UpdateEnvironmentRequest{RepoID: repoID, Name: "production"})
+	require.Equal(t, &client.Error{Code: "ENVIRONMENT_NOT_FOUND"}, err)
+	_, err = apiClient.UpdateEnvironment(ctx, client.UpdateEnvironmentRequest{RepoID: repoID})
+	require.Equal(t, &client.Error{Code: "INVALID_ENVIRONMENT_NAME"}, err, "the default environment can't be updated")
+	_, err = viewerClient.UpdateEnvironment(ctx, client.UpdateEnvironmentRequest{RepoID: repoID, Name: "staging"})
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "FORBIDDEN", e.Code, "a viewer can't update the environments")
+
+	updated, err := apiClient.UpdateEnvironment(ctx, client.UpdateEnvironmentRequest{
+		RepoID:    repoID,
+		Name:      "staging",
+		TagPrefix: "v",
+		Overrides: client.SpaceOverrides{Replicas: 3},
+		Protected: true,
+	})
+	require.NoError(t, err, "environment must be updated")
+	assert.Equal(t, created.Environment.ID, updated.Environment.ID)
+	assert.Empty(t, updated.Environment.Branch)
+	assert.Equal(t, "v", updated.Environment.TagPrefix)
+	assert.Equal(t, 3, updated.Environment.Overrides.Replicas)
+	assert.Empty(t, updated.Environment.RequiredApprover)
+	assert.True(t, updated.Environment.Protected)
+
+	envs, err = apiClient.GetEnvironments(ctx, client.GetEnvironmentsRequest{RepoID: repoID})
+	require.NoError(t, err)
+	require.Len(t, envs.Environments, 1)
+	assert.Equal(t, "v", envs.Environments[0].TagPrefix, "the update must be saved")
+	assert.True(t, envs.Environments[0].Protected)
+
+	err = apiClient.RemoveEnvironment(ctx, client.RemoveEnvironmentRequest{RepoID: repoID})
+	require.Equal(t, &client.Error{Code: "INVALID_ENVIRONMENT_NAME"}, err, "the default environment can't be removed")
+	err = viewerClient.RemoveEnvironment(ctx, client.RemoveEnvironmentRequest{RepoID: repoID, Name: "staging"})
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "FORBIDDEN", e.Code, "a viewer can't remove the environments")
+	err = apiClient.RemoveEnvironment(ctx, client.RemoveEnvironmentRequest{RepoID: repoID, Name: "staging"})
+	require.NoError(t, err, "environment must be removed")
+	err = apiClient.RemoveEnvironment(ctx, client.RemoveEnvironmentRequest{RepoID: repoID, Name: "staging"})
+	require.Equal(t, &client.Error{Code: "ENVIRONMENT_NOT_FOUND"}, err)
+
+	envs, err = apiClient.GetEnvironments(ctx, client.GetEnvironmentsRequest{RepoID: repoID})
+	require.NoError(t, err)
+	assert.Empty(t, envs.Environments)
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -70,11 +71,12 @@ func TestGithubAppInstallation(t *testing.T) {
 		Installation: treenqInstallationExists,
 		Repos: []client.GithubRepository{
 			{
-				TreenqID: reposResponse.Repos[0].TreenqID,
-				ID:       805585115,
-				FullName: "treenq/useless",
-				Private:  false,
-				Status:   "active",
+				TreenqID:              reposResponse.Repos[0].TreenqID,
+				ID:                    805585115,
+				FullName:              "treenq/useless",
+				Private:               false,
+				Status:                "active",
+				RestartOnSecretChange: false,
 			},
 		},
 	}, reposResponse, "installed repositories don't match")
@@ -92,20 +94,22 @@ func TestGithubAppInstallation(t *testing.T) {
 
 	assert.Equal(t, client.GetReposResponse{Installation: true, Repos: []client.GithubRepository{
 		{
-			TreenqID: reposResponse.Repos[0].TreenqID,
-			ID:       805585115,
-			FullName: "treenq/useless",
-			Private:  false,
-			Status:   "active",
-			Branch:   "",
+			TreenqID:              reposResponse.Repos[0].TreenqID,
+			ID:                    805585115,
+			FullName:              "treenq/useless",
+			Private:               false,
+			Status:                "active",
+			RestartOnSecretChange: false,
+			Branch:                "",
 		},
 		{
-			TreenqID: reposResponse.Repos[1].TreenqID,
-			ID:       805584540,
-			FullName: "treenq/useless-cli",
-			Private:  false,
-			Status:   "active",
-			Branch:   "",
+			TreenqID:              reposResponse.Repos[1].TreenqID,
+			ID:                    805584540,
+			FullName:              "treenq/useless-cli",
+			Private:               false,
+			Status:                "active",
+			RestartOnSecretChange: false,
+			Branch:                "",
 		},
 	}}, reposResponse, "installed repositories don't match")
 
@@ -132,13 +136,14 @@ func TestGithubAppInstallation(t *testing.T) {
 	require.NoError(t, err, "connect branch must succeed")
 	require.Equal(t, client.ConnectBranchResponse{
 		Repo: client.GithubRepository{
-			TreenqID:       reposResponse.Repos[0].TreenqID,
-			InstallationID: reposResponse.Repos[0].InstallationID,
-			ID:             805585115,
-			Branch:         branchName,
-			FullName:       reposResponse.Repos[0].FullName,
-			Private:        reposResponse.Repos[0].Private,
-			Status:         reposResponse.Repos[0].Status,
+			TreenqID:              reposResponse.Repos[0].TreenqID,
+			InstallationID:        reposResponse.Repos[0].InstallationID,
+			ID:                    805585115,
+			Branch:                branchName,
+			FullName:              reposResponse.Repos[0].FullName,
+			Private:               reposResponse.Repos[0].Private,
+			Status:                reposResponse.Repos[0].Status,
+			RestartOnSecretChange: false,
 		},
 	}, connectRepoRes, "connect repo branch response doesn't match")
 
@@ -152,20 +157,22 @@ func TestGithubAppInstallation(t *testing.T) {
 
 	assert.Equal(t, client.GetReposResponse{Installation: true, Repos: []client.GithubRepository{
 		{
-			TreenqID: reposResponse.Repos[0].TreenqID,
-			ID:       805585115,
-			FullName: "treenq/useless",
-			Private:  false,
-			Status:   "active",
-			Branch:   branchName,
+			TreenqID:              reposResponse.Repos[0].TreenqID,
+			ID:                    805585115,
+			FullName:              "treenq/useless",
+			Private:               false,
+			Status:                "active",
+			RestartOnSecretChange: false,
+			Branch:                branchName,
 		},
 		{
-			TreenqID: reposResponse.Repos[1].TreenqID,
-			ID:       805584540,
-			FullName: "treenq/useless-cli",
-			Private:  false,
-			Status:   "active",
-			Branch:   "",
+			TreenqID:              reposResponse.Repos[1].TreenqID,
+			ID:                    805584540,
+			FullName:              "treenq/useless-cli",
+			Private:               false,
+			Status:                "active",
+			RestartOnSecretChange: false,
+			Branch:                "",
 		},
 	}}, reposResponse, "installed repositories don't match")
 
@@ -180,12 +187,13 @@ func TestGithubAppInstallation(t *testing.T) {
 	require.NoError(t, err, "repositores must be available after app installation")
 	assert.Equal(t, client.GetReposResponse{Installation: true, Repos: []client.GithubRepository{
 		{
-			TreenqID: reposResponse.Repos[0].TreenqID,
-			ID:       805585115,
-			FullName: "treenq/useless",
-			Private:  false,
-			Status:   "active",
-			Branch:   branchName,
+			TreenqID:              reposResponse.Repos[0].TreenqID,
+			ID:                    805585115,
+			FullName:              "treenq/useless",
+			Private:               false,
+			Status:                "active",
+			RestartOnSecretChange: false,
+			Branch:                branchName,
 		},
 	}}, reposResponse, "installed repositories don't match")
 
@@ -206,12 +214,13 @@ func TestGithubAppInstallation(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, connectRepoResponse, client.ConnectBranchResponse{
 		Repo: client.GithubRepository{
-			TreenqID: reposResponse.Repos[0].TreenqID,
-			ID:       805585115,
-			FullName: "treenq/useless",
-			Private:  false,
-			Status:   "active",
-			Branch:   branchName,
+			TreenqID:              reposResponse.Repos[0].TreenqID,
+			ID:                    805585115,
+			FullName:              "treenq/useless",
+			Private:               false,
+			Status:                "active",
+			RestartOnSecretChange: false,
+			Branch:                branchName,
 		},
 	})
 	// get repos and make sure there is a connected one
@@ -219,12 +228,13 @@ func TestGithubAppInstallation(t *testing.T) {
 	require.NoError(t, err, "repositores must be available after app installation")
 	assert.Equal(t, client.GetReposResponse{Installation: true, Repos: []client.GithubRepository{
 		{
-			TreenqID: reposResponse.Repos[0].TreenqID,
-			ID:       805585115,
-			FullName: "treenq/useless",
-			Private:  false,
-			Status:   "active",
-			Branch:   branchName,
+			TreenqID:              reposResponse.Repos[0].TreenqID,
+			ID:                    805585115,
+			FullName:              "treenq/useless",
+			Private:               false,
+			Status:                "active",
+			RestartOnSecretChange: false,
+			Branch:                branchName,
 		},
 	}}, reposResponse, "installed repositories don't match")
 
@@ -270,6 +280,7 @@ func TestGithubAppInstallation(t *testing.T) {
 	assert.NotEmpty(t, createdDeployment.Deployment.CommitMessage)
 	assert.Equal(t, createdDeployment.Deployment.BuildTag, createdDeployment.Deployment.Sha)
 	assert.Equal(t, createdDeployment.Deployment.UserDisplayName, "testing")
+	testBuildLogs(t, ctx, apiClient, anotherApiClient, userToken, createdDeployment.Deployment)
 
 	branchDeployment := testDeploymentValidation(t, apiClient, userToken, serviceValidateRequest{
 		req: client.DeployRequest{
@@ -327,6 +338,36 @@ func TestGithubAppInstallation(t *testing.T) {
 	assert.Equal(t, rollbackDeploy.Deployment.BuildTag, rollbackDeploy.Deployment.Sha)
 	assert.Equal(t, rollbackDeploy.Deployment.UserDisplayName, "testing")
 
+	// a deployment requiring an absent secret fails before anything is built or applied
+	requiringDeployment := xid.New().String()
+	_, err = db.Exec(`INSERT INTO deployments (id, fromDeploymentId, repoId, space, sha, branch, commitMessage, buildTag, userDisplayName, status, environment)
+		SELECT $1, '', repoId, jsonb_set(space, '{Service,requiredSecrets}', '["TQ_REQUIRED_SECRET"]'), sha, branch, commitMessage, buildTag, userDisplayName, 'failed', environment
+		FROM deployments WHERE id = $2`, requiringDeployment, createdDeployment.Deployment.ID)
+	require.NoError(t, err, "a deployment requiring a secret must be inserted")
+	_, err = apiClient.Deploy(ctx, client.DeployRequest{
+		RepoID:           reposResponse.Repos[0].TreenqID,
+		FromDeploymentID: requiringDeployment,
+	})
+	var missingErr *client.Error
+	require.ErrorAs(t, err, &missingErr)
+	assert.Equal(t, "MISSING_SECRETS", missingErr.Code)
+	assert.Equal(t, "TQ_REQUIRED_SECRET", missingErr.Meta["keys"], "the absent keys must be listed")
+	_, err = db.Exec("DELETE FROM deployments WHERE id = $1", requiringDeployment)
+	require.NoError(t, err)
+
+	// the deployer is matched by the user id, a display name doesn't identify one
+	awaitingDeployment := xid.New().String()
+	_, err = db.Exec(`INSERT INTO deployments (id, fromDeploymentId, repoId, space, sha, branch, commitMessage, buildTag, userDisplayName, userId, status, environment)
+		SELECT $1, '', repoId, space, sha, branch, commitMessage, buildTag, 'someone-else', $3, 'awaiting_approval', environment
+		FROM deployments WHERE id = $2`, awaitingDeployment, createdDeployment.Deployment.ID, user.ID)
+	require.NoError(t, err, "an awaiting deployment must be inserted")
+	_, err = apiClient.ApproveDeployment(ctx, client.ApproveDeploymentRequest{DeploymentID: awaitingDeployment})
+	require.Equal(t, &client.Error{Code: "SELF_APPROVAL_NOT_ALLOWED"}, err, "a deployer must not approve its own deployment")
+	_, err = db.Exec("DELETE FROM deployments WHERE id = $1", awaitingDeployment)
+	require.NoError(t, err)
+
+	testRequiredApprover(t, ctx, apiClient, user, reposResponse.Repos[0].TreenqID, createdDeployment.Deployment.ID)
+
 	deployments, err := apiClient.GetDeployments(ctx, client.GetDeploymentsRequest{
 		RepoID: reposResponse.Repos[0].TreenqID,
 	})
@@ -356,6 +397,8 @@ func TestGithubAppInstallation(t *testing.T) {
 	// wait for secrets test to complete before uninstalling
 	<-secretsTestDone
 
+	testSecretRestart(t, ctx, apiClient, userToken, reposResponse.Repos[0].TreenqID, rollbackDeploy.Deployment.ID)
+
 	// save repo ID for later validation
 	repoIDForValidation := reposResponse.Repos[0].TreenqID
 
@@ -388,21 +431,21 @@ func testSecretsApi(t *testing.T, ctx context.Context, apiClient, anotherApiClie
 	require.Empty(t, secrets.Keys, "secrets are expected to be empty")
 
 	// Test invalid secret key validation
-	err = apiClient.SetSecret(ctx, client.SetSecretRequest{
+	_, err = apiClient.SetSecret(ctx, client.SetSecretRequest{
 		RepoID: connectRepoRes.Repo.TreenqID,
 		Key:    "1INVALID",
 		Value:  "TEST",
 	})
 	require.Equal(t, err, &client.Error{Code: "INVALID_SECRET_KEY"}, "secret key starting with digit should be invalid")
 
-	err = apiClient.SetSecret(ctx, client.SetSecretRequest{
+	_, err = apiClient.SetSecret(ctx, client.SetSecretRequest{
 		RepoID: connectRepoRes.Repo.TreenqID,
 		Key:    "INVALID@KEY",
 		Value:  "TEST",
 	})
 	require.Equal(t, err, &client.Error{Code: "INVALID_SECRET_KEY"}, "secret key with @ symbol should be invalid")
 
-	err = apiClient.SetSecret(ctx, client.SetSecretRequest{
+	_, err = apiClient.SetSecret(ctx, client.SetSecretRequest{
 		RepoID: connectRepoRes.Repo.TreenqID,
 		Key:    "",
 		Value:  "TEST",
@@ -416,13 +459,21 @@ func testSecretsApi(t *testing.T, ctx context.Context, apiClient, anotherApiClie
 	require.Equal(t, err, &client.Error{Code: "SECRET_DOESNT_EXIST"})
 	require.Empty(t, revealSecretResponse.Value, "no revealed secret is expected")
 
-	err = apiClient.SetSecret(ctx, client.SetSecretRequest{
+	_, err = apiClient.SetSecret(ctx, client.SetSecretRequest{
 		RepoID: connectRepoRes.Repo.TreenqID,
 		Key:    "SECRET",
 		Value:  "SUPER",
 	})
 	require.NoError(t, err, "no error expect on set secret")
 
+	_, err = apiClient.SetSecretStore(ctx, client.SetSecretStoreRequest{
+		Kind:         "vault",
+		VaultAddress: "https://vault.example.com",
+		VaultRole:    "treenq-apps",
+		VaultToken:   "s.token",
+	})
+	require.Equal(t, &client.Error{Code: "SECRET_STORE_IN_USE"}, err, "the secret store can't be changed while the workspace has secrets")
+
 	secrets, err = apiClient.GetSecrets(ctx, client.GetSecretsRequest{
 		RepoID: connectRepoRes.Repo.TreenqID,
 	})
@@ -436,6 +487,45 @@ func testSecretsApi(t *testing.T, ctx context.Context, apiClient, anotherApiClie
 	require.NoError(t, err, "must reveal a secret successfully")
 	require.Equal(t, "SUPER", revealSecretResponse.Value, "no revealed secret is expected")
 
+	// an overwrite keeps the previous value as a version to roll back to
+	_, err = apiClient.SetSecret(ctx, client.SetSecretRequest{
+		RepoID: connectRepoRes.Repo.TreenqID,
+		Key:    "SECRET",
+		Value:  "DUPER",
+	})
+	require.NoError(t, err, "no error expect on overwriting a secret")
+	versions, err := apiClient.GetSecretVersions(ctx, client.GetSecretVersionsRequest{
+		RepoID: connectRepoRes.Repo.TreenqID,
+		Key:    "SECRET",
+	})
+	require.NoError(t, err, "no error expected on getting secret versions")
+	require.Len(t, versions.Versions, 2, "both secret values must be kept")
+	require.Equal(t, 2, versions.Versions[0].Version, "the latest version goes first")
+	require.Equal(t, 1, versions.Versions[1].Version)
+	require.Equal(t, "testing", versions.Versions[0].AuthorName, "a version must keep its author")
+
+	_, err = apiClient.RollbackSecret(ctx, client.RollbackSecretRequest{
+		RepoID:  connectRepoRes.Repo.TreenqID,
+		Key:     "SECRET",
+		Version: 99,
+	})
+	require.Equal(t, &client.Error{Code: "SECRET_VERSION_NOT_FOUND"}, err)
+
+	rollback, err := apiClient.RollbackSecret(ctx, client.RollbackSecretRequest{
+		RepoID:  connectRepoRes.Repo.TreenqID,
+		Key:     "SECRET",
+		Version: 1,
+	})
+	require.NoError(t, err, "no error expected on secret rollback")
+	require.Equal(t, 3, rollback.Version.Version, "a rollback creates a new version")
+	require.Equal(t, 1, rollback.Version.FromVersion)
+	revealSecretResponse, err = apiClient.RevealSecret(ctx, client.RevealSecretRequest{
+		RepoID: connectRepoRes.Repo.TreenqID,
+		Key:    "SECRET",
+	})
+	require.NoError(t, err, "must reveal a secret successfully")
+	require.Equal(t, "SUPER", revealSecretResponse.Value, "the rolled back value is expected")
+
 	revealSecretResponse, err = apiClient.RevealSecret(ctx, client.RevealSecretRequest{
 		RepoID: connectRepoRes.Repo.TreenqID,
 		Key:    "SECRET2",
@@ -464,7 +554,7 @@ func testSecretsApi(t *testing.T, ctx context.Context, apiClient, anotherApiClie
 	require.Equal(t, err, &client.Error{Code: "SECRET_DOESNT_EXIST"})
 	require.Empty(t, revealSecretResponse.Value, "no revealed secret is expected")
 
-	err = apiClient.RemoveSecret(ctx, client.RemoveSecretRequest{
+	_, err = apiClient.RemoveSecret(ctx, client.RemoveSecretRequest{
 		RepoID: connectRepoRes.Repo.TreenqID,
 		Key:    "SECRET",
 	})
@@ -481,6 +571,119 @@ func testSecretsApi(t *testing.T, ctx context.Context, apiClient, anotherApiClie
 	})
 	require.Equal(t, err, &client.Error{Code: "SECRET_DOESNT_EXIST"})
 	require.Empty(t, revealSecretResponse.Value, "no revealed secret is expected")
+
+	// the attached secret groups go to the app env, a repo secret overrides a group one
+	group, err := apiClient.CreateSecretGroup(ctx, client.CreateSecretGroupRequest{Name: "shared"})
+	require.NoError(t, err, "secret group must be created")
+	require.NoError(t, apiClient.SetGroupSecret(ctx, client.SetGroupSecretRequest{GroupID: group.Group.ID, Key: "SENTRY_DSN", Value: "https://sentry"}))
+	require.NoError(t, apiClient.SetGroupSecret(ctx, client.SetGroupSecretRequest{GroupID: group.Group.ID, Key: "DB_URL", Value: "postgres://shared"}))
+	_, err = apiClient.SetSecret(ctx, client.SetSecretRequest{RepoID: connectRepoRes.Repo.TreenqID, Key: "DB_URL", Value: "postgres://own"})
+	require.NoError(t, err)
+	err = apiClient.AttachSecretGroup(ctx, client.SecretGroupAttachmentRequest{RepoID: connectRepoRes.Repo.TreenqID, GroupID: group.Group.ID})
+	require.NoError(t, err, "secret group must be attached")
+
+	appEnv, err := apiClient.GetAppEnv(ctx, client.GetAppEnvRequest{RepoID: connectRepoRes.Repo.TreenqID})
+	require.NoError(t, err, "app env must be given")
+	require.Len(t, appEnv.Groups, 1)
+	assert.Equal(t, group.Group.ID, appEnv.Groups[0].ID)
+	var secretEnvs []client.EnvSource
+	for _, env := range appEnv.Envs {
+		if env.Source != "runtimeEnv" {
+			secretEnvs = append(secretEnvs, env)
+		}
+	}
+	assert.Equal(t, []client.EnvSource{
+		{Name: "DB_URL", Source: "secretGroup", Key: "DB_URL", GroupID: group.Group.ID, Group: "shared", Overridden: true},
+		{Name: "SENTRY_DSN", Source: "secretGroup", Key: "SENTRY_DSN", GroupID: group.Group.ID, Group: "shared"},
+		{Name: "DB_URL", Source: "secret", Key: "DB_URL"},
+	}, secretEnvs)
+
+	err = apiClient.DetachSecretGroup(ctx, client.SecretGroupAttachmentRequest{RepoID: connectRepoRes.Repo.TreenqID, GroupID: group.Group.ID})
+	require.NoError(t, err, "secret group must be detached")
+	err = apiClient.DetachSecretGroup(ctx, client.SecretGroupAttachmentRequest{RepoID: connectRepoRes.Repo.TreenqID, GroupID: group.Group.ID})
+	require.Equal(t, &client.Error{Code: "SECRET_GROUP_NOT_FOUND"}, err)
+	_, err = apiClient.RemoveSecret(ctx, client.RemoveSecretRequest{RepoID: connectRepoRes.Repo.TreenqID, Key: "DB_URL"})
+	require.NoError(t, err)
+
+	// bulk import previews and upserts many secrets, the export gives them back in the same format
+	_, err = apiClient.ImportSecrets(ctx, client.ImportSecretsRequest{RepoID: connectRepoRes.Repo.TreenqID, Content: "A=1\nINVALID"})
+	require.Equal(t, &client.Error{Code: "INVALID_SECRETS_FILE", Message: "line 2: expected KEY=VALUE"}, err)
+	_, err = apiClient.ImportSecrets(ctx, client.ImportSecretsRequest{RepoID: connectRepoRes.Repo.TreenqID, Content: "1A=1"})
+	require.Equal(t, &client.Error{Code: "INVALID_SECRET_KEY", Message: "1A"}, err)
+	_, err = apiClient.ImportSecrets(ctx, client.ImportSecretsRequest{RepoID: connectRepoRes.Repo.TreenqID, Format: "yaml", Content: "A: 1"})
+	require.Equal(t, &client.Error{Code: "UNKNOWN_SECRETS_FORMAT"}, err)
+
+	_, err = apiClient.SetSecret(ctx, client.SetSecretRequest{RepoID: connectRepoRes.Repo.TreenqID, Key: "KEEP", Value: "same"})
+	require.NoError(t, err)
+	_, err = apiClient.SetSecret(ctx, client.SetSecretRequest{RepoID: connectRepoRes.Repo.TreenqID, Key: "CHANGE", Value: "old"})
+	require.NoError(t, err)
+	dotenvContent := "# from heroku\nKEEP=same\nCHANGE=new\nexport ADDED=\"multi\\nline\"\n"
+	preview, err := apiClient.ImportSecrets(ctx, client.ImportSecretsRequest{RepoID: connectRepoRes.Repo.TreenqID, Content: dotenvContent, DryRun: true})
+	require.NoError(t, err, "dry run must succeed")
+	assert.Equal(t, client.ImportSecretsResponse{Added: []string{"ADDED"}, Changed: []string{"CHANGE"}, Unchanged: []string{"KEEP"}}, preview)
+	revealSecretResponse, err = apiClient.RevealSecret(ctx, client.RevealSecretRequest{RepoID: connectRepoRes.Repo.TreenqID, Key: "CHANGE"})
+	require.NoError(t, err)
+	require.Equal(t, "old", revealSecretResponse.Value, "a dry run must change nothing")
+
+	imported, err := apiClient.ImportSecrets(ctx, client.ImportSecretsRequest{RepoID: connectRepoRes.Repo.TreenqID, Content: dotenvContent})
+	require.NoError(t, err, "import must succeed")
+	assert.Equal(t, preview, imported)
+	revealSecretResponse, err = apiClient.RevealSecret(ctx, client.RevealSecretRequest{RepoID: connectRepoRes.Repo.TreenqID, Key: "ADDED"})
+	require.NoError(t, err)
+	require.Equal(t, "multi\nline", revealSecretResponse.Value)
+
+	imported, err = apiClient.ImportSecrets(ctx, client.ImportSecretsRequest{RepoID: connectRepoRes.Repo.TreenqID, Format: "json", Content: `{"KEEP": "same", "JSON": "value"}`})
+	require.NoError(t, err, "json import must succeed")
+	assert.Equal(t, client.ImportSecretsResponse{Added: []string{"JSON"}, Changed: []string{}, Unchanged: []string{"KEEP"}}, imported)
+
+	exported, err := apiClient.ExportSecrets(ctx, client.ExportSecretsRequest{RepoID: connectRepoRes.Repo.TreenqID})
+	require.NoError(t, err, "export must succeed")
+	assert.Equal(t, "ADDED=\"multi\\nline\"\nCHANGE=new\nJSON=value\nKEEP=same\n", exported.Content)
+	exported, err = apiClient.ExportSecrets(ctx, client.ExportSecretsRequest{RepoID: connectRepoRes.Repo.TreenqID, Format: "json"})
+	require.NoError(t, err, "json export must succeed")
+	assert.JSONEq(t, `{"ADDED": "multi\nline", "CHANGE": "new", "JSON": "value", "KEEP": "same"}`, exported.Content)
+
+	for _, key := range []string{"ADDED", "CHANGE", "JSON", "KEEP"} {
+		_, err = apiClient.RemoveSecret(ctx, client.RemoveSecretRequest{RepoID: connectRepoRes.Repo.TreenqID, Key: key})
+		require.NoError(t, err)
+	}
+}
+
+// testSecretRestart checks a secret change restarts the deployed app from its last deployment
+func testSecretRestart(t *testing.T, ctx context.Context, apiClient *client.Client, userToken, repoID, lastDeploymentID string) {
+	changed, err := apiClient.SetSecret(ctx, client.SetSecretRequest{RepoID: repoID, Key: "RESTART", Value: "1"})
+	require.NoError(t, err)
+	assert.Empty(t, changed.Deployment.ID, "the app must not be restarted with the restart disabled")
+
+	err = apiClient.SetRepoSecretRestart(ctx, client.SetRepoSecretRestartRequest{RepoID: repoID, Restart: true})
+	require.NoError(t, err, "secret restart must be enabled")
+
+	changed, err = apiClient.SetSecret(ctx, client.SetSecretRequest{RepoID: repoID, Key: "RESTART", Value: "2"})
+	require.NoError(t, err)
+	require.NotEmpty(t, changed.Deployment.ID, "a changed secret must restart the app")
+	assert.Equal(t, lastDeploymentID, changed.Deployment.FromDeploymentID, "the restart must reapply the last deployment")
+	assert.Equal(t, "run", changed.Deployment.Status)
+	readProgress(t, ctx, client.GetDeploymentResponse{Deployment: changed.Deployment}, apiClient, userToken)
+	validateDeployedServiceResponse(t, repoID+".localhost", "Hello, main\n", 200)
+
+	removed, err := apiClient.RemoveSecret(ctx, client.RemoveSecretRequest{RepoID: repoID, Key: "RESTART"})
+	require.NoError(t, err)
+	require.NotEmpty(t, removed.Deployment.ID, "a removed secret must restart the app")
+	assert.Equal(t, changed.Deployment.ID, removed.Deployment.FromDeploymentID, "the restart must reapply the last restart")
+	readProgress(t, ctx, client.GetDeploymentResponse{Deployment: removed.Deployment}, apiClient, userToken)
+
+	err = apiClient.SetRepoProtection(ctx, client.SetRepoProtectionRequest{RepoID: repoID, Protected: true})
+	require.NoError(t, err)
+	changed, err = apiClient.SetSecret(ctx, client.SetSecretRequest{RepoID: repoID, Key: "RESTART", Value: "3"})
+	require.NoError(t, err)
+	assert.Equal(t, "awaiting_approval", changed.Deployment.Status, "a restart of a protected repo must await an approval")
+	err = apiClient.SetRepoProtection(ctx, client.SetRepoProtectionRequest{RepoID: repoID, Protected: false})
+	require.NoError(t, err)
+	err = apiClient.SetRepoSecretRestart(ctx, client.SetRepoSecretRestartRequest{RepoID: repoID, Restart: false})
+	require.NoError(t, err, "secret restart must be disabled")
+	removed, err = apiClient.RemoveSecret(ctx, client.RemoveSecretRequest{RepoID: repoID, Key: "RESTART"})
+	require.NoError(t, err)
+	assert.Empty(t, removed.Deployment.ID)
 }
 
 func readProgress(t *testing.T, ctx context.Context, createdDeployment client.GetDeploymentResponse, apiClient *client.Client, userToken string) {
@@ -504,9 +707,14 @@ func readProgress(t *testing.T, ctx context.Context, createdDeployment client.Ge
 		defer resp.Body.Close()
 		scanner := bufio.NewScanner(resp.Body)
 		hasFinalMessage := false
+		var ids []string
 		for scanner.Scan() {
 			line := scanner.Text()
-			if line == "" {
+			if line == "" || strings.HasPrefix(line, ":") {
+				continue
+			}
+			if id, ok := strings.CutPrefix(line, "id: "); ok {
+				ids = append(ids, id)
 				continue
 			}
 
@@ -514,6 +722,8 @@ func readProgress(t *testing.T, ctx context.Context, createdDeployment client.Ge
 			line = strings.TrimPrefix(line, "data: ")
 			err = json.Unmarshal([]byte(line), &progressMessage)
 			require.NoError(t, err)
+			require.NotEmpty(t, ids, "a progress message must have an event id")
+			assert.Equal(t, ids[len(ids)-1], strconv.FormatInt(progressMessage.Message.ID, 10))
 
 			hasFinalMessage = progressMessage.Message.Final
 			if hasFinalMessage {
@@ -526,6 +736,24 @@ func readProgress(t *testing.T, ctx context.Context, createdDeployment client.Ge
 		}
 
 		assert.True(t, hasFinalMessage, "progress build must have a final message")
+		require.Greater(t, len(ids), 1)
+
+		// a reconnected client gets the messages after the last event id only
+		req, err = http.NewRequest("GET", "http://localhost:8000/getBuildProgress?deploymentID="+createdDeployment.Deployment.ID, nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+userToken)
+		req.Header.Set("Last-Event-ID", ids[len(ids)-2])
+		resumed, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resumed.Body.Close()
+		var resumedIDs []string
+		scanner = bufio.NewScanner(resumed.Body)
+		for scanner.Scan() {
+			if id, ok := strings.CutPrefix(scanner.Text(), "id: "); ok {
+				resumedIDs = append(resumedIDs, id)
+			}
+		}
+		assert.Equal(t, ids[len(ids)-1:], resumedIDs, "the stream must be resumed after the last event id")
 		progressRead = true
 		break
 	}
@@ -533,6 +761,84 @@ func readProgress(t *testing.T, ctx context.Context, createdDeployment client.Ge
 	require.True(t, progressRead, "progress must be read")
 }
 
+// testRequiredApprover promotes a deployment to an environment having a required approver,
+// the promotion awaits the approval of that user only
+func testRequiredApprover(t *testing.T, ctx context.Context, apiClient *client.Client, owner client.UserInfo, repoID, deploymentID string) {
+	approver := client.UserInfo{ID: xid.New().String(), Email: "approver@mail.com", DisplayName: "approver"}
+	_, err := addWorkspaceMember(owner.ID, approver, "admin")
+	require.NoError(t, err, "approver must be added")
+	developer := client.UserInfo{ID: xid.New().String(), Email: "developer@mail.com", DisplayName: "developer"}
+	_, err = addWorkspaceMember(owner.ID, developer, "developer")
+	require.NoError(t, err, "developer must be added")
+
+	var e *client.Error
+	_, err = apiClient.CreateEnvironment(ctx, client.CreateEnvironmentRequest{RepoID: repoID, Name: "approved", RequiredApprover: approver.DisplayName})
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "INVALID_REQUIRED_APPROVER", e.Code, "the required approver is a user id")
+	_, err = apiClient.CreateEnvironment(ctx, client.CreateEnvironmentRequest{RepoID: repoID, Name: "approved", RequiredApprover: developer.ID})
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "INVALID_REQUIRED_APPROVER", e.Code, "the required approver must be able to approve")
+	_, err = apiClient.CreateEnvironment(ctx, client.CreateEnvironmentRequest{RepoID: repoID, Name: "approved", RequiredApprover: approver.ID})
+	require.NoError(t, err, "an environment having a required approver must be created")
+
+	promoted, err := apiClient.PromoteDeployment(ctx, client.PromoteDeploymentRequest{DeploymentID: deploymentID, Environment: "approved"})
+	require.NoError(t, err, "a promotion must be created")
+	assert.Equal(t, "awaiting_approval", promoted.Deployment.Status, "a promotion must await the required approver")
+	assert.Equal(t, owner.ID, promoted.Deployment.UserID)
+
+	_, err = apiClient.ApproveDeployment(ctx, client.ApproveDeploymentRequest{DeploymentID: promoted.Deployment.ID})
+	require.Equal(t, &client.Error{Code: "APPROVER_REQUIRED"}, err, "only the required approver approves the promotion")
+
+	_, err = db.Exec("DELETE FROM deployments WHERE id = $1", promoted.Deployment.ID)
+	require.NoError(t, err)
+	_, err = db.Exec("DELETE FROM environments WHERE repoId = $1 AND name = 'approved'", repoID)
+	require.NoError(t, err)
+}
+
+func testBuildLogs(t *testing.T, ctx context.Context, apiClient, anotherApiClient *client.Client, userToken string, deployment client.AppDeployment) {
+	_, err := apiClient.SearchBuildLogs(ctx, client.SearchBuildLogsRequest{Query: " "})
+	require.Equal(t, &client.Error{Code: "EMPTY_QUERY"}, err)
+
+	found, err := apiClient.SearchBuildLogs(ctx, client.SearchBuildLogsRequest{
+		Query:        "cloned github repository",
+		DeploymentID: deployment.ID,
+	})
+	require.NoError(t, err, "build logs must be searched")
+	require.NotEmpty(t, found.Logs, "the build logs must be persisted")
+	for _, log := range found.Logs {
+		assert.Equal(t, deployment.RepoID, log.RepoID)
+		assert.Equal(t, deployment.ID, log.DeploymentID)
+		assert.Contains(t, log.Payload, "cloned")
+	}
+	assert.Empty(t, found.NextCursor)
+
+	paged, err := apiClient.SearchBuildLogs(ctx, client.SearchBuildLogsRequest{Query: "image", RepoID: deployment.RepoID, Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, paged.Logs, 1)
+	require.NotEmpty(t, paged.NextCursor, "a full page must give the next cursor")
+	next, err := apiClient.SearchBuildLogs(ctx, client.SearchBuildLogsRequest{Query: "image", RepoID: deployment.RepoID, Limit: 1, Cursor: paged.NextCursor})
+	require.NoError(t, err)
+	require.Len(t, next.Logs, 1)
+	assert.Less(t, next.Logs[0].ID, paged.Logs[0].ID, "the latest logs come first")
+
+	another, err := anotherApiClient.SearchBuildLogs(ctx, client.SearchBuildLogsRequest{Query: "cloned github repository"})
+	require.NoError(t, err)
+	assert.Empty(t, another.Logs, "another workspace must not see the build logs")
+
+	req, err := http.NewRequest(http.MethodGet, "http://localhost:8000/downloadBuildLogs?deploymentID="+deployment.ID, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+userToken)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/plain; charset=utf-8", resp.Header.Get("Content-Type"))
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), " INFO cloned github repository\n")
+	assert.Contains(t, string(body), " INFO applied new image\n")
+}
+
 type serviceValidateRequest struct {
 	req          client.DeployRequest
 	expectedBody string
@@ -0,0 +1,144 @@
+package e2e
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/treenq/treenq/client"
+)
+
+func TestWorkspaceMembers(t *testing.T) {
+	clearDatabase()
+
+	owner := client.UserInfo{ID: xid.New().String(), Email: "owner@mail.com", DisplayName: "owner"}
+	ownerToken, err := createUser(owner)
+	require.NoError(t, err, "owner must be created")
+	ownerClient := client.NewClient("http://localhost:8000", http.DefaultClient, map[string]string{
+		"Authorization": "Bearer " + ownerToken,
+	})
+
+	invitee := client.UserInfo{ID: xid.New().String(), Email: "invitee@mail.com", DisplayName: "invitee"}
+	inviteeToken, err := createUser(invitee)
+	require.NoError(t, err, "invitee must be created")
+	inviteeClient := client.NewClient("http://localhost:8000", http.DefaultClient, map[string]string{
+		"Authorization": "Bearer " + inviteeToken,
+	})
+
+	stranger := client.UserInfo{ID: xid.New().String(), Email: "stranger@mail.com", DisplayName: "stranger"}
+	strangerToken, err := createUser(stranger)
+	require.NoError(t, err, "stranger must be created")
+	strangerClient := client.NewClient("http://localhost:8000", http.DefaultClient, map[string]string{
+		"Authorization": "Bearer " + strangerToken,
+	})
+
+	ctx := context.Background()
+	var e *client.Error
+
+	_, err = ownerClient.InviteMember(ctx, client.InviteMemberRequest{Email: invitee.Email, GithubLogin: invitee.DisplayName, Role: "developer"})
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "INVALID_INVITEE", e.Code)
+	_, err = ownerClient.InviteMember(ctx, client.InviteMemberRequest{Email: invitee.Email, Role: "superuser"})
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "INVALID_ROLE", e.Code)
+
+	invite, err := ownerClient.InviteMember(ctx, client.InviteMemberRequest{Email: "INVITEE@mail.com", Role: "developer"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, invite.Token)
+	assert.Equal(t, "developer", invite.Invitation.Role)
+	assert.Equal(t, owner.ID, invite.Invitation.InvitedBy)
+
+	members, err := ownerClient.GetMembers(ctx)
+	require.NoError(t, err)
+	require.Len(t, members.Members, 1)
+	assert.Equal(t, "owner", members.Members[0].Role)
+	require.Len(t, members.Invitations, 1)
+	assert.Equal(t, invite.Invitation.ID, members.Invitations[0].ID)
+
+	// only the invitee may accept the invitation
+	_, err = strangerClient.AcceptInvitation(ctx, client.AcceptInvitationRequest{Token: invite.Token})
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "INVITATION_FOR_ANOTHER_USER", e.Code)
+	_, err = inviteeClient.AcceptInvitation(ctx, client.AcceptInvitationRequest{Token: invite.Token + "x"})
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "INVALID_INVITATION_TOKEN", e.Code)
+
+	accepted, err := inviteeClient.AcceptInvitation(ctx, client.AcceptInvitationRequest{Token: invite.Token})
+	require.NoError(t, err)
+	assert.Equal(t, owner.ID, accepted.Workspace.ID)
+	assert.Equal(t, "developer", accepted.Workspace.Role)
+	require.NotEmpty(t, accepted.Token)
+
+	_, err = inviteeClient.AcceptInvitation(ctx, client.AcceptInvitationRequest{Token: invite.Token})
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "INVITATION_ALREADY_ACCEPTED", e.Code)
+
+	// the reissued token has both workspaces of the invitee
+	memberClient := client.NewClient("http://localhost:8000", http.DefaultClient, map[string]string{
+		"Authorization": "Bearer " + accepted.Token,
+		"t-workspace":   owner.ID,
+	})
+	profile, err := memberClient.GetProfile(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, owner.ID, profile.UserInfo.CurrentWorkspace)
+	assert.ElementsMatch(t, []string{owner.ID, invitee.ID}, profile.UserInfo.Workspaces)
+
+	members, err = memberClient.GetMembers(ctx)
+	require.NoError(t, err)
+	require.Len(t, members.Members, 2)
+	assert.Equal(t, invitee.ID, members.Members[1].UserID)
+	assert.Equal(t, "developer", members.Members[1].Role)
+	assert.Empty(t, members.Invitations)
+
+	// a developer can't manage the members
+	_, err = memberClient.InviteMember(ctx, client.InviteMemberRequest{Email: stranger.Email, Role: "viewer"})
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "FORBIDDEN", e.Code)
+
+	err = ownerClient.UpdateMemberRole(ctx, client.UpdateMemberRoleRequest{UserID: invitee.ID, Role: "admin"})
+	require.NoError(t, err)
+
+	// an admin manages the members, but not the owners
+	_, err = memberClient.InviteMember(ctx, client.InviteMemberRequest{GithubLogin: stranger.DisplayName, Role: "owner"})
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "ROLE_NOT_ALLOWED", e.Code)
+	err = memberClient.UpdateMemberRole(ctx, client.UpdateMemberRoleRequest{UserID: owner.ID, Role: "viewer"})
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "ROLE_NOT_ALLOWED", e.Code)
+	err = memberClient.RemoveMember(ctx, client.RemoveMemberRequest{UserID: owner.ID})
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "ROLE_NOT_ALLOWED", e.Code)
+	githubInvite, err := memberClient.InviteMember(ctx, client.InviteMemberRequest{GithubLogin: stranger.DisplayName, Role: "viewer"})
+	require.NoError(t, err)
+
+	// a display name is not a github login, the invitation needs a github identity
+	_, err = strangerClient.AcceptInvitation(ctx, client.AcceptInvitationRequest{Token: githubInvite.Token})
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "INVITATION_FOR_ANOTHER_USER", e.Code)
+
+	err = ownerClient.UpdateMemberRole(ctx, client.UpdateMemberRoleRequest{UserID: owner.ID, Role: "admin"})
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "LAST_OWNER", e.Code)
+	err = ownerClient.RemoveMember(ctx, client.RemoveMemberRequest{UserID: owner.ID})
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "LAST_OWNER", e.Code)
+	err = ownerClient.RemoveMember(ctx, client.RemoveMemberRequest{UserID: stranger.ID})
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "MEMBER_NOT_FOUND", e.Code)
+
+	_, err = db.Exec("INSERT INTO userIdentities (provider, subject, userId, login, createdAt) VALUES ('github', '1', $1, 'Stranger', now())", stranger.ID)
+	require.NoError(t, err)
+	_, err = strangerClient.AcceptInvitation(ctx, client.AcceptInvitationRequest{Token: githubInvite.Token})
+	require.NoError(t, err)
+
+	err = ownerClient.RemoveMember(ctx, client.RemoveMemberRequest{UserID: invitee.ID})
+	require.NoError(t, err)
+
+	// the removed member token still has the workspace, but the membership is gone
+	_, err = memberClient.GetMembers(ctx)
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "FORBIDDEN", e.Code)
+}
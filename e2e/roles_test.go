@@ -0,0 +1,194 @@
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/treenq/treenq/client"
+)
+
+func TestWorkspaceRoles(t *testing.T) {
+	clearDatabase()
+
+	owner := client.UserInfo{ID: xid.New().String(), Email: "owner@mail.com", DisplayName: "owner"}
+	ownerToken, err := createUser(owner)
+	require.NoError(t, err, "owner must be created")
+	workspaceID := owner.ID
+
+	tokens := map[string]string{"owner": ownerToken}
+	for _, role := range []string{"admin", "developer", "viewer"} {
+		member := client.UserInfo{ID: xid.New().String(), Email: role + "@mail.com", DisplayName: role}
+		token, err := addWorkspaceMember(workspaceID, member, role)
+		require.NoError(t, err, role+" must be added")
+		tokens[role] = token
+	}
+
+	repoID := xid.New().String()
+	testCases := []struct {
+		name string
+		call func(ctx context.Context, apiClient *client.Client) error
+		// allowedCode is returned to the roles having the permission,
+		// the calls are made invalid on purpose to fail right after the authorization
+		allowedCode string
+		allowed     []string
+	}{
+		{
+			name: "getSecrets",
+			call: func(ctx context.Context, apiClient *client.Client) error {
+				_, err := apiClient.GetSecrets(ctx, client.GetSecretsRequest{RepoID: repoID})
+				return err
+			},
+			allowed: []string{"owner", "admin", "developer", "viewer"},
+		},
+		{
+			name: "setSecret",
+			call: func(ctx context.Context, apiClient *client.Client) error {
+				_, err := apiClient.SetSecret(ctx, client.SetSecretRequest{RepoID: repoID, Key: "1_INVALID"})
+				return err
+			},
+			allowedCode: "INVALID_SECRET_KEY",
+			allowed:     []string{"owner", "admin", "developer"},
+		},
+		{
+			name: "promoteDeployment",
+			call: func(ctx context.Context, apiClient *client.Client) error {
+				_, err := apiClient.PromoteDeployment(ctx, client.PromoteDeploymentRequest{DeploymentID: xid.New().String()})
+				return err
+			},
+			allowedCode: "DEPLOYMENT_NOT_FOUND",
+			allowed:     []string{"owner", "admin", "developer"},
+		},
+		{
+			name: "revealSecret",
+			call: func(ctx context.Context, apiClient *client.Client) error {
+				_, err := apiClient.RevealSecret(ctx, client.RevealSecretRequest{RepoID: repoID, Key: "TOKEN"})
+				return err
+			},
+			allowedCode: "SECRET_DOESNT_EXIST",
+			allowed:     []string{"owner", "admin"},
+		},
+		{
+			name: "exportSecrets",
+			call: func(ctx context.Context, apiClient *client.Client) error {
+				_, err := apiClient.ExportSecrets(ctx, client.ExportSecretsRequest{RepoID: repoID, Format: "yaml"})
+				return err
+			},
+			allowedCode: "UNKNOWN_SECRETS_FORMAT",
+			allowed:     []string{"owner", "admin"},
+		},
+		{
+			name: "importSecrets",
+			call: func(ctx context.Context, apiClient *client.Client) error {
+				_, err := apiClient.ImportSecrets(ctx, client.ImportSecretsRequest{RepoID: repoID, Format: "yaml"})
+				return err
+			},
+			allowedCode: "UNKNOWN_SECRETS_FORMAT",
+			allowed:     []string{"owner", "admin", "developer"},
+		},
+		{
+			name: "approveDeployment",
+			call: func(ctx context.Context, apiClient *client.Client) error {
+				_, err := apiClient.ApproveDeployment(ctx, client.ApproveDeploymentRequest{DeploymentID: xid.New().String()})
+				return err
+			},
+			allowedCode: "DEPLOYMENT_NOT_FOUND",
+			allowed:     []string{"owner", "admin"},
+		},
+		{
+			name: "addCluster",
+			call: func(ctx context.Context, apiClient *client.Client) error {
+				_, err := apiClient.AddCluster(ctx, client.AddClusterRequest{})
+				return err
+			},
+			allowedCode: "INVALID_CLUSTER",
+			allowed:     []string{"owner", "admin"},
+		},
+		{
+			name: "createApiToken",
+			call: func(ctx context.Context, apiClient *client.Client) error {
+				_, err := apiClient.CreateApiToken(ctx, client.CreateApiTokenRequest{})
+				return err
+			},
+			allowedCode: "NAME_REQUIRED",
+			allowed:     []string{"owner", "admin", "developer"},
+		},
+		{
+			name: "revokeApiToken",
+			call: func(ctx context.Context, apiClient *client.Client) error {
+				return apiClient.RevokeApiToken(ctx, client.RevokeApiTokenRequest{ID: xid.New().String()})
+			},
+			allowedCode: "API_TOKEN_NOT_FOUND",
+			allowed:     []string{"owner", "admin", "developer"},
+		},
+	}
+
+	ctx := context.Background()
+	for _, tc := range testCases {
+		for role, token := range tokens {
+			t.Run(tc.name+"/"+role, func(t *testing.T) {
+				apiClient := client.NewClient("http://localhost:8000", http.DefaultClient, map[string]string{
+					"Authorization": "Bearer " + token,
+				})
+				err := tc.call(ctx, apiClient)
+
+				isAllowed := false
+				for _, allowedRole := range tc.allowed {
+					isAllowed = isAllowed || allowedRole == role
+				}
+				if isAllowed && tc.allowedCode == "" {
+					assert.NoError(t, err)
+					return
+				}
+
+				var e *client.Error
+				require.ErrorAs(t, err, &e)
+				if isAllowed {
+					assert.Equal(t, tc.allowedCode, e.Code)
+				} else {
+					assert.Equal(t, "FORBIDDEN", e.Code)
+				}
+			})
+		}
+	}
+}
+
+func TestNotWorkspaceMemberForbidden(t *testing.T) {
+	clearDatabase()
+
+	user := client.UserInfo{ID: xid.New().String(), Email: "test@mail.com", DisplayName: "testing"}
+	_, err := createUser(user)
+	require.NoError(t, err, "user must be created")
+
+	// the token claims a workspace the user isn't a member of
+	stranger := client.UserInfo{ID: xid.New().String(), Email: "stranger@mail.com", DisplayName: "stranger"}
+	strangerToken, err := createUser(stranger)
+	require.NoError(t, err, "stranger must be created")
+	_, err = db.Exec("DELETE FROM workspaceUsers WHERE userId = $1", stranger.ID)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	_, err = client.NewClient("http://localhost:8000", http.DefaultClient, map[string]string{
+		"Authorization": "Bearer " + strangerToken,
+	}).GetSecrets(ctx, client.GetSecretsRequest{RepoID: xid.New().String()})
+	var e *client.Error
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "FORBIDDEN", e.Code)
+
+	req, err := http.NewRequest("POST", "http://localhost:8000/getSecrets", strings.NewReader(`{"repoID":"`+xid.New().String()+`"}`))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+strangerToken)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"), "a forbidden call must get a json error")
+	var body client.Error
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, "FORBIDDEN", body.Code)
+}
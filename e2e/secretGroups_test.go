@@ -0,0 +1,77 @@
+package e2e
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/treenq/treenq/client"
+)
+
+func TestSecretGroups(t *testing.T) {
+	clearDatabase()
+
+	owner := client.UserInfo{ID: xid.New().String(), Email: "owner@mail.com", DisplayName: "owner"}
+	ownerToken, err := createUser(owner)
+	require.NoError(t, err, "owner must be created")
+	apiClient := client.NewClient("http://localhost:8000", http.DefaultClient, map[string]string{
+		"Authorization": "Bearer " + ownerToken,
+	})
+	viewer := client.UserInfo{ID: xid.New().String(), Email: "viewer@mail.com", DisplayName: "viewer"}
+	viewerToken, err := addWorkspaceMember(owner.ID, viewer, "viewer")
+	require.NoError(t, err, "viewer must be added")
+	viewerClient := client.NewClient("http://localhost:8000", http.DefaultClient, map[string]string{
+		"Authorization": "Bearer " + viewerToken,
+	})
+
+	ctx := context.Background()
+
+	_, err = apiClient.CreateSecretGroup(ctx, client.CreateSecretGroupRequest{Name: "1shared"})
+	require.Equal(t, &client.Error{Code: "INVALID_SECRET_GROUP_NAME"}, err)
+	created, err := apiClient.CreateSecretGroup(ctx, client.CreateSecretGroupRequest{Name: "shared"})
+	require.NoError(t, err, "secret group must be created")
+	assert.Equal(t, "shared", created.Group.Name)
+	assert.Empty(t, created.Group.Keys)
+	_, err = apiClient.CreateSecretGroup(ctx, client.CreateSecretGroupRequest{Name: "shared"})
+	require.Equal(t, &client.Error{Code: "SECRET_GROUP_ALREADY_EXISTS"}, err)
+
+	_, err = viewerClient.CreateSecretGroup(ctx, client.CreateSecretGroupRequest{Name: "viewer"})
+	var e *client.Error
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "FORBIDDEN", e.Code, "a viewer can't change the secret groups")
+
+	err = apiClient.SetGroupSecret(ctx, client.SetGroupSecretRequest{GroupID: created.Group.ID, Key: "SENTRY_DSN", Value: "https://sentry"})
+	require.NoError(t, err, "group secret must be set")
+	err = apiClient.SetGroupSecret(ctx, client.SetGroupSecretRequest{GroupID: created.Group.ID, Key: "DB_URL", Value: "postgres://db"})
+	require.NoError(t, err, "group secret must be set")
+	err = apiClient.SetGroupSecret(ctx, client.SetGroupSecretRequest{GroupID: created.Group.ID, Key: "DB_URL", Value: "postgres://another"})
+	require.NoError(t, err, "group secret must be replaced")
+	err = apiClient.SetGroupSecret(ctx, client.SetGroupSecretRequest{GroupID: xid.New().String(), Key: "DB_URL", Value: "postgres://db"})
+	require.Equal(t, &client.Error{Code: "SECRET_GROUP_NOT_FOUND"}, err)
+	err = apiClient.SetGroupSecret(ctx, client.SetGroupSecretRequest{GroupID: created.Group.ID, Key: "INVALID@KEY", Value: "value"})
+	require.Equal(t, &client.Error{Code: "INVALID_SECRET_KEY"}, err)
+
+	groups, err := viewerClient.GetSecretGroups(ctx)
+	require.NoError(t, err, "a viewer can see the secret groups")
+	require.Len(t, groups.Groups, 1)
+	assert.Equal(t, []string{"DB_URL", "SENTRY_DSN"}, groups.Groups[0].Keys, "only the keys are given")
+
+	err = apiClient.RemoveGroupSecret(ctx, client.RemoveGroupSecretRequest{GroupID: created.Group.ID, Key: "DB_URL"})
+	require.NoError(t, err, "group secret must be removed")
+	err = apiClient.RemoveGroupSecret(ctx, client.RemoveGroupSecretRequest{GroupID: created.Group.ID, Key: "DB_URL"})
+	require.Equal(t, &client.Error{Code: "SECRET_DOESNT_EXIST"}, err)
+
+	err = apiClient.AttachSecretGroup(ctx, client.SecretGroupAttachmentRequest{RepoID: xid.New().String(), GroupID: created.Group.ID})
+	require.ErrorAs(t, err, &e, "a group can't be attached to an unknown repo")
+
+	err = apiClient.RemoveSecretGroup(ctx, client.RemoveSecretGroupRequest{ID: created.Group.ID})
+	require.NoError(t, err, "secret group must be removed")
+	err = apiClient.RemoveSecretGroup(ctx, client.RemoveSecretGroupRequest{ID: created.Group.ID})
+	require.Equal(t, &client.Error{Code: "SECRET_GROUP_NOT_FOUND"}, err)
+	groups, err = apiClient.GetSecretGroups(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, groups.Groups)
+}
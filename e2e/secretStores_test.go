@@ -0,0 +1,89 @@
+package e2e
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/treenq/treenq/client"
+)
+
+func TestSecretStores(t *testing.T) {
+	clearDatabase()
+
+	owner := client.UserInfo{ID: xid.New().String(), Email: "owner@mail.com", DisplayName: "owner"}
+	ownerToken, err := createUser(owner)
+	require.NoError(t, err, "owner must be created")
+	apiClient := client.NewClient("http://localhost:8000", http.DefaultClient, map[string]string{
+		"Authorization": "Bearer " + ownerToken,
+	})
+	viewer := client.UserInfo{ID: xid.New().String(), Email: "viewer@mail.com", DisplayName: "viewer"}
+	viewerToken, err := addWorkspaceMember(owner.ID, viewer, "viewer")
+	require.NoError(t, err, "viewer must be added")
+	viewerClient := client.NewClient("http://localhost:8000", http.DefaultClient, map[string]string{
+		"Authorization": "Bearer " + viewerToken,
+	})
+
+	ctx := context.Background()
+
+	store, err := viewerClient.GetSecretStore(ctx)
+	require.NoError(t, err, "a viewer can see the secret store")
+	assert.Equal(t, client.WorkspaceSecretStore{Kind: "kubernetes"}, store.Store, "kubernetes is the default store")
+
+	_, err = apiClient.SetSecretStore(ctx, client.SetSecretStoreRequest{Kind: "etcd"})
+	require.Equal(t, &client.Error{Code: "UNKNOWN_SECRET_STORE"}, err)
+	_, err = apiClient.SetSecretStore(ctx, client.SetSecretStoreRequest{Kind: "vault", VaultAddress: "vault.example.com", VaultRole: "treenq-apps", VaultToken: "s.token"})
+	require.Equal(t, &client.Error{Code: "INVALID_SECRET_STORE"}, err, "the vault address must be an url")
+	_, err = apiClient.SetSecretStore(ctx, client.SetSecretStoreRequest{Kind: "vault", VaultAddress: "https://vault.example.com", VaultToken: "s.token"})
+	require.Equal(t, &client.Error{Code: "INVALID_SECRET_STORE"}, err, "the vault role is required")
+	_, err = apiClient.SetSecretStore(ctx, client.SetSecretStoreRequest{Kind: "vault", VaultAddress: "https://vault.example.com", VaultRole: "treenq-apps"})
+	require.Equal(t, &client.Error{Code: "INVALID_SECRET_STORE"}, err, "the vault token is required on the first set")
+
+	_, err = viewerClient.SetSecretStore(ctx, client.SetSecretStoreRequest{Kind: "kubernetes"})
+	var e *client.Error
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "FORBIDDEN", e.Code, "a viewer can't change the secret store")
+
+	set, err := apiClient.SetSecretStore(ctx, client.SetSecretStoreRequest{
+		Kind:            "vault",
+		VaultAddress:    "https://vault.example.com",
+		VaultMount:      "kv",
+		VaultPathPrefix: "treenq",
+		VaultRole:       "treenq-apps",
+		VaultToken:      "s.token",
+	})
+	require.NoError(t, err, "vault store must be set")
+	assert.Equal(t, "vault", set.Store.Kind)
+	assert.NotEmpty(t, set.Store.UpdatedAt)
+
+	store, err = apiClient.GetSecretStore(ctx)
+	require.NoError(t, err)
+	store.Store.UpdatedAt = time.Time{}
+	assert.Equal(t, client.WorkspaceSecretStore{
+		Kind:            "vault",
+		VaultAddress:    "https://vault.example.com",
+		VaultMount:      "kv",
+		VaultPathPrefix: "treenq",
+		VaultRole:       "treenq-apps",
+	}, store.Store, "the vault token is never given back")
+
+	_, err = apiClient.SetSecretStore(ctx, client.SetSecretStoreRequest{Kind: "vault", VaultAddress: "https://vault.internal:8200", VaultRole: "treenq-apps"})
+	require.Equal(t, &client.Error{Code: "INVALID_SECRET_STORE"}, err, "another vault address requires a new token")
+	_, err = apiClient.SetSecretStore(ctx, client.SetSecretStoreRequest{Kind: "vault", VaultAddress: "https://vault.example.com", VaultRole: "treenq-apps-v2"})
+	require.NoError(t, err, "the vault token is kept once it's omitted for the same address")
+	_, err = apiClient.SetSecretStore(ctx, client.SetSecretStoreRequest{Kind: "vault", VaultAddress: "https://vault.internal:8200", VaultRole: "treenq-apps", VaultToken: "s.internal"})
+	require.NoError(t, err, "another vault address is set with its token")
+	var token []byte
+	require.NoError(t, db.Get(&token, "SELECT vaultToken FROM workspaceSecretStores"))
+	assert.NotEmpty(t, token)
+	assert.NotContains(t, string(token), "s.internal", "the vault token must be encrypted")
+
+	set, err = apiClient.SetSecretStore(ctx, client.SetSecretStoreRequest{Kind: "kubernetes"})
+	require.NoError(t, err, "kubernetes store must be set back")
+	assert.Equal(t, "kubernetes", set.Store.Kind)
+	assert.Empty(t, set.Store.VaultAddress)
+}
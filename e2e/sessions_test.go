@@ -0,0 +1,110 @@
+package e2e
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/treenq/treenq/client"
+)
+
+func TestSessions(t *testing.T) {
+	clearDatabase()
+
+	user := client.UserInfo{ID: xid.New().String(), Email: "test@mail.com", DisplayName: "testing"}
+	userToken, err := createUser(user)
+	require.NoError(t, err, "user must be created")
+	apiClient := client.NewClient("http://localhost:8000", http.DefaultClient, map[string]string{
+		"Authorization": "Bearer " + userToken,
+	})
+
+	ctx := context.Background()
+	var e *client.Error
+
+	// another login of the same user
+	refreshToken := xid.New().String()
+	sessionID, err := startSession(user.ID, refreshToken)
+	require.NoError(t, err, "session must be started")
+
+	sessions, err := apiClient.GetSessions(ctx)
+	require.NoError(t, err)
+	require.Len(t, sessions.Sessions, 2)
+	assert.Equal(t, sessionID, sessions.Sessions[0].ID)
+	assert.False(t, sessions.Sessions[0].Current)
+	assert.True(t, sessions.Sessions[1].Current)
+
+	_, err = apiClient.RefreshToken(ctx, client.RefreshTokenRequest{RefreshToken: "unknown"})
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "INVALID_REFRESH_TOKEN", e.Code)
+
+	refreshed, err := apiClient.RefreshToken(ctx, client.RefreshTokenRequest{RefreshToken: refreshToken})
+	require.NoError(t, err)
+	require.NotEmpty(t, refreshed.Token)
+	require.NotEqual(t, refreshToken, refreshed.RefreshToken)
+	sessionClient := client.NewClient("http://localhost:8000", http.DefaultClient, map[string]string{
+		"Authorization": "Bearer " + refreshed.Token,
+	})
+	profile, err := sessionClient.GetProfile(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, profile.UserInfo.ID)
+
+	// the rotated refresh token prolongs the session again
+	_, err = sessionClient.RefreshToken(ctx, client.RefreshTokenRequest{RefreshToken: refreshed.RefreshToken})
+	require.NoError(t, err)
+
+	err = apiClient.RevokeSession(ctx, client.RevokeSessionRequest{SessionID: sessionID})
+	require.NoError(t, err)
+	err = apiClient.RevokeSession(ctx, client.RevokeSessionRequest{SessionID: sessionID})
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "SESSION_NOT_FOUND", e.Code)
+
+	// the access tokens of a revoked session are rejected before they expire
+	_, err = sessionClient.GetProfile(ctx)
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "UNAUTHORIZED", e.Code)
+
+	_, err = apiClient.GetProfile(ctx)
+	require.NoError(t, err)
+	err = apiClient.RevokeAllSessions(ctx)
+	require.NoError(t, err)
+	_, err = apiClient.GetProfile(ctx)
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "UNAUTHORIZED", e.Code)
+}
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	clearDatabase()
+
+	user := client.UserInfo{ID: xid.New().String(), Email: "test@mail.com", DisplayName: "testing"}
+	_, err := createUser(user)
+	require.NoError(t, err, "user must be created")
+	refreshToken := xid.New().String()
+	_, err = startSession(user.ID, refreshToken)
+	require.NoError(t, err, "session must be started")
+
+	ctx := context.Background()
+	apiClient := client.NewClient("http://localhost:8000", http.DefaultClient, nil)
+	var e *client.Error
+
+	refreshed, err := apiClient.RefreshToken(ctx, client.RefreshTokenRequest{RefreshToken: refreshToken})
+	require.NoError(t, err)
+	refreshed, err = apiClient.RefreshToken(ctx, client.RefreshTokenRequest{RefreshToken: refreshed.RefreshToken})
+	require.NoError(t, err)
+
+	// any rotated refresh token given again means it's leaked, the whole session is revoked
+	_, err = apiClient.RefreshToken(ctx, client.RefreshTokenRequest{RefreshToken: refreshToken})
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "REFRESH_TOKEN_REUSED", e.Code)
+
+	_, err = apiClient.RefreshToken(ctx, client.RefreshTokenRequest{RefreshToken: refreshed.RefreshToken})
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "INVALID_REFRESH_TOKEN", e.Code)
+	_, err = client.NewClient("http://localhost:8000", http.DefaultClient, map[string]string{
+		"Authorization": "Bearer " + refreshed.Token,
+	}).GetProfile(ctx)
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "UNAUTHORIZED", e.Code)
+}
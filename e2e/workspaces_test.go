@@ -0,0 +1,96 @@
+package e2e
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/treenq/treenq/client"
+)
+
+func TestWorkspaces(t *testing.T) {
+	clearDatabase()
+
+	user := client.UserInfo{ID: xid.New().String(), Email: "test@mail.com", DisplayName: "testing"}
+	userToken, err := createUser(user)
+	require.NoError(t, err, "user must be created")
+	apiClient := client.NewClient("http://localhost:8000", http.DefaultClient, map[string]string{
+		"Authorization": "Bearer " + userToken,
+	})
+
+	ctx := context.Background()
+	var e *client.Error
+
+	_, err = apiClient.CreateWorkspace(ctx, client.WorkspaceRequest{Name: "Client A"})
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "INVALID_WORKSPACE_NAME", e.Code)
+	_, err = apiClient.CreateWorkspace(ctx, client.WorkspaceRequest{Name: "default"})
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "INVALID_WORKSPACE_NAME", e.Code)
+
+	created, err := apiClient.CreateWorkspace(ctx, client.WorkspaceRequest{Name: "client-a"})
+	require.NoError(t, err)
+	assert.Equal(t, "client-a", created.Workspace.Name)
+	assert.Equal(t, "owner", created.Workspace.Role)
+	assert.False(t, created.Workspace.Personal)
+
+	// the old token doesn't know the new workspace, but the list comes from the database
+	workspaces, err := apiClient.GetWorkspaces(ctx)
+	require.NoError(t, err)
+	require.Len(t, workspaces.Workspaces, 2)
+	assert.Equal(t, user.ID, workspaces.Workspaces[0].ID)
+	assert.True(t, workspaces.Workspaces[0].Personal)
+	assert.Equal(t, created.Workspace.ID, workspaces.Workspaces[1].ID)
+
+	// the new token makes the created workspace current without the workspace header
+	createdClient := client.NewClient("http://localhost:8000", http.DefaultClient, map[string]string{
+		"Authorization": "Bearer " + created.Token,
+	})
+	profile, err := createdClient.GetProfile(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, created.Workspace.ID, profile.UserInfo.CurrentWorkspace)
+	assert.ElementsMatch(t, []string{user.ID, created.Workspace.ID}, profile.UserInfo.Workspaces)
+
+	err = createdClient.RenameWorkspace(ctx, client.WorkspaceRequest{Name: "client-b"})
+	require.NoError(t, err)
+
+	_, err = apiClient.SwitchWorkspace(ctx, client.SwitchWorkspaceRequest{WorkspaceID: xid.New().String()})
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "WORKSPACE_NOT_FOUND", e.Code)
+
+	switched, err := apiClient.SwitchWorkspace(ctx, client.SwitchWorkspaceRequest{WorkspaceID: user.ID})
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, switched.Workspace.ID)
+	switchedClient := client.NewClient("http://localhost:8000", http.DefaultClient, map[string]string{
+		"Authorization": "Bearer " + switched.Token,
+	})
+	profile, err = switchedClient.GetProfile(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, profile.UserInfo.CurrentWorkspace)
+
+	// the personal workspace stays as is
+	err = switchedClient.RenameWorkspace(ctx, client.WorkspaceRequest{Name: "personal"})
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "PERSONAL_WORKSPACE", e.Code)
+	_, err = switchedClient.RemoveWorkspace(ctx)
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "PERSONAL_WORKSPACE", e.Code)
+
+	switched, err = switchedClient.SwitchWorkspace(ctx, client.SwitchWorkspaceRequest{WorkspaceID: created.Workspace.ID})
+	require.NoError(t, err)
+	assert.Equal(t, "client-b", switched.Workspace.Name)
+
+	removed, err := client.NewClient("http://localhost:8000", http.DefaultClient, map[string]string{
+		"Authorization": "Bearer " + switched.Token,
+	}).RemoveWorkspace(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, removed.Workspace.ID)
+
+	workspaces, err = apiClient.GetWorkspaces(ctx)
+	require.NoError(t, err)
+	require.Len(t, workspaces.Workspaces, 1)
+	assert.Equal(t, user.ID, workspaces.Workspaces[0].ID)
+}
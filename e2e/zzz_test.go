@@ -1,11 +1,15 @@
 package e2e
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"testing"
 	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/rs/xid"
 	"github.com/treenq/treenq/client"
 	"github.com/treenq/treenq/pkg/auth"
 	"github.com/treenq/treenq/src/resources"
@@ -15,10 +19,25 @@ var (
 	db         *sqlx.DB
 	tableNames = []string{
 		"deployments",
+		"workspaceSecretStores",
+		"buildLogs",
+		"repoSecretGroups",
+		"secretGroupValues",
+		"secretGroups",
+		"secretVersions",
 		"secrets",
 		"spaces",
+		"environments",
 		"installedRepos",
 		"installations",
+		"registryCredentials",
+		"clusters",
+		"invitations",
+		"apiTokens",
+		"sessionRefreshTokens",
+		"sessions",
+		"auditEvents",
+		"userIdentities",
 		"workspaceUsers",
 		"users",
 		"workspaces",
@@ -140,9 +159,9 @@ func createUser(userInfo client.UserInfo) (string, error) {
 	// Create a default workspace for the user
 	workspaceID := userInfo.ID
 	_, err = tx.Exec(`
-		INSERT INTO workspaces (id, name, githubOrgName)
-		VALUES ($1, $2, $3)
-	`, workspaceID, "default", "")
+		INSERT INTO workspaces (id, name, githubOrgName, namespace, personalOf)
+		VALUES ($1, $2, $3, $4, $5)
+	`, workspaceID, "default", "", "default", userInfo.ID)
 	if err != nil {
 		return "", fmt.Errorf("failed to create workspace: %w", err)
 	}
@@ -161,12 +180,67 @@ func createUser(userInfo client.UserInfo) (string, error) {
 		return "", fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
+	sessionID, err := startSession(userInfo.ID, rand.Text())
+	if err != nil {
+		return "", err
+	}
+
+	issuer := auth.NewJwtIssuer("treenq-api", []byte(privateKey), []byte(publicKey), 24*time.Hour)
+	token, err := issuer.GenerateJwtToken(map[string]any{
+		"id":              userInfo.ID,
+		"email":           userInfo.Email,
+		"displayName":     userInfo.DisplayName,
+		"workspaces":      []string{workspaceID},
+		auth.SessionClaim: sessionID,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	return token, nil
+}
+
+// addWorkspaceMember creates a user being a member of the given workspace with the given role and obtains its token
+func addWorkspaceMember(workspaceID string, userInfo client.UserInfo, role string) (string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO users (id, email, displayName)
+		VALUES ($1, $2, $3)
+	`, userInfo.ID, userInfo.Email, userInfo.DisplayName)
+	if err != nil {
+		return "", fmt.Errorf("failed to create user: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO workspaceUsers (workspaceId, userId, role)
+		VALUES ($1, $2, $3)
+	`, workspaceID, userInfo.ID, role)
+	if err != nil {
+		return "", fmt.Errorf("failed to link user to workspace: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	sessionID, err := startSession(userInfo.ID, rand.Text())
+	if err != nil {
+		return "", err
+	}
+
 	issuer := auth.NewJwtIssuer("treenq-api", []byte(privateKey), []byte(publicKey), 24*time.Hour)
 	token, err := issuer.GenerateJwtToken(map[string]any{
-		"id":          userInfo.ID,
-		"email":       userInfo.Email,
-		"displayName": userInfo.DisplayName,
-		"workspaces":  []string{workspaceID},
+		"id":              userInfo.ID,
+		"email":           userInfo.Email,
+		"displayName":     userInfo.DisplayName,
+		"workspaces":      []string{workspaceID},
+		auth.SessionClaim: sessionID,
 	})
 	if err != nil {
 		return "", fmt.Errorf("failed to generate token: %w", err)
@@ -174,3 +248,18 @@ func createUser(userInfo client.UserInfo) (string, error) {
 
 	return token, nil
 }
+
+// startSession creates a session of the user having the given refresh token, the access tokens must carry its id
+func startSession(userID, refreshToken string) (string, error) {
+	sessionID := xid.New().String()
+	refreshTokenHash := sha256.Sum256([]byte(refreshToken))
+	_, err := db.Exec(`
+		INSERT INTO sessions (id, userId, refreshTokenHash, expiresAt)
+		VALUES ($1, $2, $3, $4)
+	`, sessionID, userID, hex.EncodeToString(refreshTokenHash[:]), time.Now().UTC().Add(24*time.Hour))
+	if err != nil {
+		return "", fmt.Errorf("failed to create session: %w", err)
+	}
+
+	return sessionID, nil
+}
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS registryCredentials;
+
+ALTER TABLE deployments DROP COLUMN IF EXISTS imageDigest;
+ALTER TABLE deployments DROP COLUMN IF EXISTS image;
@@ -0,0 +1,10 @@
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS image varchar(255) NOT NULL DEFAULT '';
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS imageDigest varchar(80) NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS registryCredentials (
+    workspaceId CHAR(20) REFERENCES workspaces(id) NOT NULL,
+    registry varchar(255) NOT NULL,
+    username varchar(255) NOT NULL,
+    createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    UNIQUE (workspaceId, registry)
+);
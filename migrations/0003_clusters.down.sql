@@ -0,0 +1,3 @@
+ALTER TABLE installedRepos DROP COLUMN IF EXISTS clusterId;
+
+DROP TABLE IF EXISTS clusters;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS clusters (
+    id CHAR(20) PRIMARY KEY NOT NULL,
+    workspaceId CHAR(20) REFERENCES workspaces(id) NOT NULL,
+    name varchar(255) NOT NULL,
+    kubeConfig bytea NOT NULL,
+
+    createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    UNIQUE (workspaceId, name)
+);
+
+ALTER TABLE installedRepos ADD COLUMN IF NOT EXISTS clusterId varchar(20) NOT NULL DEFAULT '';
@@ -0,0 +1,8 @@
+DELETE FROM secrets WHERE environment != '';
+ALTER TABLE secrets DROP CONSTRAINT IF EXISTS secrets_repoid_environment_key_key;
+ALTER TABLE secrets ADD CONSTRAINT secrets_repoid_key_key UNIQUE (repoId, key);
+ALTER TABLE secrets DROP COLUMN IF EXISTS environment;
+
+ALTER TABLE deployments DROP COLUMN IF EXISTS environment;
+
+DROP TABLE IF EXISTS environments;
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS environments (
+    id CHAR(20) PRIMARY KEY NOT NULL,
+    repoId CHAR(20) REFERENCES installedRepos(id) NOT NULL,
+    workspaceId CHAR(20) REFERENCES workspaces(id) NOT NULL,
+    name varchar(20) NOT NULL,
+    branch varchar(100) NOT NULL DEFAULT '',
+    tagPrefix varchar(100) NOT NULL DEFAULT '',
+    overrides jsonb NOT NULL DEFAULT '{}',
+
+    createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    updatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    UNIQUE (repoId, name)
+);
+
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS environment varchar(20) NOT NULL DEFAULT '';
+
+ALTER TABLE secrets ADD COLUMN IF NOT EXISTS environment varchar(20) NOT NULL DEFAULT '';
+ALTER TABLE secrets DROP CONSTRAINT IF EXISTS secrets_repoid_key_key;
+ALTER TABLE secrets ADD CONSTRAINT secrets_repoid_environment_key_key UNIQUE (repoId, environment, key);
@@ -0,0 +1,2 @@
+-- the required approver is a user id, a display name doesn't identify a user
+ALTER TABLE environments ADD COLUMN IF NOT EXISTS requiredApprover varchar(255) NOT NULL DEFAULT '';
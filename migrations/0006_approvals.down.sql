@@ -0,0 +1,6 @@
+ALTER TABLE deployments DROP COLUMN IF EXISTS userId;
+ALTER TABLE deployments DROP COLUMN IF EXISTS approvedAt;
+ALTER TABLE deployments DROP COLUMN IF EXISTS approvedBy;
+
+ALTER TABLE environments DROP COLUMN IF EXISTS protected;
+ALTER TABLE installedRepos DROP COLUMN IF EXISTS protected;
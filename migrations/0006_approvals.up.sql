@@ -0,0 +1,9 @@
+ALTER TABLE installedRepos ADD COLUMN IF NOT EXISTS protected boolean NOT NULL DEFAULT false;
+ALTER TABLE environments ADD COLUMN IF NOT EXISTS protected boolean NOT NULL DEFAULT false;
+
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS approvedBy varchar(255) NOT NULL DEFAULT '';
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS approvedAt TIMESTAMP;
+
+-- the deployments are bound to the user id, the display names can't identify a user,
+-- the webhook deployments have no user id
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS userId varchar(20) NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+ALTER TABLE workspaceUsers ALTER COLUMN role SET DEFAULT 'member';
+UPDATE workspaceUsers SET role = 'member' WHERE role IN ('developer', 'viewer');
+UPDATE workspaceUsers SET role = 'admin' WHERE role = 'owner';
@@ -0,0 +1,6 @@
+-- the personal workspace creator owns it
+UPDATE workspaceUsers SET role = 'owner'
+WHERE role = 'admin' AND workspaceId IN (SELECT id FROM workspaces WHERE name = 'default');
+
+UPDATE workspaceUsers SET role = 'developer' WHERE role = 'member';
+ALTER TABLE workspaceUsers ALTER COLUMN role SET DEFAULT 'developer';
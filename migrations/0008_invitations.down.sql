@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS userIdentities;
+DROP TABLE IF EXISTS invitations;
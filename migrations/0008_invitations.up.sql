@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS invitations (
+    id CHAR(20) PRIMARY KEY NOT NULL,
+    workspaceId CHAR(20) REFERENCES workspaces(id) NOT NULL,
+    email varchar(85) NOT NULL DEFAULT '',
+    githubLogin varchar(255) NOT NULL DEFAULT '',
+    role varchar(20) NOT NULL,
+    invitedBy CHAR(20) REFERENCES users(id) NOT NULL,
+    expiresAt TIMESTAMP NOT NULL,
+    acceptedBy CHAR(20) REFERENCES users(id),
+    acceptedAt TIMESTAMP,
+
+    createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS invitations_workspaceid_idx ON invitations (workspaceId);
+
+-- a user is found by the provider identity, the display name is up to the provider user and can't identify one,
+-- the users created before are linked to their identities by the email on the next login
+CREATE TABLE IF NOT EXISTS userIdentities (
+    provider varchar(255) NOT NULL,
+    subject varchar(255) NOT NULL,
+    userId CHAR(20) REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+    -- the login is verified by the provider, e.g. a GitHub login, it's updated on every login as it may be renamed
+    login varchar(255) NOT NULL DEFAULT '',
+
+    createdAt TIMESTAMP NOT NULL,
+    PRIMARY KEY (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS useridentities_userid_idx ON userIdentities (userId);
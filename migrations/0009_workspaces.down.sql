@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS workspaces_personalof_idx;
+ALTER TABLE workspaces DROP COLUMN IF EXISTS personalOf;
+ALTER TABLE workspaces DROP COLUMN IF EXISTS namespace;
@@ -0,0 +1,13 @@
+ALTER TABLE workspaces ADD COLUMN IF NOT EXISTS namespace varchar(255) NOT NULL DEFAULT '';
+UPDATE workspaces SET namespace = name;
+
+-- a personal workspace is owned by the user it's created for
+ALTER TABLE workspaces ADD COLUMN IF NOT EXISTS personalOf CHAR(20) REFERENCES users(id);
+UPDATE workspaces w SET personalOf = (
+    SELECT wu.userId FROM workspaceUsers wu
+    WHERE wu.workspaceId = w.id AND wu.role = 'owner'
+    ORDER BY wu.createdAt
+    LIMIT 1
+)
+WHERE w.name = 'default';
+CREATE UNIQUE INDEX IF NOT EXISTS workspaces_personalof_idx ON workspaces (personalOf);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS apiTokens (
+    id CHAR(20) PRIMARY KEY NOT NULL,
+    workspaceId CHAR(20) REFERENCES workspaces(id) NOT NULL,
+    userId CHAR(20) REFERENCES users(id) NOT NULL,
+    name varchar(255) NOT NULL,
+    tokenHash CHAR(64) NOT NULL UNIQUE,
+    operations jsonb NOT NULL DEFAULT '[]',
+    expiresAt TIMESTAMP,
+    lastUsedAt TIMESTAMP,
+
+    createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS apitokens_workspaceid_userid_idx ON apiTokens (workspaceId, userId);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS sessionRefreshTokens;
+DROP TABLE IF EXISTS sessions;
@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS sessions (
+    id CHAR(20) PRIMARY KEY NOT NULL,
+    userId CHAR(20) REFERENCES users(id) NOT NULL,
+    -- the refresh token rotates on every refresh
+    refreshTokenHash CHAR(64) NOT NULL UNIQUE,
+    currentWorkspace varchar(20) NOT NULL DEFAULT '',
+    userAgent varchar(255) NOT NULL DEFAULT '',
+    ip varchar(45) NOT NULL DEFAULT '',
+    expiresAt TIMESTAMP NOT NULL,
+    refreshedAt TIMESTAMP,
+    revokedAt TIMESTAMP,
+
+    createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS sessions_userid_idx ON sessions (userId);
+
+-- every rotated refresh token of a session is kept to detect its reuse
+CREATE TABLE IF NOT EXISTS sessionRefreshTokens (
+    tokenHash CHAR(64) PRIMARY KEY NOT NULL,
+    sessionId CHAR(20) REFERENCES sessions(id) ON DELETE CASCADE NOT NULL,
+
+    createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS sessionrefreshtokens_sessionid_idx ON sessionRefreshTokens (sessionId);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS auditEvents;
+DROP FUNCTION IF EXISTS auditEvents_append_only();
@@ -0,0 +1,27 @@
+-- the events outlive the workspaces and the users, so there are no foreign keys
+CREATE TABLE IF NOT EXISTS auditEvents (
+    id CHAR(20) PRIMARY KEY NOT NULL,
+    workspaceId varchar(20) NOT NULL DEFAULT '',
+    actorId varchar(20) NOT NULL DEFAULT '',
+    actorName varchar(255) NOT NULL DEFAULT '',
+    apiTokenId varchar(20) NOT NULL DEFAULT '',
+    action varchar(64) NOT NULL,
+    target jsonb NOT NULL DEFAULT '{}',
+    status INTEGER NOT NULL,
+    ip varchar(45) NOT NULL DEFAULT '',
+    userAgent varchar(255) NOT NULL DEFAULT '',
+
+    createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS auditevents_workspaceid_id_idx ON auditEvents (workspaceId, id DESC);
+
+CREATE OR REPLACE FUNCTION auditEvents_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'auditEvents is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER auditevents_append_only
+    BEFORE UPDATE OR DELETE ON auditEvents
+    FOR EACH ROW EXECUTE FUNCTION auditEvents_append_only();
@@ -0,0 +1,2 @@
+ALTER TABLE deployments DROP COLUMN IF EXISTS secretVersions;
+DROP TABLE IF EXISTS secretVersions;
@@ -0,0 +1,19 @@
+-- the values are encrypted with a per version data key, the data key is encrypted with ENCRYPTION_KEY
+CREATE TABLE IF NOT EXISTS secretVersions (
+    id CHAR(20) PRIMARY KEY NOT NULL,
+    workspaceId CHAR(20) REFERENCES workspaces(id) NOT NULL,
+    repoId CHAR(20) NOT NULL REFERENCES installedRepos(id),
+    environment varchar(20) NOT NULL DEFAULT '',
+    key varchar(64) NOT NULL,
+    version INTEGER NOT NULL,
+    value BYTEA NOT NULL,
+    -- fromVersion is set when the version is a rollback to an older one
+    fromVersion INTEGER NOT NULL DEFAULT 0,
+    authorId varchar(20) NOT NULL DEFAULT '',
+    authorName varchar(255) NOT NULL DEFAULT '',
+
+    createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    UNIQUE (repoId, environment, key, version)
+);
+
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS secretVersions jsonb NOT NULL DEFAULT '{}';
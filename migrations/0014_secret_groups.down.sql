@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS repoSecretGroups;
+DROP TABLE IF EXISTS secretGroupValues;
+DROP TABLE IF EXISTS secretGroups;
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS secretGroups (
+    id CHAR(20) PRIMARY KEY NOT NULL,
+    workspaceId CHAR(20) REFERENCES workspaces(id) NOT NULL,
+    name varchar(64) NOT NULL,
+    createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    UNIQUE (workspaceId, name)
+);
+
+-- the values are encrypted with a per value data key the same way as the secret versions
+CREATE TABLE IF NOT EXISTS secretGroupValues (
+    groupId CHAR(20) NOT NULL REFERENCES secretGroups(id),
+    workspaceId CHAR(20) REFERENCES workspaces(id) NOT NULL,
+    key varchar(64) NOT NULL,
+    value BYTEA NOT NULL,
+    createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    updatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    PRIMARY KEY (groupId, key)
+);
+
+CREATE TABLE IF NOT EXISTS repoSecretGroups (
+    repoId CHAR(20) NOT NULL REFERENCES installedRepos(id),
+    environment varchar(20) NOT NULL DEFAULT '',
+    groupId CHAR(20) NOT NULL REFERENCES secretGroups(id),
+    workspaceId CHAR(20) REFERENCES workspaces(id) NOT NULL,
+    -- position orders the attached groups, a later group overrides the same keys of an earlier one
+    position INTEGER NOT NULL,
+    createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    PRIMARY KEY (repoId, environment, groupId)
+);
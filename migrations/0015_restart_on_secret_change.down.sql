@@ -0,0 +1 @@
+ALTER TABLE installedRepos DROP COLUMN IF EXISTS restartOnSecretChange;
@@ -0,0 +1 @@
+ALTER TABLE installedRepos ADD COLUMN IF NOT EXISTS restartOnSecretChange boolean NOT NULL DEFAULT false;
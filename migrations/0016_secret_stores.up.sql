@@ -0,0 +1,12 @@
+-- a workspace without a row keeps its repo secret values in Kubernetes
+CREATE TABLE IF NOT EXISTS workspaceSecretStores (
+    workspaceId CHAR(20) PRIMARY KEY NOT NULL REFERENCES workspaces(id),
+    kind varchar(20) NOT NULL,
+    vaultAddress TEXT NOT NULL DEFAULT '',
+    vaultMount TEXT NOT NULL DEFAULT '',
+    vaultPathPrefix TEXT NOT NULL DEFAULT '',
+    vaultRole TEXT NOT NULL DEFAULT '',
+    -- the token is encrypted with the api encryption key
+    vaultToken BYTEA,
+    updatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
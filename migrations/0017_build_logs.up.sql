@@ -0,0 +1,17 @@
+-- the build progress outlives the in-memory buffer of the api, the logs are removed once the retention passes,
+-- the build logs are searched through their deployments, so they're removed with them instead of outliving them
+CREATE TABLE IF NOT EXISTS buildLogs (
+    id BIGSERIAL PRIMARY KEY,
+    deploymentId CHAR(20) REFERENCES deployments(id) ON DELETE CASCADE NOT NULL,
+    payload TEXT NOT NULL,
+    level INTEGER NOT NULL,
+    final BOOLEAN NOT NULL DEFAULT false,
+    errorCode varchar(64) NOT NULL DEFAULT '',
+    createdAt TIMESTAMP NOT NULL,
+    -- the simple configuration keeps the words as they are, the build output isn't a natural language
+    payloadSearch tsvector GENERATED ALWAYS AS (to_tsvector('simple', payload)) STORED
+);
+
+CREATE INDEX IF NOT EXISTS buildlogs_deploymentid_id_idx ON buildLogs (deploymentId, id);
+CREATE INDEX IF NOT EXISTS buildlogs_createdat_idx ON buildLogs (createdAt);
+CREATE INDEX IF NOT EXISTS buildlogs_payloadsearch_idx ON buildLogs USING GIN (payloadSearch);
@@ -0,0 +1 @@
+ALTER TABLE buildLogs DROP COLUMN IF EXISTS deployment;
@@ -0,0 +1,2 @@
+-- the progress is streamed from the build logs by any api replica, a message may carry a deployment snapshot
+ALTER TABLE buildLogs ADD COLUMN IF NOT EXISTS deployment jsonb;
@@ -3,9 +3,11 @@ package auth
 import (
 	"context"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"path"
 	"strings"
 	"time"
 
@@ -18,6 +20,11 @@ type JwtIssuer struct {
 	secret []byte
 	public []byte
 	ttl    time.Duration
+
+	// keyID is set to the kid header of the issued tokens
+	keyID   string
+	retired []JwtKey
+	grace   time.Duration
 }
 
 func NewJwtIssuer(issuerId string, secretKey []byte, publicKey []byte, ttl time.Duration) *JwtIssuer {
@@ -45,6 +52,9 @@ func (j *JwtIssuer) GenerateJwtToken(claims map[string]any) (string, error) {
 		jwtClaims[k] = v
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwtClaims)
+	if j.keyID != "" {
+		token.Header["kid"] = j.keyID
+	}
 	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(j.secret)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse pem: %w", err)
@@ -59,17 +69,13 @@ func (j *JwtIssuer) VerifyToken(tokenString string) (map[string]interface{}, err
 		return nil, fmt.Errorf("failed to decode pem")
 	}
 
-	publicKey, err := jwt.ParseRSAPublicKeyFromPEM(j.public)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse pem: %w", err)
-	}
-
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		// Verify that the signing method is RS256
 		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return publicKey, nil
+		kid, _ := token.Header["kid"].(string)
+		return j.verificationKey(kid, time.Now())
 	})
 	if err != nil {
 		return nil, err
@@ -116,7 +122,35 @@ func getToken(r *http.Request) string {
 	return authHeader.Value
 }
 
-func NewJwtMiddleware(jwtIssuer *JwtIssuer, l *slog.Logger) vel.Middleware {
+// ApiTokenPrefix distinguishes the personal api tokens from the jwt
+const ApiTokenPrefix = "tq_"
+
+var (
+	// ErrInvalidApiToken is returned by ApiTokenVerifier if the token is unknown, revoked or expired
+	ErrInvalidApiToken = errors.New("api token is invalid")
+	// ErrOperationNotAllowed is returned by ApiTokenVerifier if the token scope doesn't include the operation
+	ErrOperationNotAllowed = errors.New("operation is not allowed by the token")
+)
+
+// ApiTokenVerifier gives the claims of a personal api token if the token may call the operation
+type ApiTokenVerifier interface {
+	VerifyApiToken(ctx context.Context, token, operation string) (map[string]any, error)
+}
+
+// SessionClaim keeps an id of the login session the jwt is issued for
+const SessionClaim = "sid"
+
+// ErrSessionRevoked is returned by SessionVerifier if the session is revoked or expired
+var ErrSessionRevoked = errors.New("session is revoked")
+
+// SessionVerifier checks the session of a jwt is still active, so a revoked session rejects its tokens before they expire
+type SessionVerifier interface {
+	VerifySession(ctx context.Context, sessionID string) error
+}
+
+// NewJwtMiddleware verifies the jwt from the cookies or the bearer header and its session if sessions is given,
+// the bearer tokens having ApiTokenPrefix are given to apiTokens, the operation is the last segment of the url path
+func NewJwtMiddleware(jwtIssuer *JwtIssuer, apiTokens ApiTokenVerifier, sessions SessionVerifier, l *slog.Logger) vel.Middleware {
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			token := getToken(r)
@@ -125,11 +159,44 @@ func NewJwtMiddleware(jwtIssuer *JwtIssuer, l *slog.Logger) vel.Middleware {
 				return
 			}
 
+			if strings.HasPrefix(token, ApiTokenPrefix) && apiTokens != nil {
+				claims, err := apiTokens.VerifyApiToken(r.Context(), token, path.Base(r.URL.Path))
+				if errors.Is(err, ErrInvalidApiToken) {
+					http.Error(w, (&vel.Error{Code: "UNAUTHORIZED", Message: "api token is invalid"}).JsonString(), http.StatusForbidden)
+					return
+				}
+				if errors.Is(err, ErrOperationNotAllowed) {
+					http.Error(w, (&vel.Error{Code: "FORBIDDEN", Message: "the api token has no access to the operation"}).JsonString(), http.StatusForbidden)
+					return
+				}
+				if err != nil {
+					l.ErrorContext(r.Context(), "failed to verify api token", "err", err)
+					http.Error(w, (&vel.Error{Message: "failed to verify api token"}).JsonString(), http.StatusInternalServerError)
+					return
+				}
+				*r = *r.WithContext(ClaimsToCtx(r.Context(), claims))
+				h.ServeHTTP(w, r)
+				return
+			}
+
 			claims, err := jwtIssuer.VerifyToken(token)
 			if err != nil {
 				http.Error(w, (&vel.Error{Code: "UNAUTHORIZED", Message: "token is invalid", Err: err}).JsonString(), http.StatusForbidden)
 				return
 			}
+			if sessions != nil {
+				sessionID, _ := claims[SessionClaim].(string)
+				err := sessions.VerifySession(r.Context(), sessionID)
+				if errors.Is(err, ErrSessionRevoked) {
+					http.Error(w, (&vel.Error{Code: "UNAUTHORIZED", Message: "session is revoked"}).JsonString(), http.StatusForbidden)
+					return
+				}
+				if err != nil {
+					l.ErrorContext(r.Context(), "failed to verify session", "err", err)
+					http.Error(w, (&vel.Error{Message: "failed to verify session"}).JsonString(), http.StatusInternalServerError)
+					return
+				}
+			}
 			*r = *r.WithContext(ClaimsToCtx(r.Context(), claims))
 			h.ServeHTTP(w, r)
 		})
@@ -1,8 +1,17 @@
 package auth
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/pem"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
 	"testing"
 	"time"
 
@@ -20,3 +29,85 @@ func TestJwt(t *testing.T) {
 	assert.NoError(t, err)
 	fmt.Println(token)
 }
+
+type fakeApiTokens map[string][]string
+
+func (f fakeApiTokens) VerifyApiToken(ctx context.Context, token, operation string) (map[string]any, error) {
+	operations, ok := f[token]
+	if !ok {
+		return nil, ErrInvalidApiToken
+	}
+	if !slices.Contains(operations, operation) {
+		return nil, ErrOperationNotAllowed
+	}
+	return map[string]any{"id": token}, nil
+}
+
+func TestJwtMiddlewareApiTokens(t *testing.T) {
+	apiTokens := fakeApiTokens{ApiTokenPrefix + "ci": {"deploy"}}
+	middleware := NewJwtMiddleware(NewJwtIssuer("treenq-api", nil, nil, time.Minute), apiTokens, nil, slog.New(slog.DiscardHandler))
+	handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, ApiTokenPrefix+"ci", ClaimsFromCtx(r.Context())["id"])
+	}))
+
+	for _, tc := range []struct {
+		token  string
+		path   string
+		status int
+	}{
+		{token: ApiTokenPrefix + "ci", path: "/deploy", status: http.StatusOK},
+		{token: ApiTokenPrefix + "ci", path: "/revealSecret", status: http.StatusForbidden},
+		{token: ApiTokenPrefix + "unknown", path: "/deploy", status: http.StatusForbidden},
+	} {
+		r := httptest.NewRequest(http.MethodPost, tc.path, nil)
+		r.Header.Set(AuthKey, "Bearer "+tc.token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		assert.Equal(t, tc.status, w.Code, tc.token+" "+tc.path)
+	}
+}
+
+type fakeSessions map[string]bool
+
+func (f fakeSessions) VerifySession(ctx context.Context, sessionID string) error {
+	if !f[sessionID] {
+		return ErrSessionRevoked
+	}
+	return nil
+}
+
+func TestJwtMiddlewareSessions(t *testing.T) {
+	private, public := generateKey(t)
+	issuer := NewJwtIssuer("treenq-api", private, public, time.Minute)
+
+	middleware := NewJwtMiddleware(issuer, nil, fakeSessions{"active": true}, slog.New(slog.DiscardHandler))
+	handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, tc := range []struct {
+		claims map[string]any
+		status int
+	}{
+		{claims: map[string]any{SessionClaim: "active"}, status: http.StatusOK},
+		{claims: map[string]any{SessionClaim: "revoked"}, status: http.StatusForbidden},
+		{claims: map[string]any{}, status: http.StatusForbidden},
+	} {
+		token, err := issuer.GenerateJwtToken(tc.claims)
+		require.NoError(t, err)
+
+		r := httptest.NewRequest(http.MethodPost, "/getProfile", nil)
+		r.Header.Set(AuthKey, "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		assert.Equal(t, tc.status, w.Code, fmt.Sprint(tc.claims))
+	}
+}
+
+// generateKey gives a pem encoded rsa keypair
+func generateKey(t *testing.T) ([]byte, []byte) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	public, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public})
+}
@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/dennypenta/vel"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// ErrUnknownKey is returned if a token is signed by a key the issuer doesn't know
+	ErrUnknownKey = errors.New("unknown signing key")
+	// ErrKeyRetired is returned if a token is signed by a key retired longer than the grace period ago
+	ErrKeyRetired = errors.New("signing key is retired")
+)
+
+// JwtKey is a retired RSA key, the tokens it has signed are still verified during the grace period
+type JwtKey struct {
+	// ID is the kid header of the tokens signed by the key
+	ID string `json:"id"`
+	// PublicKey is a pem encoded public key
+	PublicKey []byte `json:"publicKey"`
+	// RetiredAt is when the key stopped signing the tokens
+	RetiredAt time.Time `json:"retiredAt"`
+}
+
+// WithKeyRotation makes the issuer put keyID to the kid header of the issued tokens
+// and verify the tokens of the retired keys until the grace period after their retirement passes,
+// the tokens having no kid header are verified with the active key
+func (j *JwtIssuer) WithKeyRotation(keyID string, retired []JwtKey, grace time.Duration) *JwtIssuer {
+	j.keyID = keyID
+	j.retired = retired
+	j.grace = grace
+	return j
+}
+
+// verificationKey gives the public key to verify a token having the given kid header
+func (j *JwtIssuer) verificationKey(kid string, now time.Time) (*rsa.PublicKey, error) {
+	if kid == "" || kid == j.keyID {
+		publicKey, err := jwt.ParseRSAPublicKeyFromPEM(j.public)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse pem: %w", err)
+		}
+		return publicKey, nil
+	}
+
+	for _, key := range j.retired {
+		if key.ID != kid {
+			continue
+		}
+		if now.After(key.RetiredAt.Add(j.grace)) {
+			return nil, ErrKeyRetired
+		}
+		publicKey, err := jwt.ParseRSAPublicKeyFromPEM(key.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse pem of key %s: %w", key.ID, err)
+		}
+		return publicKey, nil
+	}
+
+	return nil, ErrUnknownKey
+}
+
+// Jwk is a public RSA key in the JSON Web Key format (RFC 7517)
+type Jwk struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// PublicKey decodes the rsa public key of the jwk
+func (k Jwk) PublicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode modulus of key %s: %w", k.Kid, err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode exponent of key %s: %w", k.Kid, err)
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+}
+
+type Jwks struct {
+	Keys []Jwk `json:"keys"`
+}
+
+// Jwks gives the active key and the retired keys within the grace period,
+// so the other services may verify the tokens the issuer has signed
+func (j *JwtIssuer) Jwks(now time.Time) (Jwks, error) {
+	kids := []string{j.keyID}
+	for _, key := range j.retired {
+		if !now.After(key.RetiredAt.Add(j.grace)) {
+			kids = append(kids, key.ID)
+		}
+	}
+
+	jwks := Jwks{Keys: make([]Jwk, 0, len(kids))}
+	for _, kid := range kids {
+		publicKey, err := j.verificationKey(kid, now)
+		if err != nil {
+			return Jwks{}, err
+		}
+		jwks.Keys = append(jwks.Keys, Jwk{
+			Kty: "RSA",
+			Use: "sig",
+			Alg: jwt.SigningMethodRS256.Alg(),
+			Kid: kid,
+			N:   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+		})
+	}
+
+	return jwks, nil
+}
+
+// NewJwksHandler serves the json web key set of the issuer, it's meant for /.well-known/jwks.json
+func NewJwksHandler(j *JwtIssuer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jwks, err := j.Jwks(time.Now())
+		if err != nil {
+			http.Error(w, (&vel.Error{Message: "failed to build jwks", Err: err}).JsonString(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		json.NewEncoder(w).Encode(jwks)
+	}
+}
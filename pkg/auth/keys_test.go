@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJwtKeyRotation(t *testing.T) {
+	oldPrivate, oldPublic := generateKey(t)
+	newPrivate, newPublic := generateKey(t)
+
+	// a token issued before the key rotation has no kid
+	legacyToken, err := NewJwtIssuer("treenq-api", oldPrivate, oldPublic, time.Hour).GenerateJwtToken(nil)
+	require.NoError(t, err)
+	oldToken, err := NewJwtIssuer("treenq-api", oldPrivate, oldPublic, time.Hour).
+		WithKeyRotation("old", nil, 0).
+		GenerateJwtToken(map[string]any{"id": "old"})
+	require.NoError(t, err)
+
+	issuer := NewJwtIssuer("treenq-api", newPrivate, newPublic, time.Hour).
+		WithKeyRotation("new", []JwtKey{{ID: "old", PublicKey: oldPublic, RetiredAt: time.Now()}}, time.Hour)
+	newToken, err := issuer.GenerateJwtToken(map[string]any{"id": "new"})
+	require.NoError(t, err)
+	parsed, _, err := jwt.NewParser().ParseUnverified(newToken, jwt.MapClaims{})
+	require.NoError(t, err)
+	assert.Equal(t, "new", parsed.Header["kid"])
+
+	claims, err := issuer.VerifyToken(newToken)
+	require.NoError(t, err)
+	assert.Equal(t, "new", claims["id"])
+	claims, err = issuer.VerifyToken(oldToken)
+	require.NoError(t, err, "the retired key is accepted in the grace period")
+	assert.Equal(t, "old", claims["id"])
+	_, err = issuer.VerifyToken(legacyToken)
+	assert.Error(t, err, "a token without kid is verified only with the active key")
+
+	expired := NewJwtIssuer("treenq-api", newPrivate, newPublic, time.Hour).
+		WithKeyRotation("new", []JwtKey{{ID: "old", PublicKey: oldPublic, RetiredAt: time.Now().Add(-2 * time.Hour)}}, time.Hour)
+	_, err = expired.VerifyToken(oldToken)
+	assert.ErrorIs(t, err, ErrKeyRetired)
+	_, err = NewJwtIssuer("treenq-api", newPrivate, newPublic, time.Hour).
+		WithKeyRotation("new", nil, time.Hour).
+		VerifyToken(oldToken)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	jwks, err := expired.Jwks(time.Now())
+	require.NoError(t, err)
+	require.Len(t, jwks.Keys, 1, "the keys retired longer than the grace period are not published")
+	assert.Equal(t, "new", jwks.Keys[0].Kid)
+}
+
+func TestJwksHandler(t *testing.T) {
+	oldPrivate, oldPublic := generateKey(t)
+	newPrivate, newPublic := generateKey(t)
+	oldToken, err := NewJwtIssuer("treenq-api", oldPrivate, oldPublic, time.Hour).
+		WithKeyRotation("old", nil, 0).
+		GenerateJwtToken(nil)
+	require.NoError(t, err)
+	issuer := NewJwtIssuer("treenq-api", newPrivate, newPublic, time.Hour).
+		WithKeyRotation("new", []JwtKey{{ID: "old", PublicKey: oldPublic, RetiredAt: time.Now()}}, time.Hour)
+	newToken, err := issuer.GenerateJwtToken(nil)
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	NewJwksHandler(issuer).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var jwks Jwks
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&jwks))
+	require.Len(t, jwks.Keys, 2)
+	assert.Equal(t, "new", jwks.Keys[0].Kid)
+	assert.Equal(t, "old", jwks.Keys[1].Kid)
+
+	// a service knowing only the jwks verifies the tokens of both keys
+	keyfunc := func(token *jwt.Token) (any, error) {
+		for _, key := range jwks.Keys {
+			if key.Kid == token.Header["kid"] {
+				return key.PublicKey()
+			}
+		}
+		return nil, ErrUnknownKey
+	}
+	for _, token := range []string{newToken, oldToken} {
+		_, err := jwt.Parse(token, keyfunc)
+		assert.NoError(t, err)
+	}
+}
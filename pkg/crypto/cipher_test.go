@@ -0,0 +1,45 @@
+package crypto
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAesCipher(t *testing.T) {
+	c, err := NewAesCipher(bytes.Repeat([]byte{1}, 32))
+	require.NoError(t, err)
+
+	plaintext := []byte("apiVersion: v1\nkind: Config\n")
+	ciphertext, err := c.Encrypt(plaintext)
+	require.NoError(t, err)
+	assert.NotContains(t, string(ciphertext), "kind: Config")
+
+	// every encryption uses a new nonce
+	other, err := c.Encrypt(plaintext)
+	require.NoError(t, err)
+	assert.NotEqual(t, ciphertext, other)
+
+	decrypted, err := c.Decrypt(ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, plaintext, decrypted)
+
+	ciphertext[len(ciphertext)-1] ^= 1
+	_, err = c.Decrypt(ciphertext)
+	assert.Error(t, err)
+
+	_, err = c.Decrypt([]byte{1, 2})
+	assert.ErrorIs(t, err, ErrInvalidCiphertext)
+
+	anotherKey, err := NewAesCipher(bytes.Repeat([]byte{2}, 32))
+	require.NoError(t, err)
+	_, err = anotherKey.Decrypt(other)
+	assert.Error(t, err)
+}
+
+func TestAesCipherInvalidKey(t *testing.T) {
+	_, err := NewAesCipher([]byte("short"))
+	assert.ErrorIs(t, err, ErrInvalidKeySize)
+}
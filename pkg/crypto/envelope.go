@@ -0,0 +1,69 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+)
+
+// KeyCipher encrypts the data keys of an envelope
+type KeyCipher interface {
+	Encrypt(plaintext []byte) ([]byte, error)
+	Decrypt(ciphertext []byte) ([]byte, error)
+}
+
+// EnvelopeCipher encrypts every message with its own random AES-256 data key,
+// the data key is encrypted with the key encryption key and stored along the message,
+// so the key encryption key never touches the data itself.
+// The ciphertext layout is a 2 bytes big endian length of the encrypted data key, the encrypted data key and the sealed message.
+type EnvelopeCipher struct {
+	kek KeyCipher
+}
+
+func NewEnvelopeCipher(kek KeyCipher) *EnvelopeCipher {
+	return &EnvelopeCipher{kek: kek}
+}
+
+func (c *EnvelopeCipher) Encrypt(plaintext []byte) ([]byte, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	dek, err := NewAesCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := dek.Encrypt(plaintext)
+	if err != nil {
+		return nil, err
+	}
+	encryptedKey, err := c.kek.Encrypt(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt data key: %w", err)
+	}
+
+	out := make([]byte, 2, 2+len(encryptedKey)+len(sealed))
+	binary.BigEndian.PutUint16(out, uint16(len(encryptedKey)))
+	out = append(out, encryptedKey...)
+	return append(out, sealed...), nil
+}
+
+func (c *EnvelopeCipher) Decrypt(ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < 2 {
+		return nil, ErrInvalidCiphertext
+	}
+	keySize := int(binary.BigEndian.Uint16(ciphertext))
+	if len(ciphertext) < 2+keySize {
+		return nil, ErrInvalidCiphertext
+	}
+
+	dataKey, err := c.kek.Decrypt(ciphertext[2 : 2+keySize])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data key: %w", err)
+	}
+	dek, err := NewAesCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return dek.Decrypt(ciphertext[2+keySize:])
+}
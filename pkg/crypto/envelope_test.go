@@ -0,0 +1,44 @@
+package crypto
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvelopeCipher(t *testing.T) {
+	kek, err := NewAesCipher(bytes.Repeat([]byte{1}, 32))
+	require.NoError(t, err)
+	c := NewEnvelopeCipher(kek)
+
+	plaintext := []byte("postgres://user:password@db:5432/app")
+	ciphertext, err := c.Encrypt(plaintext)
+	require.NoError(t, err)
+	assert.NotContains(t, string(ciphertext), "password")
+
+	// every message gets its own data key
+	other, err := c.Encrypt(plaintext)
+	require.NoError(t, err)
+	assert.NotEqual(t, ciphertext[:60], other[:60])
+
+	decrypted, err := c.Decrypt(ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, plaintext, decrypted)
+
+	tampered := bytes.Clone(ciphertext)
+	tampered[len(tampered)-1] ^= 1
+	_, err = c.Decrypt(tampered)
+	assert.Error(t, err)
+
+	_, err = c.Decrypt([]byte{0})
+	assert.ErrorIs(t, err, ErrInvalidCiphertext)
+	_, err = c.Decrypt([]byte{0, 200, 1})
+	assert.ErrorIs(t, err, ErrInvalidCiphertext)
+
+	anotherKek, err := NewAesCipher(bytes.Repeat([]byte{2}, 32))
+	require.NoError(t, err)
+	_, err = NewEnvelopeCipher(anotherKek).Decrypt(ciphertext)
+	assert.Error(t, err)
+}
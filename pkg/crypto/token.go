@@ -0,0 +1,74 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrTokenMalformed = errors.New("token is malformed")
+	ErrTokenSignature = errors.New("token signature is invalid")
+	ErrTokenExpired   = errors.New("token is expired")
+)
+
+// HmacTokenSigner issues short opaque tokens carrying a payload and an expiration time,
+// the token is signed with HMAC SHA256 so it can't be forged or prolonged without the secret.
+type HmacTokenSigner struct {
+	secret []byte
+}
+
+func NewHmacTokenSigner(secret []byte) *HmacTokenSigner {
+	return &HmacTokenSigner{secret: secret}
+}
+
+// Sign gives a token in the form of payload.expiration.signature, every part is base64 url encoded
+func (s *HmacTokenSigner) Sign(payload string, expiresAt time.Time) string {
+	body := base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(expiresAt.Unix(), 10)))
+	return body + "." + base64.RawURLEncoding.EncodeToString(s.sign(body))
+}
+
+// Verify checks the token signature and expiration and gives back its payload
+func (s *HmacTokenSigner) Verify(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", ErrTokenMalformed
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", ErrTokenMalformed
+	}
+	if !hmac.Equal(signature, s.sign(parts[0]+"."+parts[1])) {
+		return "", ErrTokenSignature
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", ErrTokenMalformed
+	}
+	rawExpiration, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", ErrTokenMalformed
+	}
+	expiration, err := strconv.ParseInt(string(rawExpiration), 10, 64)
+	if err != nil {
+		return "", ErrTokenMalformed
+	}
+	if time.Now().Unix() >= expiration {
+		return "", ErrTokenExpired
+	}
+
+	return string(payload), nil
+}
+
+func (s *HmacTokenSigner) sign(body string) []byte {
+	h := hmac.New(sha256.New, s.secret)
+	h.Write([]byte(body))
+	return h.Sum(nil)
+}
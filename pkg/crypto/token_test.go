@@ -0,0 +1,34 @@
+package crypto
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHmacTokenSigner(t *testing.T) {
+	s := NewHmacTokenSigner([]byte("secret"))
+
+	token := s.Sign("invitation-id", time.Now().Add(time.Hour))
+	payload, err := s.Verify(token)
+	require.NoError(t, err)
+	assert.Equal(t, "invitation-id", payload)
+
+	_, err = s.Verify(s.Sign("invitation-id", time.Now().Add(-time.Second)))
+	assert.ErrorIs(t, err, ErrTokenExpired)
+
+	_, err = NewHmacTokenSigner([]byte("another")).Verify(token)
+	assert.ErrorIs(t, err, ErrTokenSignature)
+
+	// the payload can't be swapped keeping the signature
+	parts := strings.Split(token, ".")
+	forged := strings.Split(s.Sign("another-id", time.Now().Add(time.Hour)), ".")
+	_, err = s.Verify(forged[0] + "." + parts[1] + "." + parts[2])
+	assert.ErrorIs(t, err, ErrTokenSignature)
+
+	_, err = s.Verify("invitation-id")
+	assert.ErrorIs(t, err, ErrTokenMalformed)
+}
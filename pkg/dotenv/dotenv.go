@@ -0,0 +1,226 @@
+package dotenv
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var ErrSyntax = errors.New("invalid dotenv syntax")
+
+// SyntaxError points to the line a dotenv content can't be parsed at
+type SyntaxError struct {
+	Line   int
+	Reason string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Reason)
+}
+
+func (e *SyntaxError) Unwrap() error {
+	return ErrSyntax
+}
+
+// Parse reads the KEY=VALUE lines of a .env file, a later key overrides an earlier one.
+// The lines may start with export, # starts a comment unless it's quoted.
+// A single quoted value is taken as is, a double quoted one unescapes \n, \r, \t, \" and \\,
+// both may span several lines. The variables are never expanded.
+func Parse(content string) (map[string]string, error) {
+	values := make(map[string]string)
+	p := parser{content: strings.ReplaceAll(content, "\r\n", "\n"), line: 1}
+	for {
+		p.skipBlank()
+		if p.done() {
+			return values, nil
+		}
+
+		key, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		values[key] = value
+	}
+}
+
+type parser struct {
+	content string
+	pos     int
+	line    int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.content)
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return &SyntaxError{Line: p.line, Reason: fmt.Sprintf(format, args...)}
+}
+
+// skipBlank skips the empty lines and the comments
+func (p *parser) skipBlank() {
+	for !p.done() {
+		switch p.content[p.pos] {
+		case '\n':
+			p.line++
+			p.pos++
+		case ' ', '\t':
+			p.pos++
+		case '#':
+			p.skipLine()
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) skipLine() {
+	end := strings.IndexByte(p.content[p.pos:], '\n')
+	if end < 0 {
+		p.pos = len(p.content)
+		return
+	}
+	p.pos += end
+}
+
+func (p *parser) key() (string, error) {
+	end := strings.IndexByte(p.content[p.pos:], '=')
+	newline := strings.IndexByte(p.content[p.pos:], '\n')
+	if end < 0 || (newline >= 0 && newline < end) {
+		return "", p.errorf("expected KEY=VALUE")
+	}
+
+	key := strings.TrimSpace(p.content[p.pos : p.pos+end])
+	if rest, ok := strings.CutPrefix(key, "export "); ok {
+		key = strings.TrimSpace(rest)
+	}
+	if key == "" {
+		return "", p.errorf("empty key")
+	}
+	if strings.ContainsAny(key, " \t") {
+		return "", p.errorf("key %q contains spaces", key)
+	}
+	p.pos += end + 1
+	return key, nil
+}
+
+func (p *parser) value() (string, error) {
+	for !p.done() && (p.content[p.pos] == ' ' || p.content[p.pos] == '\t') {
+		p.pos++
+	}
+	if p.done() {
+		return "", nil
+	}
+
+	var value string
+	switch p.content[p.pos] {
+	case '\'':
+		start := p.line
+		end := strings.IndexByte(p.content[p.pos+1:], '\'')
+		if end < 0 {
+			return "", &SyntaxError{Line: start, Reason: "unterminated single quote"}
+		}
+		value = p.content[p.pos+1 : p.pos+1+end]
+		p.line += strings.Count(value, "\n")
+		p.pos += end + 2
+	case '"':
+		var err error
+		if value, err = p.doubleQuoted(); err != nil {
+			return "", err
+		}
+	default:
+		end := strings.IndexByte(p.content[p.pos:], '\n')
+		if end < 0 {
+			end = len(p.content) - p.pos
+		}
+		value = p.content[p.pos : p.pos+end]
+		if comment := strings.Index(value, " #"); comment >= 0 {
+			value = value[:comment]
+		}
+		p.pos += end
+		return strings.TrimSpace(value), nil
+	}
+
+	// only a comment may follow a quoted value
+	end := strings.IndexByte(p.content[p.pos:], '\n')
+	if end < 0 {
+		end = len(p.content) - p.pos
+	}
+	rest := strings.TrimSpace(p.content[p.pos : p.pos+end])
+	if rest != "" && !strings.HasPrefix(rest, "#") {
+		return "", p.errorf("unexpected %q after a quoted value", rest)
+	}
+	p.pos += end
+	return value, nil
+}
+
+func (p *parser) doubleQuoted() (string, error) {
+	start := p.line
+	var b strings.Builder
+	for i := p.pos + 1; i < len(p.content); i++ {
+		c := p.content[i]
+		switch c {
+		case '"':
+			p.pos = i + 1
+			return b.String(), nil
+		case '\n':
+			p.line++
+		case '\\':
+			if i+1 < len(p.content) {
+				i++
+				switch p.content[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 'r':
+					b.WriteByte('\r')
+				case 't':
+					b.WriteByte('\t')
+				case '"', '\\':
+					b.WriteByte(p.content[i])
+				default:
+					b.WriteByte('\\')
+					b.WriteByte(p.content[i])
+				}
+				continue
+			}
+		}
+		b.WriteByte(c)
+	}
+	return "", &SyntaxError{Line: start, Reason: "unterminated double quote"}
+}
+
+var bareValue = regexp.MustCompile(`^[a-zA-Z0-9_./:@+,=-]*$`)
+
+// Format writes the values as KEY=VALUE lines sorted by key, Parse reads them back as is.
+// The values having anything but the plain characters are double quoted.
+func Format(values map[string]string) string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(quote(values[key]))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+func quote(value string) string {
+	if bareValue.MatchString(value) {
+		return value
+	}
+	return `"` + escaper.Replace(value) + `"`
+}
@@ -0,0 +1,87 @@
+package dotenv
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	values, err := Parse(`# heroku config
+DATABASE_URL=postgres://user:pass@db:5432/app
+export SENTRY_DSN = https://key@sentry.io/1 # inline comment
+
+EMPTY=
+HASH=abc#def
+SINGLE='literal \n $HOME # not a comment'
+DOUBLE="line\nnext \"quoted\" \\ # not a comment" # a comment
+MULTILINE="-----BEGIN KEY-----
+abc
+-----END KEY-----"
+SINGLE_MULTILINE='a
+b'
+DUPLICATE=first
+DUPLICATE=second
+WINDOWS=crlf` + "\r\n" + `LAST=value`)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		"DATABASE_URL":     "postgres://user:pass@db:5432/app",
+		"SENTRY_DSN":       "https://key@sentry.io/1",
+		"EMPTY":            "",
+		"HASH":             "abc#def",
+		"SINGLE":           `literal \n $HOME # not a comment`,
+		"DOUBLE":           "line\nnext \"quoted\" \\ # not a comment",
+		"MULTILINE":        "-----BEGIN KEY-----\nabc\n-----END KEY-----",
+		"SINGLE_MULTILINE": "a\nb",
+		"DUPLICATE":        "second",
+		"WINDOWS":          "crlf",
+		"LAST":             "value",
+	}, values)
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		content string
+		line    int
+	}{
+		{name: "no separator", content: "A=1\nINVALID\n", line: 2},
+		{name: "empty key", content: "=value", line: 1},
+		{name: "key with spaces", content: "A B=1", line: 1},
+		{name: "unterminated double quote", content: "A=1\n\nB=\"value\nC=2", line: 3},
+		{name: "unterminated single quote", content: "A='value", line: 1},
+		{name: "text after quotes", content: "A=\"value\" tail", line: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse(tc.content)
+			assert.ErrorIs(t, err, ErrSyntax)
+			var syntaxErr *SyntaxError
+			require.ErrorAs(t, err, &syntaxErr)
+			assert.Equal(t, tc.line, syntaxErr.Line)
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	values := map[string]string{
+		"PLAIN":     "postgres://user:pass@db:5432/app",
+		"EMPTY":     "",
+		"SPACES":    "a b",
+		"MULTILINE": "line\nnext\ttab",
+		"QUOTES":    `say "hi" \ $HOME # here`,
+	}
+
+	content := Format(values)
+	assert.Equal(t, `EMPTY=
+MULTILINE="line\nnext\ttab"
+PLAIN=postgres://user:pass@db:5432/app
+QUOTES="say \"hi\" \\ $HOME # here"
+SPACES="a b"
+`, content)
+
+	parsed, err := Parse(content)
+	require.NoError(t, err)
+	assert.Equal(t, values, parsed, "the formatted values must be parsed back as is")
+}
@@ -2,13 +2,20 @@ package tqsdk
 
 import (
 	"errors"
+	"fmt"
+	"regexp"
 )
 
 var (
 	ErrServiceNameRequired = errors.New("service.name required")
 	ErrHttpPortRequired    = errors.New("service.httpPort required")
+	ErrInvalidSecretKey    = errors.New("service.requiredSecrets has an invalid key")
+	ErrDuplicateSecretKey  = errors.New("service.requiredSecrets has a duplicate key")
 )
 
+// secretKeyRegex matches the keys the secrets are set with
+var secretKeyRegex = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_.-]*$`)
+
 const (
 	DefaultDockerfilePath = "Dockerfile"
 	DefaultDockerContext  = "."
@@ -36,6 +43,9 @@ type Service struct {
 	DockerContext string `json:"dockerContext"`
 	// runtime envs
 	RuntimeEnvs map[string]string `json:"runtimeEnvs"`
+	// RequiredSecrets are the secret keys the service can't run without,
+	// a deployment fails before the build if any of them isn't set for the environment
+	RequiredSecrets []string `json:"requiredSecrets"`
 
 	// The internal port on which this service's run command will listen.
 	HttpPort int `json:"httpPort"`
@@ -70,6 +80,17 @@ func (s *Space) Validate() error {
 		return ErrHttpPortRequired
 	}
 
+	seen := make(map[string]struct{}, len(s.Service.RequiredSecrets))
+	for _, key := range s.Service.RequiredSecrets {
+		if !secretKeyRegex.MatchString(key) {
+			return fmt.Errorf("%w: %q", ErrInvalidSecretKey, key)
+		}
+		if _, ok := seen[key]; ok {
+			return fmt.Errorf("%w: %s", ErrDuplicateSecretKey, key)
+		}
+		seen[key] = struct{}{}
+	}
+
 	if s.Service.DockerfilePath == "" {
 		s.Service.DockerfilePath = DefaultDockerfilePath
 	}
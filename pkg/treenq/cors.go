@@ -12,6 +12,8 @@ var allowedHeaders = []string{
 	"Accept",
 	"Authorization",
 	"X-CSRF-Token",
+	// Last-Event-ID resumes an event stream
+	"Last-Event-ID",
 	WorkspaceHeader,
 }
 
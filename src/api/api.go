@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"log/slog"
 	"net/http"
 	"os"
@@ -16,10 +17,12 @@ import (
 	"github.com/treenq/treenq/src/repo/extract"
 	"github.com/treenq/treenq/src/repo/git"
 	"github.com/treenq/treenq/src/repo/github"
+	"github.com/treenq/treenq/src/repo/pubsub"
 	"github.com/treenq/treenq/src/resources"
 
 	authService "github.com/treenq/treenq/src/services/auth"
 	"github.com/treenq/treenq/src/services/cdk"
+	"github.com/treenq/treenq/src/services/vault"
 )
 
 func New(conf Config) (http.Handler, error) {
@@ -39,7 +42,8 @@ func New(conf Config) (http.Handler, error) {
 	}
 
 	githubJwtIssuer := auth.NewJwtIssuer(conf.GithubClientID, []byte(conf.GithubPrivateKey), nil, conf.JwtTtl)
-	authJwtIssuer := auth.NewJwtIssuer("treenq-api", []byte(conf.AuthPrivateKey), []byte(conf.AuthPublicKey), conf.AuthTtl)
+	authJwtIssuer := auth.NewJwtIssuer("treenq-api", []byte(conf.AuthPrivateKey), []byte(conf.AuthPublicKey), conf.AuthTtl).
+		WithKeyRotation(conf.AuthKeyID, conf.AuthRetiredKeys, conf.AuthKeyGrace)
 	githubClient := github.NewGithubClient(githubJwtIssuer, http.DefaultClient)
 	gitDir := filepath.Join(wd, "gits")
 	gitClient := git.NewGit(gitDir)
@@ -57,14 +61,40 @@ func New(conf Config) (http.Handler, error) {
 	}
 	extractor := extract.NewExtractor()
 
-	authMiddleware := auth.NewJwtMiddleware(authJwtIssuer, l)
 	githubAuthMiddleware := vel.NoopMiddleware
 	if conf.GithubWebhookSecretEnable {
 		sha256Verifier := crypto.NewSha256SignatureVerifier(conf.GithubWebhookSecret, "sha256=")
 		githubAuthMiddleware = crypto.NewSha256SignatureVerifierMiddleware(sha256Verifier, l)
 	}
 
-	oauthProvider := authService.New(conf.GithubClientID, conf.GithubSecret, conf.GithubRedirectURL)
+	cipher, err := crypto.NewAesCipher([]byte(conf.EncryptionKey))
+	if err != nil {
+		return nil, err
+	}
+
+	var oauthProvider domain.OauthProvider = authService.New(conf.GithubClientID, conf.GithubSecret, conf.GithubRedirectURL)
+	if conf.AuthProvider == AuthProviderOidc {
+		oauthProvider, err = authService.NewOidc(context.Background(), http.DefaultClient, authService.OidcConfig{
+			IssuerURL:          conf.OidcIssuerURL,
+			ClientID:           conf.OidcClientID,
+			ClientSecret:       conf.OidcClientSecret,
+			RedirectURL:        conf.OidcRedirectURL,
+			Scopes:             conf.OidcScopes,
+			EmailClaim:         conf.OidcEmailClaim,
+			EmailVerifiedClaim: conf.OidcEmailVerifiedClaim,
+			DisplayNameClaim:   conf.OidcDisplayNameClaim,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	var progressPubSub domain.ProgressPubSub = pubsub.NewMemory()
+	if conf.ProgressPubSub == ProgressPubSubPostgres {
+		progressPubSub, err = pubsub.NewPostgres(conf.DbDsn, db)
+		if err != nil {
+			return nil, err
+		}
+	}
 	kube := cdk.NewKube(conf.Host, conf.DockerRegistry, conf.RegistryUsername, conf.RegistryPassword)
 	handlers := domain.NewHandler(
 		store,
@@ -74,12 +104,30 @@ func New(conf Config) (http.Handler, error) {
 		docker,
 		kube,
 		string(conf.KubeConfig),
+		cipher,
+		crypto.NewEnvelopeCipher(cipher),
+		conf.SecretVersionsKept,
+		func(conf domain.VaultConfig) domain.SecretStore {
+			return vault.NewStore(http.DefaultClient, conf)
+		},
+		conf.BuildLogsRetention,
+		progressPubSub,
 		oauthProvider,
 		authJwtIssuer,
 		conf.AuthRedirectUrl,
 		conf.AuthTtl,
+		conf.RefreshTtl,
+		crypto.NewHmacTokenSigner([]byte(conf.InviteSecret)),
+		conf.InviteTtl,
+		conf.TrustedProxies,
 		l,
 		conf.IsProd,
 	)
-	return resources.NewRouter(handlers, authMiddleware, githubAuthMiddleware, treenq.NewLoggingMiddleware(l), treenq.NewCorsMiddleware(conf.CorsAllowOrigin)).Mux(), nil
+	go handlers.RemoveExpiredBuildLogs(context.Background())
+
+	authMiddleware := auth.NewJwtMiddleware(authJwtIssuer, handlers, handlers, l)
+	mux := resources.NewRouter(handlers, authMiddleware, githubAuthMiddleware, treenq.NewLoggingMiddleware(l), treenq.NewCorsMiddleware(conf.CorsAllowOrigin)).Mux()
+	// the other services verify the treenq tokens with the published keys
+	mux.Handle("GET /.well-known/jwks.json", auth.NewJwksHandler(authJwtIssuer))
+	return mux, nil
 }
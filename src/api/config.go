@@ -2,19 +2,26 @@ package api
 
 import (
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net/netip"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/kelseyhightower/envconfig"
+	"github.com/treenq/treenq/pkg/auth"
 )
 
 var (
 	ErrRegistryUnknownAuthType = errors.New("OCI registry auth type is unknown")
 	ErrRegistryBasicAuthEmpty  = errors.New("oci registry basic auth is empty")
 	ErrRegistryTokenEmpty      = errors.New("oci registry token is empty")
+	ErrAuthUnknownProvider     = errors.New("auth provider is unknown")
+	ErrOidcConfigEmpty         = errors.New("oidc issuer url, client id and redirect url are required")
+	ErrProgressUnknownPubSub   = errors.New("progress pubsub is unknown")
 )
 
 type Config struct {
@@ -42,12 +49,48 @@ type Config struct {
 	BuildkitTLSCA string `envconfig:"BUILDKIT_TLS_CA" required:"false"`
 
 	KubeConfig FileSource `envconfig:"KUBE_CONFIG" required:"true"`
+	// EncryptionKey is a 32 bytes key encrypting sensitive data at rest, e.g. workspace kubeconfigs
+	EncryptionKey StringBase64 `envconfig:"ENCRYPTION_KEY" required:"true"`
+	// SecretVersionsKept is how many versions of every secret are kept to roll back to, including the current one
+	SecretVersionsKept int `envconfig:"SECRET_VERSIONS_KEPT" default:"10"`
+	// BuildLogsRetention is how long the build logs are kept to read and search, zero keeps them forever
+	BuildLogsRetention time.Duration `envconfig:"BUILD_LOGS_RETENTION" default:"720h"`
+	// ProgressPubSub delivers the build progress across the api replicas, postgres or memory,
+	// memory fits a single replica only, e.g. the local development
+	ProgressPubSub string `envconfig:"PROGRESS_PUBSUB" default:"postgres"`
 
 	AuthPrivateKey  StringBase64  `envconfig:"AUTH_PRIVATE_KEY" required:"true"`
 	AuthPublicKey   StringBase64  `envconfig:"AUTH_PUBLIC_KEY" required:"true"`
-	AuthTtl         time.Duration `envconfig:"AUTH_TTL" default:"24h"`
+	AuthTtl         time.Duration `envconfig:"AUTH_TTL" default:"15m"`
+	RefreshTtl      time.Duration `envconfig:"REFRESH_TTL" default:"720h"`
 	AuthRedirectUrl string        `envconfig:"AUTH_REDIRECT_URL" required:"true"`
 
+	// AuthKeyID identifies the active AUTH_PRIVATE_KEY in the kid header of the issued tokens,
+	// to rotate the key the active one is moved to AUTH_RETIRED_KEYS and the new one gets another id
+	AuthKeyID string `envconfig:"AUTH_KEY_ID" default:"default"`
+	// AuthRetiredKeys is a json list of {"id", "publicKey", "retiredAt"}, publicKey is a base64 encoded pem
+	AuthRetiredKeys JwtKeys `envconfig:"AUTH_RETIRED_KEYS"`
+	// AuthKeyGrace is how long the tokens signed by a retired key are accepted after its retirement
+	AuthKeyGrace time.Duration `envconfig:"AUTH_KEY_GRACE" default:"24h"`
+
+	// AuthProvider logs in the users, github or oidc,
+	// the github app settings are required either way to connect the repos
+	AuthProvider string `envconfig:"AUTH_PROVIDER" default:"github"`
+	// Oidc* settings configure a generic OpenID Connect provider discovered by its issuer url, e.g. a Keycloak realm
+	OidcIssuerURL    string   `envconfig:"OIDC_ISSUER_URL"`
+	OidcClientID     string   `envconfig:"OIDC_CLIENT_ID"`
+	OidcClientSecret string   `envconfig:"OIDC_CLIENT_SECRET"`
+	OidcRedirectURL  string   `envconfig:"OIDC_REDIRECT_URL"`
+	OidcScopes       []string `envconfig:"OIDC_SCOPES" default:"openid,email,profile"`
+	// OidcEmailClaim, OidcEmailVerifiedClaim and OidcDisplayNameClaim map the provider claims to the user
+	OidcEmailClaim         string `envconfig:"OIDC_EMAIL_CLAIM" default:"email"`
+	OidcEmailVerifiedClaim string `envconfig:"OIDC_EMAIL_VERIFIED_CLAIM" default:"email_verified"`
+	OidcDisplayNameClaim   string `envconfig:"OIDC_DISPLAY_NAME_CLAIM" default:"preferred_username"`
+
+	// InviteSecret signs the workspace invitation tokens
+	InviteSecret StringBase64  `envconfig:"INVITE_SECRET" required:"true"`
+	InviteTtl    time.Duration `envconfig:"INVITE_TTL" default:"72h"`
+
 	// Host is a main app host to provide a quick preview for the deployed apps
 	Host string `envconfig:"HOST" required:"true"`
 
@@ -60,6 +103,9 @@ type Config struct {
 
 	// HTTP settings
 	CorsAllowOrigin string `envconfig:"CORS_ALLOW_ORIGIN" required:"true"`
+	// TrustedProxies is a comma separated list of the proxy addresses or cidrs whose X-Forwarded-For is believed,
+	// the client address of the other requests is the remote address
+	TrustedProxies TrustedProxies `envconfig:"TRUSTED_PROXIES"`
 
 	IsProd bool `envconfig:"IS_PROD" default:"true"`
 }
@@ -75,6 +121,35 @@ func (s *StringBase64) Decode(value string) error {
 	return nil
 }
 
+type JwtKeys []auth.JwtKey
+
+func (k *JwtKeys) Decode(value string) error {
+	return json.Unmarshal([]byte(value), (*[]auth.JwtKey)(k))
+}
+
+type TrustedProxies []netip.Prefix
+
+func (p *TrustedProxies) Decode(value string) error {
+	var prefixes []netip.Prefix
+	for item := range strings.SplitSeq(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(item); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(item)
+		if err != nil {
+			return fmt.Errorf("failed to parse trusted proxy %s: %w", item, err)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	*p = prefixes
+	return nil
+}
+
 type FileSource string
 
 func (s *FileSource) Decode(value string) error {
@@ -94,6 +169,16 @@ func (s *FileSource) Decode(value string) error {
 	return nil
 }
 
+const (
+	AuthProviderGithub = "github"
+	AuthProviderOidc   = "oidc"
+)
+
+const (
+	ProgressPubSubPostgres = "postgres"
+	ProgressPubSubMemory   = "memory"
+)
+
 const (
 	OciAuthTypeNoauth = "noauth"
 	OciAuthTypeBasic  = "basic"
@@ -107,6 +192,17 @@ func NewConfig() (Config, error) {
 		return conf, err
 	}
 
+	if conf.AuthProvider != AuthProviderGithub && conf.AuthProvider != AuthProviderOidc {
+		return conf, fmt.Errorf("given '%s': %w", conf.AuthProvider, ErrAuthUnknownProvider)
+	}
+	if conf.AuthProvider == AuthProviderOidc && (conf.OidcIssuerURL == "" || conf.OidcClientID == "" || conf.OidcRedirectURL == "") {
+		return conf, ErrOidcConfigEmpty
+	}
+
+	if conf.ProgressPubSub != ProgressPubSubPostgres && conf.ProgressPubSub != ProgressPubSubMemory {
+		return conf, fmt.Errorf("given '%s': %w", conf.ProgressPubSub, ErrProgressUnknownPubSub)
+	}
+
 	if conf.RegistryAuthType != OciAuthTypeNoauth && conf.RegistryAuthType != OciAuthTypeBasic && conf.RegistryAuthType != OciAuthTypeToken {
 		return conf, fmt.Errorf("given '%s': %w", conf.RegistryAuthType, ErrRegistryUnknownAuthType)
 	}
@@ -0,0 +1,206 @@
+package domain
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/dennypenta/vel"
+	"github.com/rs/xid"
+	"github.com/treenq/treenq/pkg/auth"
+)
+
+var ErrApiTokenNotFound = errors.New("api token not found")
+
+// operationRegex matches the api operation ids, e.g. deploy or getDeployment
+var operationRegex = regexp.MustCompile(`^[a-zA-Z]+$`)
+
+// ApiToken is a long-lived personal token limited to a workspace and a set of operations,
+// the token has no more access than its user role in the workspace
+type ApiToken struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Operations []string  `json:"operations"`
+	ExpiresAt  time.Time `json:"expiresAt,omitzero"`
+	LastUsedAt time.Time `json:"lastUsedAt,omitzero"`
+	CreatedAt  time.Time `json:"createdAt"`
+
+	WorkspaceID string `json:"-"`
+	UserID      string `json:"-"`
+	// TokenHash is a sha256 of the token, the token itself is never stored
+	TokenHash string `json:"-"`
+	// User is the token owner, it's filled only on the token verification
+	User UserInfo `json:"-"`
+}
+
+type CreateApiTokenRequest struct {
+	Name string `json:"name"`
+	// Operations are the api operation ids the token may call, e.g. deploy and getDeployment
+	Operations []string `json:"operations"`
+	// ExpiresAt is optional, the token never expires if it's empty
+	ExpiresAt time.Time `json:"expiresAt,omitzero"`
+}
+
+type CreateApiTokenResponse struct {
+	ApiToken ApiToken `json:"apiToken"`
+	// Token is returned only once, it's sent as a bearer Authorization header
+	Token string `json:"token"`
+}
+
+// CreateApiToken issues a personal api token for the current workspace,
+// a token can't issue another token
+func (h *Handler) CreateApiToken(ctx context.Context, req CreateApiTokenRequest) (CreateApiTokenResponse, *vel.Error) {
+	if req.Name == "" {
+		return CreateApiTokenResponse{}, &vel.Error{
+			Code: "NAME_REQUIRED",
+		}
+	}
+	if len(req.Operations) == 0 {
+		return CreateApiTokenResponse{}, &vel.Error{
+			Code: "OPERATIONS_REQUIRED",
+		}
+	}
+	for _, operation := range req.Operations {
+		if !operationRegex.MatchString(operation) {
+			return CreateApiTokenResponse{}, &vel.Error{
+				Code:    "INVALID_OPERATION",
+				Message: "operation " + operation + " is invalid",
+			}
+		}
+	}
+	if !req.ExpiresAt.IsZero() && req.ExpiresAt.Before(time.Now()) {
+		return CreateApiTokenResponse{}, &vel.Error{
+			Code: "INVALID_EXPIRATION",
+		}
+	}
+	if _, ok := auth.ClaimsFromCtx(ctx)["apiTokenID"]; ok {
+		return CreateApiTokenResponse{}, &vel.Error{
+			Code: "API_TOKEN_NOT_ALLOWED",
+		}
+	}
+
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return CreateApiTokenResponse{}, rpcErr
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return CreateApiTokenResponse{}, &vel.Error{
+			Message: "failed to generate api token",
+			Err:     err,
+		}
+	}
+	token := auth.ApiTokenPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	apiToken, err := h.db.SaveApiToken(ctx, ApiToken{
+		ID:          xid.New().String(),
+		Name:        req.Name,
+		Operations:  req.Operations,
+		ExpiresAt:   req.ExpiresAt,
+		WorkspaceID: profile.UserInfo.CurrentWorkspace,
+		UserID:      profile.UserInfo.ID,
+		TokenHash:   hashApiToken(token),
+	})
+	if err != nil {
+		return CreateApiTokenResponse{}, &vel.Error{
+			Message: "failed to save api token",
+			Err:     err,
+		}
+	}
+
+	return CreateApiTokenResponse{
+		ApiToken: apiToken,
+		Token:    token,
+	}, nil
+}
+
+type GetApiTokensResponse struct {
+	ApiTokens []ApiToken `json:"apiTokens"`
+}
+
+// GetApiTokens gives the user tokens of the current workspace
+func (h *Handler) GetApiTokens(ctx context.Context, _ struct{}) (GetApiTokensResponse, *vel.Error) {
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return GetApiTokensResponse{}, rpcErr
+	}
+
+	tokens, err := h.db.GetApiTokens(ctx, profile.UserInfo.CurrentWorkspace, profile.UserInfo.ID)
+	if err != nil {
+		return GetApiTokensResponse{}, &vel.Error{
+			Message: "failed to get api tokens",
+			Err:     err,
+		}
+	}
+
+	return GetApiTokensResponse{ApiTokens: tokens}, nil
+}
+
+type RevokeApiTokenRequest struct {
+	ID string `json:"id"`
+}
+
+// RevokeApiToken removes the user token, it's rejected right away
+func (h *Handler) RevokeApiToken(ctx context.Context, req RevokeApiTokenRequest) (struct{}, *vel.Error) {
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return struct{}{}, rpcErr
+	}
+
+	if err := h.db.RemoveApiToken(ctx, profile.UserInfo.CurrentWorkspace, profile.UserInfo.ID, req.ID); err != nil {
+		if errors.Is(err, ErrApiTokenNotFound) {
+			return struct{}{}, &vel.Error{
+				Code: "API_TOKEN_NOT_FOUND",
+			}
+		}
+		return struct{}{}, &vel.Error{
+			Message: "failed to revoke api token",
+			Err:     err,
+		}
+	}
+
+	return struct{}{}, nil
+}
+
+// VerifyApiToken implements auth.ApiTokenVerifier,
+// the claims have the token workspace as the only one, so the workspace header isn't needed
+func (h *Handler) VerifyApiToken(ctx context.Context, token, operation string) (map[string]any, error) {
+	apiToken, err := h.db.GetApiTokenByHash(ctx, hashApiToken(token))
+	if err != nil {
+		if errors.Is(err, ErrApiTokenNotFound) {
+			return nil, auth.ErrInvalidApiToken
+		}
+		return nil, err
+	}
+	if !apiToken.ExpiresAt.IsZero() && apiToken.ExpiresAt.Before(time.Now()) {
+		return nil, auth.ErrInvalidApiToken
+	}
+	if !slices.Contains(apiToken.Operations, operation) {
+		return nil, auth.ErrOperationNotAllowed
+	}
+
+	if err := h.db.TouchApiToken(ctx, apiToken.ID); err != nil {
+		return nil, err
+	}
+
+	return map[string]any{
+		"id":          apiToken.User.ID,
+		"email":       apiToken.User.Email,
+		"displayName": apiToken.User.DisplayName,
+		// the jwt claims are decoded the same way
+		"workspaces": []any{apiToken.WorkspaceID},
+		"apiTokenID": apiToken.ID,
+	}, nil
+}
+
+func hashApiToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,117 @@
+package domain
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dennypenta/vel"
+)
+
+var ErrDeploymentNotAwaitingApproval = errors.New("deployment is not awaiting approval")
+
+type ApproveDeploymentRequest struct {
+	DeploymentID string `json:"deploymentID"`
+}
+
+// ApproveDeployment lets a deployment to a protected repo or environment proceed,
+// the approver must have the approve permission and differ from the user requested the deployment,
+// the deployments to an environment having a required approver are approved by that user only
+func (h *Handler) ApproveDeployment(ctx context.Context, req ApproveDeploymentRequest) (GetDeploymentResponse, *vel.Error) {
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return GetDeploymentResponse{}, rpcErr
+	}
+
+	deployment, err := h.db.GetDeployment(ctx, profile.UserInfo.CurrentWorkspace, req.DeploymentID)
+	if err != nil {
+		if errors.Is(err, ErrDeploymentNotFound) {
+			return GetDeploymentResponse{}, &vel.Error{
+				Code: "DEPLOYMENT_NOT_FOUND",
+			}
+		}
+		return GetDeploymentResponse{}, &vel.Error{
+			Message: "failed to get deployment",
+			Err:     err,
+		}
+	}
+	if deployment.Status != DeployStatusAwaitingApproval {
+		return GetDeploymentResponse{}, &vel.Error{
+			Code: "DEPLOYMENT_NOT_AWAITING_APPROVAL",
+		}
+	}
+	if isDeployer(deployment, profile.UserInfo) {
+		return GetDeploymentResponse{}, &vel.Error{
+			Code: "SELF_APPROVAL_NOT_ALLOWED",
+		}
+	}
+
+	workspace, repo, rpcErr := h.workspaceRepo(ctx, profile.UserInfo.CurrentWorkspace, deployment.RepoID)
+	if rpcErr != nil {
+		return GetDeploymentResponse{}, rpcErr
+	}
+	env, rpcErr := h.repoEnvironment(ctx, workspace.ID, repo.TreenqID, deployment.Environment)
+	if rpcErr != nil {
+		return GetDeploymentResponse{}, rpcErr
+	}
+	if env.RequiredApprover != "" && env.RequiredApprover != profile.UserInfo.ID {
+		return GetDeploymentResponse{}, &vel.Error{
+			Code: "APPROVER_REQUIRED",
+		}
+	}
+
+	approvedAt, err := h.db.ApproveDeployment(ctx, workspace.ID, deployment.ID, profile.UserInfo.DisplayName)
+	if err != nil {
+		if errors.Is(err, ErrDeploymentNotAwaitingApproval) {
+			return GetDeploymentResponse{}, &vel.Error{
+				Code: "DEPLOYMENT_NOT_AWAITING_APPROVAL",
+			}
+		}
+		return GetDeploymentResponse{}, &vel.Error{
+			Message: "failed to approve deployment",
+			Err:     err,
+		}
+	}
+	deployment.Status = DeployStatusRunning
+	deployment.ApprovedBy = profile.UserInfo.DisplayName
+	deployment.ApprovedAt = approvedAt
+
+	h.runDeployment(ctx, deployment, repo, workspace)
+
+	return GetDeploymentResponse{Deployment: deployment}, nil
+}
+
+// isDeployer tells if the user has requested the deployment, the deployments having no user id,
+// e.g. the webhook ones or created before the user ids were kept, are matched by the display name
+func isDeployer(deployment AppDeployment, user UserInfo) bool {
+	if deployment.UserID != "" {
+		return deployment.UserID == user.ID
+	}
+	return deployment.UserDisplayName == user.DisplayName
+}
+
+type SetRepoProtectionRequest struct {
+	RepoID    string `json:"repoID"`
+	Protected bool   `json:"protected"`
+}
+
+// SetRepoProtection requires an admin approval for the deployments of the repo to all of its environments
+func (h *Handler) SetRepoProtection(ctx context.Context, req SetRepoProtectionRequest) (struct{}, *vel.Error) {
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return struct{}{}, rpcErr
+	}
+
+	if err := h.db.SetRepoProtected(ctx, profile.UserInfo.CurrentWorkspace, req.RepoID, req.Protected); err != nil {
+		if errors.Is(err, ErrRepoNotFound) {
+			return struct{}{}, &vel.Error{
+				Code: "REPO_NOT_FOUND",
+			}
+		}
+		return struct{}{}, &vel.Error{
+			Message: "failed to set repo protection",
+			Err:     err,
+		}
+	}
+
+	return struct{}{}, nil
+}
@@ -0,0 +1,347 @@
+package domain
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/dennypenta/vel"
+	"github.com/rs/xid"
+	"github.com/treenq/treenq/pkg/auth"
+)
+
+// AuditEvent is an append-only record of a mutating api call, a secret reveal or a github webhook change
+type AuditEvent struct {
+	ID          string `json:"id"`
+	WorkspaceID string `json:"workspaceID"`
+	// ActorID is a user id, empty for the github webhooks
+	ActorID string `json:"actorID"`
+	// ActorName is a user display name or a github login of the webhook sender
+	ActorName string `json:"actorName"`
+	// ApiTokenID is set if the user has called the api with a personal api token
+	ApiTokenID string `json:"apiTokenID,omitempty"`
+	// Action is an api operation, e.g. deploy or revealSecret, the github webhook actions are prefixed with github.
+	Action string `json:"action"`
+	// Target keeps the identifiers of the request, e.g. repoID, environment and key, the secret values are never kept
+	Target map[string]string `json:"target"`
+	// Status is a response status code, so the failed attempts are seen too
+	Status    int       `json:"status"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"userAgent"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// auditTargetFields are the request fields identifying the target of an action
+var auditTargetFields = []string{
+	"id",
+	"repoID",
+	"deploymentID",
+	"environment",
+	"namespace",
+	"key",
+	"version",
+	"branch",
+	"sha",
+	"tag",
+	"image",
+	"clusterID",
+	"groupID",
+	"registry",
+	"name",
+	"email",
+	"githubLogin",
+	"userID",
+	"role",
+	"sessionID",
+	"protected",
+	"restart",
+	"format",
+	"dryRun",
+	"kind",
+	"vaultAddress",
+	"workspaceID",
+}
+
+// maxAuditBody limits the request body read to find the target
+const maxAuditBody = 1 << 20
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+type auditEventKey struct{}
+
+// setAuditActor names the actor of an action the user is not authenticated for yet, e.g. a login
+func setAuditActor(ctx context.Context, user UserInfo) {
+	if event, ok := ctx.Value(auditEventKey{}).(*AuditEvent); ok {
+		event.ActorID = user.ID
+		event.ActorName = user.DisplayName
+	}
+}
+
+// Audit is a middleware recording a handled request to the audit log,
+// the actor is taken from the token verified by the auth middleware before,
+// the handlers of the unauthenticated requests name it with setAuditActor
+func (h *Handler) Audit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event := AuditEvent{
+			Action:    path.Base(r.URL.Path),
+			Target:    auditTarget(r),
+			IP:        h.clientIP(r),
+			UserAgent: truncate(r.UserAgent(), 255),
+		}
+
+		if claims := auth.ClaimsFromCtx(r.Context()); claims != nil {
+			user := userFromClaims(claims)
+			event.ActorID = user.ID
+			event.ActorName = user.DisplayName
+			event.ApiTokenID, _ = claims["apiTokenID"].(string)
+			// the actions out of a workspace, e.g. the sessions revocation, are kept without it
+			if userInfo, rpcErr := userInfoFromClaims(claims, r); rpcErr == nil {
+				event.WorkspaceID = userInfo.CurrentWorkspace
+			}
+		}
+
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), auditEventKey{}, &event)))
+
+		event.Status = sw.status
+		if event.Status == 0 {
+			event.Status = http.StatusOK
+		}
+		h.recordAudit(context.WithoutCancel(r.Context()), event)
+	})
+}
+
+// auditTarget picks the target fields of the query or the json body, the body is restored for the handler
+func auditTarget(r *http.Request) map[string]string {
+	target := make(map[string]string)
+	if r.Method == http.MethodGet {
+		query := r.URL.Query()
+		for _, field := range auditTargetFields {
+			if value := query.Get(field); value != "" {
+				target[field] = value
+			}
+		}
+		return target
+	}
+
+	if r.Body == nil {
+		return target
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxAuditBody))
+	if err != nil {
+		return target
+	}
+	r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+
+	var fields map[string]any
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return target
+	}
+	for _, field := range auditTargetFields {
+		switch value := fields[field].(type) {
+		case string:
+			if value != "" {
+				target[field] = value
+			}
+		case bool, float64:
+			target[field] = fmt.Sprint(value)
+		}
+	}
+
+	return target
+}
+
+// recordAudit saves an audit event, a failure is logged, it never fails the action itself
+func (h *Handler) recordAudit(ctx context.Context, event AuditEvent) {
+	event.ID = xid.New().String()
+	if event.Target == nil {
+		event.Target = map[string]string{}
+	}
+	if err := h.db.SaveAuditEvent(ctx, event); err != nil {
+		h.l.ErrorContext(ctx, "failed to save audit event", "action", event.Action, "err", err)
+	}
+}
+
+// auditWebhook records a change made by a github webhook
+func (h *Handler) auditWebhook(ctx context.Context, req GithubWebhookRequest, action, workspaceID string, target map[string]string) {
+	h.recordAudit(ctx, AuditEvent{
+		WorkspaceID: workspaceID,
+		ActorName:   req.Sender.Login,
+		Action:      "github." + action,
+		Target:      target,
+		Status:      http.StatusOK,
+	})
+}
+
+// AuditFilter narrows the audit log, zero fields match everything
+type AuditFilter struct {
+	Action  string
+	ActorID string
+	RepoID  string
+	Since   time.Time
+	Until   time.Time
+	// Before is an id of the last event of the previous page
+	Before string
+	Limit  int
+}
+
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 500
+)
+
+type GetAuditLogRequest struct {
+	Action  string    `json:"action"`
+	ActorID string    `json:"actorID"`
+	RepoID  string    `json:"repoID"`
+	Since   time.Time `json:"since,omitzero"`
+	Until   time.Time `json:"until,omitzero"`
+	// Cursor is NextCursor of the previous page
+	Cursor string `json:"cursor"`
+	// Limit is 50 by default and 500 at most
+	Limit int `json:"limit"`
+}
+
+type GetAuditLogResponse struct {
+	Events []AuditEvent `json:"events"`
+	// NextCursor is empty on the last page
+	NextCursor string `json:"nextCursor"`
+}
+
+// GetAuditLog gives the workspace audit events, the latest first
+func (h *Handler) GetAuditLog(ctx context.Context, req GetAuditLogRequest) (GetAuditLogResponse, *vel.Error) {
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return GetAuditLogResponse{}, rpcErr
+	}
+
+	if req.Limit < 0 || req.Limit > maxAuditLimit {
+		return GetAuditLogResponse{}, &vel.Error{
+			Code:    "INVALID_LIMIT",
+			Message: "limit must be between 1 and " + strconv.Itoa(maxAuditLimit),
+		}
+	}
+	if req.Limit == 0 {
+		req.Limit = defaultAuditLimit
+	}
+
+	events, err := h.db.GetAuditEvents(ctx, profile.UserInfo.CurrentWorkspace, AuditFilter{
+		Action:  req.Action,
+		ActorID: req.ActorID,
+		RepoID:  req.RepoID,
+		Since:   req.Since,
+		Until:   req.Until,
+		Before:  req.Cursor,
+		Limit:   req.Limit,
+	})
+	if err != nil {
+		return GetAuditLogResponse{}, &vel.Error{
+			Message: "failed to get audit events",
+			Err:     err,
+		}
+	}
+
+	resp := GetAuditLogResponse{Events: events}
+	if len(events) == req.Limit {
+		resp.NextCursor = events[len(events)-1].ID
+	}
+	return resp, nil
+}
+
+type ExportAuditLogRequest struct {
+	Action  string `schema:"action"`
+	ActorID string `schema:"actorID"`
+	RepoID  string `schema:"repoID"`
+	// Since and Until are RFC 3339 times
+	Since string `schema:"since"`
+	Until string `schema:"until"`
+}
+
+// ExportAuditLog streams the filtered workspace audit events as json lines, the latest first
+func (h *Handler) ExportAuditLog(ctx context.Context, req ExportAuditLogRequest) (struct{}, *vel.Error) {
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return struct{}{}, rpcErr
+	}
+
+	filter := AuditFilter{
+		Action:  req.Action,
+		ActorID: req.ActorID,
+		RepoID:  req.RepoID,
+		Limit:   maxAuditLimit,
+	}
+	for _, t := range []struct {
+		value string
+		time  *time.Time
+	}{{req.Since, &filter.Since}, {req.Until, &filter.Until}} {
+		if t.value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, t.value)
+		if err != nil {
+			return struct{}{}, &vel.Error{
+				Code:    "INVALID_TIME",
+				Message: "since and until must be RFC 3339 times",
+			}
+		}
+		*t.time = parsed
+	}
+
+	w := vel.WriterFromContext(ctx)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="audit-log.jsonl"`)
+
+	encoder := json.NewEncoder(w)
+	for page := 0; ; page++ {
+		events, err := h.db.GetAuditEvents(ctx, profile.UserInfo.CurrentWorkspace, filter)
+		if err != nil {
+			if page == 0 {
+				return struct{}{}, &vel.Error{
+					Message: "failed to get audit events",
+					Err:     err,
+				}
+			}
+			// the response has started already, the export is cut short
+			h.l.ErrorContext(ctx, "failed to get audit events to export", "err", err)
+			return struct{}{}, nil
+		}
+		for _, event := range events {
+			if err := encoder.Encode(event); err != nil {
+				return struct{}{}, nil
+			}
+		}
+		if len(events) < filter.Limit {
+			return struct{}{}, nil
+		}
+		filter.Before = events[len(events)-1].ID
+	}
+}
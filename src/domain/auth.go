@@ -9,6 +9,7 @@ import (
 	"github.com/dennypenta/vel"
 	"github.com/rs/xid"
 	"github.com/treenq/treenq/pkg/auth"
+	"golang.org/x/oauth2"
 )
 
 var (
@@ -17,14 +18,37 @@ var (
 	ErrInstallationNotFound = errors.New("installation not found")
 	ErrUnauthorized         = errors.New("unauthorized: github token expired or invalid")
 	ErrWorkspaceNotFound    = errors.New("workspace not found")
+	// ErrEmailNotVerified is returned by OauthProvider if the provider hasn't verified the user email,
+	// the users are linked by the email, so an unverified one is never accepted
+	ErrEmailNotVerified = errors.New("email is not verified")
+	// ErrNoGithubAccount is returned by OauthProvider if the users log in with another provider
+	ErrNoGithubAccount = errors.New("user has no github account")
+	// ErrIdentityNotFound is returned if a user has never logged in with a provider
+	ErrIdentityNotFound = errors.New("identity not found")
 )
 
+// GithubProvider is a provider of the identities of the users logged in with GitHub
+const GithubProvider = "github"
+
 type UserInfo struct {
 	ID               string   `json:"id"`
 	Email            string   `json:"email"`
 	DisplayName      string   `json:"displayName"`
 	CurrentWorkspace string   `json:"currentWorkspace"`
 	Workspaces       []string `json:"workspaces"`
+	// Provider and Subject identify a user given by OauthProvider, the display name is up to the provider user,
+	// so a user is never matched by it
+	Provider string `json:"-"`
+	Subject  string `json:"-"`
+	// Login is a user name verified by the provider, e.g. a GitHub login, empty if the provider has none
+	Login string `json:"-"`
+}
+
+// UserIdentity is a provider account a user has logged in with
+type UserIdentity struct {
+	Provider string
+	Subject  string
+	Login    string
 }
 
 type Workspace struct {
@@ -32,11 +56,17 @@ type Workspace struct {
 	Name          string `json:"name"`
 	GithubOrgName string `json:"githubOrgName,omitempty"`
 	Role          string `json:"role"`
+	// Personal workspace is created along with a user, it can't be renamed or removed
+	Personal bool `json:"personal"`
+	// Namespace prefixes the kube namespaces of the workspace apps,
+	// it's fixed at the workspace creation, so a rename doesn't move the running apps
+	Namespace string `json:"-"`
 }
 
 func (h *Handler) GithubAuthHandler(w http.ResponseWriter, r *http.Request) {
 	state := h.writeState(w)
-	authUrl := h.oauthProvider.AuthUrl(state)
+	verifier := h.writeVerifier(w)
+	authUrl := h.oauthProvider.AuthUrl(state, verifier)
 	http.Redirect(w, r, authUrl, http.StatusTemporaryRedirect)
 }
 
@@ -50,6 +80,17 @@ func (h *Handler) writeState(w http.ResponseWriter) string {
 	return state
 }
 
+// writeVerifier keeps a PKCE code verifier until the provider calls back
+func (h *Handler) writeVerifier(w http.ResponseWriter) string {
+	verifier := oauth2.GenerateVerifier()
+	exp := time.Second * 300
+	expiration := time.Now().Add(exp)
+
+	cookie := http.Cookie{Name: "authverifier", Value: verifier, Expires: expiration, MaxAge: int(exp.Seconds()), HttpOnly: true, SameSite: http.SameSiteLaxMode, Secure: h.isProd}
+	http.SetCookie(w, &cookie)
+	return verifier
+}
+
 func (h *Handler) writeToken(w http.ResponseWriter, token string) {
 	expiration := time.Now().Add(h.authTtl)
 
@@ -84,8 +125,21 @@ func (h *Handler) GithubCallbackHandler(ctx context.Context, req CodeExchangeReq
 		}
 	}
 
-	user, err := h.oauthProvider.ExchangeUser(r.Context(), req.Code)
+	verifier, _ := r.Cookie("authverifier")
+	if verifier == nil {
+		return GithubCallbackResponse{}, &vel.Error{
+			Code:    "COOKIE_IS_EMPTY",
+			Message: "cookie authverifier is expected",
+		}
+	}
+
+	user, err := h.oauthProvider.ExchangeUser(r.Context(), req.Code, verifier.Value)
 	if err != nil {
+		if errors.Is(err, ErrEmailNotVerified) {
+			return GithubCallbackResponse{}, &vel.Error{
+				Code: "EMAIL_NOT_VERIFIED",
+			}
+		}
 		return GithubCallbackResponse{}, &vel.Error{
 			Code:    "UNKNOWN",
 			Message: "failed to fetch user form oauth provider",
@@ -101,29 +155,28 @@ func (h *Handler) GithubCallbackHandler(ctx context.Context, req CodeExchangeReq
 			Err:     err,
 		}
 	}
+	setAuditActor(ctx, savedUser)
 
-	token, err := h.jwtIssuer.GenerateJwtToken(map[string]any{
-		"id":          savedUser.ID,
-		"email":       savedUser.Email,
-		"displayName": savedUser.DisplayName,
-		"workspaces":  savedUser.Workspaces,
-	})
-	if err != nil {
-		return GithubCallbackResponse{}, &vel.Error{
-			Message: "failed ogenerate jwt token",
-			Err:     err,
-		}
+	if rpcErr := h.startSession(ctx, savedUser); rpcErr != nil {
+		return GithubCallbackResponse{}, rpcErr
 	}
-	h.writeToken(w, token)
 	http.Redirect(w, r, h.authRedirectUrl, http.StatusTemporaryRedirect)
 	return GithubCallbackResponse{}, nil
 }
 
+// Logout revokes the current session and clears the tokens
 func (h *Handler) Logout(ctx context.Context, req struct{}) (struct{}, *vel.Error) {
-	w := vel.WriterFromContext(ctx)
-
-	cookie := http.Cookie{Name: auth.AuthKey, Value: "", MaxAge: -1, HttpOnly: true, SameSite: http.SameSiteLaxMode}
-	http.SetCookie(w, &cookie)
+	claims := auth.ClaimsFromCtx(ctx)
+	if sessionID, _ := claims[auth.SessionClaim].(string); sessionID != "" {
+		err := h.db.RevokeSession(ctx, userFromClaims(claims).ID, sessionID)
+		if err != nil && !errors.Is(err, ErrSessionNotFound) {
+			return struct{}{}, &vel.Error{
+				Message: "failed to revoke session",
+				Err:     err,
+			}
+		}
+	}
+	h.clearTokens(vel.WriterFromContext(ctx))
 
 	return struct{}{}, nil
 }
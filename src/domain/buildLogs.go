@@ -0,0 +1,225 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dennypenta/vel"
+)
+
+// BuildLog is a persisted progress message of a deployment
+type BuildLog struct {
+	ID           int64  `json:"id"`
+	DeploymentID string `json:"deploymentID"`
+	// RepoID and Environment are given by the search only
+	RepoID      string     `json:"repoID,omitempty"`
+	Environment string     `json:"environment,omitempty"`
+	Payload     string     `json:"payload"`
+	Level       slog.Level `json:"level"`
+	Final       bool       `json:"final,omitempty"`
+	ErrorCode   string     `json:"errorCode,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	// Deployment is a deployment snapshot the progress message is given with
+	Deployment AppDeployment `json:"-"`
+}
+
+func (l BuildLog) ProgressMessage() ProgressMessage {
+	return ProgressMessage{
+		ID:         l.ID,
+		Payload:    l.Payload,
+		Level:      l.Level,
+		Final:      l.Final,
+		Timestamp:  l.CreatedAt,
+		Deployment: l.Deployment,
+		ErrorCode:  l.ErrorCode,
+	}
+}
+
+// BuildLogFilter narrows the build logs search, zero fields except Query match everything
+type BuildLogFilter struct {
+	// Query is a full-text query, e.g. "npm error" or "timeout -retry"
+	Query        string
+	RepoID       string
+	DeploymentID string
+	Since        time.Time
+	Until        time.Time
+	// Before is an id of the last log of the previous page
+	Before int64
+	Limit  int
+}
+
+const (
+	defaultBuildLogsLimit = 100
+	maxBuildLogsLimit     = 1000
+)
+
+type SearchBuildLogsRequest struct {
+	Query        string    `json:"query"`
+	RepoID       string    `json:"repoID"`
+	DeploymentID string    `json:"deploymentID"`
+	Since        time.Time `json:"since,omitzero"`
+	Until        time.Time `json:"until,omitzero"`
+	// Cursor is NextCursor of the previous page
+	Cursor string `json:"cursor"`
+	// Limit is 100 by default and 1000 at most
+	Limit int `json:"limit"`
+}
+
+type SearchBuildLogsResponse struct {
+	Logs []BuildLog `json:"logs"`
+	// NextCursor is empty on the last page
+	NextCursor string `json:"nextCursor"`
+}
+
+// SearchBuildLogs gives the workspace build logs matching a full-text query, the latest first,
+// the logs are kept for the build logs retention
+func (h *Handler) SearchBuildLogs(ctx context.Context, req SearchBuildLogsRequest) (SearchBuildLogsResponse, *vel.Error) {
+	if strings.TrimSpace(req.Query) == "" {
+		return SearchBuildLogsResponse{}, &vel.Error{
+			Code: "EMPTY_QUERY",
+		}
+	}
+	if req.Limit < 0 || req.Limit > maxBuildLogsLimit {
+		return SearchBuildLogsResponse{}, &vel.Error{
+			Code:    "INVALID_LIMIT",
+			Message: "limit must be between 1 and " + strconv.Itoa(maxBuildLogsLimit),
+		}
+	}
+	if req.Limit == 0 {
+		req.Limit = defaultBuildLogsLimit
+	}
+	var before int64
+	if req.Cursor != "" {
+		var err error
+		before, err = strconv.ParseInt(req.Cursor, 10, 64)
+		if err != nil {
+			return SearchBuildLogsResponse{}, &vel.Error{
+				Code: "INVALID_CURSOR",
+			}
+		}
+	}
+
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return SearchBuildLogsResponse{}, rpcErr
+	}
+
+	logs, err := h.db.SearchBuildLogs(ctx, profile.UserInfo.CurrentWorkspace, BuildLogFilter{
+		Query:        req.Query,
+		RepoID:       req.RepoID,
+		DeploymentID: req.DeploymentID,
+		Since:        req.Since,
+		Until:        req.Until,
+		Before:       before,
+		Limit:        req.Limit,
+	})
+	if err != nil {
+		return SearchBuildLogsResponse{}, &vel.Error{
+			Message: "failed to search build logs",
+			Err:     err,
+		}
+	}
+
+	resp := SearchBuildLogsResponse{Logs: logs}
+	if len(logs) == req.Limit {
+		resp.NextCursor = strconv.FormatInt(logs[len(logs)-1].ID, 10)
+	}
+	return resp, nil
+}
+
+type DownloadBuildLogsRequest struct {
+	DeploymentID string `schema:"deploymentID"`
+}
+
+// DownloadBuildLogs gives the build logs of a deployment as plain text, a line per message
+func (h *Handler) DownloadBuildLogs(ctx context.Context, req DownloadBuildLogsRequest) (struct{}, *vel.Error) {
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return struct{}{}, rpcErr
+	}
+	belongs, err := h.db.DeploymentBelongsToWorkspace(ctx, profile.UserInfo.CurrentWorkspace, req.DeploymentID)
+	if err != nil {
+		return struct{}{}, &vel.Error{
+			Err:     err,
+			Message: "failed to verify whom a deployment belong to",
+		}
+	}
+	if !belongs {
+		return struct{}{}, &vel.Error{
+			Code: "DEPLOYMENT_NOT_FOUND",
+		}
+	}
+
+	logs, err := h.db.GetBuildLogs(ctx, req.DeploymentID, 0)
+	if err != nil {
+		return struct{}{}, &vel.Error{
+			Message: "failed to get build logs",
+			Err:     err,
+		}
+	}
+	if len(logs) == 0 {
+		return struct{}{}, &vel.Error{
+			Code: "NO_LOGS",
+		}
+	}
+
+	w := vel.WriterFromContext(ctx)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.log"`, req.DeploymentID))
+	for _, buildLog := range logs {
+		// the build output comes in chunks, a chunk may have many lines and a trailing line break
+		for _, line := range strings.Split(strings.TrimRight(buildLog.Payload, "\r\n"), "\n") {
+			if _, err := fmt.Fprintf(w, "%s %s %s\n", buildLog.CreatedAt.UTC().Format(time.RFC3339Nano), buildLog.Level, line); err != nil {
+				return struct{}{}, nil
+			}
+		}
+	}
+	return struct{}{}, nil
+}
+
+const (
+	// buildLogsRetentionInterval is how often the expired build logs are removed
+	buildLogsRetentionInterval = time.Hour
+	// buildLogsRemoveBatch limits the logs removed by a single statement, so a table lock is short
+	buildLogsRemoveBatch   = 10000
+	buildLogsRemoveTimeout = 30 * time.Second
+)
+
+// RemoveExpiredBuildLogs removes the build logs older than the retention every hour until the context is done,
+// a failure is logged only and retried on the next tick
+func (h *Handler) RemoveExpiredBuildLogs(ctx context.Context) {
+	if h.buildLogsRetention <= 0 {
+		return
+	}
+	ticker := time.NewTicker(buildLogsRetentionInterval)
+	defer ticker.Stop()
+	for {
+		h.removeExpiredBuildLogs(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (h *Handler) removeExpiredBuildLogs(ctx context.Context) {
+	before := time.Now().Add(-h.buildLogsRetention)
+	for ctx.Err() == nil {
+		removeCtx, cancel := context.WithTimeout(ctx, buildLogsRemoveTimeout)
+		removed, err := h.db.RemoveBuildLogs(removeCtx, before, buildLogsRemoveBatch)
+		cancel()
+		if err != nil {
+			log.Println("[ERROR] failed to remove expired build logs", err)
+			return
+		}
+		if removed < buildLogsRemoveBatch {
+			return
+		}
+	}
+}
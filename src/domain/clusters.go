@@ -0,0 +1,322 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dennypenta/vel"
+)
+
+var (
+	ErrClusterNotFound = errors.New("cluster not found")
+	ErrClusterInUse    = errors.New("cluster is used by a repo")
+	ErrClusterExists   = errors.New("cluster already exists")
+)
+
+// Cluster is a Kubernetes cluster registered by a workspace,
+// the repos of the workspace may be deployed to it instead of the default treenq cluster
+type Cluster struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+	// KubeConfig is encrypted, it's never returned back by the api
+	KubeConfig []byte `json:"-"`
+}
+
+type AddClusterRequest struct {
+	Name       string `json:"name"`
+	KubeConfig string `json:"kubeConfig"`
+}
+
+type AddClusterResponse struct {
+	Cluster Cluster `json:"cluster"`
+}
+
+func (h *Handler) AddCluster(ctx context.Context, req AddClusterRequest) (AddClusterResponse, *vel.Error) {
+	if req.Name == "" || req.KubeConfig == "" {
+		return AddClusterResponse{}, &vel.Error{
+			Code: "INVALID_CLUSTER",
+		}
+	}
+
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return AddClusterResponse{}, rpcErr
+	}
+
+	kubeConfig, err := h.cipher.Encrypt([]byte(req.KubeConfig))
+	if err != nil {
+		return AddClusterResponse{}, &vel.Error{
+			Message: "failed to encrypt kube config",
+			Err:     err,
+		}
+	}
+
+	cluster, err := h.db.SaveCluster(ctx, profile.UserInfo.CurrentWorkspace, Cluster{
+		Name:       req.Name,
+		KubeConfig: kubeConfig,
+	})
+	if err != nil {
+		// a cluster is never replaced, the repos deployed to it would be moved silently
+		if errors.Is(err, ErrClusterExists) {
+			return AddClusterResponse{}, &vel.Error{
+				Code: "CLUSTER_EXISTS",
+			}
+		}
+		return AddClusterResponse{}, &vel.Error{
+			Message: "failed to save cluster",
+			Err:     err,
+		}
+	}
+
+	return AddClusterResponse{Cluster: cluster}, nil
+}
+
+type GetClustersResponse struct {
+	Clusters []Cluster `json:"clusters"`
+}
+
+func (h *Handler) GetClusters(ctx context.Context, _ struct{}) (GetClustersResponse, *vel.Error) {
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return GetClustersResponse{}, rpcErr
+	}
+
+	clusters, err := h.db.GetClusters(ctx, profile.UserInfo.CurrentWorkspace)
+	if err != nil {
+		return GetClustersResponse{}, &vel.Error{
+			Message: "failed to get clusters",
+			Err:     err,
+		}
+	}
+
+	return GetClustersResponse{Clusters: clusters}, nil
+}
+
+type RemoveClusterRequest struct {
+	ClusterID string `json:"clusterID"`
+}
+
+func (h *Handler) RemoveCluster(ctx context.Context, req RemoveClusterRequest) (struct{}, *vel.Error) {
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return struct{}{}, rpcErr
+	}
+
+	if err := h.db.RemoveCluster(ctx, profile.UserInfo.CurrentWorkspace, req.ClusterID); err != nil {
+		if errors.Is(err, ErrClusterNotFound) {
+			return struct{}{}, &vel.Error{
+				Code: "CLUSTER_NOT_FOUND",
+			}
+		}
+		if errors.Is(err, ErrClusterInUse) {
+			return struct{}{}, &vel.Error{
+				Code: "CLUSTER_IN_USE",
+			}
+		}
+		return struct{}{}, &vel.Error{
+			Message: "failed to remove cluster",
+			Err:     err,
+		}
+	}
+
+	return struct{}{}, nil
+}
+
+type SetRepoClusterRequest struct {
+	RepoID string `json:"repoID"`
+	// ClusterID is empty to deploy the repo to the default treenq cluster
+	ClusterID string `json:"clusterID"`
+}
+
+// SetRepoCluster selects a cluster the next deployments of the repo go to,
+// the repo secrets are copied to the new cluster, the workload running in the previous cluster is kept as is
+func (h *Handler) SetRepoCluster(ctx context.Context, req SetRepoClusterRequest) (struct{}, *vel.Error) {
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return struct{}{}, rpcErr
+	}
+
+	workspace, err := h.db.GetWorkspaceByID(ctx, profile.UserInfo.CurrentWorkspace)
+	if err != nil {
+		if errors.Is(err, ErrWorkspaceNotFound) {
+			return struct{}{}, &vel.Error{
+				Code: "WORKSPACE_NOT_FOUND",
+			}
+		}
+		return struct{}{}, &vel.Error{
+			Message: "failed to get workspace info",
+			Err:     err,
+		}
+	}
+
+	repo, err := h.db.GetRepoByID(ctx, workspace.ID, req.RepoID)
+	if err != nil {
+		if errors.Is(err, ErrRepoNotFound) {
+			return struct{}{}, &vel.Error{
+				Code: "REPO_NOT_FOUND",
+			}
+		}
+		return struct{}{}, &vel.Error{
+			Message: "failed to get repo",
+			Err:     err,
+		}
+	}
+	if repo.ClusterID == req.ClusterID {
+		return struct{}{}, nil
+	}
+
+	fromKubeConfig, rpcErr := h.clusterKubeConfig(ctx, workspace.ID, repo.ClusterID)
+	if rpcErr != nil {
+		return struct{}{}, rpcErr
+	}
+	toKubeConfig, rpcErr := h.clusterKubeConfig(ctx, workspace.ID, req.ClusterID)
+	if rpcErr != nil {
+		return struct{}{}, rpcErr
+	}
+
+	// an external store keeps the values in place, the copy just rewrites them
+	store, rpcErr := h.secretStore(ctx, workspace.ID)
+	if rpcErr != nil {
+		return struct{}{}, rpcErr
+	}
+
+	envs, err := h.db.GetEnvironments(ctx, repo.TreenqID)
+	if err != nil {
+		return struct{}{}, &vel.Error{
+			Message: "failed to get repo environments",
+			Err:     err,
+		}
+	}
+	envNames := []string{""}
+	for _, env := range envs {
+		envNames = append(envNames, env.Name)
+	}
+
+	for _, envName := range envNames {
+		secretKeys, err := h.db.GetRepositorySecretKeys(ctx, repo.TreenqID, envName, workspace.ID)
+		if err != nil {
+			return struct{}{}, &vel.Error{
+				Message: "failed to get repo secret keys",
+				Err:     err,
+			}
+		}
+		id := appID(repo.TreenqID, envName)
+		for _, key := range secretKeys {
+			value, err := store.GetSecret(ctx, fromKubeConfig, workspace.Namespace, id, key)
+			if err != nil {
+				return struct{}{}, &vel.Error{
+					Message: "failed to get secret " + key,
+					Err:     err,
+				}
+			}
+			if err := store.StoreSecret(ctx, toKubeConfig, workspace.Namespace, id, key, value); err != nil {
+				return struct{}{}, &vel.Error{
+					Message: "failed to copy secret " + key,
+					Err:     err,
+				}
+			}
+		}
+	}
+
+	if err := h.db.SetRepoCluster(ctx, workspace.ID, repo.TreenqID, req.ClusterID); err != nil {
+		if errors.Is(err, ErrRepoNotFound) {
+			return struct{}{}, &vel.Error{
+				Code: "REPO_NOT_FOUND",
+			}
+		}
+		return struct{}{}, &vel.Error{
+			Message: "failed to set repo cluster",
+			Err:     err,
+		}
+	}
+
+	return struct{}{}, nil
+}
+
+type CheckClusterRequest struct {
+	// ClusterID is empty to check the default treenq cluster
+	ClusterID string `json:"clusterID"`
+}
+
+type CheckClusterResponse struct {
+	Reachable bool `json:"reachable"`
+	// Version is a Kubernetes version of the cluster
+	Version string `json:"version"`
+	// Error describes why the cluster is not reachable
+	Error string `json:"error"`
+}
+
+func (h *Handler) CheckCluster(ctx context.Context, req CheckClusterRequest) (CheckClusterResponse, *vel.Error) {
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return CheckClusterResponse{}, rpcErr
+	}
+
+	kubeConfig, rpcErr := h.clusterKubeConfig(ctx, profile.UserInfo.CurrentWorkspace, req.ClusterID)
+	if rpcErr != nil {
+		return CheckClusterResponse{}, rpcErr
+	}
+
+	version, err := h.kube.CheckConnection(ctx, kubeConfig)
+	if err != nil {
+		return CheckClusterResponse{
+			Error: err.Error(),
+		}, nil
+	}
+
+	return CheckClusterResponse{
+		Reachable: true,
+		Version:   version,
+	}, nil
+}
+
+// clusterKubeConfig gives a decrypted kube config of the workspace cluster,
+// the default treenq cluster is used if the cluster id is empty
+func (h *Handler) clusterKubeConfig(ctx context.Context, workspaceID, clusterID string) (string, *vel.Error) {
+	if clusterID == "" {
+		return h.kubeConfig, nil
+	}
+
+	cluster, err := h.db.GetCluster(ctx, workspaceID, clusterID)
+	if err != nil {
+		if errors.Is(err, ErrClusterNotFound) {
+			return "", &vel.Error{
+				Code: "CLUSTER_NOT_FOUND",
+			}
+		}
+		return "", &vel.Error{
+			Message: "failed to get cluster",
+			Err:     err,
+		}
+	}
+
+	kubeConfig, err := h.cipher.Decrypt(cluster.KubeConfig)
+	if err != nil {
+		return "", &vel.Error{
+			Message: "failed to decrypt kube config",
+			Err:     err,
+		}
+	}
+
+	return string(kubeConfig), nil
+}
+
+// repoKubeConfig gives a kube config of the cluster the repo is deployed to
+func (h *Handler) repoKubeConfig(ctx context.Context, workspaceID, repoID string) (string, *vel.Error) {
+	repo, err := h.db.GetRepoByID(ctx, workspaceID, repoID)
+	if err != nil {
+		if errors.Is(err, ErrRepoNotFound) {
+			return "", &vel.Error{
+				Code: "REPO_NOT_FOUND",
+			}
+		}
+		return "", &vel.Error{
+			Message: "failed to get repo",
+			Err:     err,
+		}
+	}
+
+	return h.clusterKubeConfig(ctx, workspaceID, repo.ClusterID)
+}
@@ -8,11 +8,17 @@ import (
 )
 
 type DeployRequest struct {
-	RepoID           string `json:"repoID"`
+	RepoID string `json:"repoID"`
+	// Environment is a target environment name, empty for the default one,
+	// together with FromDeploymentID it promotes the image of a deployment made to another environment
+	Environment      string `json:"environment"`
 	FromDeploymentID string `json:"fromDeploymentID"`
 	Branch           string `json:"branch"`
 	Sha              string `json:"sha"`
 	Tag              string `json:"tag"`
+	// Image is a prebuilt image reference, e.g. ghcr.io/org/app:1.0.0,
+	// mutually exclusive to Branch, Sha and Tag
+	Image string `json:"image"`
 }
 
 func (h *Handler) Deploy(ctx context.Context, req DeployRequest) (GetDeploymentResponse, *vel.Error) {
@@ -41,15 +47,22 @@ func (h *Handler) Deploy(ctx context.Context, req DeployRequest) (GetDeploymentR
 		}
 	}
 
+	env, rpcErr := h.repoEnvironment(ctx, workspace.ID, repo.TreenqID, req.Environment)
+	if rpcErr != nil {
+		return GetDeploymentResponse{}, rpcErr
+	}
+
 	appDeployment, apiErr := h.deployRepo(
 		ctx,
-		profile.UserInfo.DisplayName,
+		profile.UserInfo,
 		workspace,
 		repo,
+		env,
 		req.FromDeploymentID,
 		req.Branch,
 		req.Sha,
 		req.Tag,
+		req.Image,
 	)
 	if apiErr != nil {
 		return GetDeploymentResponse{}, apiErr
@@ -0,0 +1,407 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dennypenta/vel"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+var (
+	ErrEnvironmentNotFound = errors.New("environment not found")
+	ErrEnvironmentExists   = errors.New("environment already exists")
+)
+
+// Environment is a named deployment target of a repo, e.g. staging or production,
+// every environment runs in its own namespace with its own secrets and url.
+// The repo itself is the default environment with an empty name.
+type Environment struct {
+	ID     string `json:"id"`
+	RepoID string `json:"repoID"`
+	Name   string `json:"name"`
+	// Branch triggers a deployment to the environment on a push to the branch
+	Branch string `json:"branch"`
+	// TagPrefix triggers a deployment to the environment on a pushed tag starting with the prefix,
+	// "*" means any tag
+	TagPrefix string `json:"tagPrefix"`
+	// Overrides are applied on top of the space of every deployment to the environment
+	Overrides SpaceOverrides `json:"overrides"`
+	// RequiredApprover is an id of a workspace member having the approve permission,
+	// if set the promotions to the environment await this user approval, and only this user approves them
+	RequiredApprover string `json:"requiredApprover"`
+	// Protected requires a workspace admin approval for every deployment to the environment
+	Protected bool `json:"protected"`
+	// Namespace and URL are computed, they aren't stored
+	Namespace string    `json:"namespace"`
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	WorkspaceID string `json:"-"`
+}
+
+// Triggers reports whether a pushed git ref must be deployed to the environment
+func (e Environment) Triggers(ref string) bool {
+	if e.Branch != "" && ref == "refs/heads/"+e.Branch {
+		return true
+	}
+	if e.TagPrefix == "" {
+		return false
+	}
+	tag, ok := strings.CutPrefix(ref, "refs/tags/")
+	if !ok {
+		return false
+	}
+	return e.TagPrefix == "*" || strings.HasPrefix(tag, e.TagPrefix)
+}
+
+// SpaceOverrides changes a space defined in a repo for a specific environment,
+// zero values keep the repo defined values
+type SpaceOverrides struct {
+	Replicas int `json:"replicas"`
+	// RuntimeEnvs are merged into the service runtime envs, the environment values win
+	RuntimeEnvs         map[string]string         `json:"runtimeEnvs"`
+	ComputationResource tqsdk.ComputationResource `json:"computationResource"`
+}
+
+// Apply gives a copy of the space with the overrides applied
+func (o SpaceOverrides) Apply(space tqsdk.Space) tqsdk.Space {
+	if o.Replicas > 0 {
+		space.Service.Replicas = o.Replicas
+	}
+	if len(o.RuntimeEnvs) > 0 {
+		envs := make(map[string]string, len(space.Service.RuntimeEnvs)+len(o.RuntimeEnvs))
+		maps.Copy(envs, space.Service.RuntimeEnvs)
+		maps.Copy(envs, o.RuntimeEnvs)
+		space.Service.RuntimeEnvs = envs
+	}
+	if o.ComputationResource.CpuUnits > 0 {
+		space.Service.ComputationResource.CpuUnits = o.ComputationResource.CpuUnits
+	}
+	if o.ComputationResource.MemoryMibs > 0 {
+		space.Service.ComputationResource.MemoryMibs = o.ComputationResource.MemoryMibs
+	}
+	if o.ComputationResource.DiskGibs > 0 {
+		space.Service.ComputationResource.DiskGibs = o.ComputationResource.DiskGibs
+	}
+	return space
+}
+
+// environment name is a part of a namespace and a host, therefore it must be a valid dns label
+var environmentNameRegex = regexp.MustCompile(`^[a-z]([a-z0-9-]{0,18}[a-z0-9])?$`)
+
+// appID identifies an app of the repo environment in a cluster,
+// the default environment keeps the repo id, so the apps deployed before environments stay in place
+func appID(repoID, environment string) string {
+	if environment == "" {
+		return repoID
+	}
+	return repoID + "-" + environment
+}
+
+type CreateEnvironmentRequest struct {
+	RepoID           string         `json:"repoID"`
+	Name             string         `json:"name"`
+	Branch           string         `json:"branch"`
+	TagPrefix        string         `json:"tagPrefix"`
+	Overrides        SpaceOverrides `json:"overrides"`
+	RequiredApprover string         `json:"requiredApprover"`
+	Protected        bool           `json:"protected"`
+}
+
+type EnvironmentResponse struct {
+	Environment Environment `json:"environment"`
+}
+
+func (h *Handler) CreateEnvironment(ctx context.Context, req CreateEnvironmentRequest) (EnvironmentResponse, *vel.Error) {
+	if !environmentNameRegex.MatchString(req.Name) {
+		return EnvironmentResponse{}, &vel.Error{
+			Code: "INVALID_ENVIRONMENT_NAME",
+		}
+	}
+	if req.Branch != "" && req.TagPrefix != "" {
+		return EnvironmentResponse{}, &vel.Error{
+			Code: "ONLY_BRANCH_OR_TAG_PREFIX_ALLOWED",
+		}
+	}
+
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return EnvironmentResponse{}, rpcErr
+	}
+
+	workspace, repo, rpcErr := h.workspaceRepo(ctx, profile.UserInfo.CurrentWorkspace, req.RepoID)
+	if rpcErr != nil {
+		return EnvironmentResponse{}, rpcErr
+	}
+	if rpcErr := h.checkRequiredApprover(ctx, workspace.ID, req.RequiredApprover); rpcErr != nil {
+		return EnvironmentResponse{}, rpcErr
+	}
+
+	env, err := h.db.SaveEnvironment(ctx, Environment{
+		RepoID:           repo.TreenqID,
+		WorkspaceID:      workspace.ID,
+		Name:             req.Name,
+		Branch:           req.Branch,
+		TagPrefix:        req.TagPrefix,
+		Overrides:        req.Overrides,
+		RequiredApprover: req.RequiredApprover,
+		Protected:        req.Protected,
+	})
+	if err != nil {
+		if errors.Is(err, ErrEnvironmentExists) {
+			return EnvironmentResponse{}, &vel.Error{
+				Code: "ENVIRONMENT_ALREADY_EXISTS",
+			}
+		}
+		return EnvironmentResponse{}, &vel.Error{
+			Message: "failed to save environment",
+			Err:     err,
+		}
+	}
+
+	return EnvironmentResponse{Environment: h.withAddress(env, workspace)}, nil
+}
+
+type GetEnvironmentsRequest struct {
+	RepoID string `json:"repoID"`
+}
+
+type GetEnvironmentsResponse struct {
+	Environments []Environment `json:"environments"`
+}
+
+func (h *Handler) GetEnvironments(ctx context.Context, req GetEnvironmentsRequest) (GetEnvironmentsResponse, *vel.Error) {
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return GetEnvironmentsResponse{}, rpcErr
+	}
+
+	workspace, repo, rpcErr := h.workspaceRepo(ctx, profile.UserInfo.CurrentWorkspace, req.RepoID)
+	if rpcErr != nil {
+		return GetEnvironmentsResponse{}, rpcErr
+	}
+
+	envs, err := h.db.GetEnvironments(ctx, repo.TreenqID)
+	if err != nil {
+		return GetEnvironmentsResponse{}, &vel.Error{
+			Message: "failed to get environments",
+			Err:     err,
+		}
+	}
+	for i := range envs {
+		envs[i] = h.withAddress(envs[i], workspace)
+	}
+
+	return GetEnvironmentsResponse{Environments: envs}, nil
+}
+
+type UpdateEnvironmentRequest struct {
+	RepoID           string         `json:"repoID"`
+	Name             string         `json:"name"`
+	Branch           string         `json:"branch"`
+	TagPrefix        string         `json:"tagPrefix"`
+	Overrides        SpaceOverrides `json:"overrides"`
+	RequiredApprover string         `json:"requiredApprover"`
+	Protected        bool           `json:"protected"`
+}
+
+// UpdateEnvironment changes the triggers and the overrides of an environment,
+// the overrides take effect on the next deployment
+func (h *Handler) UpdateEnvironment(ctx context.Context, req UpdateEnvironmentRequest) (EnvironmentResponse, *vel.Error) {
+	if req.Branch != "" && req.TagPrefix != "" {
+		return EnvironmentResponse{}, &vel.Error{
+			Code: "ONLY_BRANCH_OR_TAG_PREFIX_ALLOWED",
+		}
+	}
+
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return EnvironmentResponse{}, rpcErr
+	}
+
+	workspace, repo, rpcErr := h.workspaceRepo(ctx, profile.UserInfo.CurrentWorkspace, req.RepoID)
+	if rpcErr != nil {
+		return EnvironmentResponse{}, rpcErr
+	}
+
+	env, rpcErr := h.repoEnvironment(ctx, workspace.ID, repo.TreenqID, req.Name)
+	if rpcErr != nil {
+		return EnvironmentResponse{}, rpcErr
+	}
+	if env.Name == "" {
+		return EnvironmentResponse{}, &vel.Error{
+			Code: "INVALID_ENVIRONMENT_NAME",
+		}
+	}
+	if rpcErr := h.checkRequiredApprover(ctx, workspace.ID, req.RequiredApprover); rpcErr != nil {
+		return EnvironmentResponse{}, rpcErr
+	}
+
+	env.Branch = req.Branch
+	env.TagPrefix = req.TagPrefix
+	env.Overrides = req.Overrides
+	env.RequiredApprover = req.RequiredApprover
+	env.Protected = req.Protected
+	if err := h.db.UpdateEnvironment(ctx, env); err != nil {
+		if errors.Is(err, ErrEnvironmentNotFound) {
+			return EnvironmentResponse{}, &vel.Error{
+				Code: "ENVIRONMENT_NOT_FOUND",
+			}
+		}
+		return EnvironmentResponse{}, &vel.Error{
+			Message: "failed to update environment",
+			Err:     err,
+		}
+	}
+
+	return EnvironmentResponse{Environment: h.withAddress(env, workspace)}, nil
+}
+
+// checkRequiredApprover fails with INVALID_REQUIRED_APPROVER unless the approver is a workspace member able to approve
+func (h *Handler) checkRequiredApprover(ctx context.Context, workspaceID, userID string) *vel.Error {
+	if userID == "" {
+		return nil
+	}
+	role, err := h.db.GetWorkspaceRole(ctx, workspaceID, userID)
+	if err != nil && !errors.Is(err, ErrWorkspaceNotFound) {
+		return &vel.Error{
+			Message: "failed to get workspace role",
+			Err:     err,
+		}
+	}
+	if err != nil || !RoleAllows(role, PermissionApprove) {
+		return &vel.Error{
+			Code:    "INVALID_REQUIRED_APPROVER",
+			Message: "the required approver must be a workspace member able to approve deployments",
+		}
+	}
+	return nil
+}
+
+type RemoveEnvironmentRequest struct {
+	RepoID string `json:"repoID"`
+	Name   string `json:"name"`
+}
+
+// RemoveEnvironment deletes the environment namespace with everything running in it and the environment secrets,
+// the deployments history is kept
+func (h *Handler) RemoveEnvironment(ctx context.Context, req RemoveEnvironmentRequest) (struct{}, *vel.Error) {
+	if req.Name == "" {
+		return struct{}{}, &vel.Error{
+			Code: "INVALID_ENVIRONMENT_NAME",
+		}
+	}
+
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return struct{}{}, rpcErr
+	}
+
+	workspace, repo, rpcErr := h.workspaceRepo(ctx, profile.UserInfo.CurrentWorkspace, req.RepoID)
+	if rpcErr != nil {
+		return struct{}{}, rpcErr
+	}
+
+	env, rpcErr := h.repoEnvironment(ctx, workspace.ID, repo.TreenqID, req.Name)
+	if rpcErr != nil {
+		return struct{}{}, rpcErr
+	}
+
+	kubeConfig, rpcErr := h.clusterKubeConfig(ctx, workspace.ID, repo.ClusterID)
+	if rpcErr != nil {
+		return struct{}{}, rpcErr
+	}
+	if err := h.kube.RemoveNamespace(ctx, kubeConfig, appID(repo.TreenqID, env.Name), workspace.Namespace); err != nil {
+		return struct{}{}, &vel.Error{
+			Message: "failed to remove environment namespace",
+			Err:     err,
+		}
+	}
+	store, rpcErr := h.secretStore(ctx, workspace.ID)
+	if rpcErr != nil {
+		return struct{}{}, rpcErr
+	}
+	if rpcErr := h.removeStoredSecrets(ctx, store, kubeConfig, workspace, repo.TreenqID, env.Name); rpcErr != nil {
+		return struct{}{}, rpcErr
+	}
+
+	if err := h.db.RemoveEnvironment(ctx, workspace.ID, repo.TreenqID, env.Name); err != nil {
+		if errors.Is(err, ErrEnvironmentNotFound) {
+			return struct{}{}, &vel.Error{
+				Code: "ENVIRONMENT_NOT_FOUND",
+			}
+		}
+		return struct{}{}, &vel.Error{
+			Message: "failed to remove environment",
+			Err:     err,
+		}
+	}
+
+	return struct{}{}, nil
+}
+
+// repoEnvironment gives an environment of the repo by its name,
+// an empty name gives the default environment
+func (h *Handler) repoEnvironment(ctx context.Context, workspaceID, repoID, name string) (Environment, *vel.Error) {
+	if name == "" {
+		return Environment{RepoID: repoID, WorkspaceID: workspaceID}, nil
+	}
+
+	env, err := h.db.GetEnvironment(ctx, workspaceID, repoID, name)
+	if err != nil {
+		if errors.Is(err, ErrEnvironmentNotFound) {
+			return Environment{}, &vel.Error{
+				Code: "ENVIRONMENT_NOT_FOUND",
+			}
+		}
+		return Environment{}, &vel.Error{
+			Message: "failed to get environment",
+			Err:     err,
+		}
+	}
+
+	return env, nil
+}
+
+// workspaceRepo gives a workspace and its repo
+func (h *Handler) workspaceRepo(ctx context.Context, workspaceID, repoID string) (Workspace, GithubRepository, *vel.Error) {
+	workspace, err := h.db.GetWorkspaceByID(ctx, workspaceID)
+	if err != nil {
+		if errors.Is(err, ErrWorkspaceNotFound) {
+			return Workspace{}, GithubRepository{}, &vel.Error{
+				Code: "WORKSPACE_NOT_FOUND",
+			}
+		}
+		return Workspace{}, GithubRepository{}, &vel.Error{
+			Message: "failed to get workspace info",
+			Err:     err,
+		}
+	}
+
+	repo, err := h.db.GetRepoByID(ctx, workspace.ID, repoID)
+	if err != nil {
+		if errors.Is(err, ErrRepoNotFound) {
+			return Workspace{}, GithubRepository{}, &vel.Error{
+				Code: "REPO_NOT_FOUND",
+			}
+		}
+		return Workspace{}, GithubRepository{}, &vel.Error{
+			Message: "failed to get repo",
+			Err:     err,
+		}
+	}
+
+	return workspace, repo, nil
+}
+
+func (h *Handler) withAddress(env Environment, workspace Workspace) Environment {
+	id := appID(env.RepoID, env.Name)
+	env.Namespace = h.kube.Namespace(id, workspace.Namespace)
+	env.URL = h.kube.AppURL(id)
+	return env
+}
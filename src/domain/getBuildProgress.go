@@ -2,10 +2,10 @@ package domain
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
-	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/dennypenta/vel"
 )
@@ -52,23 +52,24 @@ func (h *Handler) GetBuildProgress(ctx context.Context, req GetBuildProgressRequ
 		}
 	}
 
-	messages := progress.Get(ctx, req.DeploymentID)
-
+	// the ids are the build log ids, a reconnected client gets the messages it has missed only
+	messages := h.progress.Get(ctx, req.DeploymentID, lastEventID(ctx))
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
 	for {
 		select {
 		case m, ok := <-messages:
 			if !ok {
 				return GetBuildProgressResponse{}, nil
 			}
-			b, err := json.Marshal(GetBuildProgressResponse{Message: m})
-			if err != nil {
+			if err := writeEvent(w, flusher, strconv.FormatInt(m.ID, 10), GetBuildProgressResponse{Message: m}); err != nil {
 				return GetBuildProgressResponse{}, &vel.Error{
 					Err:     err,
 					Message: "failed to write a progress message",
 				}
 			}
-			fmt.Fprintf(w, "data: %s\n\n", b)
-			flusher.Flush()
+		case <-heartbeat.C:
+			writeHeartbeat(w, flusher)
 		case <-ctx.Done():
 			return GetBuildProgressResponse{}, nil
 		}
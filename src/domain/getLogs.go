@@ -2,17 +2,22 @@ package domain
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/dennypenta/vel"
 )
 
 type GetLogsRequest struct {
-	RepoID string `schema:"repoID"`
+	RepoID      string `schema:"repoID"`
+	Environment string `schema:"environment"`
 }
 
 type GetLogsResponse struct {
@@ -41,6 +46,10 @@ func (h *Handler) GetLogs(ctx context.Context, req GetLogsRequest) (GetLogsRespo
 		return GetLogsResponse{}, rpcErr
 	}
 
+	// the ids are the positions of every pod streamed, so a reconnected client is given the lines
+	// written after the last one of each pod it has received
+	positions := ParseLogPositions(vel.RequestFromContext(ctx).Header.Get("Last-Event-ID"))
+
 	logChan := make(chan ProgressMessage, 100)
 
 	go func() {
@@ -56,7 +65,17 @@ func (h *Handler) GetLogs(ctx context.Context, req GetLogsRequest) (GetLogsRespo
 
 			return
 		}
-		err = h.kube.StreamLogs(ctx, h.kubeConfig, req.RepoID, workspace.Name, logChan)
+		kubeConfig, rpcErr := h.repoKubeConfig(ctx, workspace.ID, req.RepoID)
+		if rpcErr != nil {
+			logChan <- ProgressMessage{
+				ErrorCode: rpcErr.Code,
+				Payload:   rpcErr.Message,
+				Level:     slog.LevelError,
+				Final:     true,
+			}
+			return
+		}
+		err = h.kube.StreamLogs(ctx, kubeConfig, appID(req.RepoID, req.Environment), workspace.Namespace, positions.Clone(), logChan)
 		if errors.Is(err, ErrNoPodsRunning) {
 			logChan <- ProgressMessage{
 				ErrorCode: "NO_PODS_RUNNING",
@@ -73,6 +92,8 @@ func (h *Handler) GetLogs(ctx context.Context, req GetLogsRequest) (GetLogsRespo
 		}
 	}()
 
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
 	for {
 		select {
 		case msg, ok := <-logChan:
@@ -80,22 +101,79 @@ func (h *Handler) GetLogs(ctx context.Context, req GetLogsRequest) (GetLogsRespo
 				return GetLogsResponse{}, nil
 			}
 
-			b, err := json.Marshal(GetLogsResponse{Message: msg})
-			if err != nil {
+			// the errors have no pod, they keep the last event id of the client
+			id := ""
+			if msg.Pod != "" {
+				positions[msg.Pod] = msg.Timestamp
+				id = positions.String()
+			}
+			if err := writeEvent(w, flusher, id, GetLogsResponse{Message: msg}); err != nil {
 				return GetLogsResponse{}, &vel.Error{
 					Err:     err,
 					Message: "failed to write a log message",
 				}
 			}
 
-			fmt.Fprintf(w, "data: %s\n\n", b)
-			flusher.Flush()
-
 			if msg.Final {
 				return GetLogsResponse{}, nil
 			}
+		case <-heartbeat.C:
+			writeHeartbeat(w, flusher)
 		case <-ctx.Done():
 			return GetLogsResponse{}, nil
 		}
 	}
 }
+
+// LogPositions keeps the time of the last log line given of every pod, a stream is resumed after them.
+// The lines a pod writes at the same nanosecond as its last given one are skipped, the kubelet time makes it unlikely.
+type LogPositions map[string]time.Time
+
+// ParseLogPositions parses the positions written by String, an invalid value gives empty positions
+func ParseLogPositions(s string) LogPositions {
+	positions := LogPositions{}
+	if s == "" {
+		return positions
+	}
+	for _, position := range strings.Split(s, ",") {
+		pod, nanos, ok := strings.Cut(position, "@")
+		if !ok || pod == "" {
+			return LogPositions{}
+		}
+		n, err := strconv.ParseInt(nanos, 10, 64)
+		if err != nil || n <= 0 {
+			return LogPositions{}
+		}
+		positions[pod] = time.Unix(0, n).UTC()
+	}
+	return positions
+}
+
+// String gives the positions as pod@unixnano pairs separated by commas, a pod name has neither of them
+func (p LogPositions) String() string {
+	pods := slices.Sorted(maps.Keys(p))
+	positions := make([]string, len(pods))
+	for i, pod := range pods {
+		positions[i] = pod + "@" + strconv.FormatInt(p[pod].UnixNano(), 10)
+	}
+	return strings.Join(positions, ",")
+}
+
+func (p LogPositions) Clone() LogPositions {
+	return maps.Clone(p)
+}
+
+// Since gives the time the lines of a pod are followed from, a pod started after the stream has broken
+// has no position, so it's followed from the earliest position of the other pods
+func (p LogPositions) Since(pod string) time.Time {
+	if since, ok := p[pod]; ok {
+		return since
+	}
+	var earliest time.Time
+	for _, since := range p {
+		if earliest.IsZero() || since.Before(earliest) {
+			earliest = since
+		}
+	}
+	return earliest
+}
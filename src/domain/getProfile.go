@@ -2,6 +2,7 @@ package domain
 
 import (
 	"context"
+	"net/http"
 	"slices"
 
 	"github.com/dennypenta/vel"
@@ -14,8 +15,49 @@ type GetProfileResponse struct {
 }
 
 func (h *Handler) GetProfile(ctx context.Context, _ struct{}) (GetProfileResponse, *vel.Error) {
-	claims := auth.ClaimsFromCtx(ctx)
+	userInfo, rpcErr := userInfoFromClaims(auth.ClaimsFromCtx(ctx), vel.RequestFromContext(ctx))
+	if rpcErr != nil {
+		return GetProfileResponse{}, rpcErr
+	}
+
+	return GetProfileResponse{
+		UserInfo: userInfo,
+	}, nil
+}
+
+// userInfoFromClaims gives a user of the verified token claims,
+// the current workspace comes from the request header if the user has more than one,
+// the workspace chosen by switchWorkspace is used if the header is empty
+func userInfoFromClaims(claims map[string]any, r *http.Request) (UserInfo, *vel.Error) {
+	user := userFromClaims(claims)
 
+	if len(user.Workspaces) == 1 {
+		user.CurrentWorkspace = user.Workspaces[0]
+		return user, nil
+	}
+
+	currentWorkspace := r.Header.Get(treenq.WorkspaceHeader)
+	if currentWorkspace == "" {
+		currentWorkspace, _ = claims["currentWorkspace"].(string)
+	}
+	if currentWorkspace == "" {
+		return UserInfo{}, &vel.Error{
+			Code: "CURRENT_WORKSPACE_HEADER_REQUIRED",
+		}
+	}
+	if !slices.Contains(user.Workspaces, currentWorkspace) {
+		return UserInfo{}, &vel.Error{
+			Code: "CURRENT_WORKSPACE_HEADER_REQUIRED",
+		}
+	}
+	user.CurrentWorkspace = currentWorkspace
+
+	return user, nil
+}
+
+// userFromClaims gives a user of the verified token claims without resolving the current workspace,
+// it's used by the endpoints not bound to a workspace
+func userFromClaims(claims map[string]any) UserInfo {
 	// Extract workspaces from claims
 	var workspaces []string
 	if workspacesRaw, exists := claims["workspaces"]; exists && workspacesRaw != nil {
@@ -29,31 +71,10 @@ func (h *Handler) GetProfile(ctx context.Context, _ struct{}) (GetProfileRespons
 		}
 	}
 
-	var currentWorkspace string
-	if len(workspaces) == 1 {
-		currentWorkspace = workspaces[0]
-	} else {
-		r := vel.RequestFromContext(ctx)
-		currentWorkspace = r.Header.Get(treenq.WorkspaceHeader)
-		if currentWorkspace == "" {
-			return GetProfileResponse{}, &vel.Error{
-				Code: "CURRENT_WORKSPACE_HEADER_REQUIRED",
-			}
-		}
-		if !slices.Contains(workspaces, currentWorkspace) {
-			return GetProfileResponse{}, &vel.Error{
-				Code: "CURRENT_WORKSPACE_HEADER_REQUIRED",
-			}
-		}
+	return UserInfo{
+		ID:          claims["id"].(string),
+		Email:       claims["email"].(string),
+		DisplayName: claims["displayName"].(string),
+		Workspaces:  workspaces,
 	}
-
-	return GetProfileResponse{
-		UserInfo: UserInfo{
-			ID:               claims["id"].(string),
-			Email:            claims["email"].(string),
-			DisplayName:      claims["displayName"].(string),
-			CurrentWorkspace: currentWorkspace,
-			Workspaces:       workspaces,
-		},
-	}, nil
 }
@@ -7,7 +7,8 @@ import (
 )
 
 type GetSecretsRequest struct {
-	RepoID string `json:"repoID"`
+	RepoID      string `json:"repoID"`
+	Environment string `json:"environment"`
 }
 
 type GetSecretsResponse struct {
@@ -19,7 +20,7 @@ func (h *Handler) GetSecrets(ctx context.Context, req GetSecretsRequest) (GetSec
 	if rpcErr != nil {
 		return GetSecretsResponse{}, rpcErr
 	}
-	keys, err := h.db.GetRepositorySecretKeys(ctx, req.RepoID, profile.UserInfo.CurrentWorkspace)
+	keys, err := h.db.GetRepositorySecretKeys(ctx, req.RepoID, req.Environment, profile.UserInfo.CurrentWorkspace)
 	if err != nil {
 		return GetSecretsResponse{}, &vel.Error{
 			Message: "failed to get secrets keys",
@@ -8,7 +8,8 @@ import (
 )
 
 type GetWorkloadStatsRequest struct {
-	RepoID string `json:"repoID"`
+	RepoID      string `json:"repoID"`
+	Environment string `json:"environment"`
 }
 
 type GetWorkloadStatsResponse struct {
@@ -60,7 +61,12 @@ func (h *Handler) GetWorkloadStats(ctx context.Context, req GetWorkloadStatsRequ
 		}
 	}
 
-	stats, err := h.kube.GetWorkloadStats(ctx, h.kubeConfig, req.RepoID, workspace.Name)
+	kubeConfig, rpcErr := h.repoKubeConfig(ctx, workspace.ID, req.RepoID)
+	if rpcErr != nil {
+		return GetWorkloadStatsResponse{}, rpcErr
+	}
+
+	stats, err := h.kube.GetWorkloadStats(ctx, kubeConfig, appID(req.RepoID, req.Environment), workspace.Namespace)
 	if errors.Is(err, ErrNoPodsRunning) {
 		return GetWorkloadStatsResponse{}, &vel.Error{
 			Code: "NO_PODS_RUNNING",
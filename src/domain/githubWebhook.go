@@ -5,23 +5,22 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"log"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"strconv"
-	"sync"
+	"strings"
 	"time"
 
 	"github.com/dennypenta/vel"
 	tqsdk "github.com/treenq/treenq/pkg/sdk"
-	"golang.org/x/exp/maps"
 )
 
 var (
 	ErrDeployStatusMustBeString         = errors.New("deploy status must be string")
 	ErrImageNotFound                    = errors.New("image not found")
+	ErrRegistryUnauthorized             = errors.New("registry unauthorized")
 	ErrNoGitCheckoutSpecified           = errors.New("git branch or sha must be specified")
 	ErrGitBranchAndShaMutuallyExclusive = errors.New("git branch and sha and tag are mutually exclusive")
 	ErrSecretNotFound                   = errors.New("secret not found")
@@ -88,6 +87,12 @@ type GithubRepository struct {
 	TreenqID string `json:"treenqID"`
 	// Status describes whether a repo is actively deployed or suspended
 	Status string `json:"status"`
+	// ClusterID is a workspace cluster the repo is deployed to, empty means the default treenq cluster
+	ClusterID string `json:"clusterID"`
+	// Protected requires a workspace admin approval for every deployment of the repo
+	Protected bool `json:"protected"`
+	// RestartOnSecretChange rolls the deployed app out once its secrets are changed
+	RestartOnSecretChange bool `json:"restartOnSecretChange"`
 }
 
 // CloneUrl implements gives a provider's clone url
@@ -121,6 +126,16 @@ type Image struct {
 	Repository string
 	// Tag is a version of the image
 	Tag string
+	// Digest is a content addressable manifest digest, e.g. sha256:...
+	Digest string
+}
+
+// ImageRuntime is what an image runs by default
+type ImageRuntime struct {
+	// Command is the entrypoint followed by the cmd
+	Command []string
+	// Shell tells the image has /bin/sh, e.g. a distroless or a scratch image has none
+	Shell bool
 }
 
 func (i Image) Image() string {
@@ -128,9 +143,21 @@ func (i Image) Image() string {
 }
 
 func (i Image) FullPath() string {
+	if i.Tag == "" && i.Digest != "" {
+		return fmt.Sprintf("%s/%s@%s", i.Registry, i.Repository, i.Digest)
+	}
 	return fmt.Sprintf("%s/%s:%s", i.Registry, i.Repository, i.Tag)
 }
 
+// Reference gives an image reference pinned by the digest if it's known,
+// unlike a tag a digest can't be repushed, therefore the same reference always gives the same image
+func (i Image) Reference() string {
+	if i.Digest == "" || i.Tag == "" {
+		return i.FullPath()
+	}
+	return i.FullPath() + "@" + i.Digest
+}
+
 type GithubWebhookResponse struct{}
 
 type GitRepo struct {
@@ -147,6 +174,8 @@ type AppDeployment struct {
 	FromDeploymentID string `json:"fromDeploymentID"`
 	// RepoID is a reference to a repository id
 	RepoID string `json:"repoID"`
+	// Environment is a name of the repo environment the deployment goes to, empty for the default one
+	Environment string `json:"environment"`
 	// Space is a treenq space definition
 	Space tqsdk.Space `json:"space"`
 	// Sha is a commit sha a user requested to deploy or given from a github webhook
@@ -157,13 +186,25 @@ type AppDeployment struct {
 	CommitMessage string `json:"commitMessage"`
 	// BuildTag is a docker build image or an image created using buildpacks
 	BuildTag string `json:"buildTag"`
+	// Image is a prebuilt image reference given by a user,
+	// if set the deployment skips the git clone and the build
+	Image string `json:"image"`
+	// ImageDigest is a manifest digest of the deployed image
+	ImageDigest string `json:"imageDigest"`
 	// UserDisplayName is a user loging, comes from a user token or github hook Sender
 	UserDisplayName string `json:"userDisplayName"`
+	// UserID is an id of the user requested the deployment, empty for the webhook deployments
+	UserID string `json:"userID,omitempty"`
 	// CreatedAt marks the start of the deployment (might not fit the exact start of the execution)
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
 	// Status describes the status of the deployment
 	Status DeployStatus `json:"status"`
+	// ApprovedBy is a display name of an admin approved the deployment to a protected repo or environment
+	ApprovedBy string    `json:"approvedBy,omitempty"`
+	ApprovedAt time.Time `json:"approvedAt,omitzero"`
+	// SecretVersions maps the secret keys to the versions the deployment has been applied with
+	SecretVersions map[string]int `json:"secretVersions,omitempty"`
 }
 
 func (d AppDeployment) IsZero() bool {
@@ -173,9 +214,10 @@ func (d AppDeployment) IsZero() bool {
 type DeployStatus string
 
 const (
-	DeployStatusRunning DeployStatus = "run"
-	DeployStatusDone    DeployStatus = "done"
-	DeployStatusFailed  DeployStatus = "failed"
+	DeployStatusRunning          DeployStatus = "run"
+	DeployStatusDone             DeployStatus = "done"
+	DeployStatusFailed           DeployStatus = "failed"
+	DeployStatusAwaitingApproval DeployStatus = "awaiting_approval"
 )
 
 func (h *Handler) GithubWebhook(ctx context.Context, req GithubWebhookRequest) (GithubWebhookResponse, *vel.Error) {
@@ -193,6 +235,7 @@ func (h *Handler) GithubWebhook(ctx context.Context, req GithubWebhookRequest) (
 				Err:     err,
 			}
 		}
+		h.auditWebhook(ctx, req, "installationCreated", h.webhookWorkspaceID(ctx, req.Sender.Login), installationTarget(req.Installation.ID, req.Repositories))
 		return GithubWebhookResponse{}, nil
 	}
 	if req.Action == "added" {
@@ -203,6 +246,7 @@ func (h *Handler) GithubWebhook(ctx context.Context, req GithubWebhookRequest) (
 				Err:     err,
 			}
 		}
+		h.auditWebhook(ctx, req, "reposAdded", h.webhookWorkspaceID(ctx, req.Sender.Login), installationTarget(req.Installation.ID, req.RepositoriesAdded))
 		return GithubWebhookResponse{}, nil
 
 	}
@@ -214,6 +258,7 @@ func (h *Handler) GithubWebhook(ctx context.Context, req GithubWebhookRequest) (
 				Err:     err,
 			}
 		}
+		h.auditWebhook(ctx, req, "reposRemoved", h.webhookWorkspaceID(ctx, req.Sender.Login), installationTarget(req.Installation.ID, req.RepositoriesRemoved))
 		return GithubWebhookResponse{}, nil
 	}
 	if req.Action == "deleted" {
@@ -224,6 +269,7 @@ func (h *Handler) GithubWebhook(ctx context.Context, req GithubWebhookRequest) (
 				Err:     err,
 			}
 		}
+		h.auditWebhook(ctx, req, "installationDeleted", h.webhookWorkspaceID(ctx, req.Sender.Login), installationTarget(req.Installation.ID, req.Repositories))
 		return GithubWebhookResponse{}, nil
 	}
 
@@ -265,6 +311,10 @@ func (h *Handler) GithubWebhook(ctx context.Context, req GithubWebhookRequest) (
 				}
 			}
 		}
+
+		if rpcErr := h.deployEnvironments(ctx, req, repo); rpcErr != nil {
+			return GithubWebhookResponse{}, rpcErr
+		}
 	}
 
 	// new commit to the default branch
@@ -291,6 +341,99 @@ func (h *Handler) GithubWebhook(ctx context.Context, req GithubWebhookRequest) (
 	return GithubWebhookResponse{}, nil
 }
 
+// deployEnvironments deploys the pushed ref to every repo environment triggered by it,
+// an environment failed to deploy doesn't stop the others, the failures are reported together
+func (h *Handler) deployEnvironments(ctx context.Context, req GithubWebhookRequest, repo GithubRepository) *vel.Error {
+	envs, err := h.db.GetEnvironments(ctx, repo.TreenqID)
+	if err != nil {
+		return &vel.Error{
+			Message: "failed to get repo environments",
+			Err:     err,
+		}
+	}
+
+	var failed []string
+	var errs []error
+	for _, env := range envs {
+		if !env.Triggers(req.Ref) {
+			continue
+		}
+
+		if rpcErr := h.deployEnvironment(ctx, req, repo, env); rpcErr != nil {
+			log.Println("[ERROR] failed to deploy environment", env.Name, rpcErr, rpcErr.Err)
+			failed = append(failed, env.Name)
+			errs = append(errs, fmt.Errorf("environment %s: %w", env.Name, errors.Join(rpcErr, rpcErr.Err)))
+		}
+	}
+
+	if len(errs) > 0 {
+		return &vel.Error{
+			Message: "failed to deploy environments",
+			Err:     errors.Join(errs...),
+			Meta:    map[string]string{"environments": strings.Join(failed, ",")},
+		}
+	}
+	return nil
+}
+
+// deployEnvironment deploys the pushed ref to a repo environment
+func (h *Handler) deployEnvironment(ctx context.Context, req GithubWebhookRequest, repo GithubRepository, env Environment) *vel.Error {
+	workspace, err := h.db.GetWorkspaceByID(ctx, env.WorkspaceID)
+	if err != nil {
+		if errors.Is(err, ErrWorkspaceNotFound) {
+			return &vel.Error{
+				Code: "WORKSPACE_NOT_FOUND",
+			}
+		}
+		return &vel.Error{
+			Message: "failed to get workspace info",
+			Err:     err,
+		}
+	}
+
+	branch, tag := "", ""
+	if tagName, ok := strings.CutPrefix(req.Ref, "refs/tags/"); ok {
+		tag = tagName
+	} else {
+		branch = strings.TrimPrefix(req.Ref, "refs/heads/")
+	}
+
+	deployment, rpcErr := h.deployRepo(ctx, UserInfo{DisplayName: req.Sender.Login}, workspace, repo, env, "", branch, "", tag, "")
+	if rpcErr != nil {
+		return rpcErr
+	}
+	h.auditWebhook(ctx, req, "push", workspace.ID, map[string]string{
+		"repoID":       repo.TreenqID,
+		"environment":  env.Name,
+		"ref":          req.Ref,
+		"sha":          req.After,
+		"deploymentID": deployment.ID,
+	})
+
+	return nil
+}
+
+// webhookWorkspaceID gives the personal workspace of the webhook sender the installations are linked to,
+// it's empty if the sender isn't a treenq user
+func (h *Handler) webhookWorkspaceID(ctx context.Context, senderLogin string) string {
+	workspace, err := h.db.GetWorkspaceByUserDisplayName(ctx, senderLogin)
+	if err != nil {
+		return ""
+	}
+	return workspace.ID
+}
+
+func installationTarget(installationID int, repos []InstalledRepository) map[string]string {
+	names := make([]string, len(repos))
+	for i := range repos {
+		names[i] = repos[i].FullName
+	}
+	return map[string]string{
+		"installationID": strconv.Itoa(installationID),
+		"repos":          strings.Join(names, ","),
+	}
+}
+
 func countNotEmpty(vals ...string) int {
 	notEmpty := 0
 	for i := range vals {
@@ -302,7 +445,7 @@ func countNotEmpty(vals ...string) int {
 	return notEmpty
 }
 
-func (h *Handler) deployRepo(ctx context.Context, userDisplayName string, workspace Workspace, repo GithubRepository, fromDeploymentID, branch, sha, tag string) (AppDeployment, *vel.Error) {
+func (h *Handler) deployRepo(ctx context.Context, user UserInfo, workspace Workspace, repo GithubRepository, env Environment, fromDeploymentID, branch, sha, tag, image string) (AppDeployment, *vel.Error) {
 	// validate the repo must run
 	if repo.Branch == "" {
 		return AppDeployment{}, &vel.Error{
@@ -323,21 +466,59 @@ func (h *Handler) deployRepo(ctx context.Context, userDisplayName string, worksp
 			Code: "ONLY_BRANCH_OR_SHA_OR_TAG_ALLOWED",
 		}
 	}
+	if image != "" && notEmptyDeployMarks > 0 {
+		return AppDeployment{}, &vel.Error{
+			Code: "IMAGE_AND_GIT_REF_MUTUALLY_EXCLUSIVE",
+		}
+	}
 
 	if notEmptyDeployMarks == 0 {
 		branch = repo.Branch
+		if env.Branch != "" {
+			branch = env.Branch
+		}
 	}
 
 	// Create initial deployment with "init" status
 	deployment := AppDeployment{
 		RepoID:           repo.TreenqID,
-		UserDisplayName:  userDisplayName,
+		Environment:      env.Name,
+		UserDisplayName:  user.DisplayName,
+		UserID:           user.ID,
 		Status:           DeployStatusRunning,
 		Space:            tqsdk.Space{},
 		FromDeploymentID: fromDeploymentID,
 		Branch:           branch,
 		Sha:              sha,
 		BuildTag:         tag,
+		Image:            image,
+	}
+
+	if image != "" {
+		parsedImage, err := h.docker.ParseImage(image)
+		if err != nil {
+			return AppDeployment{}, &vel.Error{
+				Code:    "INVALID_IMAGE_REFERENCE",
+				Message: err.Error(),
+			}
+		}
+		space, err := h.db.GetSpace(ctx, repo.TreenqID)
+		if err != nil {
+			if errors.Is(err, ErrNoSpaceFound) {
+				return AppDeployment{}, &vel.Error{
+					Code: "SPACE_NOT_FOUND",
+				}
+			}
+			return AppDeployment{}, &vel.Error{
+				Message: "failed to get repo space",
+				Err:     err,
+			}
+		}
+		deployment.Branch = ""
+		deployment.Image = parsedImage.FullPath()
+		deployment.BuildTag = parsedImage.Tag
+		deployment.ImageDigest = parsedImage.Digest
+		deployment.Space = space
 	}
 
 	if fromDeploymentID != "" {
@@ -358,6 +539,18 @@ func (h *Handler) deployRepo(ctx context.Context, userDisplayName string, worksp
 		deployment.CommitMessage = fromDeployment.CommitMessage
 		deployment.BuildTag = fromDeployment.BuildTag
 		deployment.Space = fromDeployment.Space
+		deployment.Image = fromDeployment.Image
+		deployment.ImageDigest = fromDeployment.ImageDigest
+	}
+
+	// a known space is checked right away, otherwise it's checked once the config is extracted
+	if rpcErr := h.checkRequiredSecrets(ctx, workspace.ID, repo.TreenqID, env.Name, deployment.Space); rpcErr != nil {
+		return AppDeployment{}, rpcErr
+	}
+
+	// a protected deployment waits for an admin to approve it, see ApproveDeployment
+	if repo.Protected || env.Protected {
+		deployment.Status = DeployStatusAwaitingApproval
 	}
 
 	deployment, err := h.db.SaveDeployment(ctx, deployment)
@@ -367,26 +560,28 @@ func (h *Handler) deployRepo(ctx context.Context, userDisplayName string, worksp
 			Err:  err,
 		}
 	}
+	if deployment.Status == DeployStatusRunning {
+		h.runDeployment(ctx, deployment, repo, workspace)
+	}
 
+	return deployment, nil
+}
+
+// runDeployment builds and applies the deployment in background
+func (h *Handler) runDeployment(ctx context.Context, deployment AppDeployment, repo GithubRepository, workspace Workspace) {
 	go func() {
-		// prepare local goroutine scope
-		deployment := deployment
-		workspace := workspace
 		ctx := context.WithoutCancel(ctx)
 		ctx, cancel := context.WithTimeout(ctx, time.Second*300)
 		defer cancel()
 
 		// start the build process
-		deployment, err := h.buildApp(ctx, deployment, repo, workspace)
+		built, err := h.buildApp(ctx, deployment, repo, workspace)
 		if err != nil {
-			// update deployment status to failed
-			deployment.Status = DeployStatusFailed
-			if updateErr := h.db.UpdateDeployment(ctx, deployment); updateErr != nil {
-				// TODO: log error
-				log.Println("[ERROR] failed update deployment", updateErr)
-			}
 			log.Println("[ERROR] failed to build app", err)
+			h.failDeployment(ctx, deployment, err)
+			return
 		}
+		deployment = built
 
 		// update deployment status to done
 		deployment.Status = DeployStatusDone
@@ -395,169 +590,44 @@ func (h *Handler) deployRepo(ctx context.Context, userDisplayName string, worksp
 			log.Println("[ERROR] failed mark deployment as done", err)
 		}
 	}()
-
-	return deployment, nil
 }
 
-type ProgressBuf struct {
-	Bufs map[string]buf
-
-	mx sync.RWMutex
-}
-
-func NewProgressBuf() *ProgressBuf {
-	return &ProgressBuf{
-		Bufs: make(map[string]buf),
-	}
-}
-
-type buf struct {
-	WriteAt time.Time
-	Content []ProgressMessage
-	Subs    []Subscriber
-}
-
-type ProgressMessage struct {
-	Payload    string        `json:"payload"`
-	Level      slog.Level    `json:"level"`
-	Final      bool          `json:"final"`
-	Timestamp  time.Time     `json:"timestamp"`
-	Deployment AppDeployment `json:"deployment,omitzero"`
-	ErrorCode  string        `json:"errorCode,omitempty"`
-}
-
-type Subscriber struct {
-	out    chan ProgressMessage
-	done   <-chan struct{}
-	closed bool
-}
-
-func (b *ProgressBuf) Get(ctx context.Context, deploymentID string) <-chan ProgressMessage {
-	b.mx.Lock()
-
-	out := make(chan ProgressMessage)
-
-	go func() {
-		defer b.mx.Unlock()
-
-		buf, ok := b.Bufs[deploymentID]
-		if !ok {
-			out <- ProgressMessage{
-				ErrorCode: "NO_LOGS",
-			}
-			close(out)
-			return
-		}
-		for _, m := range buf.Content {
-			select {
-			case out <- m:
-				if m.Final {
-					return
-				}
-			case <-ctx.Done():
-				return
-			}
-		}
-		buf.Subs = append(buf.Subs, Subscriber{
-			out:  out,
-			done: ctx.Done(),
-		})
-		b.Bufs[deploymentID] = buf
-	}()
-
-	return out
-}
-
-func (b *ProgressBuf) Append(deploymentID string, m ProgressMessage) {
-	m.Timestamp = time.Now().UTC()
-	b.mx.Lock()
-	defer b.mx.Unlock()
-
-	buf := b.Bufs[deploymentID]
-	buf.WriteAt = time.Now()
-	buf.Content = append(buf.Content, m)
-	for i, sub := range buf.Subs {
-		select {
-		case <-sub.done:
-			close(sub.out)
-			buf.Subs[i].closed = true
-			continue
-		case <-time.After(time.Second):
-			close(sub.out)
-			buf.Subs[i].closed = true
-			continue
-		case sub.out <- m:
-		}
-
-		if m.Final {
-			close(sub.out)
-			buf.Subs[i].closed = true
-			continue
-		}
-	}
-
-	copiedSubs := make([]Subscriber, 0, len(buf.Subs))
-	for i := range buf.Subs {
-		if buf.Subs[i].closed {
-			continue
-		}
-
-		copiedSubs = append(copiedSubs, buf.Subs[i])
-	}
-	buf.Subs = copiedSubs
-	b.Bufs[deploymentID] = buf
-
-	if len(b.Bufs) >= 100 {
-		b.clean()
-	}
-}
-
-func (b *ProgressBuf) clean() {
-	maps.DeleteFunc(b.Bufs, func(k string, v buf) bool {
-		return time.Since(v.WriteAt) > (time.Minute * 5)
+// failDeployment ends the deployment progress with the failure and marks the deployment failed,
+// the final message is saved before the status, so a stream of the failed deployment always ends with it
+func (h *Handler) failDeployment(ctx context.Context, deployment AppDeployment, rpcErr *vel.Error) {
+	deployment.Status = DeployStatusFailed
+	h.progress.Append(deployment.ID, ProgressMessage{
+		Payload:    "deployment failed",
+		Level:      slog.LevelError,
+		Final:      true,
+		ErrorCode:  rpcErr.Code,
+		Deployment: deployment,
 	})
-}
-
-func (b *ProgressBuf) AsWriter(deploymentID string, level slog.Level) io.Writer {
-	return &progressWriter{
-		deploymentID: deploymentID,
-		level:        level,
-		buf:          b,
+	if err := h.db.UpdateDeployment(ctx, deployment); err != nil {
+		log.Println("[ERROR] failed update deployment", err)
 	}
 }
 
-type progressWriter struct {
-	deploymentID string
-	level        slog.Level
-	buf          *ProgressBuf
-}
-
-func (w *progressWriter) Write(buf []byte) (int, error) {
-	w.buf.Append(w.deploymentID, ProgressMessage{
-		Payload: string(buf),
-		Level:   w.level,
-	})
-	return len(buf), nil
-}
-
-var progress = &ProgressBuf{Bufs: make(map[string]buf)}
-
 func (h *Handler) buildApp(ctx context.Context, deployment AppDeployment, repo GithubRepository, workspace Workspace) (AppDeployment, *vel.Error) {
+	if deployment.Image != "" {
+		return h.deployExternalImage(ctx, deployment, repo, workspace)
+	}
+
 	if deployment.FromDeploymentID != "" {
-		progress.Append(deployment.ID, ProgressMessage{
+		h.progress.Append(deployment.ID, ProgressMessage{
 			Payload: "inspecting an image",
 			Level:   slog.LevelDebug,
 		})
 		image, err := h.docker.Inspect(ctx, deployment)
 		if err != nil {
 			if errors.Is(err, ErrImageNotFound) {
-				progress.Append(deployment.ID, ProgressMessage{
+				h.progress.Append(deployment.ID, ProgressMessage{
 					Payload: "image not found, build is required",
 					Level:   slog.LevelWarn,
 				})
 				return h.buildFromRepo(ctx, deployment, repo, workspace)
 			}
-			progress.Append(deployment.ID, ProgressMessage{
+			h.progress.Append(deployment.ID, ProgressMessage{
 				Payload: "failed to inspect an iamge",
 				Level:   slog.LevelError,
 			})
@@ -566,12 +636,26 @@ func (h *Handler) buildApp(ctx context.Context, deployment AppDeployment, repo G
 				Err:     err,
 			}
 		}
-		progress.Append(deployment.ID, ProgressMessage{
-			Payload: "image has been inspected",
+		h.progress.Append(deployment.ID, ProgressMessage{
+			Payload: "image has been inspected: " + image.Reference(),
 			Level:   slog.LevelInfo,
 		})
 
-		return h.applyImage(ctx, repo.TreenqID, deployment, image, workspace)
+		if deployment.ImageDigest != image.Digest {
+			deployment.ImageDigest = image.Digest
+			if err := h.db.UpdateDeployment(ctx, deployment); err != nil {
+				h.progress.Append(deployment.ID, ProgressMessage{
+					Payload: "failed to update deployment state" + err.Error(),
+					Level:   slog.LevelError,
+				})
+				return AppDeployment{}, &vel.Error{
+					Message: "failed to save deployment",
+					Err:     err,
+				}
+			}
+		}
+
+		return h.applyImage(ctx, repo, deployment, image, workspace)
 	}
 
 	return h.buildFromRepo(ctx, deployment, repo, workspace)
@@ -581,13 +665,13 @@ func (h *Handler) buildFromRepo(ctx context.Context, deployment AppDeployment, r
 	token := ""
 	if repo.Private {
 		var err error
-		progress.Append(deployment.ID, ProgressMessage{
+		h.progress.Append(deployment.ID, ProgressMessage{
 			Payload: "private repository detected, issuing github access token",
 			Level:   slog.LevelDebug,
 		})
 		token, err = h.githubClient.IssueAccessToken(repo.InstallationID)
 		if err != nil {
-			progress.Append(deployment.ID, ProgressMessage{
+			h.progress.Append(deployment.ID, ProgressMessage{
 				Payload: "failed to issue a github access token: " + err.Error(),
 				Level:   slog.LevelError,
 			})
@@ -596,19 +680,19 @@ func (h *Handler) buildFromRepo(ctx context.Context, deployment AppDeployment, r
 				Err:     err,
 			}
 		}
-		progress.Append(deployment.ID, ProgressMessage{
+		h.progress.Append(deployment.ID, ProgressMessage{
 			Payload: "issued github access token",
 			Level:   slog.LevelInfo,
 		})
 	}
 
-	progress.Append(deployment.ID, ProgressMessage{
+	h.progress.Append(deployment.ID, ProgressMessage{
 		Payload: "cloning github repository",
 		Level:   slog.LevelDebug,
 	})
-	gitRepo, err := h.git.Clone(repo, token, deployment.Branch, deployment.Sha, deployment.BuildTag, progress.AsWriter(deployment.ID, slog.LevelInfo))
+	gitRepo, err := h.git.Clone(repo, token, deployment.Branch, deployment.Sha, deployment.BuildTag, h.progress.AsWriter(deployment.ID, slog.LevelInfo))
 	if err != nil {
-		progress.Append(deployment.ID, ProgressMessage{
+		h.progress.Append(deployment.ID, ProgressMessage{
 			Payload: "failed to clone github repository: " + err.Error(),
 			Level:   slog.LevelError,
 		})
@@ -622,7 +706,7 @@ func (h *Handler) buildFromRepo(ctx context.Context, deployment AppDeployment, r
 	if deployment.BuildTag == "" {
 		deployment.BuildTag = gitRepo.Sha
 	}
-	progress.Append(deployment.ID, ProgressMessage{
+	h.progress.Append(deployment.ID, ProgressMessage{
 		Payload:    "cloned github repository",
 		Level:      slog.LevelInfo,
 		Deployment: deployment,
@@ -630,21 +714,21 @@ func (h *Handler) buildFromRepo(ctx context.Context, deployment AppDeployment, r
 
 	defer os.RemoveAll(gitRepo.Dir)
 
-	progress.Append(deployment.ID, ProgressMessage{
+	h.progress.Append(deployment.ID, ProgressMessage{
 		Payload: "extracting treenq config",
 		Level:   slog.LevelDebug,
 	})
 	var appSpace tqsdk.Space
 	if deployment.Space.Service.Name != "" {
 		appSpace = deployment.Space
-		progress.Append(deployment.ID, ProgressMessage{
+		h.progress.Append(deployment.ID, ProgressMessage{
 			Payload: "reusing tq config from referenced deployment",
 			Level:   slog.LevelInfo,
 		})
 	} else {
 		appSpace, err = h.extractor.ExtractConfig(gitRepo.Dir)
 		if err != nil {
-			progress.Append(deployment.ID, ProgressMessage{
+			h.progress.Append(deployment.ID, ProgressMessage{
 				Payload: "failed to extract treenq config: " + err.Error(),
 				Level:   slog.LevelError,
 			})
@@ -660,7 +744,7 @@ func (h *Handler) buildFromRepo(ctx context.Context, deployment AppDeployment, r
 			}
 		}
 		deployment.Space = appSpace
-		progress.Append(deployment.ID, ProgressMessage{
+		h.progress.Append(deployment.ID, ProgressMessage{
 			Payload:    "extracted treenq config",
 			Level:      slog.LevelInfo,
 			Deployment: deployment,
@@ -668,12 +752,20 @@ func (h *Handler) buildFromRepo(ctx context.Context, deployment AppDeployment, r
 	}
 	marshalledSpaceConfig, err := json.Marshal(deployment.Space)
 	if err == nil {
-		progress.Append(deployment.ID, ProgressMessage{
+		h.progress.Append(deployment.ID, ProgressMessage{
 			Payload: string(marshalledSpaceConfig),
 			Level:   slog.LevelDebug,
 		})
 	}
 
+	if rpcErr := h.checkRequiredSecrets(ctx, workspace.ID, repo.TreenqID, deployment.Environment, appSpace); rpcErr != nil {
+		h.progress.Append(deployment.ID, ProgressMessage{
+			Payload: rpcErr.Message,
+			Level:   slog.LevelError,
+		})
+		return AppDeployment{}, rpcErr
+	}
+
 	dockerContext := appSpace.Service.DockerContext
 	dockerContext = filepath.Join(gitRepo.Dir, dockerContext)
 	dockerFilePath := filepath.Join(gitRepo.Dir, appSpace.Service.DockerfilePath)
@@ -686,17 +778,17 @@ func (h *Handler) buildFromRepo(ctx context.Context, deployment AppDeployment, r
 		Tag:           deployment.BuildTag,
 		DeploymentID:  deployment.ID,
 	}
-	progress.Append(deployment.ID, ProgressMessage{
+	h.progress.Append(deployment.ID, ProgressMessage{
 		Payload: "build image",
 		Level:   slog.LevelDebug,
 	})
-	progress.Append(deployment.ID, ProgressMessage{
+	h.progress.Append(deployment.ID, ProgressMessage{
 		Payload: fmt.Sprintf("%+v", buildRequest),
 		Level:   slog.LevelDebug,
 	})
-	image, err := h.docker.Build(ctx, buildRequest, progress)
+	image, err := h.docker.Build(ctx, buildRequest, h.progress.AsWriter(deployment.ID, slog.LevelInfo))
 	if err != nil {
-		progress.Append(deployment.ID, ProgressMessage{
+		h.progress.Append(deployment.ID, ProgressMessage{
 			Payload: "failed to build image: " + err.Error(),
 			Level:   slog.LevelError,
 		})
@@ -706,19 +798,20 @@ func (h *Handler) buildFromRepo(ctx context.Context, deployment AppDeployment, r
 		}
 	}
 	deployment.BuildTag = image.Tag
-	progress.Append(deployment.ID, ProgressMessage{
-		Payload:    "built image: " + image.FullPath(),
+	deployment.ImageDigest = image.Digest
+	h.progress.Append(deployment.ID, ProgressMessage{
+		Payload:    "built image: " + image.Reference(),
 		Level:      slog.LevelInfo,
 		Deployment: deployment,
 	})
 
-	progress.Append(deployment.ID, ProgressMessage{
+	h.progress.Append(deployment.ID, ProgressMessage{
 		Payload: "updating deployment state",
 		Level:   slog.LevelDebug,
 	})
 	err = h.db.UpdateDeployment(ctx, deployment)
 	if err != nil {
-		progress.Append(deployment.ID, ProgressMessage{
+		h.progress.Append(deployment.ID, ProgressMessage{
 			Payload: "failed to update deployment state" + err.Error(),
 			Level:   slog.LevelError,
 		})
@@ -727,22 +820,150 @@ func (h *Handler) buildFromRepo(ctx context.Context, deployment AppDeployment, r
 			Err:     err,
 		}
 	}
-	progress.Append(deployment.ID, ProgressMessage{
+	h.progress.Append(deployment.ID, ProgressMessage{
 		Payload: "updated deployment state",
 		Level:   slog.LevelInfo,
 	})
 
-	return h.applyImage(ctx, repo.TreenqID, deployment, image, workspace)
+	return h.applyImage(ctx, repo, deployment, image, workspace)
+}
+
+// deployExternalImage resolves a prebuilt image from an external registry
+// and applies it as is, the git clone and the build steps are skipped
+func (h *Handler) deployExternalImage(ctx context.Context, deployment AppDeployment, repo GithubRepository, workspace Workspace) (AppDeployment, *vel.Error) {
+	image, err := h.docker.ParseImage(deployment.Image)
+	if err != nil {
+		h.progress.Append(deployment.ID, ProgressMessage{
+			Payload: "failed to parse image reference: " + err.Error(),
+			Level:   slog.LevelError,
+		})
+		return AppDeployment{}, &vel.Error{
+			Message: "failed to parse image reference",
+			Err:     err,
+		}
+	}
+	// a known digest pins the image, so a rollback gets exactly the same one
+	if deployment.ImageDigest != "" {
+		image.Digest = deployment.ImageDigest
+	}
+
+	h.progress.Append(deployment.ID, ProgressMessage{
+		Payload: "get registry credentials for " + image.Registry,
+		Level:   slog.LevelDebug,
+	})
+	creds, vErr := h.getRegistryCredentials(ctx, workspace, image.Registry)
+	if vErr != nil {
+		h.progress.Append(deployment.ID, ProgressMessage{
+			Payload: "failed to get registry credentials",
+			Level:   slog.LevelError,
+		})
+		return AppDeployment{}, vErr
+	}
+
+	h.progress.Append(deployment.ID, ProgressMessage{
+		Payload: "resolving image " + deployment.Image,
+		Level:   slog.LevelDebug,
+	})
+	image, err = h.docker.Resolve(ctx, image, creds)
+	if err != nil {
+		h.progress.Append(deployment.ID, ProgressMessage{
+			Payload: "failed to resolve image: " + err.Error(),
+			Level:   slog.LevelError,
+		})
+		return AppDeployment{}, resolveImageError(err)
+	}
+	deployment.ImageDigest = image.Digest
+	deployment.BuildTag = image.Tag
+	h.progress.Append(deployment.ID, ProgressMessage{
+		Payload:    "resolved image: " + image.Reference(),
+		Level:      slog.LevelInfo,
+		Deployment: deployment,
+	})
+
+	if err := h.db.UpdateDeployment(ctx, deployment); err != nil {
+		h.progress.Append(deployment.ID, ProgressMessage{
+			Payload: "failed to update deployment state" + err.Error(),
+			Level:   slog.LevelError,
+		})
+		return AppDeployment{}, &vel.Error{
+			Message: "failed to save deployment",
+			Err:     err,
+		}
+	}
+
+	// the credentials the image is resolved with pull it too
+	var pullCredentials []RegistryCredentials
+	if creds.Username != "" {
+		pullCredentials = append(pullCredentials, creds)
+	}
+	return h.applyApp(ctx, repo, deployment, image, workspace, pullCredentials, true)
+}
+
+// resolveImageError tells a missing image from the registry refusing the credentials
+func resolveImageError(err error) *vel.Error {
+	switch {
+	case errors.Is(err, ErrImageNotFound):
+		return &vel.Error{
+			Code: "IMAGE_NOT_FOUND",
+		}
+	case errors.Is(err, ErrRegistryUnauthorized):
+		return &vel.Error{
+			Code:    "REGISTRY_UNAUTHORIZED",
+			Message: "the registry has refused the credentials, check the registry credentials of the workspace",
+		}
+	}
+	return &vel.Error{
+		Message: "failed to resolve an image",
+		Err:     err,
+	}
+}
+
+func (h *Handler) applyImage(ctx context.Context, repo GithubRepository, deployment AppDeployment, image Image, workspace Workspace) (AppDeployment, *vel.Error) {
+	pullCredentials, rpcErr := h.pullCredentials(ctx, workspace, deployment, image)
+	if rpcErr != nil {
+		return AppDeployment{}, rpcErr
+	}
+	return h.applyApp(ctx, repo, deployment, image, workspace, pullCredentials, true)
+}
+
+// pullCredentials gives the credentials of the external registry the deployment image is pulled from, none for the built images
+func (h *Handler) pullCredentials(ctx context.Context, workspace Workspace, deployment AppDeployment, image Image) ([]RegistryCredentials, *vel.Error) {
+	if deployment.Image == "" {
+		return nil, nil
+	}
+	creds, rpcErr := h.getRegistryCredentials(ctx, workspace, image.Registry)
+	if rpcErr != nil {
+		h.progress.Append(deployment.ID, ProgressMessage{
+			Payload: "failed to get registry credentials",
+			Level:   slog.LevelError,
+		})
+		return nil, rpcErr
+	}
+	if creds.Username == "" {
+		return nil, nil
+	}
+	return []RegistryCredentials{creds}, nil
 }
 
-func (h *Handler) applyImage(ctx context.Context, repoID string, deployment AppDeployment, image Image, workspace Workspace) (AppDeployment, *vel.Error) {
-	progress.Append(deployment.ID, ProgressMessage{
+// applyApp defines the app with the current secrets of its environment and applies it to the cluster,
+// final marks the last progress message as the end of the deployment progress
+func (h *Handler) applyApp(ctx context.Context, repo GithubRepository, deployment AppDeployment, image Image, workspace Workspace, pullCredentials []RegistryCredentials, final bool) (AppDeployment, *vel.Error) {
+	env, rpcErr := h.repoEnvironment(ctx, workspace.ID, repo.TreenqID, deployment.Environment)
+	if rpcErr != nil {
+		h.progress.Append(deployment.ID, ProgressMessage{
+			Payload: "failed to get environment " + deployment.Environment,
+			Level:   slog.LevelError,
+		})
+		return AppDeployment{}, rpcErr
+	}
+
+	h.progress.Append(deployment.ID, ProgressMessage{
 		Payload: "get avilable secret keys",
 		Level:   slog.LevelDebug,
 	})
-	secretKeys, err := h.db.GetRepositorySecretKeys(ctx, repoID, workspace.ID)
+	secretKeys, err := h.db.GetRepositorySecretKeys(ctx, repo.TreenqID, env.Name, workspace.ID)
 	if err != nil {
-		progress.Append(deployment.ID, ProgressMessage{
+		h.progress.Append(deployment.ID, ProgressMessage{
 			Payload: "failed to get repo secret keys" + err.Error(),
 			Level:   slog.LevelError,
 		})
@@ -751,19 +972,92 @@ func (h *Handler) applyImage(ctx context.Context, repoID string, deployment AppD
 			Err:     err,
 		}
 	}
-	progress.Append(deployment.ID, ProgressMessage{
+	deployment.SecretVersions, err = h.db.GetCurrentSecretVersions(ctx, workspace.ID, repo.TreenqID, env.Name)
+	if err != nil {
+		h.progress.Append(deployment.ID, ProgressMessage{
+			Payload: "failed to get secret versions" + err.Error(),
+			Level:   slog.LevelError,
+		})
+		return AppDeployment{}, &vel.Error{
+			Message: "failed to get secret versions",
+			Err:     err,
+		}
+	}
+	h.progress.Append(deployment.ID, ProgressMessage{
 		Payload: "retrieved available secret keys",
 		Level:   slog.LevelInfo,
-		Final:   true,
 	})
 
-	progress.Append(deployment.ID, ProgressMessage{
+	h.progress.Append(deployment.ID, ProgressMessage{
 		Payload: fmt.Sprintf("apply new image: %+v", image),
 		Level:   slog.LevelDebug,
 	})
-	appKubeDef, err := h.kube.DefineApp(ctx, repoID, workspace.Name, deployment.Space, image, secretKeys)
+	groupSecrets, rpcErr := h.attachedGroupSecrets(ctx, workspace.ID, repo.TreenqID, env.Name)
+	if rpcErr != nil {
+		h.progress.Append(deployment.ID, ProgressMessage{
+			Payload: "failed to get attached secret groups",
+			Level:   slog.LevelError,
+		})
+		return AppDeployment{}, rpcErr
+	}
+	// a secret may be removed since the deployment is created, e.g. while it awaits an approval
+	if missing := MissingSecrets(deployment.Space.Service.RequiredSecrets, secretKeys, groupSecrets); len(missing) > 0 {
+		rpcErr := missingSecretsError(missing)
+		h.progress.Append(deployment.ID, ProgressMessage{
+			Payload: rpcErr.Message,
+			Level:   slog.LevelError,
+		})
+		return AppDeployment{}, rpcErr
+	}
+
+	store, rpcErr := h.secretStore(ctx, workspace.ID)
+	if rpcErr != nil {
+		h.progress.Append(deployment.ID, ProgressMessage{
+			Payload: "failed to get secret store",
+			Level:   slog.LevelError,
+		})
+		return AppDeployment{}, rpcErr
+	}
+
+	kubeConfig, rpcErr := h.clusterKubeConfig(ctx, workspace.ID, repo.ClusterID)
+	if rpcErr != nil {
+		h.progress.Append(deployment.ID, ProgressMessage{
+			Payload: "failed to get cluster config",
+			Level:   slog.LevelError,
+		})
+		return AppDeployment{}, rpcErr
+	}
+
+	// the deployment keeps the space as defined in the repo, so a promotion applies the overrides of the target environment only
+	space := env.Overrides.Apply(deployment.Space)
+	id := appID(repo.TreenqID, env.Name)
+	injectedEnv := InjectedEnv(groupSecrets, space.Service.RuntimeEnvs, secretKeys)
+	if err := store.StoreGroupSecrets(ctx, kubeConfig, workspace.Namespace, id, groupEnvValues(injectedEnv, groupSecrets)); err != nil {
+		h.progress.Append(deployment.ID, ProgressMessage{
+			Payload: "failed to store group secrets" + err.Error(),
+			Level:   slog.LevelError,
+		})
+		return AppDeployment{}, &vel.Error{
+			Message: "failed to store group secrets",
+			Err:     err,
+		}
+	}
+	injection, rpcErr := h.injectSecrets(ctx, store, workspace, id, injectedEnv, image, pullCredentials)
+	if rpcErr != nil {
+		h.progress.Append(deployment.ID, ProgressMessage{
+			Payload: "failed to inject secrets: " + rpcErr.Message,
+			Level:   slog.LevelError,
+		})
+		return AppDeployment{}, rpcErr
+	}
+	appKubeDef, err := h.kube.DefineApp(ctx, id, workspace.Namespace, space, image, AppSecrets{
+		Keys:      secretKeys,
+		Groups:    groupSecrets,
+		Checksum:  SecretsChecksum(secretKeys, deployment.SecretVersions, groupSecrets),
+		Injection: injection,
+	}, pullCredentials)
 	if err != nil {
-		progress.Append(deployment.ID, ProgressMessage{
+		h.progress.Append(deployment.ID, ProgressMessage{
 			Payload: "failed to define app" + err.Error(),
 			Level:   slog.LevelError,
 		})
@@ -772,8 +1066,8 @@ func (h *Handler) applyImage(ctx context.Context, repoID string, deployment AppD
 			Err:     err,
 		}
 	}
-	if err := h.kube.Apply(ctx, h.kubeConfig, appKubeDef); err != nil {
-		progress.Append(deployment.ID, ProgressMessage{
+	if err := h.kube.Apply(ctx, kubeConfig, appKubeDef); err != nil {
+		h.progress.Append(deployment.ID, ProgressMessage{
 			Payload: "failed to apply new image" + err.Error(),
 			Level:   slog.LevelError,
 		})
@@ -782,14 +1076,46 @@ func (h *Handler) applyImage(ctx context.Context, repoID string, deployment AppD
 			Err:     err,
 		}
 	}
-	progress.Append(deployment.ID, ProgressMessage{
+	h.progress.Append(deployment.ID, ProgressMessage{
 		Payload: "applied new image",
 		Level:   slog.LevelInfo,
-		Final:   true,
+		Final:   final,
 	})
 	return deployment, nil
 }
 
+// injectSecrets gives the injection of the app secret envs by an external store, nil for the Kubernetes secrets,
+// the injection runs the image command by /bin/sh, so the image must define a command and have a shell
+func (h *Handler) injectSecrets(ctx context.Context, store SecretStore, workspace Workspace, id string, envs []EnvSource, image Image, pullCredentials []RegistryCredentials) (*SecretInjection, *vel.Error) {
+	injection := store.InjectSecrets(workspace.Namespace, id, envs)
+	if injection == nil {
+		return nil, nil
+	}
+
+	runtime, err := h.docker.Runtime(ctx, image, pullCredentials)
+	if err != nil {
+		return nil, &vel.Error{
+			Message: "failed to get image runtime",
+			Err:     err,
+		}
+	}
+	if !runtime.Shell {
+		return nil, &vel.Error{
+			Code:    "IMAGE_SHELL_REQUIRED",
+			Message: "the image must have /bin/sh to run with the injected secrets, a distroless or a scratch image can't get them",
+		}
+	}
+	if len(runtime.Command) == 0 {
+		return nil, &vel.Error{
+			Code:    "IMAGE_COMMAND_REQUIRED",
+			Message: "the image must define an entrypoint or a cmd to run with the injected secrets",
+		}
+	}
+	injection.Command = runtime.Command
+
+	return injection, nil
+}
+
 func (h *Handler) removeInstallation(ctx context.Context, installationID int, userDisplayName string, repos []InstalledRepository) *vel.Error {
 	// Remove Kubernetes namespaces first
 	for _, repo := range repos {
@@ -817,12 +1143,37 @@ func (h *Handler) removeInstallation(ctx context.Context, installationID int, us
 			}
 		}
 
-		if err := h.kube.RemoveNamespace(ctx, h.kubeConfig, treenqRepo.TreenqID, workspace.Name); err != nil {
+		kubeConfig, rpcErr := h.clusterKubeConfig(ctx, workspace.ID, treenqRepo.ClusterID)
+		if rpcErr != nil {
+			return rpcErr
+		}
+
+		envs, err := h.db.GetEnvironments(ctx, treenqRepo.TreenqID)
+		if err != nil {
 			return &vel.Error{
-				Message: "failed to remove namespace",
+				Message: "failed to get repo environments",
 				Err:     err,
 			}
 		}
+		store, rpcErr := h.secretStore(ctx, workspace.ID)
+		if rpcErr != nil {
+			return rpcErr
+		}
+		envNames := []string{""}
+		for _, env := range envs {
+			envNames = append(envNames, env.Name)
+		}
+		for _, envName := range envNames {
+			if err := h.kube.RemoveNamespace(ctx, kubeConfig, appID(treenqRepo.TreenqID, envName), workspace.Namespace); err != nil {
+				return &vel.Error{
+					Message: "failed to remove namespace",
+					Err:     err,
+				}
+			}
+			if rpcErr := h.removeStoredSecrets(ctx, store, kubeConfig, workspace, treenqRepo.TreenqID, envName); rpcErr != nil {
+				return rpcErr
+			}
+		}
 	}
 
 	// Remove all database data (this handles repos, deployments, secrets, spaces, and installation)
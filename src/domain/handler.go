@@ -4,6 +4,7 @@ import (
 	"context"
 	"io"
 	"log/slog"
+	"net/netip"
 	"time"
 
 	tqsdk "github.com/treenq/treenq/pkg/sdk"
@@ -18,11 +19,28 @@ type Handler struct {
 	kube         Kube
 
 	kubeConfig string
+	cipher     Cipher
+	// secretCipher encrypts the secret versions, every version gets its own data key
+	secretCipher       Cipher
+	secretVersionsKept int
+	// vaultStore connects a secret store of a workspace keeping its repo secrets in Vault
+	vaultStore func(conf VaultConfig) SecretStore
+	// buildLogsRetention is how long the build logs are kept, zero keeps them forever
+	buildLogsRetention time.Duration
+	// progress streams the build progress to the clients on any api replica
+	progress *Progress
 
 	oauthProvider   OauthProvider
 	jwtIssuer       JwtIssuer
 	authRedirectUrl string
 	authTtl         time.Duration
+	refreshTtl      time.Duration
+
+	inviteSigner TokenSigner
+	inviteTtl    time.Duration
+
+	// trustedProxies are the proxies whose X-Forwarded-For gives the client address
+	trustedProxies []netip.Prefix
 
 	l      *slog.Logger
 	isProd bool
@@ -36,11 +54,23 @@ func NewHandler(
 	docker DockerArtifactory,
 	kube Kube,
 	kubeConfig string,
+	cipher Cipher,
+	secretCipher Cipher,
+	secretVersionsKept int,
+	vaultStore func(conf VaultConfig) SecretStore,
+	buildLogsRetention time.Duration,
+	progressPubSub ProgressPubSub,
 
 	oauthProvider OauthProvider,
 	jwtIssuer JwtIssuer,
 	authRedirectUrl string,
 	authTtl time.Duration,
+	refreshTtl time.Duration,
+
+	inviteSigner TokenSigner,
+	inviteTtl time.Duration,
+
+	trustedProxies []netip.Prefix,
 
 	l *slog.Logger,
 	isProd bool,
@@ -54,32 +84,94 @@ func NewHandler(
 		kube:         kube,
 
 		kubeConfig: kubeConfig,
+		cipher:     cipher,
+
+		secretCipher:       secretCipher,
+		secretVersionsKept: secretVersionsKept,
+		vaultStore:         vaultStore,
+		buildLogsRetention: buildLogsRetention,
+		progress:           NewProgress(db, progressPubSub),
 
 		oauthProvider:   oauthProvider,
 		jwtIssuer:       jwtIssuer,
 		authRedirectUrl: authRedirectUrl,
 		authTtl:         authTtl,
-		l:               l,
-		isProd:          isProd,
+		refreshTtl:      refreshTtl,
+
+		inviteSigner: inviteSigner,
+		inviteTtl:    inviteTtl,
+
+		trustedProxies: trustedProxies,
+
+		l:      l,
+		isProd: isProd,
 	}
 }
 
 type Database interface {
 	// User domain
 	////////////////////////
+	// GetOrCreateUser finds a user by the provider identity or the email, a found user keeps the stored display name,
+	// a created one is given a unique one
 	GetOrCreateUser(ctx context.Context, user UserInfo) (UserInfo, error)
+	// GetUserIdentity gives the user identity of the provider, ErrIdentityNotFound if there is none
+	GetUserIdentity(ctx context.Context, userID, provider string) (UserIdentity, error)
 	GetUserWorkspaces(ctx context.Context, userID string) ([]Workspace, error)
 	GetDefaultWorkspace(ctx context.Context, userID string) (Workspace, error)
 	GetWorkspaceByID(ctx context.Context, workspaceID string) (Workspace, error)
 	GetWorkspaceByUserDisplayName(ctx context.Context, userDisplayName string) (Workspace, error)
+	GetWorkspaceRole(ctx context.Context, workspaceID, userID string) (string, error)
+	CreateWorkspace(ctx context.Context, ownerID, name string) (Workspace, error)
+	RenameWorkspace(ctx context.Context, workspaceID, name string) error
+	RemoveWorkspace(ctx context.Context, workspaceID string) error
 	DeploymentBelongsToWorkspace(ctx context.Context, workspaceID, deploymentID string) (bool, error)
 
+	// Workspace members
+	// ////////////////
+	SaveInvitation(ctx context.Context, invitation Invitation) (Invitation, error)
+	GetInvitation(ctx context.Context, invitationID string) (Invitation, error)
+	GetInvitations(ctx context.Context, workspaceID string) ([]Invitation, error)
+	AcceptInvitation(ctx context.Context, invitationID, userID string) error
+	GetMembers(ctx context.Context, workspaceID string) ([]Member, error)
+	UpdateMemberRole(ctx context.Context, workspaceID, userID, role string) error
+	RemoveMember(ctx context.Context, workspaceID, userID string) error
+
+	// Api tokens
+	// ////////////////
+	SaveApiToken(ctx context.Context, token ApiToken) (ApiToken, error)
+	GetApiTokens(ctx context.Context, workspaceID, userID string) ([]ApiToken, error)
+	GetApiTokenByHash(ctx context.Context, tokenHash string) (ApiToken, error)
+	TouchApiToken(ctx context.Context, tokenID string) error
+	RemoveApiToken(ctx context.Context, workspaceID, userID, tokenID string) error
+
+	SaveSession(ctx context.Context, session Session) (Session, error)
+	RotateSession(ctx context.Context, refreshTokenHash, newRefreshTokenHash string, expiresAt time.Time) (Session, error)
+	SessionIsActive(ctx context.Context, sessionID string) (bool, error)
+	GetSessions(ctx context.Context, userID string) ([]Session, error)
+	RevokeSession(ctx context.Context, userID, sessionID string) error
+	RevokeSessions(ctx context.Context, userID string) error
+	SetSessionWorkspace(ctx context.Context, sessionID, workspaceID string) error
+
+	// Audit log
+	SaveAuditEvent(ctx context.Context, event AuditEvent) error
+	GetAuditEvents(ctx context.Context, workspaceID string, filter AuditFilter) ([]AuditEvent, error)
+
+	// Build logs
+	SaveBuildLogs(ctx context.Context, logs []BuildLog) ([]BuildLog, error)
+	GetBuildLogs(ctx context.Context, deploymentID string, after int64) ([]BuildLog, error)
+	SearchBuildLogs(ctx context.Context, workspaceID string, filter BuildLogFilter) ([]BuildLog, error)
+	// RemoveBuildLogs removes at most limit logs created before the given time, it gives how many are removed
+	RemoveBuildLogs(ctx context.Context, before time.Time, limit int) (int, error)
+
 	// Deployment domain
 	// ////////////////
 	SaveDeployment(ctx context.Context, def AppDeployment) (AppDeployment, error)
 	UpdateDeployment(ctx context.Context, def AppDeployment) error
 	GetDeployment(ctx context.Context, workspaceID, deploymentID string) (AppDeployment, error)
+	GetDeploymentStatus(ctx context.Context, deploymentID string) (DeployStatus, error)
 	GetDeployments(ctx context.Context, workspaceID, repoID string) ([]AppDeployment, error)
+	GetLastDoneDeployment(ctx context.Context, workspaceID, repoID, environment string) (AppDeployment, error)
+	ApproveDeployment(ctx context.Context, workspaceID, deploymentID, approvedBy string) (time.Time, error)
 
 	// Github repos domain
 	// //////////////////////
@@ -93,15 +185,63 @@ type Database interface {
 	GetRepoByGithub(ctx context.Context, githubRepoID int) (GithubRepository, error)
 	GetRepoByID(ctx context.Context, workspaceID, repoID string) (GithubRepository, error)
 	RepoIsConnected(ctx context.Context, repoID string) (bool, error)
+	SetRepoProtected(ctx context.Context, workspaceID, repoID string, protected bool) error
+	SetRepoRestartOnSecretChange(ctx context.Context, workspaceID, repoID string, restart bool) error
 	GetSpace(ctx context.Context, repoID string) (tqsdk.Space, error)
 	SaveSpace(ctx context.Context, repoID string, space tqsdk.Space) error
 
 	// Secrets
 	// ////////////////////////
-	SaveSecret(ctx context.Context, repoID, key, workspaceID string) error
-	GetRepositorySecretKeys(ctx context.Context, repoID, workspaceID string) ([]string, error)
-	RepositorySecretKeyExists(ctx context.Context, repoID, key, workspaceID string) (bool, error)
-	RemoveSecret(ctx context.Context, repoID, key, workspaceID string) error
+	SaveSecret(ctx context.Context, repoID, environment, key, workspaceID string) error
+	GetRepositorySecretKeys(ctx context.Context, repoID, environment, workspaceID string) ([]string, error)
+	RepositorySecretKeyExists(ctx context.Context, repoID, environment, key, workspaceID string) (bool, error)
+	RemoveSecret(ctx context.Context, repoID, environment, key, workspaceID string) error
+	SaveSecretVersion(ctx context.Context, workspaceID string, version SecretVersion, kept int) (SecretVersion, error)
+	GetSecretVersions(ctx context.Context, workspaceID, repoID, environment, key string) ([]SecretVersion, error)
+	GetSecretVersion(ctx context.Context, workspaceID, repoID, environment, key string, version int) (SecretVersion, error)
+	GetCurrentSecretVersions(ctx context.Context, workspaceID, repoID, environment string) (map[string]int, error)
+	ImportSecrets(ctx context.Context, workspaceID string, versions []SecretVersion, kept int) error
+
+	// Secret groups
+	// ////////////////
+	SaveSecretGroup(ctx context.Context, workspaceID, name string) (SecretGroup, error)
+	GetSecretGroups(ctx context.Context, workspaceID string) ([]SecretGroup, error)
+	RemoveSecretGroup(ctx context.Context, workspaceID, groupID string) error
+	SetGroupSecret(ctx context.Context, workspaceID, groupID, key string, value []byte) error
+	RemoveGroupSecret(ctx context.Context, workspaceID, groupID, key string) error
+	AttachSecretGroup(ctx context.Context, workspaceID, repoID, environment, groupID string) error
+	DetachSecretGroup(ctx context.Context, workspaceID, repoID, environment, groupID string) error
+	GetAttachedSecretGroups(ctx context.Context, workspaceID, repoID, environment string) ([]SecretGroup, error)
+	GetAttachedGroupSecrets(ctx context.Context, workspaceID, repoID, environment string) ([]GroupSecret, error)
+
+	// Environments
+	// ////////////////////////
+	SaveEnvironment(ctx context.Context, env Environment) (Environment, error)
+	UpdateEnvironment(ctx context.Context, env Environment) error
+	GetEnvironment(ctx context.Context, workspaceID, repoID, name string) (Environment, error)
+	GetEnvironments(ctx context.Context, repoID string) ([]Environment, error)
+	RemoveEnvironment(ctx context.Context, workspaceID, repoID, name string) error
+
+	// Registry credentials
+	// ////////////////////////
+	SaveRegistryCredentials(ctx context.Context, workspaceID, registry, username string) error
+	GetRegistryCredentials(ctx context.Context, workspaceID string) ([]RegistryCredentials, error)
+	GetRegistryCredentialsByRegistry(ctx context.Context, workspaceID, registry string) (RegistryCredentials, error)
+	RemoveRegistryCredentials(ctx context.Context, workspaceID, registry string) error
+
+	// Secret stores
+	// ////////////////////////
+	SaveWorkspaceSecretStore(ctx context.Context, workspaceID string, store WorkspaceSecretStore) (WorkspaceSecretStore, error)
+	GetWorkspaceSecretStore(ctx context.Context, workspaceID string) (WorkspaceSecretStore, error)
+	CountWorkspaceSecrets(ctx context.Context, workspaceID string) (int, error)
+
+	// Clusters
+	// ////////////////////////
+	SaveCluster(ctx context.Context, workspaceID string, cluster Cluster) (Cluster, error)
+	GetClusters(ctx context.Context, workspaceID string) ([]Cluster, error)
+	GetCluster(ctx context.Context, workspaceID, clusterID string) (Cluster, error)
+	RemoveCluster(ctx context.Context, workspaceID, clusterID string) error
+	SetRepoCluster(ctx context.Context, workspaceID, repoID, clusterID string) error
 
 	// Installation cleanup
 	// ////////////////////////
@@ -128,25 +268,72 @@ type Extractor interface {
 
 type DockerArtifactory interface {
 	Image(name, tag string) Image
-	Build(ctx context.Context, args BuildArtifactRequest, progress *ProgressBuf) (Image, error)
+	Build(ctx context.Context, args BuildArtifactRequest, out io.Writer) (Image, error)
 	Inspect(ctx context.Context, deploy AppDeployment) (Image, error)
+	ParseImage(ref string) (Image, error)
+	Resolve(ctx context.Context, image Image, creds RegistryCredentials) (Image, error)
+	// Runtime gives what the image runs by default, the pull credentials are used for the external registries
+	Runtime(ctx context.Context, image Image, pullCredentials []RegistryCredentials) (ImageRuntime, error)
 }
 
 type Kube interface {
-	DefineApp(ctx context.Context, id, nsName string, app tqsdk.Space, image Image, secretKeys []string) (string, error)
+	// Kube is the default secret store of the repo secrets and the store of the workspace secrets, e.g. the registry passwords
+	SecretStore
+	DefineApp(ctx context.Context, id, nsName string, app tqsdk.Space, image Image, secrets AppSecrets, pullCredentials []RegistryCredentials) (string, error)
 	Apply(ctx context.Context, rawConig, data string) error
-	StoreSecret(ctx context.Context, rawConfig, nsName, repoID, key, value string) error
-	GetSecret(ctx context.Context, rawConfig, nsName, repoID, key string) (string, error)
-	RemoveSecret(ctx context.Context, rawConfig string, space, repoID, key string) error
-	StreamLogs(ctx context.Context, rawConfig, repoID, spaceName string, logChan chan<- ProgressMessage) error
+	Plan(ctx context.Context, rawConfig, data string) (DeploymentPlan, error)
+	// StreamLogs follows the app logs of every pod, the last lines are given for empty positions,
+	// the lines written after the position of the pod otherwise, see LogPositions
+	StreamLogs(ctx context.Context, rawConfig, repoID, spaceName string, positions LogPositions, logChan chan<- ProgressMessage) error
+	WaitRollout(ctx context.Context, rawConfig, repoID, spaceName string, progressChan chan<- ProgressMessage) error
 	RemoveNamespace(ctx context.Context, rawConfig, id, nsName string) error
 	GetWorkloadStats(ctx context.Context, rawConfig, repoID, spaceName string) (WorkloadStats, error)
+	CheckConnection(ctx context.Context, rawConfig string) (string, error)
+	Namespace(id, nsName string) string
+	AppURL(id string) string
 }
 
+// SecretStore keeps the values of the repo secrets, an app is identified by its id and the workspace namespace,
+// rawConfig is a kube config of the cluster the app is deployed to
+type SecretStore interface {
+	StoreSecret(ctx context.Context, rawConfig, nsName, appID, key, value string) error
+	// GetSecret returns ErrSecretNotFound if the key has no value
+	GetSecret(ctx context.Context, rawConfig, nsName, appID, key string) (string, error)
+	RemoveSecret(ctx context.Context, rawConfig, nsName, appID, key string) error
+	// StoreGroupSecrets keeps the values of the attached secret groups the app env takes by the env names,
+	// empty values remove them
+	StoreGroupSecrets(ctx context.Context, rawConfig, nsName, appID string, values map[string]string) error
+	// InjectSecrets gives the injection of the secret envs into the app, see InjectedEnv,
+	// nil means the app env refers to the Kubernetes secrets
+	InjectSecrets(nsName, appID string, envs []EnvSource) *SecretInjection
+}
+
+// ProgressPubSub notifies the api replicas about the progress messages of the deployments,
+// a notification carries a build log id only, the message itself is read from the build logs
+type ProgressPubSub interface {
+	Publish(ctx context.Context, deploymentID string, logID int64) error
+	// Subscribe gives the ids of the logs published after the subscription until the context is done
+	Subscribe(ctx context.Context, deploymentID string) (<-chan int64, error)
+}
+
+// Cipher encrypts sensitive data stored in a database
+type Cipher interface {
+	Encrypt(plaintext []byte) ([]byte, error)
+	Decrypt(ciphertext []byte) ([]byte, error)
+}
+
+// OauthProvider logs in the users with the authorization code flow,
+// the verifier is a PKCE code verifier the challenge of AuthUrl is made of
 type OauthProvider interface {
-	AuthUrl(string) string
-	ExchangeUser(ctx context.Context, code string) (UserInfo, error)
-	GetUserGithubToken(userDisplayName string) (string, error)
+	AuthUrl(state, verifier string) string
+	ExchangeUser(ctx context.Context, code, verifier string) (UserInfo, error)
+	GetUserGithubToken(githubID string) (string, error)
+}
+
+// TokenSigner issues and verifies expiring tokens, e.g. workspace invitations
+type TokenSigner interface {
+	Sign(payload string, expiresAt time.Time) string
+	Verify(token string) (string, error)
 }
 
 type JwtIssuer interface {
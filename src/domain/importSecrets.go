@@ -0,0 +1,356 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/dennypenta/vel"
+	"github.com/treenq/treenq/pkg/dotenv"
+)
+
+// the formats of the imported and exported secrets
+const (
+	SecretsFormatDotenv = "dotenv"
+	SecretsFormatJson   = "json"
+)
+
+type ImportSecretsRequest struct {
+	RepoID      string `json:"repoID"`
+	Environment string `json:"environment"`
+	// Format is dotenv or json, a json content is a flat object of string values, dotenv is the default
+	Format  string `json:"format"`
+	Content string `json:"content"`
+	// DryRun previews the changes without applying them
+	DryRun bool `json:"dryRun"`
+}
+
+type ImportSecretsResponse struct {
+	Added     []string `json:"added"`
+	Changed   []string `json:"changed"`
+	Unchanged []string `json:"unchanged"`
+	// Deployment restarts the app with the imported secrets, see SecretChangeResponse
+	Deployment AppDeployment `json:"deployment,omitzero"`
+}
+
+// importedSecret is a secret written by an import, the previous value restores it if the import fails
+type importedSecret struct {
+	key      string
+	value    string
+	previous string
+	existed  bool
+}
+
+// ImportSecrets upserts all the secrets of a .env or json content or none of them,
+// if the written secrets can't be reverted after a failure the error lists them as SECRETS_PARTIALLY_IMPORTED.
+// The users who can't reveal the secrets see every existing key as changed,
+// so an import can't be used to guess the values.
+func (h *Handler) ImportSecrets(ctx context.Context, req ImportSecretsRequest) (ImportSecretsResponse, *vel.Error) {
+	values, rpcErr := parseSecrets(req.Format, req.Content)
+	if rpcErr != nil {
+		return ImportSecretsResponse{}, rpcErr
+	}
+
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return ImportSecretsResponse{}, rpcErr
+	}
+
+	workspace, err := h.db.GetWorkspaceByID(ctx, profile.UserInfo.CurrentWorkspace)
+	if err != nil {
+		if errors.Is(err, ErrWorkspaceNotFound) {
+			return ImportSecretsResponse{}, &vel.Error{
+				Code: "WORKSPACE_NOT_FOUND",
+			}
+		}
+
+		return ImportSecretsResponse{}, &vel.Error{
+			Message: "failed to get workspace info",
+			Err:     err,
+		}
+	}
+
+	kubeConfig, rpcErr := h.repoKubeConfig(ctx, workspace.ID, req.RepoID)
+	if rpcErr != nil {
+		return ImportSecretsResponse{}, rpcErr
+	}
+
+	env, rpcErr := h.repoEnvironment(ctx, workspace.ID, req.RepoID, req.Environment)
+	if rpcErr != nil {
+		return ImportSecretsResponse{}, rpcErr
+	}
+
+	store, rpcErr := h.secretStore(ctx, workspace.ID)
+	if rpcErr != nil {
+		return ImportSecretsResponse{}, rpcErr
+	}
+
+	existingKeys, err := h.db.GetRepositorySecretKeys(ctx, req.RepoID, env.Name, workspace.ID)
+	if err != nil {
+		return ImportSecretsResponse{}, &vel.Error{
+			Message: "failed to get repo secret keys",
+			Err:     err,
+		}
+	}
+
+	role, err := h.db.GetWorkspaceRole(ctx, workspace.ID, profile.UserInfo.ID)
+	if err != nil && !errors.Is(err, ErrWorkspaceNotFound) {
+		return ImportSecretsResponse{}, &vel.Error{
+			Message: "failed to get workspace role",
+			Err:     err,
+		}
+	}
+	canReveal := RoleAllows(role, PermissionRevealSecrets)
+
+	id := appID(req.RepoID, env.Name)
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	res := ImportSecretsResponse{Added: []string{}, Changed: []string{}, Unchanged: []string{}}
+	var imported []importedSecret
+	for _, key := range keys {
+		secret := importedSecret{key: key, value: values[key]}
+		if !slices.Contains(existingKeys, key) {
+			res.Added = append(res.Added, key)
+			imported = append(imported, secret)
+			continue
+		}
+
+		secret.previous, err = store.GetSecret(ctx, kubeConfig, workspace.Namespace, id, key)
+		if err != nil && !errors.Is(err, ErrSecretNotFound) {
+			return ImportSecretsResponse{}, &vel.Error{
+				Message: "failed to get secret " + key,
+				Err:     err,
+			}
+		}
+		secret.existed = err == nil
+		if secret.existed && secret.previous == secret.value {
+			if canReveal {
+				res.Unchanged = append(res.Unchanged, key)
+			} else {
+				res.Changed = append(res.Changed, key)
+			}
+			continue
+		}
+		res.Changed = append(res.Changed, key)
+		imported = append(imported, secret)
+	}
+
+	if req.DryRun || len(imported) == 0 {
+		return res, nil
+	}
+
+	// all the versions are prepared before the first write, so only the writes themselves can fail halfway
+	versions := make([]SecretVersion, 0, len(imported))
+	for _, secret := range imported {
+		encrypted, err := h.secretCipher.Encrypt([]byte(secret.value))
+		if err != nil {
+			return ImportSecretsResponse{}, &vel.Error{
+				Message: "failed to encrypt secret version",
+				Err:     err,
+			}
+		}
+		versions = append(versions, SecretVersion{
+			RepoID:      req.RepoID,
+			Environment: env.Name,
+			Key:         secret.key,
+			Value:       encrypted,
+			AuthorID:    profile.UserInfo.ID,
+			AuthorName:  profile.UserInfo.DisplayName,
+		})
+	}
+
+	for i, secret := range imported {
+		if err := store.StoreSecret(ctx, kubeConfig, workspace.Namespace, id, secret.key, secret.value); err != nil {
+			unrestored := h.restoreImportedSecrets(ctx, store, kubeConfig, workspace.Namespace, id, imported[:i])
+			return ImportSecretsResponse{}, importError("failed to store secret "+secret.key, err, unrestored)
+		}
+	}
+
+	if err := h.db.ImportSecrets(ctx, workspace.ID, versions, h.secretVersionsKept); err != nil {
+		unrestored := h.restoreImportedSecrets(ctx, store, kubeConfig, workspace.Namespace, id, imported)
+		return ImportSecretsResponse{}, importError("failed to save imported secrets", err, unrestored)
+	}
+
+	res.Deployment, rpcErr = h.restartOnSecretChange(ctx, workspace, profile.UserInfo, req.RepoID, env)
+	if rpcErr != nil {
+		return ImportSecretsResponse{}, rpcErr
+	}
+
+	return res, nil
+}
+
+// restoreImportedSecrets reverts the secrets an import has written before its failure,
+// it gives the keys left with the imported values
+func (h *Handler) restoreImportedSecrets(ctx context.Context, store SecretStore, kubeConfig, nsName, id string, imported []importedSecret) []string {
+	var unrestored []string
+	for _, secret := range imported {
+		var err error
+		if secret.existed {
+			err = store.StoreSecret(ctx, kubeConfig, nsName, id, secret.key, secret.previous)
+		} else {
+			err = store.RemoveSecret(ctx, kubeConfig, nsName, id, secret.key)
+		}
+		if err != nil {
+			h.l.ErrorContext(ctx, "failed to restore secret after a failed import", "appID", id, "key", secret.key, "err", err)
+			unrestored = append(unrestored, secret.key)
+		}
+	}
+	return unrestored
+}
+
+// importError reports a failed import, SECRETS_PARTIALLY_IMPORTED lists the keys
+// the store keeps with the imported values because they couldn't be restored
+func importError(message string, err error, unrestored []string) *vel.Error {
+	if len(unrestored) == 0 {
+		return &vel.Error{
+			Message: message,
+			Err:     err,
+		}
+	}
+	return &vel.Error{
+		Code:    "SECRETS_PARTIALLY_IMPORTED",
+		Message: message,
+		Err:     err,
+		Meta:    map[string]string{"keys": strings.Join(unrestored, ",")},
+	}
+}
+
+// parseSecrets reads the secrets of the given format and validates their keys
+func parseSecrets(format, content string) (map[string]string, *vel.Error) {
+	var values map[string]string
+	switch format {
+	case "", SecretsFormatDotenv:
+		var err error
+		values, err = dotenv.Parse(content)
+		if err != nil {
+			return nil, &vel.Error{
+				Code:    "INVALID_SECRETS_FILE",
+				Message: err.Error(),
+			}
+		}
+	case SecretsFormatJson:
+		if err := json.Unmarshal([]byte(content), &values); err != nil {
+			return nil, &vel.Error{
+				Code:    "INVALID_SECRETS_FILE",
+				Message: "expected an object of string values: " + err.Error(),
+			}
+		}
+	default:
+		return nil, &vel.Error{
+			Code: "UNKNOWN_SECRETS_FORMAT",
+		}
+	}
+
+	if len(values) == 0 {
+		return nil, &vel.Error{
+			Code:    "INVALID_SECRETS_FILE",
+			Message: "no secrets found",
+		}
+	}
+	for key := range values {
+		if !validateSecretKey(key) {
+			return nil, &vel.Error{
+				Code:    "INVALID_SECRET_KEY",
+				Message: key,
+			}
+		}
+	}
+
+	return values, nil
+}
+
+type ExportSecretsRequest struct {
+	RepoID      string `json:"repoID"`
+	Environment string `json:"environment"`
+	// Format is dotenv or json, dotenv is the default
+	Format string `json:"format"`
+}
+
+type ExportSecretsResponse struct {
+	Content string `json:"content"`
+}
+
+// ExportSecrets gives all the secrets of a repo environment in the format ImportSecrets accepts
+func (h *Handler) ExportSecrets(ctx context.Context, req ExportSecretsRequest) (ExportSecretsResponse, *vel.Error) {
+	if req.Format != "" && req.Format != SecretsFormatDotenv && req.Format != SecretsFormatJson {
+		return ExportSecretsResponse{}, &vel.Error{
+			Code: "UNKNOWN_SECRETS_FORMAT",
+		}
+	}
+
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return ExportSecretsResponse{}, rpcErr
+	}
+
+	workspace, err := h.db.GetWorkspaceByID(ctx, profile.UserInfo.CurrentWorkspace)
+	if err != nil {
+		if errors.Is(err, ErrWorkspaceNotFound) {
+			return ExportSecretsResponse{}, &vel.Error{
+				Code: "WORKSPACE_NOT_FOUND",
+			}
+		}
+
+		return ExportSecretsResponse{}, &vel.Error{
+			Message: "failed to get workspace info",
+			Err:     err,
+		}
+	}
+
+	kubeConfig, rpcErr := h.repoKubeConfig(ctx, workspace.ID, req.RepoID)
+	if rpcErr != nil {
+		return ExportSecretsResponse{}, rpcErr
+	}
+
+	env, rpcErr := h.repoEnvironment(ctx, workspace.ID, req.RepoID, req.Environment)
+	if rpcErr != nil {
+		return ExportSecretsResponse{}, rpcErr
+	}
+
+	store, rpcErr := h.secretStore(ctx, workspace.ID)
+	if rpcErr != nil {
+		return ExportSecretsResponse{}, rpcErr
+	}
+
+	keys, err := h.db.GetRepositorySecretKeys(ctx, req.RepoID, env.Name, workspace.ID)
+	if err != nil {
+		return ExportSecretsResponse{}, &vel.Error{
+			Message: "failed to get repo secret keys",
+			Err:     err,
+		}
+	}
+
+	values := make(map[string]string, len(keys))
+	for _, key := range keys {
+		value, err := store.GetSecret(ctx, kubeConfig, workspace.Namespace, appID(req.RepoID, env.Name), key)
+		if err != nil {
+			if errors.Is(err, ErrSecretNotFound) {
+				continue
+			}
+			return ExportSecretsResponse{}, &vel.Error{
+				Message: "failed to get secret " + key,
+				Err:     err,
+			}
+		}
+		values[key] = value
+	}
+
+	if req.Format == SecretsFormatJson {
+		content, err := json.MarshalIndent(values, "", "  ")
+		if err != nil {
+			return ExportSecretsResponse{}, &vel.Error{
+				Message: "failed to marshal secrets",
+				Err:     err,
+			}
+		}
+		return ExportSecretsResponse{Content: string(content)}, nil
+	}
+
+	return ExportSecretsResponse{Content: dotenv.Format(values)}, nil
+}
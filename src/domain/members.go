@@ -0,0 +1,402 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/dennypenta/vel"
+	"github.com/rs/xid"
+	"github.com/treenq/treenq/pkg/auth"
+	"github.com/treenq/treenq/pkg/crypto"
+)
+
+var (
+	ErrInvitationNotFound = errors.New("invitation not found")
+	ErrAlreadyMember      = errors.New("user is a workspace member already")
+	ErrMemberNotFound     = errors.New("member not found")
+)
+
+type Member struct {
+	UserID      string    `json:"userID"`
+	Email       string    `json:"email"`
+	DisplayName string    `json:"displayName"`
+	Role        string    `json:"role"`
+	JoinedAt    time.Time `json:"joinedAt"`
+}
+
+// Invitation lets a user join a workspace with the given role,
+// the invitee is identified either by a verified email or by a GitHub login of the GitHub account the invitee has logged in with
+type Invitation struct {
+	ID          string    `json:"id"`
+	Email       string    `json:"email"`
+	GithubLogin string    `json:"githubLogin"`
+	Role        string    `json:"role"`
+	InvitedBy   string    `json:"invitedBy"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+	CreatedAt   time.Time `json:"createdAt"`
+
+	WorkspaceID string    `json:"-"`
+	AcceptedAt  time.Time `json:"-"`
+}
+
+type InviteMemberRequest struct {
+	Email       string `json:"email"`
+	GithubLogin string `json:"githubLogin"`
+	Role        string `json:"role"`
+}
+
+type InviteMemberResponse struct {
+	Invitation Invitation `json:"invitation"`
+	// Token is signed and expires along with the invitation, it must be passed to the invitee to accept it
+	Token string `json:"token"`
+}
+
+// InviteMember creates an invitation to the current workspace,
+// only an owner may invite another owner
+func (h *Handler) InviteMember(ctx context.Context, req InviteMemberRequest) (InviteMemberResponse, *vel.Error) {
+	if (req.Email == "") == (req.GithubLogin == "") {
+		return InviteMemberResponse{}, &vel.Error{
+			Code:    "INVALID_INVITEE",
+			Message: "either email or githubLogin is required",
+		}
+	}
+	if !ValidRole(req.Role) {
+		return InviteMemberResponse{}, &vel.Error{
+			Code: "INVALID_ROLE",
+		}
+	}
+
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return InviteMemberResponse{}, rpcErr
+	}
+
+	if req.Role == RoleOwner {
+		role, err := h.db.GetWorkspaceRole(ctx, profile.UserInfo.CurrentWorkspace, profile.UserInfo.ID)
+		if err != nil {
+			return InviteMemberResponse{}, &vel.Error{
+				Message: "failed to get workspace role",
+				Err:     err,
+			}
+		}
+		if role != RoleOwner {
+			return InviteMemberResponse{}, &vel.Error{
+				Code: "ROLE_NOT_ALLOWED",
+			}
+		}
+	}
+
+	invitation, err := h.db.SaveInvitation(ctx, Invitation{
+		ID:          xid.New().String(),
+		Email:       req.Email,
+		GithubLogin: req.GithubLogin,
+		Role:        req.Role,
+		InvitedBy:   profile.UserInfo.ID,
+		ExpiresAt:   time.Now().Add(h.inviteTtl),
+		WorkspaceID: profile.UserInfo.CurrentWorkspace,
+	})
+	if err != nil {
+		return InviteMemberResponse{}, &vel.Error{
+			Message: "failed to save invitation",
+			Err:     err,
+		}
+	}
+
+	return InviteMemberResponse{
+		Invitation: invitation,
+		Token:      h.inviteSigner.Sign(invitation.ID, invitation.ExpiresAt),
+	}, nil
+}
+
+// checkInvitee fails with INVITATION_FOR_ANOTHER_USER unless the invitation is for the user,
+// a display name is up to the user, so a GitHub login is matched against the GitHub identity only
+func (h *Handler) checkInvitee(ctx context.Context, invitation Invitation, user UserInfo) *vel.Error {
+	if invitation.Email != "" && strings.EqualFold(invitation.Email, user.Email) {
+		return nil
+	}
+	if invitation.GithubLogin != "" {
+		identity, err := h.db.GetUserIdentity(ctx, user.ID, GithubProvider)
+		if err != nil && !errors.Is(err, ErrIdentityNotFound) {
+			return &vel.Error{
+				Message: "failed to get user github identity",
+				Err:     err,
+			}
+		}
+		if err == nil && strings.EqualFold(invitation.GithubLogin, identity.Login) {
+			return nil
+		}
+	}
+	return &vel.Error{
+		Code: "INVITATION_FOR_ANOTHER_USER",
+	}
+}
+
+type AcceptInvitationRequest struct {
+	Token string `json:"token"`
+}
+
+type AcceptInvitationResponse struct {
+	Workspace Workspace `json:"workspace"`
+	// Token is a new auth token including the joined workspace
+	Token string `json:"token"`
+}
+
+// AcceptInvitation adds the user to the workspace of the invitation if the user email or GitHub login matches the invitee,
+// the auth token is reissued to include the joined workspace as the current one
+func (h *Handler) AcceptInvitation(ctx context.Context, req AcceptInvitationRequest) (AcceptInvitationResponse, *vel.Error) {
+	invitationID, err := h.inviteSigner.Verify(req.Token)
+	if err != nil {
+		if errors.Is(err, crypto.ErrTokenExpired) {
+			return AcceptInvitationResponse{}, &vel.Error{
+				Code: "INVITATION_EXPIRED",
+			}
+		}
+		return AcceptInvitationResponse{}, &vel.Error{
+			Code: "INVALID_INVITATION_TOKEN",
+		}
+	}
+
+	user := userFromClaims(auth.ClaimsFromCtx(ctx))
+
+	invitation, err := h.db.GetInvitation(ctx, invitationID)
+	if err != nil {
+		if errors.Is(err, ErrInvitationNotFound) {
+			return AcceptInvitationResponse{}, &vel.Error{
+				Code: "INVITATION_NOT_FOUND",
+			}
+		}
+		return AcceptInvitationResponse{}, &vel.Error{
+			Message: "failed to get invitation",
+			Err:     err,
+		}
+	}
+	if !invitation.AcceptedAt.IsZero() {
+		return AcceptInvitationResponse{}, &vel.Error{
+			Code: "INVITATION_ALREADY_ACCEPTED",
+		}
+	}
+	if rpcErr := h.checkInvitee(ctx, invitation, user); rpcErr != nil {
+		return AcceptInvitationResponse{}, rpcErr
+	}
+
+	if err := h.db.AcceptInvitation(ctx, invitation.ID, user.ID); err != nil {
+		if errors.Is(err, ErrInvitationNotFound) {
+			return AcceptInvitationResponse{}, &vel.Error{
+				Code: "INVITATION_ALREADY_ACCEPTED",
+			}
+		}
+		if errors.Is(err, ErrAlreadyMember) {
+			return AcceptInvitationResponse{}, &vel.Error{
+				Code: "ALREADY_MEMBER",
+			}
+		}
+		return AcceptInvitationResponse{}, &vel.Error{
+			Message: "failed to accept invitation",
+			Err:     err,
+		}
+	}
+
+	workspace, err := h.db.GetWorkspaceByID(ctx, invitation.WorkspaceID)
+	if err != nil {
+		return AcceptInvitationResponse{}, &vel.Error{
+			Message: "failed to get workspace info",
+			Err:     err,
+		}
+	}
+	workspace.Role = invitation.Role
+
+	token, rpcErr := h.reissueToken(ctx, user, workspace.ID)
+	if rpcErr != nil {
+		return AcceptInvitationResponse{}, rpcErr
+	}
+
+	return AcceptInvitationResponse{
+		Workspace: workspace,
+		Token:     token,
+	}, nil
+}
+
+// reissueToken issues a new auth token with the actual user workspaces and writes it to the cookies,
+// the given current workspace is used by default when the request has no workspace header
+func (h *Handler) reissueToken(ctx context.Context, user UserInfo, currentWorkspace string) (string, *vel.Error) {
+	workspaces, err := h.db.GetUserWorkspaces(ctx, user.ID)
+	if err != nil {
+		return "", &vel.Error{
+			Message: "failed to get user workspaces",
+			Err:     err,
+		}
+	}
+	workspaceIDs := make([]string, len(workspaces))
+	for i := range workspaces {
+		workspaceIDs[i] = workspaces[i].ID
+	}
+
+	// the session keeps the current workspace for the tokens issued on refresh
+	sessionID, _ := auth.ClaimsFromCtx(ctx)[auth.SessionClaim].(string)
+	if sessionID != "" && currentWorkspace != "" {
+		if err := h.db.SetSessionWorkspace(ctx, sessionID, currentWorkspace); err != nil {
+			return "", &vel.Error{
+				Message: "failed to set session workspace",
+				Err:     err,
+			}
+		}
+	}
+
+	token, err := h.issueAccessToken(user, workspaceIDs, sessionID, currentWorkspace)
+	if err != nil {
+		return "", &vel.Error{
+			Message: "failed to generate jwt token",
+			Err:     err,
+		}
+	}
+	h.writeToken(vel.WriterFromContext(ctx), token)
+
+	return token, nil
+}
+
+type GetMembersResponse struct {
+	Members []Member `json:"members"`
+	// Invitations are the pending ones, neither accepted nor expired
+	Invitations []Invitation `json:"invitations"`
+}
+
+func (h *Handler) GetMembers(ctx context.Context, _ struct{}) (GetMembersResponse, *vel.Error) {
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return GetMembersResponse{}, rpcErr
+	}
+
+	members, err := h.db.GetMembers(ctx, profile.UserInfo.CurrentWorkspace)
+	if err != nil {
+		return GetMembersResponse{}, &vel.Error{
+			Message: "failed to get members",
+			Err:     err,
+		}
+	}
+	invitations, err := h.db.GetInvitations(ctx, profile.UserInfo.CurrentWorkspace)
+	if err != nil {
+		return GetMembersResponse{}, &vel.Error{
+			Message: "failed to get invitations",
+			Err:     err,
+		}
+	}
+
+	return GetMembersResponse{
+		Members:     members,
+		Invitations: invitations,
+	}, nil
+}
+
+type UpdateMemberRoleRequest struct {
+	UserID string `json:"userID"`
+	Role   string `json:"role"`
+}
+
+// UpdateMemberRole changes a role of a workspace member,
+// only an owner may grant or revoke the owner role and the last owner can't be demoted
+func (h *Handler) UpdateMemberRole(ctx context.Context, req UpdateMemberRoleRequest) (struct{}, *vel.Error) {
+	if !ValidRole(req.Role) {
+		return struct{}{}, &vel.Error{
+			Code: "INVALID_ROLE",
+		}
+	}
+
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return struct{}{}, rpcErr
+	}
+
+	if rpcErr := h.checkMemberChange(ctx, profile.UserInfo, req.UserID, req.Role); rpcErr != nil {
+		return struct{}{}, rpcErr
+	}
+
+	if err := h.db.UpdateMemberRole(ctx, profile.UserInfo.CurrentWorkspace, req.UserID, req.Role); err != nil {
+		if errors.Is(err, ErrMemberNotFound) {
+			return struct{}{}, &vel.Error{
+				Code: "MEMBER_NOT_FOUND",
+			}
+		}
+		return struct{}{}, &vel.Error{
+			Message: "failed to update member role",
+			Err:     err,
+		}
+	}
+
+	return struct{}{}, nil
+}
+
+type RemoveMemberRequest struct {
+	UserID string `json:"userID"`
+}
+
+// RemoveMember removes a user from the current workspace,
+// only an owner may remove another owner and the last owner can't be removed
+func (h *Handler) RemoveMember(ctx context.Context, req RemoveMemberRequest) (struct{}, *vel.Error) {
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return struct{}{}, rpcErr
+	}
+
+	if rpcErr := h.checkMemberChange(ctx, profile.UserInfo, req.UserID, ""); rpcErr != nil {
+		return struct{}{}, rpcErr
+	}
+
+	if err := h.db.RemoveMember(ctx, profile.UserInfo.CurrentWorkspace, req.UserID); err != nil {
+		if errors.Is(err, ErrMemberNotFound) {
+			return struct{}{}, &vel.Error{
+				Code: "MEMBER_NOT_FOUND",
+			}
+		}
+		return struct{}{}, &vel.Error{
+			Message: "failed to remove member",
+			Err:     err,
+		}
+	}
+
+	return struct{}{}, nil
+}
+
+// checkMemberChange verifies the user may give the member a new role, empty role means the member removal
+func (h *Handler) checkMemberChange(ctx context.Context, user UserInfo, memberID, role string) *vel.Error {
+	members, err := h.db.GetMembers(ctx, user.CurrentWorkspace)
+	if err != nil {
+		return &vel.Error{
+			Message: "failed to get members",
+			Err:     err,
+		}
+	}
+
+	var userRole, memberRole string
+	owners := 0
+	for _, m := range members {
+		if m.UserID == user.ID {
+			userRole = m.Role
+		}
+		if m.UserID == memberID {
+			memberRole = m.Role
+		}
+		if m.Role == RoleOwner {
+			owners++
+		}
+	}
+	if memberRole == "" {
+		return &vel.Error{
+			Code: "MEMBER_NOT_FOUND",
+		}
+	}
+
+	if (memberRole == RoleOwner || role == RoleOwner) && userRole != RoleOwner {
+		return &vel.Error{
+			Code: "ROLE_NOT_ALLOWED",
+		}
+	}
+	if memberRole == RoleOwner && role != RoleOwner && owners == 1 {
+		return &vel.Error{
+			Code: "LAST_OWNER",
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,262 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/dennypenta/vel"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+type PlanDeploymentRequest struct {
+	RepoID      string `json:"repoID"`
+	Environment string `json:"environment"`
+	Branch      string `json:"branch"`
+	Sha         string `json:"sha"`
+}
+
+type PlanDeploymentResponse struct {
+	// Sha is a commit the plan is made for
+	Sha   string         `json:"sha"`
+	Space tqsdk.Space    `json:"space"`
+	Plan  DeploymentPlan `json:"plan"`
+	// MissingSecrets are the required secrets the environment misses, a deployment would fail with MISSING_SECRETS
+	MissingSecrets []string `json:"missingSecrets"`
+}
+
+// DeploymentPlan is a difference between the live objects of an app and the objects a deployment would apply
+type DeploymentPlan struct {
+	Added   []ObjectDiff `json:"added"`
+	Changed []ObjectDiff `json:"changed"`
+	Removed []ObjectDiff `json:"removed"`
+}
+
+type ObjectDiff struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Fields are set only for the changed objects
+	Fields []FieldDiff `json:"fields"`
+}
+
+const (
+	FieldAdded   = "added"
+	FieldChanged = "changed"
+	FieldRemoved = "removed"
+)
+
+type FieldDiff struct {
+	// Path is a dot separated field path, e.g. spec.replicas or spec.template.spec.containers[0].env[1]
+	Path string `json:"path"`
+	// Change is one of added, changed or removed
+	Change string `json:"change"`
+	// Old and New values are omitted for the secret data
+	Old any `json:"old,omitempty"`
+	New any `json:"new,omitempty"`
+	// Pending marks a value known once the deployment runs, e.g. the image of a commit that isn't built yet
+	Pending bool `json:"pending,omitempty"`
+}
+
+// markImagePending marks the container images of the planned deployments as pending
+func (p DeploymentPlan) markImagePending() {
+	for _, obj := range p.Changed {
+		if obj.Kind != "Deployment" {
+			continue
+		}
+		for i := range obj.Fields {
+			if strings.HasPrefix(obj.Fields[i].Path, "spec.template.spec.containers[") && strings.HasSuffix(obj.Fields[i].Path, "].image") {
+				obj.Fields[i].Pending = true
+			}
+		}
+	}
+}
+
+// PlanDeployment shows what a deployment of the given branch or sha changes in the cluster,
+// nothing is built or applied
+func (h *Handler) PlanDeployment(ctx context.Context, req PlanDeploymentRequest) (PlanDeploymentResponse, *vel.Error) {
+	if req.Branch != "" && req.Sha != "" {
+		return PlanDeploymentResponse{}, &vel.Error{
+			Code: "ONLY_BRANCH_OR_SHA_ALLOWED",
+		}
+	}
+
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return PlanDeploymentResponse{}, rpcErr
+	}
+
+	repo, err := h.db.GetRepoByID(ctx, profile.UserInfo.CurrentWorkspace, req.RepoID)
+	if err != nil {
+		if errors.Is(err, ErrRepoNotFound) {
+			return PlanDeploymentResponse{}, &vel.Error{
+				Code: "REPO_NOT_FOUND",
+			}
+		}
+		return PlanDeploymentResponse{}, &vel.Error{
+			Message: "failed to get repo",
+			Err:     err,
+		}
+	}
+	if repo.Branch == "" {
+		return PlanDeploymentResponse{}, &vel.Error{
+			Code: "REPO_IS_NOT_CONNECTED",
+		}
+	}
+
+	workspace, err := h.db.GetWorkspaceByID(ctx, profile.UserInfo.CurrentWorkspace)
+	if err != nil {
+		if errors.Is(err, ErrWorkspaceNotFound) {
+			return PlanDeploymentResponse{}, &vel.Error{
+				Code: "WORKSPACE_NOT_FOUND",
+			}
+		}
+		return PlanDeploymentResponse{}, &vel.Error{
+			Message: "failed to get workspace info",
+			Err:     err,
+		}
+	}
+
+	env, rpcErr := h.repoEnvironment(ctx, workspace.ID, repo.TreenqID, req.Environment)
+	if rpcErr != nil {
+		return PlanDeploymentResponse{}, rpcErr
+	}
+
+	branch := req.Branch
+	if branch == "" && req.Sha == "" {
+		branch = repo.Branch
+		if env.Branch != "" {
+			branch = env.Branch
+		}
+	}
+
+	token := ""
+	if repo.Private {
+		token, err = h.githubClient.IssueAccessToken(repo.InstallationID)
+		if err != nil {
+			return PlanDeploymentResponse{}, &vel.Error{
+				Message: "failed to issue github access token",
+				Err:     err,
+			}
+		}
+	}
+
+	gitRepo, err := h.git.Clone(repo, token, branch, req.Sha, "", io.Discard)
+	if err != nil {
+		return PlanDeploymentResponse{}, &vel.Error{
+			Message: "failed to clone git repo",
+			Err:     err,
+		}
+	}
+	defer os.RemoveAll(gitRepo.Dir)
+
+	space, err := h.extractor.ExtractConfig(gitRepo.Dir)
+	if err != nil {
+		if errors.Is(err, ErrNoTqJsonFound) {
+			return PlanDeploymentResponse{}, &vel.Error{
+				Code: "NO_TQ_JSON_FOUND",
+			}
+		}
+		return PlanDeploymentResponse{}, &vel.Error{
+			Message: "failed to extract config",
+			Err:     err,
+		}
+	}
+
+	// the image isn't built, but it may exist already if the commit has been deployed before
+	deployment := AppDeployment{
+		RepoID:   repo.TreenqID,
+		Space:    space,
+		Sha:      gitRepo.Sha,
+		BuildTag: gitRepo.Sha,
+	}
+	image, err := h.docker.Inspect(ctx, deployment)
+	if err != nil && !errors.Is(err, ErrImageNotFound) {
+		return PlanDeploymentResponse{}, &vel.Error{
+			Message: "failed to inspect an image",
+			Err:     err,
+		}
+	}
+	imageFound := err == nil
+	if !imageFound {
+		// the deployment would build the commit and push it by the sha tag, its digest is unknown until then
+		image = h.docker.Image(space.Service.Name, gitRepo.Sha)
+	}
+
+	secretKeys, err := h.db.GetRepositorySecretKeys(ctx, repo.TreenqID, env.Name, workspace.ID)
+	if err != nil {
+		return PlanDeploymentResponse{}, &vel.Error{
+			Message: "failed to get repo secret keys",
+			Err:     err,
+		}
+	}
+
+	secretVersions, err := h.db.GetCurrentSecretVersions(ctx, workspace.ID, repo.TreenqID, env.Name)
+	if err != nil {
+		return PlanDeploymentResponse{}, &vel.Error{
+			Message: "failed to get secret versions",
+			Err:     err,
+		}
+	}
+
+	groupSecrets, rpcErr := h.attachedGroupSecrets(ctx, workspace.ID, repo.TreenqID, env.Name)
+	if rpcErr != nil {
+		return PlanDeploymentResponse{}, rpcErr
+	}
+
+	store, rpcErr := h.secretStore(ctx, workspace.ID)
+	if rpcErr != nil {
+		return PlanDeploymentResponse{}, rpcErr
+	}
+
+	appSpace := env.Overrides.Apply(space)
+	id := appID(repo.TreenqID, env.Name)
+	injectedEnv := InjectedEnv(groupSecrets, appSpace.Service.RuntimeEnvs, secretKeys)
+	var injection *SecretInjection
+	// the command of an image isn't known until it's built, the plan shows the injection without the command then
+	if imageFound {
+		injection, rpcErr = h.injectSecrets(ctx, store, workspace, id, injectedEnv, image, nil)
+		if rpcErr != nil {
+			return PlanDeploymentResponse{}, rpcErr
+		}
+	} else {
+		injection = store.InjectSecrets(workspace.Namespace, id, injectedEnv)
+	}
+	appKubeDef, err := h.kube.DefineApp(ctx, id, workspace.Namespace, appSpace, image, AppSecrets{
+		Keys:      secretKeys,
+		Groups:    groupSecrets,
+		Checksum:  SecretsChecksum(secretKeys, secretVersions, groupSecrets),
+		Injection: injection,
+	}, nil)
+	if err != nil {
+		return PlanDeploymentResponse{}, &vel.Error{
+			Message: "failed to define app",
+			Err:     err,
+		}
+	}
+
+	kubeConfig, rpcErr := h.clusterKubeConfig(ctx, workspace.ID, repo.ClusterID)
+	if rpcErr != nil {
+		return PlanDeploymentResponse{}, rpcErr
+	}
+
+	plan, err := h.kube.Plan(ctx, kubeConfig, appKubeDef)
+	if err != nil {
+		return PlanDeploymentResponse{}, &vel.Error{
+			Message: "failed to plan app definition",
+			Err:     err,
+		}
+	}
+	if !imageFound {
+		plan.markImagePending()
+	}
+
+	return PlanDeploymentResponse{
+		Sha:            gitRepo.Sha,
+		Space:          space,
+		Plan:           plan,
+		MissingSecrets: MissingSecrets(space.Service.RequiredSecrets, secretKeys, groupSecrets),
+	}, nil
+}
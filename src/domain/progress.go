@@ -0,0 +1,318 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"log/slog"
+	"time"
+)
+
+type ProgressMessage struct {
+	// ID increases monotonically within a stream, a stream is resumed after it
+	ID         int64         `json:"id,omitempty"`
+	Payload    string        `json:"payload"`
+	Level      slog.Level    `json:"level"`
+	Final      bool          `json:"final"`
+	Timestamp  time.Time     `json:"timestamp"`
+	Deployment AppDeployment `json:"deployment,omitzero"`
+	ErrorCode  string        `json:"errorCode,omitempty"`
+	// Pod is a pod an app log line is written by
+	Pod string `json:"pod,omitempty"`
+}
+
+// progressPollInterval is how often the logs are read without a notification,
+// a notification may be lost, e.g. once a replica reconnects to the pubsub
+const progressPollInterval = 5 * time.Second
+
+const (
+	// progressQueueSize is how many messages wait to be saved, an append waits once the queue is full
+	progressQueueSize = 1024
+	// progressBatchSize is how many queued messages are saved at once
+	progressBatchSize   = 100
+	progressSaveTimeout = 5 * time.Second
+	// progressSaveAttempts is how many times a batch is saved before it's given up, the retries back off by progressRetryInterval
+	progressSaveAttempts  = 5
+	progressRetryInterval = time.Second
+	// progressFinalGrace is how long an ended deployment is followed for its final message before it's ended by the reader,
+	// the final message of another replica may be saved after the status is read
+	progressFinalGrace        = 2 * time.Second
+	progressFinalPollInterval = 200 * time.Millisecond
+)
+
+// BuildLogs keeps the progress messages of the deployments
+type BuildLogs interface {
+	// SaveBuildLogs gives the logs having their ids in the order of the given ones,
+	// ErrDeploymentNotFound means a log belongs to a removed deployment
+	SaveBuildLogs(ctx context.Context, logs []BuildLog) ([]BuildLog, error)
+	// GetBuildLogs gives the logs of a deployment written after the log with the given id, all of them for 0
+	GetBuildLogs(ctx context.Context, deploymentID string, after int64) ([]BuildLog, error)
+	GetDeploymentStatus(ctx context.Context, deploymentID string) (DeployStatus, error)
+}
+
+// Progress keeps the progress of the deployments in the build logs and streams it to the subscribers,
+// the pubsub notifies every api replica, so a deployment progress can be followed on any of them
+type Progress struct {
+	logs   BuildLogs
+	pubsub ProgressPubSub
+	// queue is saved in background, so a deployment doesn't wait for every message to be written
+	queue chan queuedLog
+}
+
+type queuedLog struct {
+	log BuildLog
+	// saved is closed once the log is written or given up, nil if nobody waits for it
+	saved chan struct{}
+}
+
+func NewProgress(logs BuildLogs, pubsub ProgressPubSub) *Progress {
+	p := &Progress{
+		logs:   logs,
+		pubsub: pubsub,
+		queue:  make(chan queuedLog, progressQueueSize),
+	}
+	go p.save()
+	return p
+}
+
+// Append queues the message to be saved and published, it waits while the queue is full,
+// so a slow database slows a deployment down instead of losing its progress.
+// A final message is returned once it's saved, so a deployment status updated after it never ends a stream before its final message.
+func (p *Progress) Append(deploymentID string, m ProgressMessage) {
+	queued := queuedLog{log: BuildLog{
+		DeploymentID: deploymentID,
+		Payload:      m.Payload,
+		Level:        m.Level,
+		Final:        m.Final,
+		ErrorCode:    m.ErrorCode,
+		Deployment:   m.Deployment,
+		CreatedAt:    time.Now().UTC(),
+	}}
+	if m.Final {
+		queued.saved = make(chan struct{})
+	}
+	p.queue <- queued
+	if queued.saved != nil {
+		<-queued.saved
+	}
+}
+
+// save writes the queued messages in order, the messages queued while a batch is written go to the next one
+func (p *Progress) save() {
+	batch := make([]queuedLog, 0, progressBatchSize)
+	for queued := range p.queue {
+		batch = append(batch[:0], queued)
+	fill:
+		for len(batch) < progressBatchSize {
+			select {
+			case queued := <-p.queue:
+				batch = append(batch, queued)
+			default:
+				break fill
+			}
+		}
+		p.saveBatch(batch)
+	}
+}
+
+func (p *Progress) saveBatch(batch []queuedLog) {
+	logs := make([]BuildLog, len(batch))
+	for i := range batch {
+		logs[i] = batch[i].log
+	}
+
+	saved, err := p.saveLogs(logs)
+	if errors.Is(err, ErrDeploymentNotFound) && len(batch) > 1 {
+		// the logs of a removed deployment fail the whole batch, so the logs are saved one by one
+		for i := range batch {
+			p.saveBatch(batch[i : i+1])
+		}
+		return
+	}
+	for _, queued := range batch {
+		if queued.saved != nil {
+			close(queued.saved)
+		}
+	}
+	if err != nil {
+		log.Println("[ERROR] failed to save build logs, the logs are given up", err)
+		return
+	}
+
+	p.publish(saved)
+}
+
+// saveLogs saves the logs retrying the failures, the logs of a removed deployment are never retried
+func (p *Progress) saveLogs(logs []BuildLog) ([]BuildLog, error) {
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), progressSaveTimeout)
+		saved, err := p.logs.SaveBuildLogs(ctx, logs)
+		cancel()
+		if err == nil || errors.Is(err, ErrDeploymentNotFound) || attempt == progressSaveAttempts {
+			return saved, err
+		}
+		log.Println("[ERROR] failed to save build logs, retrying", err)
+		time.Sleep(time.Duration(attempt) * progressRetryInterval)
+	}
+}
+
+// publish notifies the subscribers about the saved logs,
+// a subscriber reads all the logs after the one it has given, so the last id of a deployment is enough
+func (p *Progress) publish(saved []BuildLog) {
+	ctx, cancel := context.WithTimeout(context.Background(), progressSaveTimeout)
+	defer cancel()
+
+	last := make(map[string]int64)
+	for _, buildLog := range saved {
+		last[buildLog.DeploymentID] = buildLog.ID
+	}
+	for deploymentID, logID := range last {
+		if err := p.pubsub.Publish(ctx, deploymentID, logID); err != nil {
+			log.Println("[ERROR] failed to publish build log", err)
+		}
+	}
+}
+
+// end saves the final message of a deployment ended without one, e.g. the api has been restarted while it's running,
+// so the message has an id a stream is resumed after as any other. A deployment ended without progress gets NO_LOGS error code.
+func (p *Progress) end(ctx context.Context, deploymentID string, noLogs bool) (BuildLog, error) {
+	final := BuildLog{
+		DeploymentID: deploymentID,
+		Payload:      "deployment ended",
+		Level:        slog.LevelInfo,
+		Final:        true,
+		CreatedAt:    time.Now().UTC(),
+	}
+	if noLogs {
+		final.ErrorCode = "NO_LOGS"
+	}
+	saved, err := p.logs.SaveBuildLogs(ctx, []BuildLog{final})
+	if err != nil {
+		return BuildLog{}, err
+	}
+	p.publish(saved)
+	return saved[0], nil
+}
+
+// Get replays the progress of a deployment after the given message id and follows it until the final message,
+// the deployment is done or failed, or the context is done. Every message is a saved build log having its id.
+func (p *Progress) Get(ctx context.Context, deploymentID string, after int64) <-chan ProgressMessage {
+	out := make(chan ProgressMessage)
+
+	go func() {
+		defer close(out)
+
+		// the subscription starts before the replay, so no message is missed in between
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		notifications, err := p.pubsub.Subscribe(ctx, deploymentID)
+		if err != nil {
+			log.Println("[ERROR] failed to subscribe to build logs", err)
+			return
+		}
+
+		poll := time.NewTicker(progressPollInterval)
+		defer poll.Stop()
+
+		last := after
+		// the status is read at first and on every poll only, the notifications are about the logs
+		polled := true
+		var endedAt time.Time
+		for {
+			// the status is read before the logs, so the logs written before the deployment has ended are given
+			if polled && endedAt.IsZero() {
+				status, err := p.logs.GetDeploymentStatus(ctx, deploymentID)
+				if errors.Is(err, ErrDeploymentNotFound) {
+					return
+				}
+				if err != nil {
+					log.Println("[ERROR] failed to get deployment status", err)
+					return
+				}
+				if status == DeployStatusDone || status == DeployStatusFailed {
+					endedAt = time.Now()
+				}
+			}
+
+			logs, err := p.logs.GetBuildLogs(ctx, deploymentID, last)
+			if err != nil {
+				log.Println("[ERROR] failed to get build logs", err)
+				return
+			}
+			for _, buildLog := range logs {
+				select {
+				case out <- buildLog.ProgressMessage():
+				case <-ctx.Done():
+					return
+				}
+				last = buildLog.ID
+				if buildLog.Final {
+					return
+				}
+			}
+			if !endedAt.IsZero() && time.Since(endedAt) >= progressFinalGrace {
+				final, err := p.end(ctx, deploymentID, last == 0)
+				if err != nil {
+					log.Println("[ERROR] failed to save the final build log", err)
+					return
+				}
+				select {
+				case out <- final.ProgressMessage():
+				case <-ctx.Done():
+				}
+				return
+			}
+
+			// the notifications of the logs given already are skipped, a burst of them is read in a single query
+			polled = false
+			var recheck <-chan time.Time
+			if !endedAt.IsZero() {
+				recheck = time.After(progressFinalPollInterval)
+			}
+		wait:
+			for {
+				select {
+				case id, ok := <-notifications:
+					if !ok {
+						return
+					}
+					if id > last {
+						break wait
+					}
+				case <-recheck:
+					break wait
+				case <-poll.C:
+					polled = true
+					break wait
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return out
+}
+
+func (p *Progress) AsWriter(deploymentID string, level slog.Level) io.Writer {
+	return &progressWriter{
+		deploymentID: deploymentID,
+		level:        level,
+		progress:     p,
+	}
+}
+
+type progressWriter struct {
+	deploymentID string
+	level        slog.Level
+	progress     *Progress
+}
+
+func (w *progressWriter) Write(buf []byte) (int, error) {
+	w.progress.Append(w.deploymentID, ProgressMessage{
+		Payload: string(buf),
+		Level:   w.level,
+	})
+	return len(buf), nil
+}
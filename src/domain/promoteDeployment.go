@@ -0,0 +1,194 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"log"
+	"log/slog"
+	"time"
+
+	"github.com/dennypenta/vel"
+)
+
+type PromoteDeploymentRequest struct {
+	DeploymentID string `json:"deploymentID"`
+	// Environment is a target environment name,
+	// empty means the default environment unless Namespace is given
+	Environment string `json:"environment"`
+	// Namespace is an alternative way to find a target environment by its namespace
+	Namespace string `json:"namespace"`
+}
+
+// PromoteDeployment deploys the exact image of a done deployment to another environment of the repo,
+// the image is never rebuilt, the space of the source deployment gets the overrides and the secrets of the target environment
+func (h *Handler) PromoteDeployment(ctx context.Context, req PromoteDeploymentRequest) (GetDeploymentResponse, *vel.Error) {
+	if req.Environment != "" && req.Namespace != "" {
+		return GetDeploymentResponse{}, &vel.Error{
+			Code: "ONLY_ENVIRONMENT_OR_NAMESPACE_ALLOWED",
+		}
+	}
+
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return GetDeploymentResponse{}, rpcErr
+	}
+
+	source, err := h.db.GetDeployment(ctx, profile.UserInfo.CurrentWorkspace, req.DeploymentID)
+	if err != nil {
+		if errors.Is(err, ErrDeploymentNotFound) {
+			return GetDeploymentResponse{}, &vel.Error{
+				Code: "DEPLOYMENT_NOT_FOUND",
+			}
+		}
+		return GetDeploymentResponse{}, &vel.Error{
+			Message: "failed to get deployment to promote",
+			Err:     err,
+		}
+	}
+	if source.Status != DeployStatusDone {
+		return GetDeploymentResponse{}, &vel.Error{
+			Code: "DEPLOYMENT_IS_NOT_DONE",
+		}
+	}
+
+	workspace, repo, rpcErr := h.workspaceRepo(ctx, profile.UserInfo.CurrentWorkspace, source.RepoID)
+	if rpcErr != nil {
+		return GetDeploymentResponse{}, rpcErr
+	}
+	if repo.Status != StatusRepoActive {
+		return GetDeploymentResponse{}, &vel.Error{
+			Code: "REPO_IS_NOT_ACTIVE",
+		}
+	}
+
+	env, rpcErr := h.promotionTarget(ctx, workspace, repo, req)
+	if rpcErr != nil {
+		return GetDeploymentResponse{}, rpcErr
+	}
+	if env.Name == source.Environment {
+		return GetDeploymentResponse{}, &vel.Error{
+			Code: "SAME_ENVIRONMENT",
+		}
+	}
+	image, rpcErr := h.deployedImage(ctx, source)
+	if rpcErr != nil {
+		return GetDeploymentResponse{}, rpcErr
+	}
+
+	status := DeployStatusRunning
+	if repo.Protected || env.Protected {
+		status = DeployStatusAwaitingApproval
+	}
+	// a promotion waits for the required approver unless the approver promotes itself
+	if env.RequiredApprover != "" && env.RequiredApprover != profile.UserInfo.ID {
+		status = DeployStatusAwaitingApproval
+	}
+
+	deployment, err := h.db.SaveDeployment(ctx, AppDeployment{
+		FromDeploymentID: source.ID,
+		RepoID:           source.RepoID,
+		Environment:      env.Name,
+		Space:            source.Space,
+		Sha:              source.Sha,
+		Branch:           source.Branch,
+		CommitMessage:    source.CommitMessage,
+		BuildTag:         source.BuildTag,
+		Image:            source.Image,
+		ImageDigest:      image.Digest,
+		UserDisplayName:  profile.UserInfo.DisplayName,
+		UserID:           profile.UserInfo.ID,
+		Status:           status,
+	})
+	if err != nil {
+		return GetDeploymentResponse{}, &vel.Error{
+			Code: "FAILED_CREATE_DEPLOYMENT",
+			Err:  err,
+		}
+	}
+
+	if deployment.Status == DeployStatusAwaitingApproval {
+		return GetDeploymentResponse{Deployment: deployment}, nil
+	}
+
+	go func() {
+		deployment := deployment
+		ctx := context.WithoutCancel(ctx)
+		ctx, cancel := context.WithTimeout(ctx, time.Second*300)
+		defer cancel()
+
+		h.progress.Append(deployment.ID, ProgressMessage{
+			Payload:    "promoting image " + image.Reference() + " from deployment " + source.ID,
+			Level:      slog.LevelInfo,
+			Deployment: deployment,
+		})
+
+		applied, rpcErr := h.applyImage(ctx, repo, deployment, image, workspace)
+		if rpcErr != nil {
+			log.Println("[ERROR] failed to promote deployment", rpcErr.Err)
+			h.failDeployment(ctx, deployment, rpcErr)
+			return
+		}
+		deployment.Status = DeployStatusDone
+		deployment.SecretVersions = applied.SecretVersions
+		if err := h.db.UpdateDeployment(ctx, deployment); err != nil {
+			log.Println("[ERROR] failed update deployment", err)
+		}
+	}()
+
+	return GetDeploymentResponse{Deployment: deployment}, nil
+}
+
+// promotionTarget finds the environment a deployment is promoted to by its name or its namespace
+func (h *Handler) promotionTarget(ctx context.Context, workspace Workspace, repo GithubRepository, req PromoteDeploymentRequest) (Environment, *vel.Error) {
+	if req.Namespace == "" {
+		return h.repoEnvironment(ctx, workspace.ID, repo.TreenqID, req.Environment)
+	}
+
+	envs, err := h.db.GetEnvironments(ctx, repo.TreenqID)
+	if err != nil {
+		return Environment{}, &vel.Error{
+			Message: "failed to get repo environments",
+			Err:     err,
+		}
+	}
+	envs = append(envs, Environment{RepoID: repo.TreenqID, WorkspaceID: workspace.ID})
+	for _, env := range envs {
+		if h.kube.Namespace(appID(repo.TreenqID, env.Name), workspace.Namespace) == req.Namespace {
+			return env, nil
+		}
+	}
+
+	return Environment{}, &vel.Error{
+		Code: "ENVIRONMENT_NOT_FOUND",
+	}
+}
+
+// deployedImage gives the image a deployment has run, pinned by its digest
+func (h *Handler) deployedImage(ctx context.Context, deployment AppDeployment) (Image, *vel.Error) {
+	if deployment.Image != "" {
+		image, err := h.docker.ParseImage(deployment.Image)
+		if err != nil {
+			return Image{}, &vel.Error{
+				Message: "failed to parse image reference",
+				Err:     err,
+			}
+		}
+		if deployment.ImageDigest != "" {
+			image.Digest = deployment.ImageDigest
+		}
+		return image, nil
+	}
+
+	image, err := h.docker.Inspect(ctx, deployment)
+	if err != nil {
+		if errors.Is(err, ErrImageNotFound) || errors.Is(err, ErrRegistryUnauthorized) {
+			return Image{}, resolveImageError(err)
+		}
+		return Image{}, &vel.Error{
+			Message: "failed to inspect an image",
+			Err:     err,
+		}
+	}
+
+	return image, nil
+}
@@ -0,0 +1,169 @@
+package domain
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+
+	"github.com/dennypenta/vel"
+)
+
+var ErrRegistryCredentialsNotFound = errors.New("registry credentials not found")
+
+// RegistryCredentials gives access to an external OCI registry,
+// used to pull prebuilt images
+type RegistryCredentials struct {
+	Registry string `json:"registry"`
+	Username string `json:"username"`
+	// Password is never returned back by the api,
+	// it's stored as a workspace secret
+	Password string `json:"password,omitempty"`
+}
+
+// registrySecretKey gives a secret key the registry password is stored by,
+// the registry host may contain symbols not allowed in a secret name, therefore it's hashed
+func registrySecretKey(registry string) string {
+	sum := sha256.Sum256([]byte(registry))
+	return "registry-" + hex.EncodeToString(sum[:8])
+}
+
+type SetRegistryCredentialsRequest struct {
+	Registry string `json:"registry"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func (h *Handler) SetRegistryCredentials(ctx context.Context, req SetRegistryCredentialsRequest) (struct{}, *vel.Error) {
+	if req.Registry == "" || req.Username == "" || req.Password == "" {
+		return struct{}{}, &vel.Error{
+			Code: "INVALID_REGISTRY_CREDENTIALS",
+		}
+	}
+
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return struct{}{}, rpcErr
+	}
+
+	workspace, err := h.db.GetWorkspaceByID(ctx, profile.UserInfo.CurrentWorkspace)
+	if err != nil {
+		if errors.Is(err, ErrWorkspaceNotFound) {
+			return struct{}{}, &vel.Error{
+				Code: "WORKSPACE_NOT_FOUND",
+			}
+		}
+
+		return struct{}{}, &vel.Error{
+			Message: "failed to get workspace info",
+			Err:     err,
+		}
+	}
+
+	err = h.kube.StoreSecret(ctx, h.kubeConfig, workspace.Namespace, workspace.ID, registrySecretKey(req.Registry), req.Password)
+	if err != nil {
+		return struct{}{}, &vel.Error{
+			Message: "failed to store registry password",
+			Err:     err,
+		}
+	}
+
+	if err := h.db.SaveRegistryCredentials(ctx, workspace.ID, req.Registry, req.Username); err != nil {
+		return struct{}{}, &vel.Error{
+			Message: "failed to save registry credentials",
+			Err:     err,
+		}
+	}
+
+	return struct{}{}, nil
+}
+
+type GetRegistryCredentialsResponse struct {
+	Credentials []RegistryCredentials `json:"credentials"`
+}
+
+func (h *Handler) GetRegistryCredentials(ctx context.Context, _ struct{}) (GetRegistryCredentialsResponse, *vel.Error) {
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return GetRegistryCredentialsResponse{}, rpcErr
+	}
+
+	creds, err := h.db.GetRegistryCredentials(ctx, profile.UserInfo.CurrentWorkspace)
+	if err != nil {
+		return GetRegistryCredentialsResponse{}, &vel.Error{
+			Message: "failed to get registry credentials",
+			Err:     err,
+		}
+	}
+
+	return GetRegistryCredentialsResponse{
+		Credentials: creds,
+	}, nil
+}
+
+type RemoveRegistryCredentialsRequest struct {
+	Registry string `json:"registry"`
+}
+
+func (h *Handler) RemoveRegistryCredentials(ctx context.Context, req RemoveRegistryCredentialsRequest) (struct{}, *vel.Error) {
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return struct{}{}, rpcErr
+	}
+
+	if err := h.db.RemoveRegistryCredentials(ctx, profile.UserInfo.CurrentWorkspace, req.Registry); err != nil {
+		return struct{}{}, &vel.Error{
+			Message: "failed to remove registry credentials from database",
+			Err:     err,
+		}
+	}
+
+	workspace, err := h.db.GetWorkspaceByID(ctx, profile.UserInfo.CurrentWorkspace)
+	if err != nil {
+		if errors.Is(err, ErrWorkspaceNotFound) {
+			return struct{}{}, &vel.Error{
+				Code: "WORKSPACE_NOT_FOUND",
+			}
+		}
+
+		return struct{}{}, &vel.Error{
+			Message: "failed to get workspace info",
+			Err:     err,
+		}
+	}
+
+	err = h.kube.RemoveSecret(ctx, h.kubeConfig, workspace.Namespace, workspace.ID, registrySecretKey(req.Registry))
+	if err != nil {
+		return struct{}{}, &vel.Error{
+			Message: "failed to remove registry password from Kubernetes",
+			Err:     err,
+		}
+	}
+
+	return struct{}{}, nil
+}
+
+// getRegistryCredentials gives the workspace credentials for the given registry,
+// an empty value is returned if no credentials are saved, the registry is expected to be public then
+func (h *Handler) getRegistryCredentials(ctx context.Context, workspace Workspace, registry string) (RegistryCredentials, *vel.Error) {
+	creds, err := h.db.GetRegistryCredentialsByRegistry(ctx, workspace.ID, registry)
+	if err != nil {
+		if errors.Is(err, ErrRegistryCredentialsNotFound) {
+			return RegistryCredentials{}, nil
+		}
+		return RegistryCredentials{}, &vel.Error{
+			Message: "failed to get registry credentials",
+			Err:     err,
+		}
+	}
+
+	creds.Password, err = h.kube.GetSecret(ctx, h.kubeConfig, workspace.Namespace, workspace.ID, registrySecretKey(registry))
+	if err != nil {
+		return RegistryCredentials{}, &vel.Error{
+			Message: "failed to get registry password",
+			Err:     err,
+		}
+	}
+
+	return creds, nil
+}
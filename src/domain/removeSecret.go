@@ -8,44 +8,67 @@ import (
 )
 
 type RemoveSecretRequest struct {
-	RepoID string `json:"repoID"`
-	Key    string `json:"key"`
+	RepoID      string `json:"repoID"`
+	Environment string `json:"environment"`
+	Key         string `json:"key"`
 }
 
-func (h *Handler) RemoveSecret(ctx context.Context, req RemoveSecretRequest) (struct{}, *vel.Error) {
+// RemoveSecret removes a secret of a repo environment,
+// the deployed app is restarted without it unless the repo has the restart on a secret change disabled
+func (h *Handler) RemoveSecret(ctx context.Context, req RemoveSecretRequest) (SecretChangeResponse, *vel.Error) {
 	profile, rpcErr := h.GetProfile(ctx, struct{}{})
 	if rpcErr != nil {
-		return struct{}{}, rpcErr
-	}
-
-	if err := h.db.RemoveSecret(ctx, req.RepoID, req.Key, profile.UserInfo.CurrentWorkspace); err != nil {
-		return struct{}{}, &vel.Error{
-			Message: "failed to remove secret from database",
-			Err:     err,
-		}
+		return SecretChangeResponse{}, rpcErr
 	}
 
 	workspace, err := h.db.GetWorkspaceByID(ctx, profile.UserInfo.CurrentWorkspace)
 	if err != nil {
 		if errors.Is(err, ErrWorkspaceNotFound) {
-			return struct{}{}, &vel.Error{
+			return SecretChangeResponse{}, &vel.Error{
 				Code: "WORKSPACE_NOT_FOUND",
 			}
 		}
 
-		return struct{}{}, &vel.Error{
+		return SecretChangeResponse{}, &vel.Error{
 			Message: "failed to get workspace info",
 			Err:     err,
 		}
 	}
 
-	err = h.kube.RemoveSecret(ctx, h.kubeConfig, workspace.Name, req.RepoID, req.Key)
+	env, rpcErr := h.repoEnvironment(ctx, workspace.ID, req.RepoID, req.Environment)
+	if rpcErr != nil {
+		return SecretChangeResponse{}, rpcErr
+	}
+
+	if err := h.db.RemoveSecret(ctx, req.RepoID, env.Name, req.Key, workspace.ID); err != nil {
+		return SecretChangeResponse{}, &vel.Error{
+			Message: "failed to remove secret from database",
+			Err:     err,
+		}
+	}
+
+	kubeConfig, rpcErr := h.repoKubeConfig(ctx, workspace.ID, req.RepoID)
+	if rpcErr != nil {
+		return SecretChangeResponse{}, rpcErr
+	}
+
+	store, rpcErr := h.secretStore(ctx, workspace.ID)
+	if rpcErr != nil {
+		return SecretChangeResponse{}, rpcErr
+	}
+
+	err = store.RemoveSecret(ctx, kubeConfig, workspace.Namespace, appID(req.RepoID, env.Name), req.Key)
 	if err != nil {
-		return struct{}{}, &vel.Error{
-			Message: "failed to remove secret from Kubernetes",
+		return SecretChangeResponse{}, &vel.Error{
+			Message: "failed to remove secret from the secret store",
 			Err:     err,
 		}
 	}
 
-	return struct{}{}, nil
+	deployment, rpcErr := h.restartOnSecretChange(ctx, workspace, profile.UserInfo, req.RepoID, env)
+	if rpcErr != nil {
+		return SecretChangeResponse{}, rpcErr
+	}
+
+	return SecretChangeResponse{Deployment: deployment}, nil
 }
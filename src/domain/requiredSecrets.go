@@ -0,0 +1,63 @@
+package domain
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/dennypenta/vel"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+// MissingSecrets gives the required secret keys set neither as a repo secret nor in an attached secret group,
+// in the order they're required
+func MissingSecrets(required, secretKeys []string, groupSecrets []GroupSecret) []string {
+	var missing []string
+	for _, key := range required {
+		if slices.Contains(secretKeys, key) {
+			continue
+		}
+		if slices.ContainsFunc(groupSecrets, func(secret GroupSecret) bool { return secret.Key == key }) {
+			continue
+		}
+		missing = append(missing, key)
+	}
+	return missing
+}
+
+// missingSecretsError lists the absent keys in the message and the "keys" meta comma separated
+func missingSecretsError(missing []string) *vel.Error {
+	return &vel.Error{
+		Code:    "MISSING_SECRETS",
+		Message: "the required secrets aren't set: " + strings.Join(missing, ", "),
+		Meta:    map[string]string{"keys": strings.Join(missing, ",")},
+	}
+}
+
+// checkRequiredSecrets fails with MISSING_SECRETS if the repo environment misses a secret the space requires,
+// so the deployment fails before the build instead of the app crash-looping at runtime
+func (h *Handler) checkRequiredSecrets(ctx context.Context, workspaceID, repoID, environment string, space tqsdk.Space) *vel.Error {
+	if len(space.Service.RequiredSecrets) == 0 {
+		return nil
+	}
+
+	secretKeys, err := h.db.GetRepositorySecretKeys(ctx, repoID, environment, workspaceID)
+	if err != nil {
+		return &vel.Error{
+			Message: "failed to get repo secret keys",
+			Err:     err,
+		}
+	}
+	groupSecrets, err := h.db.GetAttachedGroupSecrets(ctx, workspaceID, repoID, environment)
+	if err != nil {
+		return &vel.Error{
+			Message: "failed to get attached group secrets",
+			Err:     err,
+		}
+	}
+
+	if missing := MissingSecrets(space.Service.RequiredSecrets, secretKeys, groupSecrets); len(missing) > 0 {
+		return missingSecretsError(missing)
+	}
+	return nil
+}
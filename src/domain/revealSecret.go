@@ -8,8 +8,9 @@ import (
 )
 
 type RevealSecretRequest struct {
-	RepoID string `json:"repoID"`
-	Key    string `json:"key"`
+	RepoID      string `json:"repoID"`
+	Environment string `json:"environment"`
+	Key         string `json:"key"`
 }
 
 type RevealSecretResponse struct {
@@ -21,7 +22,7 @@ func (h *Handler) RevealSecret(ctx context.Context, req RevealSecretRequest) (Re
 	if rpcErr != nil {
 		return RevealSecretResponse{}, rpcErr
 	}
-	exists, err := h.db.RepositorySecretKeyExists(ctx, req.RepoID, req.Key, profile.UserInfo.CurrentWorkspace)
+	exists, err := h.db.RepositorySecretKeyExists(ctx, req.RepoID, req.Environment, req.Key, profile.UserInfo.CurrentWorkspace)
 	if err != nil {
 		return RevealSecretResponse{}, &vel.Error{
 			Message: "failed to lookup a secret key",
@@ -48,7 +49,17 @@ func (h *Handler) RevealSecret(ctx context.Context, req RevealSecretRequest) (Re
 		}
 	}
 
-	value, err := h.kube.GetSecret(ctx, h.kubeConfig, workspace.Name, req.RepoID, req.Key)
+	kubeConfig, rpcErr := h.repoKubeConfig(ctx, workspace.ID, req.RepoID)
+	if rpcErr != nil {
+		return RevealSecretResponse{}, rpcErr
+	}
+
+	store, rpcErr := h.secretStore(ctx, workspace.ID)
+	if rpcErr != nil {
+		return RevealSecretResponse{}, rpcErr
+	}
+
+	value, err := store.GetSecret(ctx, kubeConfig, workspace.Namespace, appID(req.RepoID, req.Environment), req.Key)
 	if err != nil {
 		return RevealSecretResponse{}, &vel.Error{
 			Message: "failed to reveal secret",
@@ -0,0 +1,134 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/dennypenta/vel"
+	"github.com/treenq/treenq/pkg/auth"
+)
+
+// workspace roles stored in workspaceUsers.role
+const (
+	// RoleOwner has every permission, a workspace creator becomes its owner
+	RoleOwner = "owner"
+	// RoleAdmin manages the workspace settings, members and approves protected deployments
+	RoleAdmin = "admin"
+	// RoleDeveloper deploys and changes secrets without seeing their values
+	RoleDeveloper = "developer"
+	// RoleViewer has read only access
+	RoleViewer = "viewer"
+)
+
+type Permission string
+
+const (
+	// PermissionRead allows to see repos, deployments, logs and secret keys
+	PermissionRead Permission = "read"
+	// PermissionDeploy allows to deploy, plan and promote deployments
+	PermissionDeploy Permission = "deploy"
+	// PermissionWriteSecrets allows to set and remove secrets
+	PermissionWriteSecrets Permission = "writeSecrets"
+	// PermissionRevealSecrets allows to see secret values
+	PermissionRevealSecrets Permission = "revealSecrets"
+	// PermissionApprove allows to approve deployments to protected repos and environments
+	PermissionApprove Permission = "approve"
+	// PermissionManageSettings allows to change repos, environments, clusters and registries
+	PermissionManageSettings Permission = "manageSettings"
+	// PermissionManageMembers allows to invite and remove workspace members and change their roles
+	PermissionManageMembers Permission = "manageMembers"
+	// PermissionReadAuditLog allows to see and export the workspace audit log
+	PermissionReadAuditLog Permission = "readAuditLog"
+	// PermissionManageApiTokens allows to issue and revoke the personal api tokens
+	PermissionManageApiTokens Permission = "manageApiTokens"
+	// PermissionManageWorkspace allows to rename and remove a workspace
+	PermissionManageWorkspace Permission = "manageWorkspace"
+)
+
+var rolePermissions = map[string][]Permission{
+	RoleViewer: {
+		PermissionRead,
+	},
+	RoleDeveloper: {
+		PermissionRead,
+		PermissionDeploy,
+		PermissionWriteSecrets,
+		PermissionManageApiTokens,
+	},
+	RoleAdmin: {
+		PermissionRead,
+		PermissionDeploy,
+		PermissionWriteSecrets,
+		PermissionRevealSecrets,
+		PermissionApprove,
+		PermissionManageSettings,
+		PermissionManageMembers,
+		PermissionReadAuditLog,
+		PermissionManageApiTokens,
+	},
+	RoleOwner: {
+		PermissionRead,
+		PermissionDeploy,
+		PermissionWriteSecrets,
+		PermissionRevealSecrets,
+		PermissionApprove,
+		PermissionManageSettings,
+		PermissionManageMembers,
+		PermissionReadAuditLog,
+		PermissionManageApiTokens,
+		PermissionManageWorkspace,
+	},
+}
+
+// RoleAllows reports whether the role has the permission, unknown roles have none
+func RoleAllows(role string, permission Permission) bool {
+	return slices.Contains(rolePermissions[role], permission)
+}
+
+// ValidRole reports whether the role is one of the known workspace roles
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// Authorize gives a middleware allowing the request only if the user role in the current workspace has the permission,
+// it expects the auth middleware to verify the token before
+func (h *Handler) Authorize(permission Permission) vel.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userInfo, rpcErr := userInfoFromClaims(auth.ClaimsFromCtx(r.Context()), r)
+			if rpcErr != nil {
+				writeError(w, r, http.StatusBadRequest, rpcErr)
+				return
+			}
+
+			role, err := h.db.GetWorkspaceRole(r.Context(), userInfo.CurrentWorkspace, userInfo.ID)
+			if err != nil && !errors.Is(err, ErrWorkspaceNotFound) {
+				h.l.ErrorContext(r.Context(), "failed to get workspace role", "err", err)
+				writeError(w, r, http.StatusInternalServerError, &vel.Error{Message: "failed to get workspace role", Err: err})
+				return
+			}
+			if !RoleAllows(role, permission) {
+				writeError(w, r, http.StatusForbidden, &vel.Error{Code: "FORBIDDEN", Message: "the role has no " + string(permission) + " permission"})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// writeError responds with a json error the same way the vel handlers do
+func writeError(w http.ResponseWriter, r *http.Request, status int, rpcErr *vel.Error) {
+	if vel.GlobalOpts.ProcessErr != nil {
+		vel.GlobalOpts.ProcessErr(r, rpcErr)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(rpcErr); err != nil {
+		slog.Default().ErrorContext(r.Context(), "failed to write authorization error", "err", err)
+	}
+}
@@ -0,0 +1,426 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dennypenta/vel"
+)
+
+var (
+	ErrSecretGroupNotFound = errors.New("secret group not found")
+	ErrSecretGroupExists   = errors.New("secret group already exists")
+)
+
+// SecretGroup is a set of workspace secrets shared by the repos attaching it, e.g. a Sentry DSN or a database url
+type SecretGroup struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Keys are the secret keys of the group, the values are never returned
+	Keys      []string  `json:"keys"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// GroupSecret is a secret of a group attached to a repo environment
+type GroupSecret struct {
+	GroupID string
+	Group   string
+	Key     string
+	// Value is encrypted in the database and decrypted right before the app is defined
+	Value []byte
+}
+
+// the sources of an app env variable
+const (
+	EnvSourceSecretGroup = "secretGroup"
+	EnvSourceRuntimeEnv  = "runtimeEnv"
+	EnvSourceSecret      = "secret"
+)
+
+// EnvSource is an app env variable and the place its value comes from
+type EnvSource struct {
+	Name string `json:"name"`
+	// Source is one of secretGroup, runtimeEnv or secret
+	Source string `json:"source"`
+	// Key is a secret key the value is read from, empty for the runtime envs
+	Key     string `json:"key,omitempty"`
+	GroupID string `json:"groupID,omitempty"`
+	Group   string `json:"group,omitempty"`
+	// Value is set only for the runtime envs, they are a part of the space anyway
+	Value string `json:"value,omitempty"`
+	// Overridden marks a variable taken over by the same name of a higher precedence
+	Overridden bool `json:"overridden"`
+}
+
+// ResolveEnv lists the app env variables from the lowest precedence to the highest one:
+// the attached secret groups in their attachment order, then the space runtime envs, then the repo secrets.
+// A later variable overrides an earlier one of the same name, the secret keys become upper case variables.
+func ResolveEnv(groupSecrets []GroupSecret, runtimeEnvs map[string]string, secretKeys []string) []EnvSource {
+	envs := make([]EnvSource, 0, len(groupSecrets)+len(runtimeEnvs)+len(secretKeys))
+	for _, secret := range groupSecrets {
+		envs = append(envs, EnvSource{
+			Name:    strings.ToUpper(secret.Key),
+			Source:  EnvSourceSecretGroup,
+			Key:     secret.Key,
+			GroupID: secret.GroupID,
+			Group:   secret.Group,
+		})
+	}
+	names := make([]string, 0, len(runtimeEnvs))
+	for name := range runtimeEnvs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		envs = append(envs, EnvSource{
+			Name:   name,
+			Source: EnvSourceRuntimeEnv,
+			Value:  runtimeEnvs[name],
+		})
+	}
+	for _, key := range secretKeys {
+		envs = append(envs, EnvSource{
+			Name:   strings.ToUpper(key),
+			Source: EnvSourceSecret,
+			Key:    key,
+		})
+	}
+
+	last := make(map[string]int, len(envs))
+	for i, env := range envs {
+		last[env.Name] = i
+	}
+	for i := range envs {
+		envs[i].Overridden = last[envs[i].Name] != i
+	}
+
+	return envs
+}
+
+// InjectedEnv gives the secret variables of the app env taking effect, the repo secrets and the group secrets
+// not overridden by a variable of a higher precedence, the runtime envs are left to the space
+func InjectedEnv(groupSecrets []GroupSecret, runtimeEnvs map[string]string, secretKeys []string) []EnvSource {
+	var envs []EnvSource
+	for _, env := range ResolveEnv(groupSecrets, runtimeEnvs, secretKeys) {
+		if !env.Overridden && env.Source != EnvSourceRuntimeEnv {
+			envs = append(envs, env)
+		}
+	}
+	return envs
+}
+
+// groupEnvValues gives the values of the group secrets taking effect by their env names
+func groupEnvValues(envs []EnvSource, groupSecrets []GroupSecret) map[string]string {
+	values := make(map[string]string)
+	for _, env := range envs {
+		if env.Source != EnvSourceSecretGroup {
+			continue
+		}
+		for _, secret := range groupSecrets {
+			if secret.GroupID == env.GroupID && secret.Key == env.Key {
+				values[env.Name] = string(secret.Value)
+			}
+		}
+	}
+	return values
+}
+
+// attachedGroupSecrets gives the decrypted secrets of the groups attached to the repo environment
+func (h *Handler) attachedGroupSecrets(ctx context.Context, workspaceID, repoID, environment string) ([]GroupSecret, *vel.Error) {
+	secrets, err := h.db.GetAttachedGroupSecrets(ctx, workspaceID, repoID, environment)
+	if err != nil {
+		return nil, &vel.Error{
+			Message: "failed to get attached group secrets",
+			Err:     err,
+		}
+	}
+	for i := range secrets {
+		secrets[i].Value, err = h.secretCipher.Decrypt(secrets[i].Value)
+		if err != nil {
+			return nil, &vel.Error{
+				Message: "failed to decrypt group secret",
+				Err:     err,
+			}
+		}
+	}
+
+	return secrets, nil
+}
+
+type CreateSecretGroupRequest struct {
+	Name string `json:"name"`
+}
+
+type SecretGroupResponse struct {
+	Group SecretGroup `json:"group"`
+}
+
+func (h *Handler) CreateSecretGroup(ctx context.Context, req CreateSecretGroupRequest) (SecretGroupResponse, *vel.Error) {
+	if !validateSecretKey(req.Name) || len(req.Name) > 64 {
+		return SecretGroupResponse{}, &vel.Error{
+			Code: "INVALID_SECRET_GROUP_NAME",
+		}
+	}
+
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return SecretGroupResponse{}, rpcErr
+	}
+
+	group, err := h.db.SaveSecretGroup(ctx, profile.UserInfo.CurrentWorkspace, req.Name)
+	if err != nil {
+		if errors.Is(err, ErrSecretGroupExists) {
+			return SecretGroupResponse{}, &vel.Error{
+				Code: "SECRET_GROUP_ALREADY_EXISTS",
+			}
+		}
+		return SecretGroupResponse{}, &vel.Error{
+			Message: "failed to save secret group",
+			Err:     err,
+		}
+	}
+
+	return SecretGroupResponse{Group: group}, nil
+}
+
+type GetSecretGroupsResponse struct {
+	Groups []SecretGroup `json:"groups"`
+}
+
+func (h *Handler) GetSecretGroups(ctx context.Context, _ struct{}) (GetSecretGroupsResponse, *vel.Error) {
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return GetSecretGroupsResponse{}, rpcErr
+	}
+
+	groups, err := h.db.GetSecretGroups(ctx, profile.UserInfo.CurrentWorkspace)
+	if err != nil {
+		return GetSecretGroupsResponse{}, &vel.Error{
+			Message: "failed to get secret groups",
+			Err:     err,
+		}
+	}
+
+	return GetSecretGroupsResponse{Groups: groups}, nil
+}
+
+type RemoveSecretGroupRequest struct {
+	ID string `json:"id"`
+}
+
+// RemoveSecretGroup removes a group along with its secrets and detaches it from every repo,
+// the running apps keep the values until the next deployment
+func (h *Handler) RemoveSecretGroup(ctx context.Context, req RemoveSecretGroupRequest) (struct{}, *vel.Error) {
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return struct{}{}, rpcErr
+	}
+
+	if err := h.db.RemoveSecretGroup(ctx, profile.UserInfo.CurrentWorkspace, req.ID); err != nil {
+		if errors.Is(err, ErrSecretGroupNotFound) {
+			return struct{}{}, &vel.Error{
+				Code: "SECRET_GROUP_NOT_FOUND",
+			}
+		}
+		return struct{}{}, &vel.Error{
+			Message: "failed to remove secret group",
+			Err:     err,
+		}
+	}
+
+	return struct{}{}, nil
+}
+
+type SetGroupSecretRequest struct {
+	GroupID string `json:"groupID"`
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+}
+
+func (h *Handler) SetGroupSecret(ctx context.Context, req SetGroupSecretRequest) (struct{}, *vel.Error) {
+	if !validateSecretKey(req.Key) {
+		return struct{}{}, &vel.Error{
+			Code: "INVALID_SECRET_KEY",
+		}
+	}
+
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return struct{}{}, rpcErr
+	}
+
+	value, err := h.secretCipher.Encrypt([]byte(req.Value))
+	if err != nil {
+		return struct{}{}, &vel.Error{
+			Message: "failed to encrypt group secret",
+			Err:     err,
+		}
+	}
+
+	if err := h.db.SetGroupSecret(ctx, profile.UserInfo.CurrentWorkspace, req.GroupID, req.Key, value); err != nil {
+		if errors.Is(err, ErrSecretGroupNotFound) {
+			return struct{}{}, &vel.Error{
+				Code: "SECRET_GROUP_NOT_FOUND",
+			}
+		}
+		return struct{}{}, &vel.Error{
+			Message: "failed to save group secret",
+			Err:     err,
+		}
+	}
+
+	return struct{}{}, nil
+}
+
+type RemoveGroupSecretRequest struct {
+	GroupID string `json:"groupID"`
+	Key     string `json:"key"`
+}
+
+func (h *Handler) RemoveGroupSecret(ctx context.Context, req RemoveGroupSecretRequest) (struct{}, *vel.Error) {
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return struct{}{}, rpcErr
+	}
+
+	if err := h.db.RemoveGroupSecret(ctx, profile.UserInfo.CurrentWorkspace, req.GroupID, req.Key); err != nil {
+		if errors.Is(err, ErrSecretNotFound) {
+			return struct{}{}, &vel.Error{
+				Code: "SECRET_DOESNT_EXIST",
+			}
+		}
+		return struct{}{}, &vel.Error{
+			Message: "failed to remove group secret",
+			Err:     err,
+		}
+	}
+
+	return struct{}{}, nil
+}
+
+type SecretGroupAttachmentRequest struct {
+	RepoID      string `json:"repoID"`
+	Environment string `json:"environment"`
+	GroupID     string `json:"groupID"`
+}
+
+// AttachSecretGroup injects the group secrets to the app env of the repo environment starting from the next deployment,
+// a group attached later overrides the same keys of the groups attached before
+func (h *Handler) AttachSecretGroup(ctx context.Context, req SecretGroupAttachmentRequest) (struct{}, *vel.Error) {
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return struct{}{}, rpcErr
+	}
+
+	env, rpcErr := h.repoEnvironment(ctx, profile.UserInfo.CurrentWorkspace, req.RepoID, req.Environment)
+	if rpcErr != nil {
+		return struct{}{}, rpcErr
+	}
+
+	if err := h.db.AttachSecretGroup(ctx, profile.UserInfo.CurrentWorkspace, req.RepoID, env.Name, req.GroupID); err != nil {
+		if errors.Is(err, ErrSecretGroupNotFound) {
+			return struct{}{}, &vel.Error{
+				Code: "SECRET_GROUP_NOT_FOUND",
+			}
+		}
+		return struct{}{}, &vel.Error{
+			Message: "failed to attach secret group",
+			Err:     err,
+		}
+	}
+
+	return struct{}{}, nil
+}
+
+func (h *Handler) DetachSecretGroup(ctx context.Context, req SecretGroupAttachmentRequest) (struct{}, *vel.Error) {
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return struct{}{}, rpcErr
+	}
+
+	if err := h.db.DetachSecretGroup(ctx, profile.UserInfo.CurrentWorkspace, req.RepoID, req.Environment, req.GroupID); err != nil {
+		if errors.Is(err, ErrSecretGroupNotFound) {
+			return struct{}{}, &vel.Error{
+				Code: "SECRET_GROUP_NOT_FOUND",
+			}
+		}
+		return struct{}{}, &vel.Error{
+			Message: "failed to detach secret group",
+			Err:     err,
+		}
+	}
+
+	return struct{}{}, nil
+}
+
+type GetAppEnvRequest struct {
+	RepoID      string `json:"repoID"`
+	Environment string `json:"environment"`
+}
+
+type GetAppEnvResponse struct {
+	// Groups are the attached secret groups in their attachment order
+	Groups []SecretGroup `json:"groups"`
+	// Envs are the app env variables the next deployment gets, see ResolveEnv for the precedence
+	Envs []EnvSource `json:"envs"`
+}
+
+// GetAppEnv shows the env variables of the repo environment and where each of them comes from,
+// the runtime envs are taken from the connected repo space
+func (h *Handler) GetAppEnv(ctx context.Context, req GetAppEnvRequest) (GetAppEnvResponse, *vel.Error) {
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return GetAppEnvResponse{}, rpcErr
+	}
+
+	workspace, repo, rpcErr := h.workspaceRepo(ctx, profile.UserInfo.CurrentWorkspace, req.RepoID)
+	if rpcErr != nil {
+		return GetAppEnvResponse{}, rpcErr
+	}
+	env, rpcErr := h.repoEnvironment(ctx, workspace.ID, repo.TreenqID, req.Environment)
+	if rpcErr != nil {
+		return GetAppEnvResponse{}, rpcErr
+	}
+
+	groups, err := h.db.GetAttachedSecretGroups(ctx, workspace.ID, repo.TreenqID, env.Name)
+	if err != nil {
+		return GetAppEnvResponse{}, &vel.Error{
+			Message: "failed to get attached secret groups",
+			Err:     err,
+		}
+	}
+	// the values stay encrypted, only the keys are shown
+	groupSecrets, err := h.db.GetAttachedGroupSecrets(ctx, workspace.ID, repo.TreenqID, env.Name)
+	if err != nil {
+		return GetAppEnvResponse{}, &vel.Error{
+			Message: "failed to get attached group secrets",
+			Err:     err,
+		}
+	}
+
+	// a repo without a connected space has no runtime envs yet
+	space, err := h.db.GetSpace(ctx, repo.TreenqID)
+	if err != nil && !errors.Is(err, ErrNoSpaceFound) {
+		return GetAppEnvResponse{}, &vel.Error{
+			Message: "failed to get repo space",
+			Err:     err,
+		}
+	}
+	space = env.Overrides.Apply(space)
+
+	secretKeys, err := h.db.GetRepositorySecretKeys(ctx, repo.TreenqID, env.Name, workspace.ID)
+	if err != nil {
+		return GetAppEnvResponse{}, &vel.Error{
+			Message: "failed to get repo secret keys",
+			Err:     err,
+		}
+	}
+
+	return GetAppEnvResponse{
+		Groups: groups,
+		Envs:   ResolveEnv(groupSecrets, space.Service.RuntimeEnvs, secretKeys),
+	}, nil
+}
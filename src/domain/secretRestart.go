@@ -0,0 +1,216 @@
+package domain
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/dennypenta/vel"
+)
+
+// SecretsChecksum identifies the secrets an app is defined with, the app pods are restarted once it changes.
+// The repo secrets are identified by their keys and versions, the group secrets by their values
+// in the order of precedence, so a reordered group changes the checksum too.
+func SecretsChecksum(secretKeys []string, versions map[string]int, groupSecrets []GroupSecret) string {
+	keys := slices.Clone(secretKeys)
+	slices.Sort(keys)
+
+	h := sha256.New()
+	for _, key := range keys {
+		fmt.Fprintf(h, "secret:%s:%d\n", key, versions[key])
+	}
+	for _, secret := range groupSecrets {
+		fmt.Fprintf(h, "group:%s:%s:%x\n", secret.GroupID, secret.Key, sha256.Sum256(secret.Value))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+type SetRepoSecretRestartRequest struct {
+	RepoID  string `json:"repoID"`
+	Restart bool   `json:"restart"`
+}
+
+// SetRepoSecretRestart enables or disables the restart of the repo apps on a change of their secrets,
+// the disabled apps get the changed secrets on the next deployment
+func (h *Handler) SetRepoSecretRestart(ctx context.Context, req SetRepoSecretRestartRequest) (struct{}, *vel.Error) {
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return struct{}{}, rpcErr
+	}
+
+	if err := h.db.SetRepoRestartOnSecretChange(ctx, profile.UserInfo.CurrentWorkspace, req.RepoID, req.Restart); err != nil {
+		if errors.Is(err, ErrRepoNotFound) {
+			return struct{}{}, &vel.Error{
+				Code: "REPO_NOT_FOUND",
+			}
+		}
+		return struct{}{}, &vel.Error{
+			Message: "failed to set repo secret restart",
+			Err:     err,
+		}
+	}
+
+	return struct{}{}, nil
+}
+
+// SecretChangeResponse gives the deployment restarting the app with the changed secrets,
+// it's empty if the repo has the restart disabled or the environment has never been deployed.
+// The restart progress is streamed by GetBuildProgress of the deployment,
+// a restart of a protected repo or environment awaits an approval, see ApproveDeployment.
+type SecretChangeResponse struct {
+	Deployment AppDeployment `json:"deployment,omitzero"`
+}
+
+// restartOnSecretChange reapplies the last done deployment of a repo environment with its current secrets,
+// it wires the new secret keys into the app and rolls the pods out with the new secrets checksum.
+// The image is never rebuilt, a protected repo or environment gets the restart awaiting an approval as any other deployment.
+func (h *Handler) restartOnSecretChange(ctx context.Context, workspace Workspace, user UserInfo, repoID string, env Environment) (AppDeployment, *vel.Error) {
+	repo, err := h.db.GetRepoByID(ctx, workspace.ID, repoID)
+	if err != nil {
+		if errors.Is(err, ErrRepoNotFound) {
+			return AppDeployment{}, &vel.Error{
+				Code: "REPO_NOT_FOUND",
+			}
+		}
+		return AppDeployment{}, &vel.Error{
+			Message: "failed to get repo",
+			Err:     err,
+		}
+	}
+	if !repo.RestartOnSecretChange || repo.Status != StatusRepoActive {
+		return AppDeployment{}, nil
+	}
+
+	source, err := h.db.GetLastDoneDeployment(ctx, workspace.ID, repoID, env.Name)
+	if err != nil {
+		if errors.Is(err, ErrDeploymentNotFound) {
+			return AppDeployment{}, nil
+		}
+		return AppDeployment{}, &vel.Error{
+			Message: "failed to get the last deployment",
+			Err:     err,
+		}
+	}
+
+	image, rpcErr := h.deployedImage(ctx, source)
+	if rpcErr != nil {
+		return AppDeployment{}, rpcErr
+	}
+
+	status := DeployStatusRunning
+	if repo.Protected || env.Protected {
+		status = DeployStatusAwaitingApproval
+	}
+
+	deployment, err := h.db.SaveDeployment(ctx, AppDeployment{
+		FromDeploymentID: source.ID,
+		RepoID:           source.RepoID,
+		Environment:      source.Environment,
+		Space:            source.Space,
+		Sha:              source.Sha,
+		Branch:           source.Branch,
+		CommitMessage:    source.CommitMessage,
+		BuildTag:         source.BuildTag,
+		Image:            source.Image,
+		ImageDigest:      image.Digest,
+		UserDisplayName:  user.DisplayName,
+		UserID:           user.ID,
+		Status:           status,
+	})
+	if err != nil {
+		return AppDeployment{}, &vel.Error{
+			Code: "FAILED_CREATE_DEPLOYMENT",
+			Err:  err,
+		}
+	}
+	if deployment.Status == DeployStatusAwaitingApproval {
+		return deployment, nil
+	}
+
+	go func() {
+		deployment := deployment
+		ctx := context.WithoutCancel(ctx)
+		ctx, cancel := context.WithTimeout(ctx, time.Second*300)
+		defer cancel()
+
+		h.progress.Append(deployment.ID, ProgressMessage{
+			Payload:    "restarting the app to apply the changed secrets, image " + image.Reference(),
+			Level:      slog.LevelInfo,
+			Deployment: deployment,
+		})
+
+		pullCredentials, rpcErr := h.pullCredentials(ctx, workspace, deployment, image)
+		applied := deployment
+		if rpcErr == nil {
+			applied, rpcErr = h.applyApp(ctx, repo, deployment, image, workspace, pullCredentials, false)
+		}
+		if rpcErr != nil {
+			log.Println("[ERROR] failed to restart app on secret change", rpcErr.Err)
+			h.progress.Append(deployment.ID, ProgressMessage{
+				Payload: "failed to restart the app",
+				Level:   slog.LevelError,
+				Final:   true,
+			})
+			deployment.Status = DeployStatusFailed
+		} else {
+			deployment.SecretVersions = applied.SecretVersions
+			if err := h.waitRollout(ctx, repo, deployment, workspace); err != nil {
+				log.Println("[ERROR] failed to roll out app on secret change", err)
+				deployment.Status = DeployStatusFailed
+			} else {
+				deployment.Status = DeployStatusDone
+			}
+		}
+		if err := h.db.UpdateDeployment(ctx, deployment); err != nil {
+			log.Println("[ERROR] failed update deployment", err)
+		}
+	}()
+
+	return deployment, nil
+}
+
+// waitRollout streams the rollout progress of the applied deployment until its pods are replaced
+func (h *Handler) waitRollout(ctx context.Context, repo GithubRepository, deployment AppDeployment, workspace Workspace) error {
+	kubeConfig, rpcErr := h.clusterKubeConfig(ctx, workspace.ID, repo.ClusterID)
+	if rpcErr != nil {
+		h.progress.Append(deployment.ID, ProgressMessage{
+			Payload: "failed to get cluster config",
+			Level:   slog.LevelError,
+			Final:   true,
+		})
+		return rpcErr
+	}
+
+	progressChan := make(chan ProgressMessage)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for msg := range progressChan {
+			h.progress.Append(deployment.ID, msg)
+		}
+	}()
+	err := h.kube.WaitRollout(ctx, kubeConfig, appID(repo.TreenqID, deployment.Environment), workspace.Namespace, progressChan)
+	close(progressChan)
+	<-done
+
+	if err != nil {
+		h.progress.Append(deployment.ID, ProgressMessage{
+			Payload: "failed to roll out the app: " + err.Error(),
+			Level:   slog.LevelError,
+			Final:   true,
+		})
+		return err
+	}
+	h.progress.Append(deployment.ID, ProgressMessage{
+		Payload: "the app is restarted with the changed secrets",
+		Level:   slog.LevelInfo,
+		Final:   true,
+	})
+	return nil
+}
@@ -0,0 +1,255 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/dennypenta/vel"
+)
+
+var ErrSecretStoreNotFound = errors.New("secret store not found")
+
+// the stores a workspace keeps the values of its repo secrets in
+const (
+	// SecretStoreKubernetes keeps every value in a Kubernetes secret of the app namespace
+	SecretStoreKubernetes = "kubernetes"
+	// SecretStoreVault keeps every value in a HashiCorp Vault KV v2 secret,
+	// the Vault Agent Injector renders the values for the app pods
+	SecretStoreVault = "vault"
+)
+
+// AppSecrets are the secrets an app is defined with
+type AppSecrets struct {
+	// Keys are the repo secret keys, the app env refers to their Kubernetes secrets unless they're injected
+	Keys []string
+	// Groups are the values of the attached secret groups in the order of precedence
+	Groups []GroupSecret
+	// Checksum annotates the pod template, the pods are restarted once it's changed
+	Checksum string
+	// Injection delivers the repo secrets and the group values from an external secret store,
+	// nil means the app env refers to the Kubernetes secrets
+	Injection *SecretInjection
+}
+
+// SecretInjection delivers the secret values of an external store to the app pods as a shell script,
+// the container command sources the script and runs the image command with the values as its env
+type SecretInjection struct {
+	// Annotations annotate the pod template to render the script, e.g. by the Vault Agent Injector
+	Annotations map[string]string
+	// EnvFile is a path of the script in the app container, it prepends NAME=value arguments for env(1)
+	EnvFile string
+	// Command is the image entrypoint followed by the image cmd, the image must have /bin/sh to run it, otherwise the deployment fails with IMAGE_SHELL_REQUIRED
+	Command []string
+}
+
+// WorkspaceSecretStore is the store a workspace keeps the values of its repo secrets in
+type WorkspaceSecretStore struct {
+	Kind string `json:"kind"`
+	// VaultAddress is a Vault server url, e.g. https://vault.example.com:8200
+	VaultAddress string `json:"vaultAddress,omitempty"`
+	// VaultMount is a path the KV v2 engine is mounted at, "secret" by default
+	VaultMount string `json:"vaultMount,omitempty"`
+	// VaultPathPrefix is prepended to the secret paths, the workspace namespace by default
+	VaultPathPrefix string `json:"vaultPathPrefix,omitempty"`
+	// VaultRole is a Kubernetes auth role the Vault Agent of the app pods logs in with
+	VaultRole string `json:"vaultRole,omitempty"`
+	// VaultToken is encrypted, it's never returned back by the api
+	VaultToken []byte    `json:"-"`
+	UpdatedAt  time.Time `json:"updatedAt,omitzero"`
+}
+
+// VaultConfig connects a Vault KV v2 secrets engine
+type VaultConfig struct {
+	Address    string
+	Mount      string
+	PathPrefix string
+	Role       string
+	Token      string
+}
+
+type SetSecretStoreRequest struct {
+	Kind            string `json:"kind"`
+	VaultAddress    string `json:"vaultAddress"`
+	VaultMount      string `json:"vaultMount"`
+	VaultPathPrefix string `json:"vaultPathPrefix"`
+	VaultRole       string `json:"vaultRole"`
+	// VaultToken may be empty to keep the token of the current Vault store having the same address
+	VaultToken string `json:"vaultToken"`
+}
+
+type GetSecretStoreResponse struct {
+	Store WorkspaceSecretStore `json:"store"`
+}
+
+// SetSecretStore selects the store the workspace keeps its repo secret values in.
+// The secrets aren't moved between the stores, so the kind can be changed only while the workspace has no repo secrets,
+// they may be exported and imported back after the change.
+func (h *Handler) SetSecretStore(ctx context.Context, req SetSecretStoreRequest) (GetSecretStoreResponse, *vel.Error) {
+	store := WorkspaceSecretStore{Kind: req.Kind}
+	switch req.Kind {
+	case SecretStoreKubernetes:
+	case SecretStoreVault:
+		address, err := url.Parse(req.VaultAddress)
+		if err != nil || (address.Scheme != "http" && address.Scheme != "https") || address.Host == "" || req.VaultRole == "" {
+			return GetSecretStoreResponse{}, &vel.Error{
+				Code: "INVALID_SECRET_STORE",
+			}
+		}
+		store.VaultAddress = req.VaultAddress
+		store.VaultMount = req.VaultMount
+		store.VaultPathPrefix = req.VaultPathPrefix
+		store.VaultRole = req.VaultRole
+	default:
+		return GetSecretStoreResponse{}, &vel.Error{
+			Code: "UNKNOWN_SECRET_STORE",
+		}
+	}
+
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return GetSecretStoreResponse{}, rpcErr
+	}
+	workspaceID := profile.UserInfo.CurrentWorkspace
+
+	current, err := h.db.GetWorkspaceSecretStore(ctx, workspaceID)
+	if err != nil {
+		if !errors.Is(err, ErrSecretStoreNotFound) {
+			return GetSecretStoreResponse{}, &vel.Error{
+				Message: "failed to get secret store",
+				Err:     err,
+			}
+		}
+		current = WorkspaceSecretStore{Kind: SecretStoreKubernetes}
+	}
+
+	if current.Kind != store.Kind {
+		count, err := h.db.CountWorkspaceSecrets(ctx, workspaceID)
+		if err != nil {
+			return GetSecretStoreResponse{}, &vel.Error{
+				Message: "failed to count workspace secrets",
+				Err:     err,
+			}
+		}
+		if count > 0 {
+			return GetSecretStoreResponse{}, &vel.Error{
+				Code: "SECRET_STORE_IN_USE",
+			}
+		}
+	}
+
+	if store.Kind == SecretStoreVault {
+		switch {
+		case req.VaultToken != "":
+			store.VaultToken, err = h.cipher.Encrypt([]byte(req.VaultToken))
+			if err != nil {
+				return GetSecretStoreResponse{}, &vel.Error{
+					Message: "failed to encrypt vault token",
+					Err:     err,
+				}
+			}
+		// the stored token is sent to the same vault only, another address requires its own token
+		case current.Kind == SecretStoreVault && current.VaultAddress == store.VaultAddress:
+			store.VaultToken = current.VaultToken
+		default:
+			return GetSecretStoreResponse{}, &vel.Error{
+				Code: "INVALID_SECRET_STORE",
+			}
+		}
+	}
+
+	store, err = h.db.SaveWorkspaceSecretStore(ctx, workspaceID, store)
+	if err != nil {
+		return GetSecretStoreResponse{}, &vel.Error{
+			Message: "failed to save secret store",
+			Err:     err,
+		}
+	}
+
+	return GetSecretStoreResponse{Store: store}, nil
+}
+
+// GetSecretStore gives the store the workspace keeps its repo secret values in, Kubernetes unless another one is set
+func (h *Handler) GetSecretStore(ctx context.Context, _ struct{}) (GetSecretStoreResponse, *vel.Error) {
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return GetSecretStoreResponse{}, rpcErr
+	}
+
+	store, err := h.db.GetWorkspaceSecretStore(ctx, profile.UserInfo.CurrentWorkspace)
+	if err != nil {
+		if errors.Is(err, ErrSecretStoreNotFound) {
+			return GetSecretStoreResponse{Store: WorkspaceSecretStore{Kind: SecretStoreKubernetes}}, nil
+		}
+		return GetSecretStoreResponse{}, &vel.Error{
+			Message: "failed to get secret store",
+			Err:     err,
+		}
+	}
+
+	return GetSecretStoreResponse{Store: store}, nil
+}
+
+// secretStore gives the store keeping the repo secret values of the workspace
+func (h *Handler) secretStore(ctx context.Context, workspaceID string) (SecretStore, *vel.Error) {
+	store, err := h.db.GetWorkspaceSecretStore(ctx, workspaceID)
+	if err != nil {
+		if errors.Is(err, ErrSecretStoreNotFound) {
+			return h.kube, nil
+		}
+		return nil, &vel.Error{
+			Message: "failed to get secret store",
+			Err:     err,
+		}
+	}
+	if store.Kind != SecretStoreVault {
+		return h.kube, nil
+	}
+
+	token, err := h.cipher.Decrypt(store.VaultToken)
+	if err != nil {
+		return nil, &vel.Error{
+			Message: "failed to decrypt vault token",
+			Err:     err,
+		}
+	}
+
+	return h.vaultStore(VaultConfig{
+		Address:    store.VaultAddress,
+		Mount:      store.VaultMount,
+		PathPrefix: store.VaultPathPrefix,
+		Role:       store.VaultRole,
+		Token:      string(token),
+	}), nil
+}
+
+// removeStoredSecrets removes the values of the repo environment secrets and its group values once the environment is removed,
+// the Kubernetes secrets are removed with the namespace, but an external store keeps them otherwise
+func (h *Handler) removeStoredSecrets(ctx context.Context, store SecretStore, kubeConfig string, workspace Workspace, repoID, environment string) *vel.Error {
+	keys, err := h.db.GetRepositorySecretKeys(ctx, repoID, environment, workspace.ID)
+	if err != nil {
+		return &vel.Error{
+			Message: "failed to get repo secret keys",
+			Err:     err,
+		}
+	}
+
+	id := appID(repoID, environment)
+	for _, key := range keys {
+		if err := store.RemoveSecret(ctx, kubeConfig, workspace.Namespace, id, key); err != nil {
+			return &vel.Error{
+				Message: "failed to remove secret " + key,
+				Err:     err,
+			}
+		}
+	}
+	if err := store.StoreGroupSecrets(ctx, kubeConfig, workspace.Namespace, id, nil); err != nil {
+		return &vel.Error{
+			Message: "failed to remove group secrets",
+			Err:     err,
+		}
+	}
+
+	return nil
+}
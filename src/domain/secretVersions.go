@@ -0,0 +1,182 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dennypenta/vel"
+)
+
+var ErrSecretVersionNotFound = errors.New("secret version not found")
+
+// SecretVersion is a value a secret had at some point,
+// the value is encrypted with its own data key and never leaves the api
+type SecretVersion struct {
+	ID          string `json:"id"`
+	RepoID      string `json:"repoID"`
+	Environment string `json:"environment"`
+	Key         string `json:"key"`
+	Version     int    `json:"version"`
+	Value       []byte `json:"-"`
+	// FromVersion is the version a rollback has restored, 0 for a value set by a user
+	FromVersion int       `json:"fromVersion,omitempty"`
+	AuthorID    string    `json:"authorID"`
+	AuthorName  string    `json:"authorName"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// saveSecretVersion encrypts the value and stores it as the next version of the secret
+func (h *Handler) saveSecretVersion(ctx context.Context, workspaceID string, author UserInfo, version SecretVersion, value string) (SecretVersion, *vel.Error) {
+	encrypted, err := h.secretCipher.Encrypt([]byte(value))
+	if err != nil {
+		return SecretVersion{}, &vel.Error{
+			Message: "failed to encrypt secret version",
+			Err:     err,
+		}
+	}
+	version.Value = encrypted
+	version.AuthorID = author.ID
+	version.AuthorName = author.DisplayName
+
+	version, err = h.db.SaveSecretVersion(ctx, workspaceID, version, h.secretVersionsKept)
+	if err != nil {
+		return SecretVersion{}, &vel.Error{
+			Message: "failed to save secret version",
+			Err:     err,
+		}
+	}
+
+	return version, nil
+}
+
+type GetSecretVersionsRequest struct {
+	RepoID      string `json:"repoID"`
+	Environment string `json:"environment"`
+	Key         string `json:"key"`
+}
+
+type GetSecretVersionsResponse struct {
+	Versions []SecretVersion `json:"versions"`
+}
+
+// GetSecretVersions lists the kept versions of a secret without their values, the latest first
+func (h *Handler) GetSecretVersions(ctx context.Context, req GetSecretVersionsRequest) (GetSecretVersionsResponse, *vel.Error) {
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return GetSecretVersionsResponse{}, rpcErr
+	}
+
+	versions, err := h.db.GetSecretVersions(ctx, profile.UserInfo.CurrentWorkspace, req.RepoID, req.Environment, req.Key)
+	if err != nil {
+		return GetSecretVersionsResponse{}, &vel.Error{
+			Message: "failed to get secret versions",
+			Err:     err,
+		}
+	}
+
+	return GetSecretVersionsResponse{Versions: versions}, nil
+}
+
+type RollbackSecretRequest struct {
+	RepoID      string `json:"repoID"`
+	Environment string `json:"environment"`
+	Key         string `json:"key"`
+	Version     int    `json:"version"`
+}
+
+type RollbackSecretResponse struct {
+	// Version is a new version holding the restored value
+	Version SecretVersion `json:"version"`
+	// Deployment restarts the app with the restored value, see SecretChangeResponse
+	Deployment AppDeployment `json:"deployment,omitzero"`
+}
+
+// RollbackSecret restores the value of a kept secret version, the restored value becomes the latest version,
+// a removed secret is restored as well
+func (h *Handler) RollbackSecret(ctx context.Context, req RollbackSecretRequest) (RollbackSecretResponse, *vel.Error) {
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return RollbackSecretResponse{}, rpcErr
+	}
+
+	workspace, err := h.db.GetWorkspaceByID(ctx, profile.UserInfo.CurrentWorkspace)
+	if err != nil {
+		if errors.Is(err, ErrWorkspaceNotFound) {
+			return RollbackSecretResponse{}, &vel.Error{
+				Code: "WORKSPACE_NOT_FOUND",
+			}
+		}
+
+		return RollbackSecretResponse{}, &vel.Error{
+			Message: "failed to get workspace info",
+			Err:     err,
+		}
+	}
+
+	version, err := h.db.GetSecretVersion(ctx, workspace.ID, req.RepoID, req.Environment, req.Key, req.Version)
+	if err != nil {
+		if errors.Is(err, ErrSecretVersionNotFound) {
+			return RollbackSecretResponse{}, &vel.Error{
+				Code: "SECRET_VERSION_NOT_FOUND",
+			}
+		}
+		return RollbackSecretResponse{}, &vel.Error{
+			Message: "failed to get secret version",
+			Err:     err,
+		}
+	}
+	value, err := h.secretCipher.Decrypt(version.Value)
+	if err != nil {
+		return RollbackSecretResponse{}, &vel.Error{
+			Message: "failed to decrypt secret version",
+			Err:     err,
+		}
+	}
+
+	kubeConfig, rpcErr := h.repoKubeConfig(ctx, workspace.ID, req.RepoID)
+	if rpcErr != nil {
+		return RollbackSecretResponse{}, rpcErr
+	}
+
+	env, rpcErr := h.repoEnvironment(ctx, workspace.ID, req.RepoID, req.Environment)
+	if rpcErr != nil {
+		return RollbackSecretResponse{}, rpcErr
+	}
+
+	store, rpcErr := h.secretStore(ctx, workspace.ID)
+	if rpcErr != nil {
+		return RollbackSecretResponse{}, rpcErr
+	}
+
+	if err := store.StoreSecret(ctx, kubeConfig, workspace.Namespace, appID(req.RepoID, env.Name), req.Key, string(value)); err != nil {
+		return RollbackSecretResponse{}, &vel.Error{
+			Message: "failed to store secret",
+			Err:     err,
+		}
+	}
+
+	if err := h.db.SaveSecret(ctx, req.RepoID, env.Name, req.Key, workspace.ID); err != nil {
+		return RollbackSecretResponse{}, &vel.Error{
+			Message: "failed to save secret",
+			Err:     err,
+		}
+	}
+
+	restored, rpcErr := h.saveSecretVersion(ctx, workspace.ID, profile.UserInfo, SecretVersion{
+		RepoID:      req.RepoID,
+		Environment: env.Name,
+		Key:         req.Key,
+		FromVersion: version.Version,
+	}, string(value))
+	if rpcErr != nil {
+		return RollbackSecretResponse{}, rpcErr
+	}
+
+	deployment, rpcErr := h.restartOnSecretChange(ctx, workspace, profile.UserInfo, req.RepoID, env)
+	if rpcErr != nil {
+		return RollbackSecretResponse{}, rpcErr
+	}
+
+	return RollbackSecretResponse{Version: restored, Deployment: deployment}, nil
+}
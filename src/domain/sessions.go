@@ -0,0 +1,340 @@
+package domain
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dennypenta/vel"
+	"github.com/rs/xid"
+	"github.com/treenq/treenq/pkg/auth"
+)
+
+var (
+	ErrSessionNotFound    = errors.New("session not found")
+	ErrRefreshTokenReused = errors.New("refresh token is reused")
+)
+
+// Session is a login of a user, the access tokens are short-lived and issued for a session,
+// a rotating refresh token prolongs the session, a revoked session rejects its access tokens right away
+type Session struct {
+	ID          string    `json:"id"`
+	UserAgent   string    `json:"userAgent"`
+	IP          string    `json:"ip"`
+	CreatedAt   time.Time `json:"createdAt"`
+	RefreshedAt time.Time `json:"refreshedAt,omitzero"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+	// Current is true for the session of the request
+	Current bool `json:"current"`
+
+	UserID string `json:"-"`
+	// CurrentWorkspace is kept to issue the refreshed access tokens for the same workspace
+	CurrentWorkspace string `json:"-"`
+	// RefreshTokenHash is a sha256 of the refresh token, the token itself is never stored
+	RefreshTokenHash string `json:"-"`
+	// User is filled only on the session refresh
+	User UserInfo `json:"-"`
+}
+
+// startSession creates a session for the logged in user and writes its access and refresh tokens to the cookies
+func (h *Handler) startSession(ctx context.Context, user UserInfo) *vel.Error {
+	r := vel.RequestFromContext(ctx)
+	w := vel.WriterFromContext(ctx)
+
+	refreshToken, err := generateRefreshToken()
+	if err != nil {
+		return &vel.Error{
+			Message: "failed to generate refresh token",
+			Err:     err,
+		}
+	}
+
+	session, err := h.db.SaveSession(ctx, Session{
+		ID:               xid.New().String(),
+		UserAgent:        truncate(r.UserAgent(), 255),
+		IP:               h.clientIP(r),
+		ExpiresAt:        time.Now().Add(h.refreshTtl),
+		UserID:           user.ID,
+		RefreshTokenHash: hashApiToken(refreshToken),
+	})
+	if err != nil {
+		return &vel.Error{
+			Message: "failed to save session",
+			Err:     err,
+		}
+	}
+
+	token, err := h.issueAccessToken(user, user.Workspaces, session.ID, "")
+	if err != nil {
+		return &vel.Error{
+			Message: "failed to generate jwt token",
+			Err:     err,
+		}
+	}
+	h.writeToken(w, token)
+	h.writeRefreshToken(w, refreshToken)
+
+	return nil
+}
+
+// issueAccessToken issues a jwt for the session,
+// the given current workspace is used by default when the request has no workspace header
+func (h *Handler) issueAccessToken(user UserInfo, workspaces []string, sessionID, currentWorkspace string) (string, error) {
+	claims := map[string]any{
+		"id":              user.ID,
+		"email":           user.Email,
+		"displayName":     user.DisplayName,
+		"workspaces":      workspaces,
+		auth.SessionClaim: sessionID,
+	}
+	if currentWorkspace != "" {
+		claims["currentWorkspace"] = currentWorkspace
+	}
+	return h.jwtIssuer.GenerateJwtToken(claims)
+}
+
+func (h *Handler) writeRefreshToken(w http.ResponseWriter, token string) {
+	expiration := time.Now().Add(h.refreshTtl)
+
+	cookie := http.Cookie{Name: auth.RefreshKey, Value: token, Expires: expiration, MaxAge: int(h.refreshTtl.Seconds()), HttpOnly: true, SameSite: http.SameSiteLaxMode, Secure: h.isProd}
+	http.SetCookie(w, &cookie)
+}
+
+func (h *Handler) clearTokens(w http.ResponseWriter) {
+	for _, name := range []string{auth.AuthKey, auth.RefreshKey} {
+		cookie := http.Cookie{Name: name, Value: "", MaxAge: -1, HttpOnly: true, SameSite: http.SameSiteLaxMode}
+		http.SetCookie(w, &cookie)
+	}
+}
+
+type RefreshTokenRequest struct {
+	// RefreshToken is taken from the cookies if it's empty
+	RefreshToken string `json:"refreshToken"`
+}
+
+type RefreshTokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+// RefreshToken issues a new access token and rotates the refresh token of the session,
+// a reuse of a rotated refresh token means it's stolen, so the session is revoked
+func (h *Handler) RefreshToken(ctx context.Context, req RefreshTokenRequest) (RefreshTokenResponse, *vel.Error) {
+	if req.RefreshToken == "" {
+		if cookie, err := vel.RequestFromContext(ctx).Cookie(auth.RefreshKey); err == nil {
+			req.RefreshToken = cookie.Value
+		}
+	}
+	if req.RefreshToken == "" {
+		return RefreshTokenResponse{}, &vel.Error{
+			Code: "REFRESH_TOKEN_REQUIRED",
+		}
+	}
+
+	refreshToken, err := generateRefreshToken()
+	if err != nil {
+		return RefreshTokenResponse{}, &vel.Error{
+			Message: "failed to generate refresh token",
+			Err:     err,
+		}
+	}
+
+	session, err := h.db.RotateSession(ctx, hashApiToken(req.RefreshToken), hashApiToken(refreshToken), time.Now().Add(h.refreshTtl))
+	if err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			return RefreshTokenResponse{}, &vel.Error{
+				Code: "INVALID_REFRESH_TOKEN",
+			}
+		}
+		if errors.Is(err, ErrRefreshTokenReused) {
+			return RefreshTokenResponse{}, &vel.Error{
+				Code: "REFRESH_TOKEN_REUSED",
+			}
+		}
+		return RefreshTokenResponse{}, &vel.Error{
+			Message: "failed to rotate session",
+			Err:     err,
+		}
+	}
+	setAuditActor(ctx, session.User)
+
+	workspaces, err := h.db.GetUserWorkspaces(ctx, session.UserID)
+	if err != nil {
+		return RefreshTokenResponse{}, &vel.Error{
+			Message: "failed to get user workspaces",
+			Err:     err,
+		}
+	}
+	workspaceIDs := make([]string, len(workspaces))
+	for i := range workspaces {
+		workspaceIDs[i] = workspaces[i].ID
+	}
+	currentWorkspace := session.CurrentWorkspace
+	if !slices.Contains(workspaceIDs, currentWorkspace) {
+		currentWorkspace = ""
+	}
+
+	token, err := h.issueAccessToken(session.User, workspaceIDs, session.ID, currentWorkspace)
+	if err != nil {
+		return RefreshTokenResponse{}, &vel.Error{
+			Message: "failed to generate jwt token",
+			Err:     err,
+		}
+	}
+	w := vel.WriterFromContext(ctx)
+	h.writeToken(w, token)
+	h.writeRefreshToken(w, refreshToken)
+
+	return RefreshTokenResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+type GetSessionsResponse struct {
+	Sessions []Session `json:"sessions"`
+}
+
+// GetSessions gives the active sessions of the user
+func (h *Handler) GetSessions(ctx context.Context, _ struct{}) (GetSessionsResponse, *vel.Error) {
+	claims := auth.ClaimsFromCtx(ctx)
+	user := userFromClaims(claims)
+	currentSession, _ := claims[auth.SessionClaim].(string)
+
+	sessions, err := h.db.GetSessions(ctx, user.ID)
+	if err != nil {
+		return GetSessionsResponse{}, &vel.Error{
+			Message: "failed to get sessions",
+			Err:     err,
+		}
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentSession
+	}
+
+	return GetSessionsResponse{Sessions: sessions}, nil
+}
+
+type RevokeSessionRequest struct {
+	SessionID string `json:"sessionID"`
+}
+
+// RevokeSession revokes a session of the user, its access tokens are rejected right away
+func (h *Handler) RevokeSession(ctx context.Context, req RevokeSessionRequest) (struct{}, *vel.Error) {
+	claims := auth.ClaimsFromCtx(ctx)
+	user := userFromClaims(claims)
+
+	if err := h.db.RevokeSession(ctx, user.ID, req.SessionID); err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			return struct{}{}, &vel.Error{
+				Code: "SESSION_NOT_FOUND",
+			}
+		}
+		return struct{}{}, &vel.Error{
+			Message: "failed to revoke session",
+			Err:     err,
+		}
+	}
+	if currentSession, _ := claims[auth.SessionClaim].(string); currentSession == req.SessionID {
+		h.clearTokens(vel.WriterFromContext(ctx))
+	}
+
+	return struct{}{}, nil
+}
+
+// RevokeAllSessions revokes every session of the user including the current one
+func (h *Handler) RevokeAllSessions(ctx context.Context, _ struct{}) (struct{}, *vel.Error) {
+	user := userFromClaims(auth.ClaimsFromCtx(ctx))
+
+	if err := h.db.RevokeSessions(ctx, user.ID); err != nil {
+		return struct{}{}, &vel.Error{
+			Message: "failed to revoke sessions",
+			Err:     err,
+		}
+	}
+	h.clearTokens(vel.WriterFromContext(ctx))
+
+	return struct{}{}, nil
+}
+
+// VerifySession implements auth.SessionVerifier
+func (h *Handler) VerifySession(ctx context.Context, sessionID string) error {
+	if sessionID == "" {
+		return auth.ErrSessionRevoked
+	}
+
+	active, err := h.db.SessionIsActive(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if !active {
+		return auth.ErrSessionRevoked
+	}
+
+	return nil
+}
+
+func generateRefreshToken() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// clientIP gives the client address of a request,
+// X-Forwarded-For is read only if the request comes from a trusted proxy,
+// then the client is the last address added before the trusted proxies
+func (h *Handler) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	remote, err := netip.ParseAddr(host)
+	if err != nil || !h.trustedProxy(remote) {
+		return truncate(host, 45)
+	}
+
+	var hops []string
+	for _, forwarded := range r.Header.Values("X-Forwarded-For") {
+		for hop := range strings.SplitSeq(forwarded, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(hops[i])
+		if err != nil {
+			break
+		}
+		if !h.trustedProxy(addr) {
+			return addr.String()
+		}
+		host = addr.String()
+	}
+	return truncate(host, 45)
+}
+
+// trustedProxy reports whether the address belongs to a trusted proxy
+func (h *Handler) trustedProxy(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range h.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
@@ -10,8 +10,10 @@ import (
 
 type SetSecretRequest struct {
 	RepoID string `json:"repoID"`
-	Key    string `json:"key"`
-	Value  string `json:"value"`
+	// Environment is empty for the default repo environment
+	Environment string `json:"environment"`
+	Key         string `json:"key"`
+	Value       string `json:"value"`
 }
 
 var secretKeyRegex = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_.-]*$`)
@@ -23,46 +25,76 @@ func validateSecretKey(key string) bool {
 	return secretKeyRegex.MatchString(key)
 }
 
-func (h *Handler) SetSecret(ctx context.Context, req SetSecretRequest) (struct{}, *vel.Error) {
+// SetSecret stores a secret value of a repo environment,
+// the deployed app is restarted with it unless the repo has the restart on a secret change disabled
+func (h *Handler) SetSecret(ctx context.Context, req SetSecretRequest) (SecretChangeResponse, *vel.Error) {
 	if !validateSecretKey(req.Key) {
-		return struct{}{}, &vel.Error{
+		return SecretChangeResponse{}, &vel.Error{
 			Code: "INVALID_SECRET_KEY",
 		}
 	}
 
 	profile, rpcErr := h.GetProfile(ctx, struct{}{})
 	if rpcErr != nil {
-		return struct{}{}, rpcErr
+		return SecretChangeResponse{}, rpcErr
 	}
 
 	workspace, err := h.db.GetWorkspaceByID(ctx, profile.UserInfo.CurrentWorkspace)
 	if err != nil {
 		if errors.Is(err, ErrWorkspaceNotFound) {
-			return struct{}{}, &vel.Error{
+			return SecretChangeResponse{}, &vel.Error{
 				Code: "WORKSPACE_NOT_FOUND",
 			}
 		}
 
-		return struct{}{}, &vel.Error{
+		return SecretChangeResponse{}, &vel.Error{
 			Message: "failed to get workspace info",
 			Err:     err,
 		}
 	}
 
-	err = h.kube.StoreSecret(ctx, h.kubeConfig, workspace.Name, req.RepoID, req.Key, req.Value)
+	kubeConfig, rpcErr := h.repoKubeConfig(ctx, workspace.ID, req.RepoID)
+	if rpcErr != nil {
+		return SecretChangeResponse{}, rpcErr
+	}
+
+	env, rpcErr := h.repoEnvironment(ctx, workspace.ID, req.RepoID, req.Environment)
+	if rpcErr != nil {
+		return SecretChangeResponse{}, rpcErr
+	}
+
+	store, rpcErr := h.secretStore(ctx, workspace.ID)
+	if rpcErr != nil {
+		return SecretChangeResponse{}, rpcErr
+	}
+
+	err = store.StoreSecret(ctx, kubeConfig, workspace.Namespace, appID(req.RepoID, env.Name), req.Key, req.Value)
 	if err != nil {
-		return struct{}{}, &vel.Error{
+		return SecretChangeResponse{}, &vel.Error{
 			Message: "failed to store secret",
 			Err:     err,
 		}
 	}
 
-	if err := h.db.SaveSecret(ctx, req.RepoID, req.Key, profile.UserInfo.CurrentWorkspace); err != nil {
-		return struct{}{}, &vel.Error{
+	if err := h.db.SaveSecret(ctx, req.RepoID, env.Name, req.Key, profile.UserInfo.CurrentWorkspace); err != nil {
+		return SecretChangeResponse{}, &vel.Error{
 			Message: "failed to save secret",
 			Err:     err,
 		}
 	}
 
-	return struct{}{}, nil
+	if _, rpcErr := h.saveSecretVersion(ctx, workspace.ID, profile.UserInfo, SecretVersion{
+		RepoID:      req.RepoID,
+		Environment: env.Name,
+		Key:         req.Key,
+	}, req.Value); rpcErr != nil {
+		return SecretChangeResponse{}, rpcErr
+	}
+
+	deployment, rpcErr := h.restartOnSecretChange(ctx, workspace, profile.UserInfo, req.RepoID, env)
+	if rpcErr != nil {
+		return SecretChangeResponse{}, rpcErr
+	}
+
+	return SecretChangeResponse{Deployment: deployment}, nil
 }
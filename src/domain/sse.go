@@ -0,0 +1,43 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dennypenta/vel"
+)
+
+// sseHeartbeatInterval is how often an idle stream gets a comment, so the proxies don't close it
+const sseHeartbeatInterval = 15 * time.Second
+
+// lastEventID gives an id of the last event a reconnected client has received, 0 for a new stream
+func lastEventID(ctx context.Context) int64 {
+	id, err := strconv.ParseInt(vel.RequestFromContext(ctx).Header.Get("Last-Event-ID"), 10, 64)
+	if err != nil || id < 0 {
+		return 0
+	}
+	return id
+}
+
+// writeEvent writes a server sent event, an empty id is omitted and keeps the last event id of the client
+func writeEvent(w http.ResponseWriter, flusher http.Flusher, id string, data any) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		fmt.Fprintf(w, "id: %s\n", id)
+	}
+	fmt.Fprintf(w, "data: %s\n\n", b)
+	flusher.Flush()
+	return nil
+}
+
+func writeHeartbeat(w http.ResponseWriter, flusher http.Flusher) {
+	fmt.Fprint(w, ": heartbeat\n\n")
+	flusher.Flush()
+}
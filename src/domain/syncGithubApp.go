@@ -13,8 +13,23 @@ func (h *Handler) SyncGithubApp(ctx context.Context, _ struct{}) (GetReposRespon
 		return GetReposResponse{}, rpcErr
 	}
 
+	// the token is cached by the github user id, the display name isn't necessarily a github login
+	identity, err := h.db.GetUserIdentity(ctx, profile.UserInfo.ID, GithubProvider)
+	if err != nil {
+		if errors.Is(err, ErrIdentityNotFound) {
+			return GetReposResponse{}, &vel.Error{
+				Code:    "NO_GITHUB_ACCOUNT",
+				Message: "the user has logged in without GitHub, the installed repos are synced by the webhooks only",
+			}
+		}
+		return GetReposResponse{}, &vel.Error{
+			Message: "failed to get user github identity",
+			Err:     err,
+		}
+	}
+
 	// Get the user's GitHub access token from OAuth provider cache
-	githubToken, err := h.oauthProvider.GetUserGithubToken(profile.UserInfo.DisplayName)
+	githubToken, err := h.oauthProvider.GetUserGithubToken(identity.Subject)
 	if err != nil {
 		if errors.Is(err, ErrUnauthorized) {
 			return GetReposResponse{}, &vel.Error{
@@ -22,6 +37,12 @@ func (h *Handler) SyncGithubApp(ctx context.Context, _ struct{}) (GetReposRespon
 				Message: "GitHub token expired or invalid, please re-authenticate with GitHub",
 			}
 		}
+		if errors.Is(err, ErrNoGithubAccount) {
+			return GetReposResponse{}, &vel.Error{
+				Code:    "NO_GITHUB_ACCOUNT",
+				Message: "the user has logged in without GitHub, the installed repos are synced by the webhooks only",
+			}
+		}
 		return GetReposResponse{}, &vel.Error{
 			Message: "failed to get user GitHub token",
 			Err:     err,
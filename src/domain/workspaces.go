@@ -0,0 +1,224 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"regexp"
+
+	"github.com/dennypenta/vel"
+	"github.com/treenq/treenq/pkg/auth"
+)
+
+var ErrWorkspaceNotEmpty = errors.New("workspace has github installations")
+
+// workspaceNameRegex allows a name to be a prefix of the kube namespaces of the workspace apps
+var workspaceNameRegex = regexp.MustCompile(`^[a-z]([a-z0-9-]{0,18}[a-z0-9])?$`)
+
+// personalWorkspaceName is reserved by the personal workspaces
+const personalWorkspaceName = "default"
+
+func validWorkspaceName(name string) *vel.Error {
+	if !workspaceNameRegex.MatchString(name) || name == personalWorkspaceName {
+		return &vel.Error{
+			Code:    "INVALID_WORKSPACE_NAME",
+			Message: "name must be up to 20 lowercase letters, digits or dashes and differ from " + personalWorkspaceName,
+		}
+	}
+	return nil
+}
+
+type WorkspaceRequest struct {
+	Name string `json:"name"`
+}
+
+type WorkspaceResponse struct {
+	Workspace Workspace `json:"workspace"`
+	// Token is a new auth token with the actual workspaces of the user and the current one of the response
+	Token string `json:"token"`
+}
+
+// CreateWorkspace creates a workspace owned by the user and makes it current
+func (h *Handler) CreateWorkspace(ctx context.Context, req WorkspaceRequest) (WorkspaceResponse, *vel.Error) {
+	if rpcErr := validWorkspaceName(req.Name); rpcErr != nil {
+		return WorkspaceResponse{}, rpcErr
+	}
+
+	user := userFromClaims(auth.ClaimsFromCtx(ctx))
+	workspace, err := h.db.CreateWorkspace(ctx, user.ID, req.Name)
+	if err != nil {
+		return WorkspaceResponse{}, &vel.Error{
+			Message: "failed to create workspace",
+			Err:     err,
+		}
+	}
+
+	token, rpcErr := h.reissueToken(ctx, user, workspace.ID)
+	if rpcErr != nil {
+		return WorkspaceResponse{}, rpcErr
+	}
+
+	return WorkspaceResponse{
+		Workspace: workspace,
+		Token:     token,
+	}, nil
+}
+
+type GetWorkspacesResponse struct {
+	Workspaces []Workspace `json:"workspaces"`
+}
+
+// GetWorkspaces gives the workspaces the user is a member of, the personal one goes first,
+// the memberships come from the database, so the workspaces joined after the token was issued are listed too
+func (h *Handler) GetWorkspaces(ctx context.Context, _ struct{}) (GetWorkspacesResponse, *vel.Error) {
+	user := userFromClaims(auth.ClaimsFromCtx(ctx))
+	workspaces, err := h.db.GetUserWorkspaces(ctx, user.ID)
+	if err != nil {
+		return GetWorkspacesResponse{}, &vel.Error{
+			Message: "failed to get user workspaces",
+			Err:     err,
+		}
+	}
+
+	return GetWorkspacesResponse{Workspaces: workspaces}, nil
+}
+
+type SwitchWorkspaceRequest struct {
+	WorkspaceID string `json:"workspaceID"`
+}
+
+// SwitchWorkspace reissues the auth token with the actual workspaces of the user making the given one current,
+// a membership gained after the token was issued is picked up without logging in again
+func (h *Handler) SwitchWorkspace(ctx context.Context, req SwitchWorkspaceRequest) (WorkspaceResponse, *vel.Error) {
+	user := userFromClaims(auth.ClaimsFromCtx(ctx))
+
+	role, err := h.db.GetWorkspaceRole(ctx, req.WorkspaceID, user.ID)
+	if err != nil {
+		if errors.Is(err, ErrWorkspaceNotFound) {
+			return WorkspaceResponse{}, &vel.Error{
+				Code: "WORKSPACE_NOT_FOUND",
+			}
+		}
+		return WorkspaceResponse{}, &vel.Error{
+			Message: "failed to get workspace role",
+			Err:     err,
+		}
+	}
+
+	workspace, err := h.db.GetWorkspaceByID(ctx, req.WorkspaceID)
+	if err != nil {
+		return WorkspaceResponse{}, &vel.Error{
+			Message: "failed to get workspace info",
+			Err:     err,
+		}
+	}
+	workspace.Role = role
+
+	token, rpcErr := h.reissueToken(ctx, user, workspace.ID)
+	if rpcErr != nil {
+		return WorkspaceResponse{}, rpcErr
+	}
+
+	return WorkspaceResponse{
+		Workspace: workspace,
+		Token:     token,
+	}, nil
+}
+
+// RenameWorkspace renames the current workspace, the apps keep running in their namespaces
+func (h *Handler) RenameWorkspace(ctx context.Context, req WorkspaceRequest) (struct{}, *vel.Error) {
+	if rpcErr := validWorkspaceName(req.Name); rpcErr != nil {
+		return struct{}{}, rpcErr
+	}
+
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return struct{}{}, rpcErr
+	}
+
+	workspace, rpcErr := h.nonPersonalWorkspace(ctx, profile.UserInfo.CurrentWorkspace)
+	if rpcErr != nil {
+		return struct{}{}, rpcErr
+	}
+
+	if err := h.db.RenameWorkspace(ctx, workspace.ID, req.Name); err != nil {
+		return struct{}{}, &vel.Error{
+			Message: "failed to rename workspace",
+			Err:     err,
+		}
+	}
+
+	return struct{}{}, nil
+}
+
+// RemoveWorkspace removes the current workspace with its members, invitations, clusters and registry credentials,
+// the github installations must be removed first
+func (h *Handler) RemoveWorkspace(ctx context.Context, _ struct{}) (WorkspaceResponse, *vel.Error) {
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return WorkspaceResponse{}, rpcErr
+	}
+
+	workspace, rpcErr := h.nonPersonalWorkspace(ctx, profile.UserInfo.CurrentWorkspace)
+	if rpcErr != nil {
+		return WorkspaceResponse{}, rpcErr
+	}
+
+	if err := h.db.RemoveWorkspace(ctx, workspace.ID); err != nil {
+		if errors.Is(err, ErrWorkspaceNotEmpty) {
+			return WorkspaceResponse{}, &vel.Error{
+				Code: "WORKSPACE_NOT_EMPTY",
+			}
+		}
+		return WorkspaceResponse{}, &vel.Error{
+			Message: "failed to remove workspace",
+			Err:     err,
+		}
+	}
+
+	// registry credentials are kept in the workspace namespace of the default cluster
+	if err := h.kube.RemoveNamespace(ctx, h.kubeConfig, workspace.ID, workspace.Namespace); err != nil {
+		return WorkspaceResponse{}, &vel.Error{
+			Message: "failed to remove workspace namespace",
+			Err:     err,
+		}
+	}
+
+	personal, err := h.db.GetDefaultWorkspace(ctx, profile.UserInfo.ID)
+	if err != nil {
+		return WorkspaceResponse{}, &vel.Error{
+			Message: "failed to get personal workspace",
+			Err:     err,
+		}
+	}
+	token, rpcErr := h.reissueToken(ctx, profile.UserInfo, personal.ID)
+	if rpcErr != nil {
+		return WorkspaceResponse{}, rpcErr
+	}
+
+	return WorkspaceResponse{
+		Workspace: personal,
+		Token:     token,
+	}, nil
+}
+
+func (h *Handler) nonPersonalWorkspace(ctx context.Context, workspaceID string) (Workspace, *vel.Error) {
+	workspace, err := h.db.GetWorkspaceByID(ctx, workspaceID)
+	if err != nil {
+		if errors.Is(err, ErrWorkspaceNotFound) {
+			return Workspace{}, &vel.Error{
+				Code: "WORKSPACE_NOT_FOUND",
+			}
+		}
+		return Workspace{}, &vel.Error{
+			Message: "failed to get workspace info",
+			Err:     err,
+		}
+	}
+	if workspace.Personal {
+		return Workspace{}, &vel.Error{
+			Code: "PERSONAL_WORKSPACE",
+		}
+	}
+
+	return workspace, nil
+}
@@ -4,15 +4,17 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
 	"fmt"
 	"io"
-	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"slices"
+	"sync"
 
+	"github.com/distribution/reference"
 	"github.com/pkg/errors"
 	"github.com/tonistiigi/fsutil"
 
@@ -20,6 +22,7 @@ import (
 	"github.com/docker/cli/cli/config/types"
 
 	"github.com/moby/buildkit/client"
+	"github.com/moby/buildkit/exporter/containerimage/exptypes"
 
 	gateway "github.com/moby/buildkit/frontend/gateway/client"
 	"github.com/moby/buildkit/session"
@@ -27,6 +30,10 @@ import (
 	"github.com/moby/buildkit/util/progress/progressui"
 	"github.com/moby/buildkit/util/progress/progresswriter"
 
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content"
+	"oras.land/oras-go/v2/errdef"
 	"oras.land/oras-go/v2/registry/remote"
 	"oras.land/oras-go/v2/registry/remote/auth"
 	"oras.land/oras-go/v2/registry/remote/errcode"
@@ -34,7 +41,20 @@ import (
 	"github.com/treenq/treenq/src/domain"
 )
 
-var ErrUnknownDockerAuthType = errors.New("unknown docker auth type")
+var (
+	ErrUnknownDockerAuthType = errors.New("unknown docker auth type")
+	ErrInvalidImageReference = errors.New("invalid image reference")
+)
+
+// dockerHubRegistry is a registry name the docker hub images are normalized to,
+// the api is served on a different host
+const (
+	dockerHubRegistry    = "docker.io"
+	dockerHubRegistryAPI = "registry-1.docker.io"
+)
+
+// dockerManifestListMediaType is a multi-platform image of the docker format, an equivalent of the oci image index
+const dockerManifestListMediaType = "application/vnd.docker.distribution.manifest.list.v2+json"
 
 type DockerArtifact struct {
 	buildkitHost  string
@@ -45,6 +65,9 @@ type DockerArtifact struct {
 	registryCert      string
 	registryUsername  string
 	registryPassword  string
+
+	// runtimes keeps the runtimes of the read images by their manifest digests
+	runtimes sync.Map
 }
 
 func NewDockerArtifactory(
@@ -100,9 +123,8 @@ func (fakeFile) Close() error { return nil }
 func (fakeFile) Fd() uintptr  { return 0 }
 func (fakeFile) Name() string { return "" }
 
-func (a *DockerArtifact) Build(ctx context.Context, args domain.BuildArtifactRequest, progress *domain.ProgressBuf) (domain.Image, error) {
+func (a *DockerArtifact) Build(ctx context.Context, args domain.BuildArtifactRequest, out io.Writer) (domain.Image, error) {
 	image := a.Image(args.Name, args.Tag)
-	out := progress.AsWriter(args.DeploymentID, slog.LevelInfo)
 
 	var clientOpts []client.ClientOpt
 	if a.buildkitTLSCA != "" {
@@ -178,7 +200,7 @@ func (a *DockerArtifact) Build(ctx context.Context, args domain.BuildArtifactReq
 		FrontendOpt: solveOpt.FrontendAttrs,
 	}
 
-	_, err = c.Build(ctx, solveOpt, "buildctl", func(ctx context.Context, c gateway.Client) (*gateway.Result, error) {
+	resp, err := c.Build(ctx, solveOpt, "buildctl", func(ctx context.Context, c gateway.Client) (*gateway.Result, error) {
 		res, err := c.Solve(ctx, sreq)
 		if err != nil {
 			return nil, err
@@ -194,16 +216,51 @@ func (a *DockerArtifact) Build(ctx context.Context, args domain.BuildArtifactReq
 		return image, fmt.Errorf("progress writer failed: %w", err)
 	}
 
+	// the digest of the pushed manifest pins the image, the tag may be repushed later
+	image.Digest = resp.ExporterResponse[exptypes.ExporterImageDigestKey]
+
 	return image, nil
 }
 
 func (a *DockerArtifact) Inspect(ctx context.Context, deployment domain.AppDeployment) (domain.Image, error) {
 	image := a.Image(deployment.Space.Service.Name, deployment.BuildTag)
 
+	repo, err := a.registryRepository(image)
+	if err != nil {
+		return image, err
+	}
+
+	// a known digest is looked up as is, so the image is exactly the one deployed before
+	version := image.Tag
+	if deployment.ImageDigest != "" {
+		version = deployment.ImageDigest
+	}
+
+	desc, err := repo.Resolve(ctx, version)
+	if err != nil {
+		if errors.Is(err, errdef.ErrNotFound) {
+			return image, domain.ErrImageNotFound
+		}
+		var orasErr *errcode.ErrorResponse
+		if errors.As(err, &orasErr) && orasErr.StatusCode == http.StatusNotFound {
+			return image, domain.ErrImageNotFound
+		}
+		if errors.As(err, &orasErr) && (orasErr.StatusCode == http.StatusUnauthorized || orasErr.StatusCode == http.StatusForbidden) {
+			return image, fmt.Errorf("%w: %s", domain.ErrRegistryUnauthorized, err)
+		}
+		return image, fmt.Errorf("failed to resolve image: %w", err)
+	}
+	image.Digest = desc.Digest.String()
+
+	return image, nil
+}
+
+// registryRepository gives a client of the image repository in the treenq registry
+func (a *DockerArtifact) registryRepository(image domain.Image) (*remote.Repository, error) {
 	ref := fmt.Sprintf("%s/%s", a.registry, image.Repository)
 	repo, err := remote.NewRepository(ref)
 	if err != nil {
-		return image, fmt.Errorf("failed to create repository: %w", err)
+		return nil, fmt.Errorf("failed to create repository: %w", err)
 	}
 
 	tlsConfig := &tls.Config{
@@ -212,12 +269,12 @@ func (a *DockerArtifact) Inspect(ctx context.Context, deployment domain.AppDeplo
 	if a.registryTLSVerify && a.registryCert != "" {
 		certPEM, err := os.ReadFile(a.registryCert)
 		if err != nil {
-			return image, fmt.Errorf("failed to read registry certificate: %w", err)
+			return nil, fmt.Errorf("failed to read registry certificate: %w", err)
 		}
 
 		caCertPool := x509.NewCertPool()
 		if !caCertPool.AppendCertsFromPEM(certPEM) {
-			return image, fmt.Errorf("failed to parse registry certificate")
+			return nil, fmt.Errorf("failed to parse registry certificate")
 		}
 		tlsConfig.RootCAs = caCertPool
 	}
@@ -238,24 +295,169 @@ func (a *DockerArtifact) Inspect(ctx context.Context, deployment domain.AppDeplo
 	}
 	repo.PlainHTTP = !a.registryTLSVerify
 
-	exists := false
-	err = repo.Tags(ctx, "", func(tags []string) error {
-		if slices.Contains(tags, image.Tag) {
-			exists = true
-		}
-		return nil
-	})
+	return repo, nil
+}
+
+// ParseImage parses an image reference given by a user, e.g. ghcr.io/org/app:1.0.0,
+// familiar docker hub names like nginx are normalized to docker.io/library/nginx:latest
+func (a *DockerArtifact) ParseImage(ref string) (domain.Image, error) {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return domain.Image{}, fmt.Errorf("%w: %s", ErrInvalidImageReference, err)
+	}
+
+	image := domain.Image{
+		Registry:   reference.Domain(named),
+		Repository: reference.Path(named),
+	}
+	if tagged, ok := named.(reference.Tagged); ok {
+		image.Tag = tagged.Tag()
+	}
+	if digested, ok := named.(reference.Digested); ok {
+		image.Digest = digested.Digest().String()
+	}
+	if image.Tag == "" && image.Digest == "" {
+		image.Tag = "latest"
+	}
+
+	return image, nil
+}
+
+// Resolve looks up the manifest digest of an image in an external registry,
+// if the image has a digest already it's verified to exist
+func (a *DockerArtifact) Resolve(ctx context.Context, image domain.Image, creds domain.RegistryCredentials) (domain.Image, error) {
+	repo, err := externalRepository(image, creds)
 	if err != nil {
+		return image, err
+	}
+
+	ref := image.Tag
+	if image.Digest != "" {
+		ref = image.Digest
+	}
+
+	desc, err := repo.Resolve(ctx, ref)
+	if err != nil {
+		if errors.Is(err, errdef.ErrNotFound) {
+			return image, domain.ErrImageNotFound
+		}
 		var orasErr *errcode.ErrorResponse
-		if errors.As(err, &orasErr) && (orasErr.StatusCode == 404 || orasErr.StatusCode == 401) {
+		if errors.As(err, &orasErr) && orasErr.StatusCode == http.StatusNotFound {
 			return image, domain.ErrImageNotFound
 		}
-		return image, fmt.Errorf("failed to list tags: %w", err)
+		if errors.As(err, &orasErr) && (orasErr.StatusCode == http.StatusUnauthorized || orasErr.StatusCode == http.StatusForbidden) {
+			return image, fmt.Errorf("%w: %s", domain.ErrRegistryUnauthorized, err)
+		}
+		return image, fmt.Errorf("failed to resolve image: %w", err)
 	}
 
-	if !exists {
-		return image, domain.ErrImageNotFound
+	image.Digest = desc.Digest.String()
+	return image, nil
+}
+
+// externalRepository gives a client of the image repository in an external registry, anonymous for empty credentials
+func externalRepository(image domain.Image, creds domain.RegistryCredentials) (*remote.Repository, error) {
+	registry := image.Registry
+	if registry == dockerHubRegistry {
+		registry = dockerHubRegistryAPI
 	}
 
-	return image, nil
+	repo, err := remote.NewRepository(registry + "/" + image.Repository)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create repository: %w", err)
+	}
+
+	authClient := &auth.Client{
+		Client: http.DefaultClient,
+		Cache:  auth.NewCache(),
+	}
+	if creds.Username != "" {
+		authClient.Credential = auth.StaticCredential(repo.Reference.Registry, auth.Credential{
+			Username: creds.Username,
+			Password: creds.Password,
+		})
+	}
+	repo.Client = authClient
+
+	return repo, nil
+}
+
+// Runtime gives the command an image runs by default, its entrypoint followed by its cmd, and tells if the image has /bin/sh.
+// An image of the treenq registry is read with the registry credentials, the pull credentials of its registry are used otherwise.
+// A multi-platform image gives the runtime of its linux/amd64 manifest, or the first one if there is none.
+// The layers are read to look the shell up, the result is kept by the manifest digest, so an image is read once.
+func (a *DockerArtifact) Runtime(ctx context.Context, image domain.Image, pullCredentials []domain.RegistryCredentials) (domain.ImageRuntime, error) {
+	var repo *remote.Repository
+	var err error
+	if image.Registry == a.registry {
+		repo, err = a.registryRepository(image)
+	} else {
+		var creds domain.RegistryCredentials
+		for _, c := range pullCredentials {
+			if c.Registry == image.Registry {
+				creds = c
+			}
+		}
+		repo, err = externalRepository(image, creds)
+	}
+	if err != nil {
+		return domain.ImageRuntime{}, err
+	}
+
+	ref := image.Tag
+	if image.Digest != "" {
+		ref = image.Digest
+	}
+	desc, manifestData, err := oras.FetchBytes(ctx, repo, ref, oras.DefaultFetchBytesOptions)
+	if err != nil {
+		return domain.ImageRuntime{}, fmt.Errorf("failed to fetch image manifest: %w", err)
+	}
+
+	if desc.MediaType == ocispec.MediaTypeImageIndex || desc.MediaType == dockerManifestListMediaType {
+		var index ocispec.Index
+		if err := json.Unmarshal(manifestData, &index); err != nil {
+			return domain.ImageRuntime{}, fmt.Errorf("failed to decode image index: %w", err)
+		}
+		if len(index.Manifests) == 0 {
+			return domain.ImageRuntime{}, fmt.Errorf("image index %s has no manifests", desc.Digest)
+		}
+		desc = index.Manifests[0]
+		for _, m := range index.Manifests {
+			if m.Platform != nil && m.Platform.OS == "linux" && m.Platform.Architecture == "amd64" {
+				desc = m
+				break
+			}
+		}
+		manifestData, err = content.FetchAll(ctx, repo, desc)
+		if err != nil {
+			return domain.ImageRuntime{}, fmt.Errorf("failed to fetch image manifest: %w", err)
+		}
+	}
+	if runtime, ok := a.runtimes.Load(desc.Digest); ok {
+		return runtime.(domain.ImageRuntime), nil
+	}
+
+	var manifest ocispec.Manifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return domain.ImageRuntime{}, fmt.Errorf("failed to decode image manifest: %w", err)
+	}
+	configData, err := content.FetchAll(ctx, repo, manifest.Config)
+	if err != nil {
+		return domain.ImageRuntime{}, fmt.Errorf("failed to fetch image config: %w", err)
+	}
+	var config ocispec.Image
+	if err := json.Unmarshal(configData, &config); err != nil {
+		return domain.ImageRuntime{}, fmt.Errorf("failed to decode image config: %w", err)
+	}
+	shell, err := hasShell(ctx, repo, manifest.Layers)
+	if err != nil {
+		return domain.ImageRuntime{}, err
+	}
+
+	runtime := domain.ImageRuntime{
+		Command: append(slices.Clone(config.Config.Entrypoint), config.Config.Cmd...),
+		Shell:   shell,
+	}
+	a.runtimes.Store(desc.Digest, runtime)
+	return runtime, nil
 }
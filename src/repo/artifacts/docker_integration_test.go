@@ -3,6 +3,7 @@ package artifacts
 import (
 	"context"
 	"fmt"
+	"io"
 	"path/filepath"
 	"testing"
 
@@ -136,8 +137,7 @@ func runDockerArtifactTest(t *testing.T, tc testCase) {
 	}
 
 	// Test Build operation
-	progress := domain.NewProgressBuf()
-	builtImage, err := dockerArtifact.Build(ctx, buildArgs, progress)
+	builtImage, err := dockerArtifact.Build(ctx, buildArgs, io.Discard)
 	require.NoError(t, err, "Failed to build image")
 
 	expectedImage := dockerArtifact.Image("test-app", tag)
@@ -0,0 +1,145 @@
+package artifacts
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/treenq/treenq/src/domain"
+)
+
+func TestDockerArtifact_ParseImage(t *testing.T) {
+	a, err := NewDockerArtifactory("", "", "registry:5000", false, "", "", "")
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		name     string
+		ref      string
+		expected domain.Image
+	}{
+		{
+			name: "tagged",
+			ref:  "ghcr.io/org/app:1.0.0",
+			expected: domain.Image{
+				Registry:   "ghcr.io",
+				Repository: "org/app",
+				Tag:        "1.0.0",
+			},
+		},
+		{
+			name: "docker hub familiar name",
+			ref:  "nginx",
+			expected: domain.Image{
+				Registry:   "docker.io",
+				Repository: "library/nginx",
+				Tag:        "latest",
+			},
+		},
+		{
+			name: "digest",
+			ref:  "registry.example.com:5000/app@sha256:6c3c624b58dbbcd3c0dd82b4c53f04194d1247c6eebdaab7c610cf7d66709b3b",
+			expected: domain.Image{
+				Registry:   "registry.example.com:5000",
+				Repository: "app",
+				Digest:     "sha256:6c3c624b58dbbcd3c0dd82b4c53f04194d1247c6eebdaab7c610cf7d66709b3b",
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			image, err := a.ParseImage(tt.ref)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, image)
+		})
+	}
+
+	_, err = a.ParseImage("Invalid Image")
+	assert.ErrorIs(t, err, ErrInvalidImageReference)
+}
+
+func TestDockerArtifact_Runtime(t *testing.T) {
+	blobs := make(map[string][]byte)
+	push := func(data []byte) ocispec.Descriptor {
+		d := digest.FromBytes(data)
+		blobs[d.String()] = data
+		return ocispec.Descriptor{Digest: d, Size: int64(len(data))}
+	}
+	mustJSON := func(v any) []byte {
+		data, err := json.Marshal(v)
+		require.NoError(t, err)
+		return data
+	}
+	shellLayer := push(gzipLayer(t, dirEntry("bin"), fileEntry("bin/sh")))
+	shellLayer.MediaType = ocispec.MediaTypeImageLayerGzip
+	distrolessLayer := push(gzipLayer(t, dirEntry("app"), fileEntry("app/server")))
+	distrolessLayer.MediaType = ocispec.MediaTypeImageLayerGzip
+	manifestDesc := func(entrypoint, cmd []string, platform ocispec.Platform, layer ocispec.Descriptor) ocispec.Descriptor {
+		config := push(mustJSON(ocispec.Image{Config: ocispec.ImageConfig{Entrypoint: entrypoint, Cmd: cmd}}))
+		config.MediaType = ocispec.MediaTypeImageConfig
+		desc := push(mustJSON(ocispec.Manifest{Versioned: specs.Versioned{SchemaVersion: 2}, MediaType: ocispec.MediaTypeImageManifest, Config: config, Layers: []ocispec.Descriptor{layer}}))
+		desc.MediaType = ocispec.MediaTypeImageManifest
+		desc.Platform = &platform
+		return desc
+	}
+	tags := map[string]ocispec.Descriptor{
+		"single": manifestDesc([]string{"/app/server"}, []string{"--port", "8000"}, ocispec.Platform{}, shellLayer),
+	}
+	index := push(mustJSON(ocispec.Index{Versioned: specs.Versioned{SchemaVersion: 2}, MediaType: ocispec.MediaTypeImageIndex, Manifests: []ocispec.Descriptor{
+		manifestDesc(nil, []string{"arm"}, ocispec.Platform{OS: "linux", Architecture: "arm64"}, shellLayer),
+		manifestDesc(nil, []string{"amd"}, ocispec.Platform{OS: "linux", Architecture: "amd64"}, distrolessLayer),
+	}}))
+	index.MediaType = ocispec.MediaTypeImageIndex
+	tags["multi"] = index
+
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ref := path.Base(r.URL.Path)
+		data, ok := blobs[ref]
+		mediaType := ""
+		if desc, tagged := tags[ref]; tagged {
+			data, ok, mediaType = blobs[desc.Digest.String()], true, desc.MediaType
+			ref = desc.Digest.String()
+		}
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if strings.Contains(r.URL.Path, "/manifests/") {
+			var m struct {
+				MediaType string `json:"mediaType"`
+			}
+			json.Unmarshal(data, &m)
+			mediaType = m.MediaType
+		}
+		w.Header().Set("Content-Type", mediaType)
+		w.Header().Set("Docker-Content-Digest", ref)
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Write(data)
+	}))
+	t.Cleanup(registry.Close)
+	host := strings.TrimPrefix(registry.URL, "http://")
+
+	a, err := NewDockerArtifactory("", "", host, false, "", "", "")
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	runtime, err := a.Runtime(ctx, a.Image("app", "single"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, domain.ImageRuntime{Command: []string{"/app/server", "--port", "8000"}, Shell: true}, runtime, "the entrypoint must be followed by the cmd")
+
+	runtime, err = a.Runtime(ctx, a.Image("app", "multi"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, domain.ImageRuntime{Command: []string{"amd"}}, runtime, "the linux/amd64 manifest of an index must be used")
+
+	_, err = a.Runtime(ctx, a.Image("app", "missing"), nil)
+	assert.Error(t, err)
+}
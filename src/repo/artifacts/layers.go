@@ -0,0 +1,146 @@
+package artifacts
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2/content"
+)
+
+// the whiteout files of the image layers, https://github.com/opencontainers/image-spec/blob/main/layer.md#whiteouts
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+)
+
+// shellPaths are the paths /bin/sh may be found by, /bin is a symlink to /usr/bin in the merged /usr images
+var shellPaths = []string{"bin", "bin/sh", "usr/bin", "usr/bin/sh"}
+
+// layerPath is a path as it's seen in the image, the upper layer entry wins, nil means the path is removed
+type layerPath struct {
+	header *tar.Header
+}
+
+// hasShell looks /bin/sh up in the image layers from the upper one,
+// a layer is read until the found entries tell whether the shell exists
+func hasShell(ctx context.Context, fetcher content.Fetcher, layers []ocispec.Descriptor) (bool, error) {
+	paths := make(map[string]layerPath)
+	for _, layer := range slices.Backward(layers) {
+		if err := readLayerPaths(ctx, fetcher, layer, paths); err != nil {
+			return false, err
+		}
+		if shell, known := resolveShell(paths); known {
+			return shell, nil
+		}
+	}
+	shell, _ := resolveShell(paths)
+	return shell, nil
+}
+
+// resolveShell tells whether /bin/sh exists by the paths found so far, known is false until the upper layers decide it
+func resolveShell(paths map[string]layerPath) (shell, known bool) {
+	bin, ok := paths["bin"]
+	if !ok {
+		// a lower layer may replace /bin with a symlink still, the shell found in /bin is enough though
+		if sh, ok := paths["bin/sh"]; ok && sh.header != nil {
+			return true, true
+		}
+		return false, false
+	}
+	if bin.header == nil {
+		return false, true
+	}
+	name := "bin/sh"
+	if bin.header.Typeflag == tar.TypeSymlink {
+		target := strings.TrimPrefix(path.Clean(bin.header.Linkname), "/")
+		if target != "usr/bin" {
+			return false, true
+		}
+		name = "usr/bin/sh"
+	}
+	sh, ok := paths[name]
+	if !ok {
+		return false, false
+	}
+	return sh.header != nil, true
+}
+
+// readLayerPaths adds the shell paths of the layer to the given ones unless an upper layer has them already
+func readLayerPaths(ctx context.Context, fetcher content.Fetcher, layer ocispec.Descriptor, paths map[string]layerPath) error {
+	rc, err := fetcher.Fetch(ctx, layer)
+	if err != nil {
+		return fmt.Errorf("failed to fetch image layer %s: %w", layer.Digest, err)
+	}
+	defer rc.Close()
+
+	var r io.Reader = rc
+	switch {
+	case strings.HasSuffix(layer.MediaType, "gzip"):
+		gz, err := gzip.NewReader(rc)
+		if err != nil {
+			return fmt.Errorf("failed to read image layer %s: %w", layer.Digest, err)
+		}
+		defer gz.Close()
+		r = gz
+	case strings.HasSuffix(layer.MediaType, "zstd"):
+		zr, err := zstd.NewReader(rc)
+		if err != nil {
+			return fmt.Errorf("failed to read image layer %s: %w", layer.Digest, err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	// the entries of a layer apply to the lower layers only, so they're collected before they're merged
+	found := make(map[string]layerPath)
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read image layer %s: %w", layer.Digest, err)
+		}
+
+		name := strings.TrimPrefix(path.Clean("/"+header.Name), "/")
+		dir, base := path.Split(name)
+		dir = strings.TrimSuffix(dir, "/")
+		switch {
+		case base == whiteoutOpaque:
+			// an opaque directory hides the lower entries of it, the entries of this layer stay
+			for _, p := range shellPaths {
+				if strings.HasPrefix(p, dir+"/") {
+					if _, ok := found[p]; !ok {
+						found[p] = layerPath{}
+					}
+				}
+			}
+		case strings.HasPrefix(base, whiteoutPrefix):
+			removed := path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix))
+			for _, p := range shellPaths {
+				if p == removed || strings.HasPrefix(p, removed+"/") {
+					found[p] = layerPath{}
+				}
+			}
+		case slices.Contains(shellPaths, name):
+			found[name] = layerPath{header: header}
+		}
+	}
+
+	for p, lp := range found {
+		if _, ok := paths[p]; !ok {
+			paths[p] = lp
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package artifacts
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2/content/memory"
+)
+
+func dirEntry(name string) *tar.Header {
+	return &tar.Header{Name: name + "/", Typeflag: tar.TypeDir, Mode: 0o755}
+}
+
+func fileEntry(name string) *tar.Header {
+	return &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o755}
+}
+
+func symlinkEntry(name, target string) *tar.Header {
+	return &tar.Header{Name: name, Typeflag: tar.TypeSymlink, Linkname: target, Mode: 0o777}
+}
+
+// gzipLayer gives a gzipped tar layer of the given empty entries
+func gzipLayer(t *testing.T, entries ...*tar.Header) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, entry := range entries {
+		require.NoError(t, tw.WriteHeader(entry))
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func TestHasShell(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		layers [][]*tar.Header
+		shell  bool
+	}{
+		{
+			name:   "shell",
+			layers: [][]*tar.Header{{dirEntry("bin"), fileEntry("bin/sh")}},
+			shell:  true,
+		},
+		{
+			name:   "distroless",
+			layers: [][]*tar.Header{{dirEntry("etc"), fileEntry("etc/passwd")}, {dirEntry("app"), fileEntry("app/server")}},
+		},
+		{
+			name:   "merged usr",
+			layers: [][]*tar.Header{{symlinkEntry("bin", "usr/bin"), dirEntry("usr"), dirEntry("usr/bin"), symlinkEntry("usr/bin/sh", "dash")}},
+			shell:  true,
+		},
+		{
+			name:   "merged usr without shell",
+			layers: [][]*tar.Header{{symlinkEntry("bin", "/usr/bin"), dirEntry("usr"), dirEntry("usr/bin"), fileEntry("usr/bin/env")}},
+		},
+		{
+			name:   "removed shell",
+			layers: [][]*tar.Header{{dirEntry("bin"), fileEntry("bin/sh")}, {dirEntry("bin"), fileEntry("bin/.wh.sh")}},
+		},
+		{
+			name:   "opaque bin",
+			layers: [][]*tar.Header{{dirEntry("bin"), fileEntry("bin/sh")}, {dirEntry("bin"), fileEntry("bin/.wh..wh..opq"), fileEntry("bin/app")}},
+		},
+		{
+			name:   "shell of a lower layer",
+			layers: [][]*tar.Header{{dirEntry("bin"), fileEntry("bin/sh")}, {dirEntry("app"), fileEntry("app/server")}},
+			shell:  true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := memory.New()
+			var layers []ocispec.Descriptor
+			for _, entries := range tt.layers {
+				data := gzipLayer(t, entries...)
+				desc := ocispec.Descriptor{MediaType: ocispec.MediaTypeImageLayerGzip, Digest: digest.FromBytes(data), Size: int64(len(data))}
+				require.NoError(t, store.Push(ctx, desc, bytes.NewReader(data)))
+				layers = append(layers, desc)
+			}
+
+			shell, err := hasShell(ctx, store, layers)
+			require.NoError(t, err)
+			assert.Equal(t, tt.shell, shell)
+		})
+	}
+}
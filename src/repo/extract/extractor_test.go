@@ -146,3 +146,42 @@ func TestExtractor_ExtractConfigJsonPriority(t *testing.T) {
 	// Should use JSON file (with name "treenq-e2e-sample"), not YAML (with name "different-name")
 	assert.Equal(t, "treenq-e2e-sample", resource.Service.Name)
 }
+
+func TestExtractor_ExtractConfigRequiredSecrets(t *testing.T) {
+	for _, tt := range []struct {
+		name            string
+		requiredSecrets string
+		expected        []string
+		err             error
+	}{
+		{
+			name:            "valid keys",
+			requiredSecrets: `["DB_URL", "SENTRY_DSN"]`,
+			expected:        []string{"DB_URL", "SENTRY_DSN"},
+		},
+		{
+			name:            "invalid key",
+			requiredSecrets: `["DB_URL", "1KEY"]`,
+			err:             tqsdk.ErrInvalidSecretKey,
+		},
+		{
+			name:            "duplicate key",
+			requiredSecrets: `["DB_URL", "DB_URL"]`,
+			err:             tqsdk.ErrDuplicateSecretKey,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			srcDir := t.TempDir()
+			config := []byte(`{"service": {"name": "treenq-e2e-sample", "httpPort": 8000, "requiredSecrets": ` + tt.requiredSecrets + `}}`)
+			require.NoError(t, os.WriteFile(filepath.Join(srcDir, tqJsonPath), config, 0766))
+
+			space, err := NewExtractor().ExtractConfig(srcDir)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, space.Service.RequiredSecrets)
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package pubsub
+
+import "context"
+
+// Memory notifies the subscribers of the same process only, it fits a single api replica and the local development
+type Memory struct {
+	subs *subscribers
+}
+
+func NewMemory() *Memory {
+	return &Memory{subs: newSubscribers()}
+}
+
+func (m *Memory) Publish(ctx context.Context, deploymentID string, logID int64) error {
+	m.subs.notify(deploymentID, logID)
+	return nil
+}
+
+func (m *Memory) Subscribe(ctx context.Context, deploymentID string) (<-chan int64, error) {
+	return m.subs.add(ctx, deploymentID), nil
+}
@@ -0,0 +1,246 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/treenq/treenq/src/domain"
+)
+
+func TestMemory(t *testing.T) {
+	m := NewMemory()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sub, err := m.Subscribe(ctx, "deployment-1")
+	require.NoError(t, err)
+	other, err := m.Subscribe(ctx, "deployment-2")
+	require.NoError(t, err)
+
+	require.NoError(t, m.Publish(ctx, "deployment-1", 1))
+	require.NoError(t, m.Publish(ctx, "deployment-1", 2), "a publish must not block on a pending id")
+	assert.Equal(t, int64(1), <-sub)
+	select {
+	case id := <-other:
+		t.Fatalf("another deployment must not be notified, given %d", id)
+	default:
+	}
+
+	cancel()
+	require.Eventually(t, func() bool {
+		select {
+		case _, ok := <-sub:
+			return !ok
+		default:
+			return false
+		}
+	}, time.Second, 10*time.Millisecond, "a subscription must be closed once the context is done")
+	require.Eventually(t, func() bool {
+		m.subs.mx.Lock()
+		defer m.subs.mx.Unlock()
+		return len(m.subs.subs) == 0
+	}, time.Second, 10*time.Millisecond, "the closed subscriptions must be removed")
+}
+
+// buildLogsStandIn keeps the build logs of the known deployments in memory giving them sequential ids
+type buildLogsStandIn struct {
+	mx       sync.Mutex
+	logs     []domain.BuildLog
+	statuses map[string]domain.DeployStatus
+	// failures is how many saves fail before the logs are saved
+	failures int
+}
+
+func newBuildLogsStandIn(statuses map[string]domain.DeployStatus) *buildLogsStandIn {
+	return &buildLogsStandIn{statuses: statuses}
+}
+
+func (s *buildLogsStandIn) SaveBuildLogs(ctx context.Context, logs []domain.BuildLog) ([]domain.BuildLog, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if s.failures > 0 {
+		s.failures--
+		return nil, errors.New("database is down")
+	}
+	for _, log := range logs {
+		if _, ok := s.statuses[log.DeploymentID]; !ok {
+			return nil, domain.ErrDeploymentNotFound
+		}
+	}
+	for i := range logs {
+		logs[i].ID = int64(len(s.logs) + 1)
+		s.logs = append(s.logs, logs[i])
+	}
+	return logs, nil
+}
+
+func (s *buildLogsStandIn) GetBuildLogs(ctx context.Context, deploymentID string, after int64) ([]domain.BuildLog, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	var logs []domain.BuildLog
+	for _, log := range s.logs {
+		if log.DeploymentID == deploymentID && log.ID > after {
+			logs = append(logs, log)
+		}
+	}
+	return logs, nil
+}
+
+func (s *buildLogsStandIn) GetDeploymentStatus(ctx context.Context, deploymentID string) (domain.DeployStatus, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	status, ok := s.statuses[deploymentID]
+	if !ok {
+		return "", domain.ErrDeploymentNotFound
+	}
+	return status, nil
+}
+
+func (s *buildLogsStandIn) setStatus(deploymentID string, status domain.DeployStatus) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.statuses[deploymentID] = status
+}
+
+func (s *buildLogsStandIn) setFailures(failures int) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.failures = failures
+}
+
+func (s *buildLogsStandIn) saved() int {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return len(s.logs)
+}
+
+func TestProgressAcrossReplicas(t *testing.T) {
+	logs := newBuildLogsStandIn(map[string]domain.DeployStatus{
+		"deployment-0": domain.DeployStatusFailed,
+		"deployment-1": domain.DeployStatusRunning,
+		"deployment-2": domain.DeployStatusRunning,
+	})
+	// the replicas share the build logs and the pubsub only
+	m := NewMemory()
+	builder := domain.NewProgress(logs, m)
+	streamer := domain.NewProgress(logs, m)
+	ctx := context.Background()
+
+	first := <-streamer.Get(ctx, "deployment-0", 0)
+	assert.Equal(t, "NO_LOGS", first.ErrorCode, "an ended deployment without progress must have no logs")
+	assert.True(t, first.Final)
+	assert.NotZero(t, first.ID, "the message must be saved to be resumed after")
+	_, ok := <-streamer.Get(ctx, "deployment-3", 0)
+	assert.False(t, ok, "a missing deployment must have no progress")
+
+	builder.Append("deployment-1", domain.ProgressMessage{Payload: "cloned"})
+	messages := streamer.Get(ctx, "deployment-1", 0)
+	assert.Equal(t, "cloned", (<-messages).Payload, "the written progress must be replayed")
+
+	builder.Append("deployment-2", domain.ProgressMessage{Payload: "another"})
+	builder.Append("deployment-1", domain.ProgressMessage{Payload: "built"})
+	builder.Append("deployment-1", domain.ProgressMessage{Payload: "deployed", Final: true, Deployment: domain.AppDeployment{ID: "deployment-1"}})
+
+	built := <-messages
+	assert.Equal(t, "built", built.Payload, "the progress of another replica must be followed")
+	final := <-messages
+	assert.True(t, final.Final)
+	assert.Equal(t, "deployment-1", final.Deployment.ID)
+	_, ok = <-messages
+	assert.False(t, ok, "the stream must end with the final message")
+}
+
+func TestProgressResume(t *testing.T) {
+	logs := newBuildLogsStandIn(map[string]domain.DeployStatus{
+		"deployment-1": domain.DeployStatusRunning,
+		"deployment-2": domain.DeployStatusRunning,
+	})
+	progress := domain.NewProgress(logs, NewMemory())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	progress.Append("deployment-1", domain.ProgressMessage{Payload: "cloned"})
+	progress.Append("deployment-1", domain.ProgressMessage{Payload: "built"})
+	require.Eventually(t, func() bool { return logs.saved() == 2 }, time.Second, 10*time.Millisecond, "the messages must be saved")
+	first := <-progress.Get(ctx, "deployment-1", 0)
+	assert.Equal(t, int64(1), first.ID, "a message must have the build log id")
+
+	messages := progress.Get(ctx, "deployment-1", first.ID)
+	resumed := <-messages
+	assert.Equal(t, "built", resumed.Payload, "a stream must be resumed after the given id")
+	assert.Equal(t, int64(2), resumed.ID)
+
+	progress.Append("deployment-1", domain.ProgressMessage{Payload: "deployed", Final: true})
+	final := <-messages
+	assert.Equal(t, int64(3), final.ID)
+	assert.True(t, final.Final)
+
+	empty := progress.Get(ctx, "deployment-2", 5)
+	select {
+	case m := <-empty:
+		t.Fatalf("a resumed stream must wait for the new messages, given %+v", m)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestProgressEnded(t *testing.T) {
+	logs := newBuildLogsStandIn(map[string]domain.DeployStatus{"deployment-1": domain.DeployStatusRunning})
+	progress := domain.NewProgress(logs, NewMemory())
+	ctx := context.Background()
+
+	progress.Append("deployment-1", domain.ProgressMessage{Payload: "cloned"})
+	require.Eventually(t, func() bool { return logs.saved() == 1 }, time.Second, 10*time.Millisecond, "the message must be saved")
+	logs.setStatus("deployment-1", domain.DeployStatusFailed)
+
+	messages := progress.Get(ctx, "deployment-1", 0)
+	assert.Equal(t, "cloned", (<-messages).Payload)
+	final := <-messages
+	assert.True(t, final.Final, "an ended deployment without a final message must end the stream")
+	assert.Equal(t, int64(2), final.ID, "the final message must be saved to be resumed after")
+	_, ok := <-messages
+	assert.False(t, ok)
+
+	resumed := <-progress.Get(ctx, "deployment-1", 1)
+	assert.Equal(t, final.ID, resumed.ID, "a resumed stream must give the same final message")
+}
+
+func TestProgressFinalSavedBeforeStatus(t *testing.T) {
+	logs := newBuildLogsStandIn(map[string]domain.DeployStatus{"deployment-1": domain.DeployStatusRunning})
+	progress := domain.NewProgress(logs, NewMemory())
+	ctx := context.Background()
+
+	progress.Append("deployment-1", domain.ProgressMessage{Payload: "cloned"})
+	progress.Append("deployment-1", domain.ProgressMessage{Payload: "deployment failed", Final: true, ErrorCode: "MISSING_SECRETS"})
+	assert.Equal(t, 2, logs.saved(), "a final message must be saved with the messages before it once it's appended")
+	logs.setStatus("deployment-1", domain.DeployStatusFailed)
+
+	var final domain.ProgressMessage
+	for m := range progress.Get(ctx, "deployment-1", 0) {
+		final = m
+	}
+	assert.Equal(t, "MISSING_SECRETS", final.ErrorCode, "the stream must end with the final message of the deployment")
+}
+
+func TestProgressSaveRetried(t *testing.T) {
+	logs := newBuildLogsStandIn(map[string]domain.DeployStatus{"deployment-1": domain.DeployStatusRunning})
+	progress := domain.NewProgress(logs, NewMemory())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	messages := progress.Get(ctx, "deployment-1", 0)
+
+	logs.setFailures(1)
+	progress.Append("deployment-1", domain.ProgressMessage{Payload: "built"})
+	progress.Append("deployment-2", domain.ProgressMessage{Payload: "removed deployment"})
+	progress.Append("deployment-1", domain.ProgressMessage{Payload: "deployed", Final: true})
+
+	built := <-messages
+	assert.Equal(t, "built", built.Payload, "a message failed to be saved must be saved again")
+	assert.NotZero(t, built.ID)
+	final := <-messages
+	assert.True(t, final.Final)
+	assert.Equal(t, 2, logs.saved(), "the logs of a removed deployment must be given up")
+}
@@ -0,0 +1,85 @@
+package pubsub
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// progressChannel is a postgres notification channel of all the deployments,
+// a payload is "<deploymentID>:<logID>" well below the notification payload limit
+const progressChannel = "build_progress"
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// Postgres notifies the subscribers of every api replica connected to the same database using LISTEN/NOTIFY,
+// a replica keeps a single listening connection and fans the notifications out itself
+type Postgres struct {
+	db       execer
+	listener *pq.Listener
+	subs     *subscribers
+}
+
+func NewPostgres(dsn string, db execer) (*Postgres, error) {
+	listener := pq.NewListener(dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Println("[ERROR] build progress listener", err)
+		}
+	})
+	if err := listener.Listen(progressChannel); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to listen to %s: %w", progressChannel, err)
+	}
+
+	p := &Postgres{
+		db:       db,
+		listener: listener,
+		subs:     newSubscribers(),
+	}
+	go p.dispatch()
+	return p, nil
+}
+
+func (p *Postgres) dispatch() {
+	for n := range p.listener.Notify {
+		// nil is sent once the connection is reestablished, the notifications in between are lost,
+		// the subscribers poll the logs anyway
+		if n == nil {
+			continue
+		}
+		deploymentID, rawID, ok := strings.Cut(n.Extra, ":")
+		if !ok {
+			continue
+		}
+		logID, err := strconv.ParseInt(rawID, 10, 64)
+		if err != nil {
+			continue
+		}
+		p.subs.notify(deploymentID, logID)
+	}
+}
+
+func (p *Postgres) Publish(ctx context.Context, deploymentID string, logID int64) error {
+	payload := deploymentID + ":" + strconv.FormatInt(logID, 10)
+	if _, err := p.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", progressChannel, payload); err != nil {
+		return fmt.Errorf("failed to notify build progress: %w", err)
+	}
+	return nil
+}
+
+func (p *Postgres) Subscribe(ctx context.Context, deploymentID string) (<-chan int64, error) {
+	return p.subs.add(ctx, deploymentID), nil
+}
+
+// Close stops listening, the subscriptions are ended by their contexts
+func (p *Postgres) Close() error {
+	return p.listener.Close()
+}
@@ -0,0 +1,56 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+)
+
+// subscribers fans the log ids out to the subscribers of a deployment
+type subscribers struct {
+	mx   sync.Mutex
+	subs map[string]map[chan int64]struct{}
+}
+
+func newSubscribers() *subscribers {
+	return &subscribers{subs: make(map[string]map[chan int64]struct{})}
+}
+
+// add gives a channel closed once the context is done
+func (s *subscribers) add(ctx context.Context, deploymentID string) <-chan int64 {
+	// a single pending id is enough, a subscriber reads all the logs after the last one it has given
+	ch := make(chan int64, 1)
+
+	s.mx.Lock()
+	if s.subs[deploymentID] == nil {
+		s.subs[deploymentID] = make(map[chan int64]struct{})
+	}
+	s.subs[deploymentID][ch] = struct{}{}
+	s.mx.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		s.mx.Lock()
+		defer s.mx.Unlock()
+		delete(s.subs[deploymentID], ch)
+		if len(s.subs[deploymentID]) == 0 {
+			delete(s.subs, deploymentID)
+		}
+		close(ch)
+	}()
+
+	return ch
+}
+
+// notify never blocks, an id is dropped for a subscriber having a pending one
+func (s *subscribers) notify(deploymentID string, logID int64) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	for ch := range s.subs[deploymentID] {
+		select {
+		case ch <- logID:
+		default:
+		}
+	}
+}
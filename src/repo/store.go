@@ -6,9 +6,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
 	"slices"
+	"strings"
 	"time"
 
+	"github.com/jackc/pgx"
 	"github.com/rs/xid"
 
 	"github.com/jmoiron/sqlx"
@@ -43,18 +46,27 @@ var now = func() time.Time {
 var ErrNoAuthState = fmt.Errorf("no auth state found")
 
 func (s *Store) GetOrCreateUser(ctx context.Context, user domain.UserInfo) (domain.UserInfo, error) {
-	query, args, err := s.sq.Select("id").From("users").Where(sq.Eq{"email": user.Email}).ToSql()
-	if err != nil {
-		return user, fmt.Errorf("failed to build select query GetOrCreateUser: %w", err)
-	}
-	row := s.db.QueryRow(query, args...)
-	if err := row.Scan(&user.ID); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
+	stored, err := s.getUserByIdentity(ctx, user.Provider, user.Subject)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		// the users logged in before the identities were kept, or with another provider, are linked by the verified email
+		stored, err = s.getUserByEmail(ctx, user.Email)
+		if errors.Is(err, domain.ErrUserNotFound) {
 			return s.createUser(ctx, user)
 		}
-
-		return user, fmt.Errorf("failed to scan select GetOrCreateUser: %w", err)
+		if err != nil {
+			return user, err
+		}
+	}
+	if err != nil {
+		return user, err
+	}
+	// the login is kept up to date, it may be renamed on the provider
+	if err := s.linkIdentity(ctx, s.db, stored.ID, user); err != nil {
+		return user, err
 	}
+	user.ID = stored.ID
+	user.Email = stored.Email
+	user.DisplayName = stored.DisplayName
 
 	// Get user's workspaces
 	workspaces, err := s.GetUserWorkspaces(ctx, user.ID)
@@ -72,6 +84,106 @@ func (s *Store) GetOrCreateUser(ctx context.Context, user domain.UserInfo) (doma
 	return user, nil
 }
 
+func (s *Store) getUserByIdentity(ctx context.Context, provider, subject string) (domain.UserInfo, error) {
+	query, args, err := s.sq.Select("u.id", "u.email", "u.displayName").
+		From("userIdentities i").
+		Join("users u ON u.id = i.userId").
+		Where(sq.Eq{"i.provider": provider, "i.subject": subject}).
+		ToSql()
+	if err != nil {
+		return domain.UserInfo{}, fmt.Errorf("failed to build getUserByIdentity query: %w", err)
+	}
+	var user domain.UserInfo
+	if err := s.db.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.Email, &user.DisplayName); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return user, domain.ErrUserNotFound
+		}
+		return user, fmt.Errorf("failed to scan getUserByIdentity row: %w", err)
+	}
+	return user, nil
+}
+
+func (s *Store) getUserByEmail(ctx context.Context, email string) (domain.UserInfo, error) {
+	query, args, err := s.sq.Select("id", "email", "displayName").
+		From("users").
+		Where(sq.Eq{"email": email}).
+		ToSql()
+	if err != nil {
+		return domain.UserInfo{}, fmt.Errorf("failed to build getUserByEmail query: %w", err)
+	}
+	var user domain.UserInfo
+	if err := s.db.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.Email, &user.DisplayName); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return user, domain.ErrUserNotFound
+		}
+		return user, fmt.Errorf("failed to scan getUserByEmail row: %w", err)
+	}
+	return user, nil
+}
+
+func (s *Store) linkIdentity(ctx context.Context, q Querier, userID string, user domain.UserInfo) error {
+	query, args, err := s.sq.Insert("userIdentities").
+		Columns("provider", "subject", "login", "userId", "createdAt").
+		Values(user.Provider, user.Subject, user.Login, userID, now()).
+		Suffix("ON CONFLICT (provider, subject) DO UPDATE SET login = EXCLUDED.login").
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build linkIdentity query: %w", err)
+	}
+	if _, err := q.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to exec linkIdentity: %w", err)
+	}
+	return nil
+}
+
+// maxDisplayNameSuffix bounds the attempts to find a free display name of a new user
+const maxDisplayNameSuffix = 100
+
+// uniqueDisplayName gives the name or the name having the least free numeric suffix, e.g. john-2
+func (s *Store) uniqueDisplayName(ctx context.Context, q Querier, name string) (string, error) {
+	candidate := name
+	for i := 2; i <= maxDisplayNameSuffix; i++ {
+		query, args, err := s.sq.Select("1").Prefix("SELECT EXISTS (").
+			From("users").
+			Where(sq.Eq{"displayName": candidate}).
+			Suffix(")").
+			ToSql()
+		if err != nil {
+			return "", fmt.Errorf("failed to build uniqueDisplayName query: %w", err)
+		}
+		var taken bool
+		if err := q.QueryRowContext(ctx, query, args...).Scan(&taken); err != nil {
+			return "", fmt.Errorf("failed to scan uniqueDisplayName row: %w", err)
+		}
+		if !taken {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s-%d", name, i)
+	}
+	return name + "-" + xid.New().String(), nil
+}
+
+// GetUserIdentity gives the latest user identity of the provider
+func (s *Store) GetUserIdentity(ctx context.Context, userID, provider string) (domain.UserIdentity, error) {
+	query, args, err := s.sq.Select("provider", "subject", "login").
+		From("userIdentities").
+		Where(sq.Eq{"userId": userID, "provider": provider}).
+		OrderBy("createdAt DESC").
+		Limit(1).
+		ToSql()
+	if err != nil {
+		return domain.UserIdentity{}, fmt.Errorf("failed to build GetUserIdentity query: %w", err)
+	}
+	var identity domain.UserIdentity
+	if err := s.db.QueryRowContext(ctx, query, args...).Scan(&identity.Provider, &identity.Subject, &identity.Login); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return identity, domain.ErrIdentityNotFound
+		}
+		return identity, fmt.Errorf("failed to scan GetUserIdentity row: %w", err)
+	}
+	return identity, nil
+}
+
 func (s *Store) createUser(ctx context.Context, user domain.UserInfo) (domain.UserInfo, error) {
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -79,10 +191,16 @@ func (s *Store) createUser(ctx context.Context, user domain.UserInfo) (domain.Us
 	}
 	defer tx.Rollback()
 
+	// the display name is unique, a name taken by another user gets a suffix
+	displayName, err := s.uniqueDisplayName(ctx, tx, user.DisplayName)
+	if err != nil {
+		return user, err
+	}
+
 	id := xid.New().String()
 	query, args, err := s.sq.Insert("users").
 		Columns("id", "email", "displayName").
-		Values(id, user.Email, user.DisplayName).
+		Values(id, user.Email, displayName).
 		ToSql()
 	if err != nil {
 		return user, fmt.Errorf("failed to build query createUser: %w", err)
@@ -90,6 +208,9 @@ func (s *Store) createUser(ctx context.Context, user domain.UserInfo) (domain.Us
 	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
 		return user, fmt.Errorf("failed to exec createUser: %w", err)
 	}
+	if err := s.linkIdentity(ctx, tx, id, user); err != nil {
+		return user, err
+	}
 
 	workspace, err := s.createDefaultWorkspaceForUser(ctx, tx, id)
 	if err != nil {
@@ -101,6 +222,7 @@ func (s *Store) createUser(ctx context.Context, user domain.UserInfo) (domain.Us
 	}
 
 	user.ID = id
+	user.DisplayName = displayName
 	user.Workspaces = []string{workspace.ID}
 	return user, nil
 }
@@ -114,8 +236,8 @@ func (s *Store) SaveDeployment(ctx context.Context, def domain.AppDeployment) (d
 	}
 
 	query, args, err := s.sq.Insert("deployments").
-		Columns("id", "fromDeploymentId", "repoId", "space", "sha", "branch", "commitMessage", "buildTag", "userDisplayName", "status", "createdAt").
-		Values(def.ID, def.FromDeploymentID, def.RepoID, string(appPayload), def.Sha, def.Branch, def.CommitMessage, def.BuildTag, def.UserDisplayName, def.Status, def.CreatedAt).
+		Columns("id", "fromDeploymentId", "repoId", "environment", "space", "sha", "branch", "commitMessage", "buildTag", "image", "imageDigest", "userDisplayName", "userId", "status", "createdAt").
+		Values(def.ID, def.FromDeploymentID, def.RepoID, def.Environment, string(appPayload), def.Sha, def.Branch, def.CommitMessage, def.BuildTag, def.Image, def.ImageDigest, def.UserDisplayName, def.UserID, def.Status, def.CreatedAt).
 		ToSql()
 	if err != nil {
 		return def, fmt.Errorf("failed to build SaveDeployment query: %w", err)
@@ -133,6 +255,10 @@ func (s *Store) UpdateDeployment(ctx context.Context, deployment domain.AppDeplo
 	if err != nil {
 		return fmt.Errorf("failed to marshal app definition to json: %w", err)
 	}
+	secretVersions, err := json.Marshal(deployment.SecretVersions)
+	if err != nil {
+		return fmt.Errorf("failed to marshal secret versions to json: %w", err)
+	}
 	deployment.UpdatedAt = now()
 	query, args, err := s.sq.Update("deployments").
 		Set("space", appPayload).
@@ -140,7 +266,9 @@ func (s *Store) UpdateDeployment(ctx context.Context, deployment domain.AppDeplo
 		Set("branch", deployment.Branch).
 		Set("commitMessage", deployment.CommitMessage).
 		Set("buildTag", deployment.BuildTag).
+		Set("imageDigest", deployment.ImageDigest).
 		Set("status", deployment.Status).
+		Set("secretVersions", string(secretVersions)).
 		Where(sq.Eq{"id": deployment.ID}).
 		ToSql()
 	if err != nil {
@@ -154,9 +282,28 @@ func (s *Store) UpdateDeployment(ctx context.Context, deployment domain.AppDeplo
 	return nil
 }
 
+// GetDeploymentStatus gives a status of a deployment of any workspace
+func (s *Store) GetDeploymentStatus(ctx context.Context, deploymentID string) (domain.DeployStatus, error) {
+	query, args, err := s.sq.Select("status").
+		From("deployments").
+		Where(sq.Eq{"id": deploymentID}).
+		ToSql()
+	if err != nil {
+		return "", fmt.Errorf("failed to build GetDeploymentStatus query: %w", err)
+	}
+	var status domain.DeployStatus
+	if err := s.db.QueryRowContext(ctx, query, args...).Scan(&status); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", domain.ErrDeploymentNotFound
+		}
+		return "", fmt.Errorf("failed to scan GetDeploymentStatus row: %w", err)
+	}
+	return status, nil
+}
+
 func (s *Store) GetDeployment(ctx context.Context, workspaceID, deploymentID string) (domain.AppDeployment, error) {
-	query, args, err := s.sq.Select("d.id", "d.fromDeploymentId", "d.repoId", "d.space", "d.sha", "d.branch", "d.commitMessage",
-		"d.buildTag", "d.userDisplayName", "d.status", "d.createdAt", "d.updatedAt").
+	query, args, err := s.sq.Select("d.id", "d.fromDeploymentId", "d.repoId", "d.environment", "d.space", "d.sha", "d.branch", "d.commitMessage",
+		"d.buildTag", "d.image", "d.imageDigest", "d.userDisplayName", "d.userId", "d.status", "d.approvedBy", "d.approvedAt", "d.secretVersions", "d.createdAt", "d.updatedAt").
 		From("deployments d").
 		Join("installedRepos r ON d.repoId = r.id").
 		Where(sq.And{
@@ -169,9 +316,10 @@ func (s *Store) GetDeployment(ctx context.Context, workspaceID, deploymentID str
 	}
 
 	var dep domain.AppDeployment
-	var spacePayload string
+	var spacePayload, secretVersions string
+	var approvedAt sql.NullTime
 	if err := s.db.QueryRowContext(ctx, query, args...).Scan(
-		&dep.ID, &dep.FromDeploymentID, &dep.RepoID, &spacePayload, &dep.Sha, &dep.Branch, &dep.CommitMessage, &dep.BuildTag, &dep.UserDisplayName, &dep.Status, &dep.CreatedAt, &dep.UpdatedAt,
+		&dep.ID, &dep.FromDeploymentID, &dep.RepoID, &dep.Environment, &spacePayload, &dep.Sha, &dep.Branch, &dep.CommitMessage, &dep.BuildTag, &dep.Image, &dep.ImageDigest, &dep.UserDisplayName, &dep.UserID, &dep.Status, &dep.ApprovedBy, &approvedAt, &secretVersions, &dep.CreatedAt, &dep.UpdatedAt,
 	); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return dep, domain.ErrDeploymentNotFound
@@ -184,12 +332,16 @@ func (s *Store) GetDeployment(ctx context.Context, workspaceID, deploymentID str
 		return dep, fmt.Errorf("failed to unmarshal space in GetDeployment: %w", err)
 	}
 	dep.Space = space
+	dep.ApprovedAt = approvedAt.Time
+	if err := json.Unmarshal([]byte(secretVersions), &dep.SecretVersions); err != nil {
+		return dep, fmt.Errorf("failed to unmarshal secret versions in GetDeployment: %w", err)
+	}
 
 	return dep, nil
 }
 
 func (s *Store) GetDeployments(ctx context.Context, workspaceID, repoID string) ([]domain.AppDeployment, error) {
-	query, args, err := s.sq.Select("d.id", "d.fromDeploymentId", "d.repoId", "d.space", "d.sha", "d.branch", "d.commitMessage", "d.buildTag", "d.userDisplayName", "d.status", "d.createdAt", "d.updatedAt").
+	query, args, err := s.sq.Select("d.id", "d.fromDeploymentId", "d.repoId", "d.environment", "d.space", "d.sha", "d.branch", "d.commitMessage", "d.buildTag", "d.image", "d.imageDigest", "d.userDisplayName", "d.userId", "d.status", "d.approvedBy", "d.approvedAt", "d.secretVersions", "d.createdAt", "d.updatedAt").
 		From("deployments d").
 		Join("installedRepos r ON d.repoId = r.id").
 		Where(sq.And{
@@ -212,8 +364,9 @@ func (s *Store) GetDeployments(ctx context.Context, workspaceID, repoID string)
 	var deps []domain.AppDeployment
 	for rows.Next() {
 		var dep domain.AppDeployment
-		var spacePayload string
-		if err := rows.Scan(&dep.ID, &dep.FromDeploymentID, &dep.RepoID, &spacePayload, &dep.Sha, &dep.Branch, &dep.CommitMessage, &dep.BuildTag, &dep.UserDisplayName, &dep.Status, &dep.CreatedAt, &dep.UpdatedAt); err != nil {
+		var spacePayload, secretVersions string
+		var approvedAt sql.NullTime
+		if err := rows.Scan(&dep.ID, &dep.FromDeploymentID, &dep.RepoID, &dep.Environment, &spacePayload, &dep.Sha, &dep.Branch, &dep.CommitMessage, &dep.BuildTag, &dep.Image, &dep.ImageDigest, &dep.UserDisplayName, &dep.UserID, &dep.Status, &dep.ApprovedBy, &approvedAt, &secretVersions, &dep.CreatedAt, &dep.UpdatedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan GetDeploymentHistory row: %w", err)
 		}
 
@@ -222,6 +375,10 @@ func (s *Store) GetDeployments(ctx context.Context, workspaceID, repoID string)
 			return nil, fmt.Errorf("failed to decode app payload in GetDeploymentHistory: %w", err)
 		}
 		dep.Space = space
+		dep.ApprovedAt = approvedAt.Time
+		if err := json.Unmarshal([]byte(secretVersions), &dep.SecretVersions); err != nil {
+			return nil, fmt.Errorf("failed to decode secret versions in GetDeploymentHistory: %w", err)
+		}
 		deps = append(deps, dep)
 	}
 
@@ -232,6 +389,79 @@ func (s *Store) GetDeployments(ctx context.Context, workspaceID, repoID string)
 	return deps, nil
 }
 
+// GetLastDoneDeployment gives the latest deployment of a repo environment completed successfully
+func (s *Store) GetLastDoneDeployment(ctx context.Context, workspaceID, repoID, environment string) (domain.AppDeployment, error) {
+	query, args, err := s.sq.Select("d.id", "d.fromDeploymentId", "d.repoId", "d.environment", "d.space", "d.sha", "d.branch", "d.commitMessage",
+		"d.buildTag", "d.image", "d.imageDigest", "d.userDisplayName", "d.userId", "d.status", "d.approvedBy", "d.approvedAt", "d.secretVersions", "d.createdAt", "d.updatedAt").
+		From("deployments d").
+		Join("installedRepos r ON d.repoId = r.id").
+		Where(sq.And{
+			sq.Eq{"d.repoId": repoID},
+			sq.Eq{"d.environment": environment},
+			sq.Eq{"d.status": domain.DeployStatusDone},
+			sq.Eq{"r.workspaceId": workspaceID},
+		}).
+		OrderBy("d.id DESC").
+		Limit(1).
+		ToSql()
+	if err != nil {
+		return domain.AppDeployment{}, fmt.Errorf("failed to build GetLastDoneDeployment query: %w", err)
+	}
+
+	var dep domain.AppDeployment
+	var spacePayload, secretVersions string
+	var approvedAt sql.NullTime
+	if err := s.db.QueryRowContext(ctx, query, args...).Scan(
+		&dep.ID, &dep.FromDeploymentID, &dep.RepoID, &dep.Environment, &spacePayload, &dep.Sha, &dep.Branch, &dep.CommitMessage, &dep.BuildTag, &dep.Image, &dep.ImageDigest, &dep.UserDisplayName, &dep.UserID, &dep.Status, &dep.ApprovedBy, &approvedAt, &secretVersions, &dep.CreatedAt, &dep.UpdatedAt,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return dep, domain.ErrDeploymentNotFound
+		}
+		return dep, fmt.Errorf("failed to scan GetLastDoneDeployment: %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(spacePayload), &dep.Space); err != nil {
+		return dep, fmt.Errorf("failed to unmarshal space in GetLastDoneDeployment: %w", err)
+	}
+	dep.ApprovedAt = approvedAt.Time
+	if err := json.Unmarshal([]byte(secretVersions), &dep.SecretVersions); err != nil {
+		return dep, fmt.Errorf("failed to unmarshal secret versions in GetLastDoneDeployment: %w", err)
+	}
+
+	return dep, nil
+}
+
+// ApproveDeployment marks the deployment awaiting an approval as approved and running,
+// only one approval succeeds if a few of them race
+func (s *Store) ApproveDeployment(ctx context.Context, workspaceID, deploymentID, approvedBy string) (time.Time, error) {
+	approvedAt := now()
+	query, args, err := s.sq.Update("deployments").
+		Set("status", domain.DeployStatusRunning).
+		Set("approvedBy", approvedBy).
+		Set("approvedAt", approvedAt).
+		Set("updatedAt", approvedAt).
+		Where(sq.Eq{"id": deploymentID, "status": domain.DeployStatusAwaitingApproval}).
+		Where(sq.Expr("repoId IN (SELECT id FROM installedRepos WHERE workspaceId = ?)", workspaceID)).
+		ToSql()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to build ApproveDeployment query: %w", err)
+	}
+
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to exec ApproveDeployment: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get ApproveDeployment affected rows: %w", err)
+	}
+	if affected == 0 {
+		return time.Time{}, domain.ErrDeploymentNotAwaitingApproval
+	}
+
+	return approvedAt, nil
+}
+
 func (s *Store) DeploymentBelongsToWorkspace(ctx context.Context, workspaceID, deploymentID string) (bool, error) {
 	query, args, err := s.sq.Select("1").
 		From("deployments d").
@@ -556,7 +786,7 @@ func (s *Store) GetGithubRepos(ctx context.Context, workspaceID string) ([]domai
 	if err != nil {
 		return nil, false, nil
 	}
-	query, args, err := s.sq.Select("id", "githubId", "fullName", "private", "status", "branch").
+	query, args, err := s.sq.Select("id", "githubId", "fullName", "private", "status", "branch", "clusterId", "protected", "restartOnSecretChange").
 		From("installedRepos").
 		Where(sq.Eq{"workspaceId": workspaceID}).
 		OrderBy("id ASC").
@@ -574,7 +804,7 @@ func (s *Store) GetGithubRepos(ctx context.Context, workspaceID string) ([]domai
 	var repos []domain.GithubRepository
 	for rows.Next() {
 		var repo domain.GithubRepository
-		if err := rows.Scan(&repo.TreenqID, &repo.ID, &repo.FullName, &repo.Private, &repo.Status, &repo.Branch); err != nil {
+		if err := rows.Scan(&repo.TreenqID, &repo.ID, &repo.FullName, &repo.Private, &repo.Status, &repo.Branch, &repo.ClusterID, &repo.Protected, &repo.RestartOnSecretChange); err != nil {
 			return nil, hasInstallation, fmt.Errorf("failed to scan GetGithubRepos row: %w", err)
 		}
 
@@ -645,7 +875,7 @@ func (s *Store) connectRepo(ctx context.Context, q Querier, workspaceID, repoID,
 	query, args, err := s.sq.Update("installedRepos").
 		Set("branch", branch).
 		Where(sq.Eq{"id": repoID, "workspaceId": workspaceID}).
-		Suffix("RETURNING id, githubId, fullName, private, branch, status").
+		Suffix("RETURNING id, githubId, fullName, private, branch, status, clusterId, protected, restartOnSecretChange").
 		ToSql()
 	if err != nil {
 		return domain.GithubRepository{}, fmt.Errorf("failed to build ConnectRepoBranch query: %w", err)
@@ -656,7 +886,7 @@ func (s *Store) connectRepo(ctx context.Context, q Querier, workspaceID, repoID,
 		return domain.GithubRepository{}, fmt.Errorf("failed to execute ConnectRepoBranch: %w", row.Err())
 	}
 	var repo domain.GithubRepository
-	if err := row.Scan(&repo.TreenqID, &repo.ID, &repo.FullName, &repo.Private, &repo.Branch, &repo.Status); err != nil {
+	if err := row.Scan(&repo.TreenqID, &repo.ID, &repo.FullName, &repo.Private, &repo.Branch, &repo.Status, &repo.ClusterID, &repo.Protected, &repo.RestartOnSecretChange); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return repo, domain.ErrRepoNotFound
 		}
@@ -737,7 +967,7 @@ func (s *Store) RepoIsConnected(ctx context.Context, repoID string) (bool, error
 
 func (s *Store) GetRepoByGithub(ctx context.Context, githubRepoID int) (domain.GithubRepository, error) {
 	var repo domain.GithubRepository
-	query, args, err := s.sq.Select("id", "githubId", "fullName", "private", "branch", "installationId", "status").
+	query, args, err := s.sq.Select("id", "githubId", "fullName", "private", "branch", "installationId", "status", "clusterId", "protected", "restartOnSecretChange").
 		From("installedRepos").
 		Where(sq.Eq{"githubId": githubRepoID}).
 		ToSql()
@@ -747,7 +977,7 @@ func (s *Store) GetRepoByGithub(ctx context.Context, githubRepoID int) (domain.G
 
 	row := s.db.QueryRowContext(ctx, query, args...)
 	if err := row.Scan(&repo.TreenqID, &repo.ID, &repo.FullName,
-		&repo.Private, &repo.Branch, &repo.InstallationID, &repo.Status); err != nil {
+		&repo.Private, &repo.Branch, &repo.InstallationID, &repo.Status, &repo.ClusterID, &repo.Protected, &repo.RestartOnSecretChange); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return domain.GithubRepository{}, domain.ErrRepoNotFound
 		}
@@ -759,7 +989,7 @@ func (s *Store) GetRepoByGithub(ctx context.Context, githubRepoID int) (domain.G
 
 func (s *Store) GetRepoByID(ctx context.Context, workspaceID string, repoID string) (domain.GithubRepository, error) {
 	var repo domain.GithubRepository
-	query, args, err := s.sq.Select("id", "githubId", "fullName", "private", "branch", "installationId", "status").
+	query, args, err := s.sq.Select("id", "githubId", "fullName", "private", "branch", "installationId", "status", "clusterId", "protected", "restartOnSecretChange").
 		From("installedRepos").
 		Where(sq.Eq{"id": repoID, "workspaceId": workspaceID}).
 		ToSql()
@@ -769,7 +999,7 @@ func (s *Store) GetRepoByID(ctx context.Context, workspaceID string, repoID stri
 
 	row := s.db.QueryRowContext(ctx, query, args...)
 	if err := row.Scan(&repo.TreenqID, &repo.ID, &repo.FullName,
-		&repo.Private, &repo.Branch, &repo.InstallationID, &repo.Status); err != nil {
+		&repo.Private, &repo.Branch, &repo.InstallationID, &repo.Status, &repo.ClusterID, &repo.Protected, &repo.RestartOnSecretChange); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return repo, domain.ErrRepoNotFound
 		}
@@ -780,11 +1010,11 @@ func (s *Store) GetRepoByID(ctx context.Context, workspaceID string, repoID stri
 	return repo, nil
 }
 
-func (s *Store) SaveSecret(ctx context.Context, repoID, key, workspaceID string) error {
+func (s *Store) SaveSecret(ctx context.Context, repoID, environment, key, workspaceID string) error {
 	createdAt := now()
 	query, args, err := s.sq.Insert("secrets").
-		Columns("repoId", "key", "workspaceId", "createdAt").
-		Values(repoID, key, workspaceID, createdAt).
+		Columns("repoId", "environment", "key", "workspaceId", "createdAt").
+		Values(repoID, environment, key, workspaceID, createdAt).
 		Suffix("ON CONFLICT DO NOTHING").
 		ToSql()
 	if err != nil {
@@ -798,10 +1028,10 @@ func (s *Store) SaveSecret(ctx context.Context, repoID, key, workspaceID string)
 	return nil
 }
 
-func (s *Store) GetRepositorySecretKeys(ctx context.Context, repoID, workspaceID string) ([]string, error) {
+func (s *Store) GetRepositorySecretKeys(ctx context.Context, repoID, environment, workspaceID string) ([]string, error) {
 	query, args, err := s.sq.Select("key").
 		From("secrets").
-		Where(sq.Eq{"repoId": repoID, "workspaceId": workspaceID}).
+		Where(sq.Eq{"repoId": repoID, "environment": environment, "workspaceId": workspaceID}).
 		OrderBy("createdAt ASC").
 		ToSql()
 	if err != nil {
@@ -830,10 +1060,10 @@ func (s *Store) GetRepositorySecretKeys(ctx context.Context, repoID, workspaceID
 	return keys, nil
 }
 
-func (s *Store) RepositorySecretKeyExists(ctx context.Context, repoID, key, workspaceID string) (bool, error) {
+func (s *Store) RepositorySecretKeyExists(ctx context.Context, repoID, environment, key, workspaceID string) (bool, error) {
 	query, args, err := s.sq.Select("1").
 		From("secrets").
-		Where(sq.Eq{"repoId": repoID, "workspaceId": workspaceID, "key": key}).
+		Where(sq.Eq{"repoId": repoID, "environment": environment, "workspaceId": workspaceID, "key": key}).
 		Limit(1).
 		ToSql()
 	if err != nil {
@@ -852,9 +1082,9 @@ func (s *Store) RepositorySecretKeyExists(ctx context.Context, repoID, key, work
 	return true, nil
 }
 
-func (s *Store) RemoveSecret(ctx context.Context, repoID, key, workspaceID string) error {
+func (s *Store) RemoveSecret(ctx context.Context, repoID, environment, key, workspaceID string) error {
 	query, args, err := s.sq.Delete("secrets").
-		Where(sq.Eq{"repoId": repoID, "key": key, "workspaceId": workspaceID}).
+		Where(sq.Eq{"repoId": repoID, "environment": environment, "key": key, "workspaceId": workspaceID}).
 		ToSql()
 	if err != nil {
 		return fmt.Errorf("failed to build RemoveSecret query: %w", err)
@@ -867,191 +1097,2222 @@ func (s *Store) RemoveSecret(ctx context.Context, repoID, key, workspaceID strin
 	return nil
 }
 
-func (s *Store) RemoveInstallation(ctx context.Context, installationID int) error {
+// SaveSecretVersion stores the next version of a secret and removes the versions older than the kept ones
+func (s *Store) SaveSecretVersion(ctx context.Context, workspaceID string, version domain.SecretVersion, kept int) (domain.SecretVersion, error) {
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to start remove installation transaction: %w", err)
+		return version, fmt.Errorf("failed to start SaveSecretVersion transaction: %w", err)
 	}
-	defer func() { _ = tx.Rollback() }()
+	defer tx.Rollback()
 
-	// First get all repos for this installation
-	repoQuery, args, err := s.sq.Select("id").
-		From("installedRepos").
-		Where(sq.Eq{"installationId": installationID}).
-		ToSql()
+	version, err = s.saveSecretVersion(ctx, tx, workspaceID, version, kept)
 	if err != nil {
-		return fmt.Errorf("failed to build repo query: %w", err)
+		return version, err
 	}
 
-	rows, err := tx.QueryContext(ctx, repoQuery, args...)
+	if err := tx.Commit(); err != nil {
+		return version, fmt.Errorf("failed to commit SaveSecretVersion transaction: %w", err)
+	}
+
+	return version, nil
+}
+
+func (s *Store) saveSecretVersion(ctx context.Context, tx *sql.Tx, workspaceID string, version domain.SecretVersion, kept int) (domain.SecretVersion, error) {
+	query, args, err := s.sq.Select("COALESCE(MAX(version), 0)").
+		From("secretVersions").
+		Where(sq.Eq{"workspaceId": workspaceID, "repoId": version.RepoID, "environment": version.Environment, "key": version.Key}).
+		ToSql()
 	if err != nil {
-		return fmt.Errorf("failed to query repos: %w", err)
+		return version, fmt.Errorf("failed to build last secret version query: %w", err)
+	}
+	var last int
+	if err := tx.QueryRowContext(ctx, query, args...).Scan(&last); err != nil {
+		return version, fmt.Errorf("failed to get last secret version: %w", err)
 	}
-	defer rows.Close()
 
-	var repoIDs []string
-	for rows.Next() {
-		var repoID string
-		if err := rows.Scan(&repoID); err != nil {
-			return fmt.Errorf("failed to scan repo ID: %w", err)
-		}
-		repoIDs = append(repoIDs, repoID)
+	version.ID = xid.New().String()
+	version.Version = last + 1
+	version.CreatedAt = now()
+	query, args, err = s.sq.Insert("secretVersions").
+		Columns("id", "workspaceId", "repoId", "environment", "key", "version", "value", "fromVersion", "authorId", "authorName", "createdAt").
+		Values(version.ID, workspaceID, version.RepoID, version.Environment, version.Key, version.Version, version.Value, version.FromVersion, version.AuthorID, version.AuthorName, version.CreatedAt).
+		ToSql()
+	if err != nil {
+		return version, fmt.Errorf("failed to build SaveSecretVersion query: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return version, fmt.Errorf("failed to exec SaveSecretVersion: %w", err)
 	}
 
-	if err := rows.Err(); err != nil {
-		return fmt.Errorf("failed to iterate repos: %w", err)
+	query, args, err = s.sq.Delete("secretVersions").
+		Where(sq.And{
+			sq.Eq{"workspaceId": workspaceID, "repoId": version.RepoID, "environment": version.Environment, "key": version.Key},
+			sq.LtOrEq{"version": version.Version - kept},
+		}).
+		ToSql()
+	if err != nil {
+		return version, fmt.Errorf("failed to build prune secret versions query: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return version, fmt.Errorf("failed to prune secret versions: %w", err)
 	}
 
-	// Delete all related data for each repo
-	for _, repoID := range repoIDs {
-		// Delete secrets
-		if _, err := s.sq.Delete("secrets").
-			Where(sq.Eq{"repoId": repoID}).
-			RunWith(tx).
-			ExecContext(ctx); err != nil {
-			return fmt.Errorf("failed to delete secrets for repo %s: %w", repoID, err)
-		}
+	return version, nil
+}
 
-		// Delete spaces
-		if _, err := s.sq.Delete("spaces").
-			Where(sq.Eq{"repoId": repoID}).
-			RunWith(tx).
-			ExecContext(ctx); err != nil {
-			return fmt.Errorf("failed to delete spaces for repo %s: %w", repoID, err)
-		}
+// ImportSecrets saves the keys and the new versions of many secrets of a repo environment in one transaction
+func (s *Store) ImportSecrets(ctx context.Context, workspaceID string, versions []domain.SecretVersion, kept int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start ImportSecrets transaction: %w", err)
+	}
+	defer tx.Rollback()
 
-		// Delete deployments
-		if _, err := s.sq.Delete("deployments").
-			Where(sq.Eq{"repoId": repoID}).
+	createdAt := now()
+	for _, version := range versions {
+		if _, err := s.sq.Insert("secrets").
+			Columns("repoId", "environment", "key", "workspaceId", "createdAt").
+			Values(version.RepoID, version.Environment, version.Key, workspaceID, createdAt).
+			Suffix("ON CONFLICT DO NOTHING").
 			RunWith(tx).
 			ExecContext(ctx); err != nil {
-			return fmt.Errorf("failed to delete deployments for repo %s: %w", repoID, err)
+			return fmt.Errorf("failed to save imported secret %s: %w", version.Key, err)
+		}
+		if _, err := s.saveSecretVersion(ctx, tx, workspaceID, version, kept); err != nil {
+			return err
 		}
-	}
-
-	// Delete all repos for this installation
-	if _, err := s.sq.Delete("installedRepos").
-		Where(sq.Eq{"installationId": installationID}).
-		RunWith(tx).
-		ExecContext(ctx); err != nil {
-		return fmt.Errorf("failed to delete repos: %w", err)
-	}
-
-	// Finally delete the installation
-	if _, err := s.sq.Delete("installations").
-		Where(sq.Eq{"githubId": installationID}).
-		RunWith(tx).
-		ExecContext(ctx); err != nil {
-		return fmt.Errorf("failed to delete installation: %w", err)
 	}
 
 	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit RemoveInstallation: %w", err)
+		return fmt.Errorf("failed to commit ImportSecrets transaction: %w", err)
 	}
 
 	return nil
 }
 
-func (s *Store) GetUserWorkspaces(ctx context.Context, userID string) ([]domain.Workspace, error) {
-	query, args, err := s.sq.Select("w.id", "w.name", "w.githubOrgName", "wu.role").
-		From("workspaces w").
-		Join("workspaceUsers wu ON w.id = wu.workspaceId").
-		Where(sq.Eq{"wu.userId": userID}).
+// GetSecretVersions gives the kept versions of a secret, the latest first
+func (s *Store) GetSecretVersions(ctx context.Context, workspaceID, repoID, environment, key string) ([]domain.SecretVersion, error) {
+	query, args, err := s.sq.Select("id", "repoId", "environment", "key", "version", "value", "fromVersion", "authorId", "authorName", "createdAt").
+		From("secretVersions").
+		Where(sq.Eq{"workspaceId": workspaceID, "repoId": repoID, "environment": environment, "key": key}).
+		OrderBy("version DESC").
 		ToSql()
 	if err != nil {
-		return nil, fmt.Errorf("failed to build GetUserWorkspaces query: %w", err)
+		return nil, fmt.Errorf("failed to build GetSecretVersions query: %w", err)
 	}
 
 	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query GetUserWorkspaces: %w", err)
+		return nil, fmt.Errorf("failed to query GetSecretVersions: %w", err)
 	}
 	defer rows.Close()
 
-	var workspaces []domain.Workspace
-	var personal domain.Workspace
+	versions := []domain.SecretVersion{}
 	for rows.Next() {
-		var workspace domain.Workspace
-		var githubOrgName string
-		if err := rows.Scan(&workspace.ID, &workspace.Name, &githubOrgName, &workspace.Role); err != nil {
-			return nil, fmt.Errorf("failed to scan GetUserWorkspaces row: %w", err)
-		}
-		if githubOrgName != "" {
-			workspace.GithubOrgName = githubOrgName
-		}
-		// default workspace is personal and ever goes first
-		if workspace.Name == personalWorkspaceName {
-			personal = workspace
-		} else {
-			workspaces = append(workspaces, workspace)
+		var v domain.SecretVersion
+		if err := rows.Scan(&v.ID, &v.RepoID, &v.Environment, &v.Key, &v.Version, &v.Value, &v.FromVersion, &v.AuthorID, &v.AuthorName, &v.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan GetSecretVersions row: %w", err)
 		}
+		versions = append(versions, v)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("failed to iterate GetUserWorkspaces rows: %w", err)
+		return nil, fmt.Errorf("an error occurred while iterating GetSecretVersions rows: %w", err)
 	}
 
-	return append([]domain.Workspace{personal}, workspaces...), nil
+	return versions, nil
 }
 
-func (s *Store) GetDefaultWorkspace(ctx context.Context, userID string) (domain.Workspace, error) {
-	query, args, err := s.sq.Select("w.id", "w.name", "w.githubOrgName", "wu.role").
-		From("workspaces w").
-		Join("workspaceUsers wu ON w.id = wu.workspaceId").
-		Where(sq.Eq{"wu.userId": userID, "w.name": personalWorkspaceName}).
+func (s *Store) GetSecretVersion(ctx context.Context, workspaceID, repoID, environment, key string, version int) (domain.SecretVersion, error) {
+	query, args, err := s.sq.Select("id", "repoId", "environment", "key", "version", "value", "fromVersion", "authorId", "authorName", "createdAt").
+		From("secretVersions").
+		Where(sq.Eq{"workspaceId": workspaceID, "repoId": repoID, "environment": environment, "key": key, "version": version}).
 		ToSql()
 	if err != nil {
-		return domain.Workspace{}, fmt.Errorf("failed to build GetDefaultWorkspace query: %w", err)
+		return domain.SecretVersion{}, fmt.Errorf("failed to build GetSecretVersion query: %w", err)
 	}
 
-	var workspace domain.Workspace
-	var githubOrgName string
-	if err := s.db.QueryRowContext(ctx, query, args...).Scan(&workspace.ID, &workspace.Name, &githubOrgName, &workspace.Role); err != nil {
+	var v domain.SecretVersion
+	if err := s.db.QueryRowContext(ctx, query, args...).Scan(&v.ID, &v.RepoID, &v.Environment, &v.Key, &v.Version, &v.Value, &v.FromVersion, &v.AuthorID, &v.AuthorName, &v.CreatedAt); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return workspace, domain.ErrWorkspaceNotFound
+			return v, domain.ErrSecretVersionNotFound
 		}
-		return workspace, fmt.Errorf("failed to scan GetDefaultWorkspace: %w", err)
+		return v, fmt.Errorf("failed to scan GetSecretVersion: %w", err)
 	}
 
-	if githubOrgName != "" {
-		workspace.GithubOrgName = githubOrgName
-	}
-
-	return workspace, nil
+	return v, nil
 }
 
-func (s *Store) GetWorkspaceByID(ctx context.Context, workspaceID string) (domain.Workspace, error) {
-	query, args, err := s.sq.Select("id", "name", "githubOrgName").
-		From("workspaces").
-		Where(sq.Eq{"id": workspaceID}).
+// GetCurrentSecretVersions gives the latest version of every existing secret of the repo environment,
+// the secrets set before the versioning have no versions and are omitted
+func (s *Store) GetCurrentSecretVersions(ctx context.Context, workspaceID, repoID, environment string) (map[string]int, error) {
+	query, args, err := s.sq.Select("v.key", "MAX(v.version)").
+		From("secretVersions v").
+		Join("secrets s ON s.repoId = v.repoId AND s.environment = v.environment AND s.key = v.key").
+		Where(sq.Eq{"v.workspaceId": workspaceID, "v.repoId": repoID, "v.environment": environment}).
+		GroupBy("v.key").
 		ToSql()
 	if err != nil {
-		return domain.Workspace{}, fmt.Errorf("failed to build GetWorkspaceByID query: %w", err)
+		return nil, fmt.Errorf("failed to build GetCurrentSecretVersions query: %w", err)
 	}
 
-	var workspace domain.Workspace
-	var githubOrgName string
-	if err := s.db.QueryRowContext(ctx, query, args...).Scan(&workspace.ID, &workspace.Name, &githubOrgName); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return workspace, domain.ErrWorkspaceNotFound
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query GetCurrentSecretVersions: %w", err)
+	}
+	defer rows.Close()
+
+	versions := make(map[string]int)
+	for rows.Next() {
+		var key string
+		var version int
+		if err := rows.Scan(&key, &version); err != nil {
+			return nil, fmt.Errorf("failed to scan GetCurrentSecretVersions row: %w", err)
 		}
-		return workspace, fmt.Errorf("failed to scan GetWorkspaceByID: %w", err)
+		versions[key] = version
 	}
 
-	if githubOrgName != "" {
-		workspace.GithubOrgName = githubOrgName
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("an error occurred while iterating GetCurrentSecretVersions rows: %w", err)
 	}
 
-	return workspace, nil
+	return versions, nil
 }
 
-func (s *Store) GetWorkspaceByUserDisplayName(ctx context.Context, userDisplayName string) (domain.Workspace, error) {
-	query, args, err := s.sq.Select("w.id", "w.name", "w.githubOrgName", "wu.role").
-		From("workspaces w").
-		Join("workspaceUsers wu ON w.id = wu.workspaceId").
-		Join("users u ON wu.userId = u.id").
-		Where(sq.Eq{"u.displayName": userDisplayName}).
-		Limit(1).
+func (s *Store) SaveSecretGroup(ctx context.Context, workspaceID, name string) (domain.SecretGroup, error) {
+	group := domain.SecretGroup{
+		ID:        xid.New().String(),
+		Name:      name,
+		Keys:      []string{},
+		CreatedAt: now(),
+	}
+	query, args, err := s.sq.Insert("secretGroups").
+		Columns("id", "workspaceId", "name", "createdAt").
+		Values(group.ID, workspaceID, group.Name, group.CreatedAt).
+		Suffix("ON CONFLICT (workspaceId, name) DO NOTHING RETURNING id").
+		ToSql()
+	if err != nil {
+		return group, fmt.Errorf("failed to build SaveSecretGroup query: %w", err)
+	}
+
+	if err := s.db.QueryRowContext(ctx, query, args...).Scan(&group.ID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return group, domain.ErrSecretGroupExists
+		}
+		return group, fmt.Errorf("failed to exec SaveSecretGroup: %w", err)
+	}
+
+	return group, nil
+}
+
+// GetSecretGroups gives the workspace secret groups with their keys ordered by name
+func (s *Store) GetSecretGroups(ctx context.Context, workspaceID string) ([]domain.SecretGroup, error) {
+	query, args, err := s.sq.Select("g.id", "g.name", "g.createdAt", "v.key").
+		From("secretGroups g").
+		LeftJoin("secretGroupValues v ON v.groupId = g.id").
+		Where(sq.Eq{"g.workspaceId": workspaceID}).
+		OrderBy("g.name ASC", "v.key ASC").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build GetSecretGroups query: %w", err)
+	}
+
+	return s.querySecretGroups(ctx, "GetSecretGroups", query, args)
+}
+
+// GetAttachedSecretGroups gives the secret groups attached to the repo environment in their attachment order
+func (s *Store) GetAttachedSecretGroups(ctx context.Context, workspaceID, repoID, environment string) ([]domain.SecretGroup, error) {
+	query, args, err := s.sq.Select("g.id", "g.name", "g.createdAt", "v.key").
+		From("repoSecretGroups a").
+		Join("secretGroups g ON g.id = a.groupId").
+		LeftJoin("secretGroupValues v ON v.groupId = g.id").
+		Where(sq.Eq{"a.workspaceId": workspaceID, "a.repoId": repoID, "a.environment": environment}).
+		OrderBy("a.position ASC", "v.key ASC").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build GetAttachedSecretGroups query: %w", err)
+	}
+
+	return s.querySecretGroups(ctx, "GetAttachedSecretGroups", query, args)
+}
+
+// querySecretGroups collects the groups of the rows ordered by group with a nullable key each
+func (s *Store) querySecretGroups(ctx context.Context, name, query string, args []any) ([]domain.SecretGroup, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", name, err)
+	}
+	defer rows.Close()
+
+	groups := []domain.SecretGroup{}
+	for rows.Next() {
+		var group domain.SecretGroup
+		var key sql.NullString
+		if err := rows.Scan(&group.ID, &group.Name, &group.CreatedAt, &key); err != nil {
+			return nil, fmt.Errorf("failed to scan %s row: %w", name, err)
+		}
+		if len(groups) == 0 || groups[len(groups)-1].ID != group.ID {
+			group.Keys = []string{}
+			groups = append(groups, group)
+		}
+		if key.Valid {
+			last := &groups[len(groups)-1]
+			last.Keys = append(last.Keys, key.String)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("an error occurred while iterating %s rows: %w", name, err)
+	}
+
+	return groups, nil
+}
+
+// RemoveSecretGroup removes a group with its values and attachments
+func (s *Store) RemoveSecretGroup(ctx context.Context, workspaceID, groupID string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start RemoveSecretGroup transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"repoSecretGroups", "secretGroupValues"} {
+		if _, err := s.sq.Delete(table).
+			Where(sq.Eq{"workspaceId": workspaceID, "groupId": groupID}).
+			RunWith(tx).
+			ExecContext(ctx); err != nil {
+			return fmt.Errorf("failed to delete secret group %s: %w", table, err)
+		}
+	}
+
+	res, err := s.sq.Delete("secretGroups").
+		Where(sq.Eq{"workspaceId": workspaceID, "id": groupID}).
+		RunWith(tx).
+		ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to exec RemoveSecretGroup: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get RemoveSecretGroup affected rows: %w", err)
+	}
+	if affected == 0 {
+		return domain.ErrSecretGroupNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit RemoveSecretGroup transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) secretGroupExists(ctx context.Context, q sq.BaseRunner, workspaceID, groupID string) error {
+	var exists int
+	err := s.sq.Select("1").
+		From("secretGroups").
+		Where(sq.Eq{"workspaceId": workspaceID, "id": groupID}).
+		RunWith(q).
+		QueryRowContext(ctx).
+		Scan(&exists)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.ErrSecretGroupNotFound
+		}
+		return fmt.Errorf("failed to query secret group: %w", err)
+	}
+
+	return nil
+}
+
+// SetGroupSecret creates or replaces an encrypted group secret value
+func (s *Store) SetGroupSecret(ctx context.Context, workspaceID, groupID, key string, value []byte) error {
+	if err := s.secretGroupExists(ctx, s.db, workspaceID, groupID); err != nil {
+		return err
+	}
+
+	updatedAt := now()
+	query, args, err := s.sq.Insert("secretGroupValues").
+		Columns("groupId", "workspaceId", "key", "value", "createdAt", "updatedAt").
+		Values(groupID, workspaceID, key, value, updatedAt, updatedAt).
+		Suffix("ON CONFLICT (groupId, key) DO UPDATE SET value = EXCLUDED.value, updatedAt = EXCLUDED.updatedAt").
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build SetGroupSecret query: %w", err)
+	}
+
+	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to exec SetGroupSecret: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) RemoveGroupSecret(ctx context.Context, workspaceID, groupID, key string) error {
+	query, args, err := s.sq.Delete("secretGroupValues").
+		Where(sq.Eq{"workspaceId": workspaceID, "groupId": groupID, "key": key}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build RemoveGroupSecret query: %w", err)
+	}
+
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to exec RemoveGroupSecret: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get RemoveGroupSecret affected rows: %w", err)
+	}
+	if affected == 0 {
+		return domain.ErrSecretNotFound
+	}
+
+	return nil
+}
+
+// AttachSecretGroup attaches a group to the repo environment after the attached ones, attaching it again changes nothing
+func (s *Store) AttachSecretGroup(ctx context.Context, workspaceID, repoID, environment, groupID string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start AttachSecretGroup transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := s.secretGroupExists(ctx, tx, workspaceID, groupID); err != nil {
+		return err
+	}
+
+	var position int
+	if err := s.sq.Select("COALESCE(MAX(position), 0)").
+		From("repoSecretGroups").
+		Where(sq.Eq{"repoId": repoID, "environment": environment}).
+		RunWith(tx).
+		QueryRowContext(ctx).
+		Scan(&position); err != nil {
+		return fmt.Errorf("failed to get last secret group position: %w", err)
+	}
+
+	if _, err := s.sq.Insert("repoSecretGroups").
+		Columns("repoId", "environment", "groupId", "workspaceId", "position", "createdAt").
+		Values(repoID, environment, groupID, workspaceID, position+1, now()).
+		Suffix("ON CONFLICT DO NOTHING").
+		RunWith(tx).
+		ExecContext(ctx); err != nil {
+		return fmt.Errorf("failed to exec AttachSecretGroup: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit AttachSecretGroup transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) DetachSecretGroup(ctx context.Context, workspaceID, repoID, environment, groupID string) error {
+	query, args, err := s.sq.Delete("repoSecretGroups").
+		Where(sq.Eq{"workspaceId": workspaceID, "repoId": repoID, "environment": environment, "groupId": groupID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build DetachSecretGroup query: %w", err)
+	}
+
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to exec DetachSecretGroup: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get DetachSecretGroup affected rows: %w", err)
+	}
+	if affected == 0 {
+		return domain.ErrSecretGroupNotFound
+	}
+
+	return nil
+}
+
+// GetAttachedGroupSecrets gives the encrypted secrets of the groups attached to the repo environment in their attachment order
+func (s *Store) GetAttachedGroupSecrets(ctx context.Context, workspaceID, repoID, environment string) ([]domain.GroupSecret, error) {
+	query, args, err := s.sq.Select("g.id", "g.name", "v.key", "v.value").
+		From("repoSecretGroups a").
+		Join("secretGroups g ON g.id = a.groupId").
+		Join("secretGroupValues v ON v.groupId = g.id").
+		Where(sq.Eq{"a.workspaceId": workspaceID, "a.repoId": repoID, "a.environment": environment}).
+		OrderBy("a.position ASC", "v.key ASC").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build GetAttachedGroupSecrets query: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query GetAttachedGroupSecrets: %w", err)
+	}
+	defer rows.Close()
+
+	var secrets []domain.GroupSecret
+	for rows.Next() {
+		var secret domain.GroupSecret
+		if err := rows.Scan(&secret.GroupID, &secret.Group, &secret.Key, &secret.Value); err != nil {
+			return nil, fmt.Errorf("failed to scan GetAttachedGroupSecrets row: %w", err)
+		}
+		secrets = append(secrets, secret)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("an error occurred while iterating GetAttachedGroupSecrets rows: %w", err)
+	}
+
+	return secrets, nil
+}
+
+func (s *Store) SaveRegistryCredentials(ctx context.Context, workspaceID, registry, username string) error {
+	query, args, err := s.sq.Insert("registryCredentials").
+		Columns("workspaceId", "registry", "username", "createdAt").
+		Values(workspaceID, registry, username, now()).
+		Suffix("ON CONFLICT (workspaceId, registry) DO UPDATE SET username = EXCLUDED.username").
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build SaveRegistryCredentials query: %w", err)
+	}
+
+	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to exec SaveRegistryCredentials: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) GetRegistryCredentials(ctx context.Context, workspaceID string) ([]domain.RegistryCredentials, error) {
+	query, args, err := s.sq.Select("registry", "username").
+		From("registryCredentials").
+		Where(sq.Eq{"workspaceId": workspaceID}).
+		OrderBy("createdAt ASC").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build GetRegistryCredentials query: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query GetRegistryCredentials: %w", err)
+	}
+	defer rows.Close()
+
+	var creds []domain.RegistryCredentials
+	for rows.Next() {
+		var c domain.RegistryCredentials
+		if err := rows.Scan(&c.Registry, &c.Username); err != nil {
+			return nil, fmt.Errorf("failed to scan GetRegistryCredentials row: %w", err)
+		}
+		creds = append(creds, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("an error occurred while iterating GetRegistryCredentials rows: %w", err)
+	}
+
+	return creds, nil
+}
+
+func (s *Store) GetRegistryCredentialsByRegistry(ctx context.Context, workspaceID, registry string) (domain.RegistryCredentials, error) {
+	query, args, err := s.sq.Select("registry", "username").
+		From("registryCredentials").
+		Where(sq.Eq{"workspaceId": workspaceID, "registry": registry}).
+		ToSql()
+	if err != nil {
+		return domain.RegistryCredentials{}, fmt.Errorf("failed to build GetRegistryCredentialsByRegistry query: %w", err)
+	}
+
+	var creds domain.RegistryCredentials
+	if err := s.db.QueryRowContext(ctx, query, args...).Scan(&creds.Registry, &creds.Username); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return creds, domain.ErrRegistryCredentialsNotFound
+		}
+		return creds, fmt.Errorf("failed to scan GetRegistryCredentialsByRegistry: %w", err)
+	}
+
+	return creds, nil
+}
+
+func (s *Store) RemoveRegistryCredentials(ctx context.Context, workspaceID, registry string) error {
+	query, args, err := s.sq.Delete("registryCredentials").
+		Where(sq.Eq{"workspaceId": workspaceID, "registry": registry}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build RemoveRegistryCredentials query: %w", err)
+	}
+
+	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to exec RemoveRegistryCredentials: %w", err)
+	}
+
+	return nil
+}
+
+// SaveWorkspaceSecretStore selects the store the workspace keeps its repo secret values in
+func (s *Store) SaveWorkspaceSecretStore(ctx context.Context, workspaceID string, store domain.WorkspaceSecretStore) (domain.WorkspaceSecretStore, error) {
+	store.UpdatedAt = now()
+	query, args, err := s.sq.Insert("workspaceSecretStores").
+		Columns("workspaceId", "kind", "vaultAddress", "vaultMount", "vaultPathPrefix", "vaultRole", "vaultToken", "updatedAt").
+		Values(workspaceID, store.Kind, store.VaultAddress, store.VaultMount, store.VaultPathPrefix, store.VaultRole, store.VaultToken, store.UpdatedAt).
+		Suffix(`ON CONFLICT (workspaceId) DO UPDATE SET kind = EXCLUDED.kind, vaultAddress = EXCLUDED.vaultAddress,
+			vaultMount = EXCLUDED.vaultMount, vaultPathPrefix = EXCLUDED.vaultPathPrefix, vaultRole = EXCLUDED.vaultRole,
+			vaultToken = EXCLUDED.vaultToken, updatedAt = EXCLUDED.updatedAt`).
+		ToSql()
+	if err != nil {
+		return store, fmt.Errorf("failed to build SaveWorkspaceSecretStore query: %w", err)
+	}
+
+	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+		return store, fmt.Errorf("failed to exec SaveWorkspaceSecretStore: %w", err)
+	}
+
+	return store, nil
+}
+
+func (s *Store) GetWorkspaceSecretStore(ctx context.Context, workspaceID string) (domain.WorkspaceSecretStore, error) {
+	query, args, err := s.sq.Select("kind", "vaultAddress", "vaultMount", "vaultPathPrefix", "vaultRole", "vaultToken", "updatedAt").
+		From("workspaceSecretStores").
+		Where(sq.Eq{"workspaceId": workspaceID}).
+		ToSql()
+	if err != nil {
+		return domain.WorkspaceSecretStore{}, fmt.Errorf("failed to build GetWorkspaceSecretStore query: %w", err)
+	}
+
+	var store domain.WorkspaceSecretStore
+	if err := s.db.QueryRowContext(ctx, query, args...).Scan(
+		&store.Kind, &store.VaultAddress, &store.VaultMount, &store.VaultPathPrefix, &store.VaultRole, &store.VaultToken, &store.UpdatedAt,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return store, domain.ErrSecretStoreNotFound
+		}
+		return store, fmt.Errorf("failed to scan GetWorkspaceSecretStore: %w", err)
+	}
+
+	return store, nil
+}
+
+// CountWorkspaceSecrets counts the repo secrets of all the repos and environments of the workspace
+func (s *Store) CountWorkspaceSecrets(ctx context.Context, workspaceID string) (int, error) {
+	query, args, err := s.sq.Select("count(*)").
+		From("secrets").
+		Where(sq.Eq{"workspaceId": workspaceID}).
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build CountWorkspaceSecrets query: %w", err)
+	}
+
+	var count int
+	if err := s.db.QueryRowContext(ctx, query, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to scan CountWorkspaceSecrets: %w", err)
+	}
+
+	return count, nil
+}
+
+func (s *Store) SaveCluster(ctx context.Context, workspaceID string, cluster domain.Cluster) (domain.Cluster, error) {
+	cluster.ID = xid.New().String()
+	cluster.CreatedAt = now()
+
+	query, args, err := s.sq.Insert("clusters").
+		Columns("id", "workspaceId", "name", "kubeConfig", "createdAt").
+		Values(cluster.ID, workspaceID, cluster.Name, cluster.KubeConfig, cluster.CreatedAt).
+		Suffix("ON CONFLICT (workspaceId, name) DO NOTHING RETURNING id, createdAt").
+		ToSql()
+	if err != nil {
+		return domain.Cluster{}, fmt.Errorf("failed to build SaveCluster query: %w", err)
+	}
+
+	if err := s.db.QueryRowContext(ctx, query, args...).Scan(&cluster.ID, &cluster.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.Cluster{}, domain.ErrClusterExists
+		}
+		return domain.Cluster{}, fmt.Errorf("failed to exec SaveCluster: %w", err)
+	}
+
+	return cluster, nil
+}
+
+func (s *Store) GetClusters(ctx context.Context, workspaceID string) ([]domain.Cluster, error) {
+	query, args, err := s.sq.Select("id", "name", "createdAt").
+		From("clusters").
+		Where(sq.Eq{"workspaceId": workspaceID}).
+		OrderBy("createdAt ASC").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build GetClusters query: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query GetClusters: %w", err)
+	}
+	defer rows.Close()
+
+	clusters := []domain.Cluster{}
+	for rows.Next() {
+		var cluster domain.Cluster
+		if err := rows.Scan(&cluster.ID, &cluster.Name, &cluster.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan GetClusters row: %w", err)
+		}
+		clusters = append(clusters, cluster)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("an error occurred while iterating GetClusters rows: %w", err)
+	}
+
+	return clusters, nil
+}
+
+func (s *Store) GetCluster(ctx context.Context, workspaceID, clusterID string) (domain.Cluster, error) {
+	query, args, err := s.sq.Select("id", "name", "kubeConfig", "createdAt").
+		From("clusters").
+		Where(sq.Eq{"workspaceId": workspaceID, "id": clusterID}).
+		ToSql()
+	if err != nil {
+		return domain.Cluster{}, fmt.Errorf("failed to build GetCluster query: %w", err)
+	}
+
+	var cluster domain.Cluster
+	if err := s.db.QueryRowContext(ctx, query, args...).Scan(&cluster.ID, &cluster.Name, &cluster.KubeConfig, &cluster.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return cluster, domain.ErrClusterNotFound
+		}
+		return cluster, fmt.Errorf("failed to scan GetCluster: %w", err)
+	}
+
+	return cluster, nil
+}
+
+func (s *Store) RemoveCluster(ctx context.Context, workspaceID, clusterID string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start RemoveCluster transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query, args, err := s.sq.Select("count(*)").
+		From("installedRepos").
+		Where(sq.Eq{"workspaceId": workspaceID, "clusterId": clusterID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build cluster repos query: %w", err)
+	}
+
+	var repos int
+	if err := tx.QueryRowContext(ctx, query, args...).Scan(&repos); err != nil {
+		return fmt.Errorf("failed to count cluster repos: %w", err)
+	}
+	if repos > 0 {
+		return domain.ErrClusterInUse
+	}
+
+	query, args, err = s.sq.Delete("clusters").
+		Where(sq.Eq{"workspaceId": workspaceID, "id": clusterID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build RemoveCluster query: %w", err)
+	}
+
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to exec RemoveCluster: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get RemoveCluster affected rows: %w", err)
+	}
+	if affected == 0 {
+		return domain.ErrClusterNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit RemoveCluster: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) SetRepoCluster(ctx context.Context, workspaceID, repoID, clusterID string) error {
+	query, args, err := s.sq.Update("installedRepos").
+		Set("clusterId", clusterID).
+		Where(sq.Eq{"id": repoID, "workspaceId": workspaceID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build SetRepoCluster query: %w", err)
+	}
+
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to exec SetRepoCluster: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get SetRepoCluster affected rows: %w", err)
+	}
+	if affected == 0 {
+		return domain.ErrRepoNotFound
+	}
+
+	return nil
+}
+
+func (s *Store) SetRepoProtected(ctx context.Context, workspaceID, repoID string, protected bool) error {
+	query, args, err := s.sq.Update("installedRepos").
+		Set("protected", protected).
+		Where(sq.Eq{"id": repoID, "workspaceId": workspaceID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build SetRepoProtected query: %w", err)
+	}
+
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to exec SetRepoProtected: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get SetRepoProtected affected rows: %w", err)
+	}
+	if affected == 0 {
+		return domain.ErrRepoNotFound
+	}
+
+	return nil
+}
+
+func (s *Store) SetRepoRestartOnSecretChange(ctx context.Context, workspaceID, repoID string, restart bool) error {
+	query, args, err := s.sq.Update("installedRepos").
+		Set("restartOnSecretChange", restart).
+		Where(sq.Eq{"id": repoID, "workspaceId": workspaceID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build SetRepoRestartOnSecretChange query: %w", err)
+	}
+
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to exec SetRepoRestartOnSecretChange: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get SetRepoRestartOnSecretChange affected rows: %w", err)
+	}
+	if affected == 0 {
+		return domain.ErrRepoNotFound
+	}
+
+	return nil
+}
+
+func (s *Store) SaveEnvironment(ctx context.Context, env domain.Environment) (domain.Environment, error) {
+	overrides, err := json.Marshal(env.Overrides)
+	if err != nil {
+		return env, fmt.Errorf("failed to marshal environment overrides to json: %w", err)
+	}
+
+	env.ID = xid.New().String()
+	env.CreatedAt = now()
+	query, args, err := s.sq.Insert("environments").
+		Columns("id", "repoId", "workspaceId", "name", "branch", "tagPrefix", "overrides", "requiredApprover", "protected", "createdAt", "updatedAt").
+		Values(env.ID, env.RepoID, env.WorkspaceID, env.Name, env.Branch, env.TagPrefix, string(overrides), env.RequiredApprover, env.Protected, env.CreatedAt, env.CreatedAt).
+		Suffix("ON CONFLICT (repoId, name) DO NOTHING RETURNING id").
+		ToSql()
+	if err != nil {
+		return env, fmt.Errorf("failed to build SaveEnvironment query: %w", err)
+	}
+
+	if err := s.db.QueryRowContext(ctx, query, args...).Scan(&env.ID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return env, domain.ErrEnvironmentExists
+		}
+		return env, fmt.Errorf("failed to exec SaveEnvironment: %w", err)
+	}
+
+	return env, nil
+}
+
+func (s *Store) UpdateEnvironment(ctx context.Context, env domain.Environment) error {
+	overrides, err := json.Marshal(env.Overrides)
+	if err != nil {
+		return fmt.Errorf("failed to marshal environment overrides to json: %w", err)
+	}
+
+	query, args, err := s.sq.Update("environments").
+		Set("branch", env.Branch).
+		Set("tagPrefix", env.TagPrefix).
+		Set("overrides", string(overrides)).
+		Set("requiredApprover", env.RequiredApprover).
+		Set("protected", env.Protected).
+		Set("updatedAt", now()).
+		Where(sq.Eq{"workspaceId": env.WorkspaceID, "repoId": env.RepoID, "name": env.Name}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build UpdateEnvironment query: %w", err)
+	}
+
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to exec UpdateEnvironment: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get UpdateEnvironment affected rows: %w", err)
+	}
+	if affected == 0 {
+		return domain.ErrEnvironmentNotFound
+	}
+
+	return nil
+}
+
+var environmentColumns = []string{"id", "repoId", "workspaceId", "name", "branch", "tagPrefix", "overrides", "requiredApprover", "protected", "createdAt"}
+
+func scanEnvironment(row interface{ Scan(...any) error }) (domain.Environment, error) {
+	var env domain.Environment
+	var overrides string
+	if err := row.Scan(&env.ID, &env.RepoID, &env.WorkspaceID, &env.Name, &env.Branch, &env.TagPrefix, &overrides, &env.RequiredApprover, &env.Protected, &env.CreatedAt); err != nil {
+		return env, err
+	}
+	if err := json.Unmarshal([]byte(overrides), &env.Overrides); err != nil {
+		return env, fmt.Errorf("failed to unmarshal environment overrides: %w", err)
+	}
+	return env, nil
+}
+
+func (s *Store) GetEnvironment(ctx context.Context, workspaceID, repoID, name string) (domain.Environment, error) {
+	query, args, err := s.sq.Select(environmentColumns...).
+		From("environments").
+		Where(sq.Eq{"workspaceId": workspaceID, "repoId": repoID, "name": name}).
+		ToSql()
+	if err != nil {
+		return domain.Environment{}, fmt.Errorf("failed to build GetEnvironment query: %w", err)
+	}
+
+	env, err := scanEnvironment(s.db.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return env, domain.ErrEnvironmentNotFound
+		}
+		return env, fmt.Errorf("failed to scan GetEnvironment: %w", err)
+	}
+
+	return env, nil
+}
+
+func (s *Store) GetEnvironments(ctx context.Context, repoID string) ([]domain.Environment, error) {
+	query, args, err := s.sq.Select(environmentColumns...).
+		From("environments").
+		Where(sq.Eq{"repoId": repoID}).
+		OrderBy("createdAt ASC").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build GetEnvironments query: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query GetEnvironments: %w", err)
+	}
+	defer rows.Close()
+
+	envs := []domain.Environment{}
+	for rows.Next() {
+		env, err := scanEnvironment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan GetEnvironments row: %w", err)
+		}
+		envs = append(envs, env)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("an error occurred while iterating GetEnvironments rows: %w", err)
+	}
+
+	return envs, nil
+}
+
+func (s *Store) RemoveEnvironment(ctx context.Context, workspaceID, repoID, name string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start RemoveEnvironment transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := s.sq.Delete("secrets").
+		Where(sq.Eq{"workspaceId": workspaceID, "repoId": repoID, "environment": name}).
+		RunWith(tx).
+		ExecContext(ctx); err != nil {
+		return fmt.Errorf("failed to delete environment secrets: %w", err)
+	}
+	if _, err := s.sq.Delete("secretVersions").
+		Where(sq.Eq{"workspaceId": workspaceID, "repoId": repoID, "environment": name}).
+		RunWith(tx).
+		ExecContext(ctx); err != nil {
+		return fmt.Errorf("failed to delete environment secret versions: %w", err)
+	}
+	if _, err := s.sq.Delete("repoSecretGroups").
+		Where(sq.Eq{"workspaceId": workspaceID, "repoId": repoID, "environment": name}).
+		RunWith(tx).
+		ExecContext(ctx); err != nil {
+		return fmt.Errorf("failed to detach environment secret groups: %w", err)
+	}
+
+	res, err := s.sq.Delete("environments").
+		Where(sq.Eq{"workspaceId": workspaceID, "repoId": repoID, "name": name}).
+		RunWith(tx).
+		ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to exec RemoveEnvironment: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get RemoveEnvironment affected rows: %w", err)
+	}
+	if affected == 0 {
+		return domain.ErrEnvironmentNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit RemoveEnvironment: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) RemoveInstallation(ctx context.Context, installationID int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start remove installation transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// First get all repos for this installation
+	repoQuery, args, err := s.sq.Select("id").
+		From("installedRepos").
+		Where(sq.Eq{"installationId": installationID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build repo query: %w", err)
+	}
+
+	rows, err := tx.QueryContext(ctx, repoQuery, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query repos: %w", err)
+	}
+	defer rows.Close()
+
+	var repoIDs []string
+	for rows.Next() {
+		var repoID string
+		if err := rows.Scan(&repoID); err != nil {
+			return fmt.Errorf("failed to scan repo ID: %w", err)
+		}
+		repoIDs = append(repoIDs, repoID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate repos: %w", err)
+	}
+
+	// Delete all related data for each repo
+	for _, repoID := range repoIDs {
+		// Delete secrets
+		if _, err := s.sq.Delete("secrets").
+			Where(sq.Eq{"repoId": repoID}).
+			RunWith(tx).
+			ExecContext(ctx); err != nil {
+			return fmt.Errorf("failed to delete secrets for repo %s: %w", repoID, err)
+		}
+		if _, err := s.sq.Delete("secretVersions").
+			Where(sq.Eq{"repoId": repoID}).
+			RunWith(tx).
+			ExecContext(ctx); err != nil {
+			return fmt.Errorf("failed to delete secret versions for repo %s: %w", repoID, err)
+		}
+		if _, err := s.sq.Delete("repoSecretGroups").
+			Where(sq.Eq{"repoId": repoID}).
+			RunWith(tx).
+			ExecContext(ctx); err != nil {
+			return fmt.Errorf("failed to detach secret groups for repo %s: %w", repoID, err)
+		}
+
+		// Delete environments
+		if _, err := s.sq.Delete("environments").
+			Where(sq.Eq{"repoId": repoID}).
+			RunWith(tx).
+			ExecContext(ctx); err != nil {
+			return fmt.Errorf("failed to delete environments for repo %s: %w", repoID, err)
+		}
+
+		// Delete spaces
+		if _, err := s.sq.Delete("spaces").
+			Where(sq.Eq{"repoId": repoID}).
+			RunWith(tx).
+			ExecContext(ctx); err != nil {
+			return fmt.Errorf("failed to delete spaces for repo %s: %w", repoID, err)
+		}
+
+		// Delete deployments
+		if _, err := s.sq.Delete("deployments").
+			Where(sq.Eq{"repoId": repoID}).
+			RunWith(tx).
+			ExecContext(ctx); err != nil {
+			return fmt.Errorf("failed to delete deployments for repo %s: %w", repoID, err)
+		}
+	}
+
+	// Delete all repos for this installation
+	if _, err := s.sq.Delete("installedRepos").
+		Where(sq.Eq{"installationId": installationID}).
+		RunWith(tx).
+		ExecContext(ctx); err != nil {
+		return fmt.Errorf("failed to delete repos: %w", err)
+	}
+
+	// Finally delete the installation
+	if _, err := s.sq.Delete("installations").
+		Where(sq.Eq{"githubId": installationID}).
+		RunWith(tx).
+		ExecContext(ctx); err != nil {
+		return fmt.Errorf("failed to delete installation: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit RemoveInstallation: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) GetUserWorkspaces(ctx context.Context, userID string) ([]domain.Workspace, error) {
+	query, args, err := s.sq.Select("w.id", "w.name", "w.githubOrgName", "wu.role", "w.namespace", "w.personalOf").
+		From("workspaces w").
+		Join("workspaceUsers wu ON w.id = wu.workspaceId").
+		Where(sq.Eq{"wu.userId": userID}).
+		OrderBy("w.createdAt").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build GetUserWorkspaces query: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query GetUserWorkspaces: %w", err)
+	}
+	defer rows.Close()
+
+	var workspaces []domain.Workspace
+	var personal domain.Workspace
+	for rows.Next() {
+		var workspace domain.Workspace
+		var githubOrgName string
+		var personalOf sql.NullString
+		if err := rows.Scan(&workspace.ID, &workspace.Name, &githubOrgName, &workspace.Role, &workspace.Namespace, &personalOf); err != nil {
+			return nil, fmt.Errorf("failed to scan GetUserWorkspaces row: %w", err)
+		}
+		if githubOrgName != "" {
+			workspace.GithubOrgName = githubOrgName
+		}
+		workspace.Personal = personalOf.Valid
+		// default workspace is personal and ever goes first,
+		// the user may be a member of another user personal workspace
+		if personalOf.String == userID {
+			personal = workspace
+		} else {
+			workspaces = append(workspaces, workspace)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate GetUserWorkspaces rows: %w", err)
+	}
+
+	return append([]domain.Workspace{personal}, workspaces...), nil
+}
+
+func (s *Store) GetDefaultWorkspace(ctx context.Context, userID string) (domain.Workspace, error) {
+	query, args, err := s.sq.Select("w.id", "w.name", "w.githubOrgName", "wu.role", "w.namespace").
+		From("workspaces w").
+		Join("workspaceUsers wu ON w.id = wu.workspaceId").
+		Where(sq.Eq{"wu.userId": userID, "w.personalOf": userID}).
+		ToSql()
+	if err != nil {
+		return domain.Workspace{}, fmt.Errorf("failed to build GetDefaultWorkspace query: %w", err)
+	}
+
+	var workspace domain.Workspace
+	var githubOrgName string
+	if err := s.db.QueryRowContext(ctx, query, args...).Scan(&workspace.ID, &workspace.Name, &githubOrgName, &workspace.Role, &workspace.Namespace); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return workspace, domain.ErrWorkspaceNotFound
+		}
+		return workspace, fmt.Errorf("failed to scan GetDefaultWorkspace: %w", err)
+	}
+	workspace.Personal = true
+
+	if githubOrgName != "" {
+		workspace.GithubOrgName = githubOrgName
+	}
+
+	return workspace, nil
+}
+
+func (s *Store) GetWorkspaceByID(ctx context.Context, workspaceID string) (domain.Workspace, error) {
+	query, args, err := s.sq.Select("id", "name", "githubOrgName", "namespace", "personalOf").
+		From("workspaces").
+		Where(sq.Eq{"id": workspaceID}).
+		ToSql()
+	if err != nil {
+		return domain.Workspace{}, fmt.Errorf("failed to build GetWorkspaceByID query: %w", err)
+	}
+
+	var workspace domain.Workspace
+	var githubOrgName string
+	var personalOf sql.NullString
+	if err := s.db.QueryRowContext(ctx, query, args...).Scan(&workspace.ID, &workspace.Name, &githubOrgName, &workspace.Namespace, &personalOf); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return workspace, domain.ErrWorkspaceNotFound
+		}
+		return workspace, fmt.Errorf("failed to scan GetWorkspaceByID: %w", err)
+	}
+	workspace.Personal = personalOf.Valid
+
+	if githubOrgName != "" {
+		workspace.GithubOrgName = githubOrgName
+	}
+
+	return workspace, nil
+}
+
+// CreateWorkspace creates a workspace with the user as its owner
+func (s *Store) CreateWorkspace(ctx context.Context, ownerID, name string) (domain.Workspace, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return domain.Workspace{}, fmt.Errorf("failed to start CreateWorkspace transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	workspace := domain.Workspace{
+		ID:        xid.New().String(),
+		Name:      name,
+		Role:      domain.RoleOwner,
+		Namespace: name,
+	}
+	query, args, err := s.sq.Insert("workspaces").
+		Columns("id", "name", "githubOrgName", "namespace").
+		Values(workspace.ID, workspace.Name, "", workspace.Namespace).
+		ToSql()
+	if err != nil {
+		return domain.Workspace{}, fmt.Errorf("failed to build CreateWorkspace query: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return domain.Workspace{}, fmt.Errorf("failed to exec CreateWorkspace: %w", err)
+	}
+
+	query, args, err = s.sq.Insert("workspaceUsers").
+		Columns("workspaceId", "userId", "role").
+		Values(workspace.ID, ownerID, domain.RoleOwner).
+		ToSql()
+	if err != nil {
+		return domain.Workspace{}, fmt.Errorf("failed to build workspace user query: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return domain.Workspace{}, fmt.Errorf("failed to add user to workspace: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return domain.Workspace{}, fmt.Errorf("failed to commit CreateWorkspace: %w", err)
+	}
+
+	return workspace, nil
+}
+
+func (s *Store) RenameWorkspace(ctx context.Context, workspaceID, name string) error {
+	query, args, err := s.sq.Update("workspaces").
+		Set("name", name).
+		Set("updatedAt", now()).
+		Where(sq.Eq{"id": workspaceID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build RenameWorkspace query: %w", err)
+	}
+
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to exec RenameWorkspace: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get RenameWorkspace affected rows: %w", err)
+	}
+	if affected == 0 {
+		return domain.ErrWorkspaceNotFound
+	}
+
+	return nil
+}
+
+// RemoveWorkspace removes a workspace having no github installations along with the data bound to it
+func (s *Store) RemoveWorkspace(ctx context.Context, workspaceID string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start RemoveWorkspace transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query, args, err := s.sq.Select("count(*)").
+		From("installations").
+		Where(sq.Eq{"workspaceId": workspaceID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build workspace installations query: %w", err)
+	}
+	var installations int
+	if err := tx.QueryRowContext(ctx, query, args...).Scan(&installations); err != nil {
+		return fmt.Errorf("failed to count workspace installations: %w", err)
+	}
+	if installations > 0 {
+		return domain.ErrWorkspaceNotEmpty
+	}
+
+	for _, table := range []string{"workspaceSecretStores", "repoSecretGroups", "secretGroupValues", "secretGroups", "secretVersions", "secrets", "invitations", "apiTokens", "clusters", "registryCredentials", "workspaceUsers"} {
+		query, args, err := s.sq.Delete(table).
+			Where(sq.Eq{"workspaceId": workspaceID}).
+			ToSql()
+		if err != nil {
+			return fmt.Errorf("failed to build %s removal query: %w", table, err)
+		}
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("failed to remove workspace %s: %w", table, err)
+		}
+	}
+
+	query, args, err = s.sq.Delete("workspaces").
+		Where(sq.Eq{"id": workspaceID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build RemoveWorkspace query: %w", err)
+	}
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to exec RemoveWorkspace: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get RemoveWorkspace affected rows: %w", err)
+	}
+	if affected == 0 {
+		return domain.ErrWorkspaceNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit RemoveWorkspace: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) GetWorkspaceRole(ctx context.Context, workspaceID, userID string) (string, error) {
+	query, args, err := s.sq.Select("role").
+		From("workspaceUsers").
+		Where(sq.Eq{"workspaceId": workspaceID, "userId": userID}).
+		ToSql()
+	if err != nil {
+		return "", fmt.Errorf("failed to build GetWorkspaceRole query: %w", err)
+	}
+
+	var role string
+	if err := s.db.QueryRowContext(ctx, query, args...).Scan(&role); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", domain.ErrWorkspaceNotFound
+		}
+		return "", fmt.Errorf("failed to scan GetWorkspaceRole: %w", err)
+	}
+
+	return role, nil
+}
+
+func (s *Store) SaveInvitation(ctx context.Context, invitation domain.Invitation) (domain.Invitation, error) {
+	query, args, err := s.sq.Insert("invitations").
+		Columns("id", "workspaceId", "email", "githubLogin", "role", "invitedBy", "expiresAt").
+		Values(invitation.ID, invitation.WorkspaceID, invitation.Email, invitation.GithubLogin, invitation.Role, invitation.InvitedBy, invitation.ExpiresAt.UTC()).
+		Suffix("RETURNING expiresAt, createdAt").
+		ToSql()
+	if err != nil {
+		return invitation, fmt.Errorf("failed to build SaveInvitation query: %w", err)
+	}
+
+	if err := s.db.QueryRowContext(ctx, query, args...).Scan(&invitation.ExpiresAt, &invitation.CreatedAt); err != nil {
+		return invitation, fmt.Errorf("failed to exec SaveInvitation: %w", err)
+	}
+
+	return invitation, nil
+}
+
+func (s *Store) GetInvitation(ctx context.Context, invitationID string) (domain.Invitation, error) {
+	query, args, err := s.sq.Select("id", "workspaceId", "email", "githubLogin", "role", "invitedBy", "expiresAt", "acceptedAt", "createdAt").
+		From("invitations").
+		Where(sq.Eq{"id": invitationID}).
+		ToSql()
+	if err != nil {
+		return domain.Invitation{}, fmt.Errorf("failed to build GetInvitation query: %w", err)
+	}
+
+	var invitation domain.Invitation
+	var acceptedAt sql.NullTime
+	if err := s.db.QueryRowContext(ctx, query, args...).Scan(
+		&invitation.ID,
+		&invitation.WorkspaceID,
+		&invitation.Email,
+		&invitation.GithubLogin,
+		&invitation.Role,
+		&invitation.InvitedBy,
+		&invitation.ExpiresAt,
+		&acceptedAt,
+		&invitation.CreatedAt,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return invitation, domain.ErrInvitationNotFound
+		}
+		return invitation, fmt.Errorf("failed to scan GetInvitation: %w", err)
+	}
+	invitation.AcceptedAt = acceptedAt.Time
+
+	return invitation, nil
+}
+
+func (s *Store) GetInvitations(ctx context.Context, workspaceID string) ([]domain.Invitation, error) {
+	query, args, err := s.sq.Select("id", "email", "githubLogin", "role", "invitedBy", "expiresAt", "createdAt").
+		From("invitations").
+		Where(sq.Eq{"workspaceId": workspaceID, "acceptedAt": nil}).
+		Where(sq.Gt{"expiresAt": now()}).
+		OrderBy("createdAt DESC").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build GetInvitations query: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query GetInvitations: %w", err)
+	}
+	defer rows.Close()
+
+	invitations := []domain.Invitation{}
+	for rows.Next() {
+		invitation := domain.Invitation{WorkspaceID: workspaceID}
+		if err := rows.Scan(
+			&invitation.ID,
+			&invitation.Email,
+			&invitation.GithubLogin,
+			&invitation.Role,
+			&invitation.InvitedBy,
+			&invitation.ExpiresAt,
+			&invitation.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan GetInvitations row: %w", err)
+		}
+		invitations = append(invitations, invitation)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate GetInvitations rows: %w", err)
+	}
+
+	return invitations, nil
+}
+
+// AcceptInvitation marks the invitation accepted and adds the user to its workspace in a single transaction,
+// an invitation accepted before isn't found
+func (s *Store) AcceptInvitation(ctx context.Context, invitationID, userID string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start AcceptInvitation transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query, args, err := s.sq.Update("invitations").
+		Set("acceptedBy", userID).
+		Set("acceptedAt", now()).
+		Where(sq.Eq{"id": invitationID, "acceptedAt": nil}).
+		Suffix("RETURNING workspaceId, role").
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build AcceptInvitation query: %w", err)
+	}
+
+	var workspaceID, role string
+	if err := tx.QueryRowContext(ctx, query, args...).Scan(&workspaceID, &role); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.ErrInvitationNotFound
+		}
+		return fmt.Errorf("failed to exec AcceptInvitation: %w", err)
+	}
+
+	query, args, err = s.sq.Insert("workspaceUsers").
+		Columns("workspaceId", "userId", "role").
+		Values(workspaceID, userID, role).
+		Suffix("ON CONFLICT (workspaceId, userId) DO NOTHING").
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build workspace member query: %w", err)
+	}
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to exec workspace member query: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get workspace member affected rows: %w", err)
+	}
+	if affected == 0 {
+		return domain.ErrAlreadyMember
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit AcceptInvitation: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) GetMembers(ctx context.Context, workspaceID string) ([]domain.Member, error) {
+	query, args, err := s.sq.Select("u.id", "u.email", "u.displayName", "wu.role", "wu.createdAt").
+		From("workspaceUsers wu").
+		Join("users u ON wu.userId = u.id").
+		Where(sq.Eq{"wu.workspaceId": workspaceID}).
+		OrderBy("wu.createdAt").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build GetMembers query: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query GetMembers: %w", err)
+	}
+	defer rows.Close()
+
+	members := []domain.Member{}
+	for rows.Next() {
+		var member domain.Member
+		if err := rows.Scan(&member.UserID, &member.Email, &member.DisplayName, &member.Role, &member.JoinedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan GetMembers row: %w", err)
+		}
+		members = append(members, member)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate GetMembers rows: %w", err)
+	}
+
+	return members, nil
+}
+
+func (s *Store) UpdateMemberRole(ctx context.Context, workspaceID, userID, role string) error {
+	query, args, err := s.sq.Update("workspaceUsers").
+		Set("role", role).
+		Where(sq.Eq{"workspaceId": workspaceID, "userId": userID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build UpdateMemberRole query: %w", err)
+	}
+
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to exec UpdateMemberRole: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get UpdateMemberRole affected rows: %w", err)
+	}
+	if affected == 0 {
+		return domain.ErrMemberNotFound
+	}
+
+	return nil
+}
+
+// RemoveMember removes a user from a workspace along with the user api tokens of the workspace
+func (s *Store) RemoveMember(ctx context.Context, workspaceID, userID string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start RemoveMember transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query, args, err := s.sq.Delete("workspaceUsers").
+		Where(sq.Eq{"workspaceId": workspaceID, "userId": userID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build RemoveMember query: %w", err)
+	}
+
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to exec RemoveMember: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get RemoveMember affected rows: %w", err)
+	}
+	if affected == 0 {
+		return domain.ErrMemberNotFound
+	}
+
+	query, args, err = s.sq.Delete("apiTokens").
+		Where(sq.Eq{"workspaceId": workspaceID, "userId": userID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build member api tokens removal query: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to remove member api tokens: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit RemoveMember: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) SaveApiToken(ctx context.Context, token domain.ApiToken) (domain.ApiToken, error) {
+	operations, err := json.Marshal(token.Operations)
+	if err != nil {
+		return token, fmt.Errorf("failed to marshal api token operations to json: %w", err)
+	}
+
+	var expiresAt sql.NullTime
+	if !token.ExpiresAt.IsZero() {
+		expiresAt = sql.NullTime{Time: token.ExpiresAt.UTC(), Valid: true}
+	}
+	token.CreatedAt = now()
+	query, args, err := s.sq.Insert("apiTokens").
+		Columns("id", "workspaceId", "userId", "name", "tokenHash", "operations", "expiresAt", "createdAt").
+		Values(token.ID, token.WorkspaceID, token.UserID, token.Name, token.TokenHash, string(operations), expiresAt, token.CreatedAt).
+		ToSql()
+	if err != nil {
+		return token, fmt.Errorf("failed to build SaveApiToken query: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+		return token, fmt.Errorf("failed to exec SaveApiToken: %w", err)
+	}
+
+	return token, nil
+}
+
+func (s *Store) GetApiTokens(ctx context.Context, workspaceID, userID string) ([]domain.ApiToken, error) {
+	query, args, err := s.sq.Select("id", "name", "operations", "expiresAt", "lastUsedAt", "createdAt").
+		From("apiTokens").
+		Where(sq.Eq{"workspaceId": workspaceID, "userId": userID}).
+		OrderBy("createdAt DESC").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build GetApiTokens query: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query GetApiTokens: %w", err)
+	}
+	defer rows.Close()
+
+	tokens := []domain.ApiToken{}
+	for rows.Next() {
+		token := domain.ApiToken{WorkspaceID: workspaceID, UserID: userID}
+		var operations []byte
+		var expiresAt, lastUsedAt sql.NullTime
+		if err := rows.Scan(&token.ID, &token.Name, &operations, &expiresAt, &lastUsedAt, &token.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan GetApiTokens row: %w", err)
+		}
+		if err := json.Unmarshal(operations, &token.Operations); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal api token operations: %w", err)
+		}
+		token.ExpiresAt = expiresAt.Time
+		token.LastUsedAt = lastUsedAt.Time
+		tokens = append(tokens, token)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate GetApiTokens rows: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// GetApiTokenByHash gives a token along with its user
+func (s *Store) GetApiTokenByHash(ctx context.Context, tokenHash string) (domain.ApiToken, error) {
+	query, args, err := s.sq.Select("t.id", "t.workspaceId", "t.name", "t.operations", "t.expiresAt", "t.lastUsedAt", "t.createdAt", "u.id", "u.email", "u.displayName").
+		From("apiTokens t").
+		Join("users u ON t.userId = u.id").
+		Where(sq.Eq{"t.tokenHash": tokenHash}).
+		ToSql()
+	if err != nil {
+		return domain.ApiToken{}, fmt.Errorf("failed to build GetApiTokenByHash query: %w", err)
+	}
+
+	var token domain.ApiToken
+	var operations []byte
+	var expiresAt, lastUsedAt sql.NullTime
+	if err := s.db.QueryRowContext(ctx, query, args...).Scan(
+		&token.ID,
+		&token.WorkspaceID,
+		&token.Name,
+		&operations,
+		&expiresAt,
+		&lastUsedAt,
+		&token.CreatedAt,
+		&token.User.ID,
+		&token.User.Email,
+		&token.User.DisplayName,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return token, domain.ErrApiTokenNotFound
+		}
+		return token, fmt.Errorf("failed to scan GetApiTokenByHash: %w", err)
+	}
+	if err := json.Unmarshal(operations, &token.Operations); err != nil {
+		return token, fmt.Errorf("failed to unmarshal api token operations: %w", err)
+	}
+	token.UserID = token.User.ID
+	token.TokenHash = tokenHash
+	token.ExpiresAt = expiresAt.Time
+	token.LastUsedAt = lastUsedAt.Time
+
+	return token, nil
+}
+
+func (s *Store) TouchApiToken(ctx context.Context, tokenID string) error {
+	query, args, err := s.sq.Update("apiTokens").
+		Set("lastUsedAt", now()).
+		Where(sq.Eq{"id": tokenID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build TouchApiToken query: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to exec TouchApiToken: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) RemoveApiToken(ctx context.Context, workspaceID, userID, tokenID string) error {
+	query, args, err := s.sq.Delete("apiTokens").
+		Where(sq.Eq{"id": tokenID, "workspaceId": workspaceID, "userId": userID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build RemoveApiToken query: %w", err)
+	}
+
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to exec RemoveApiToken: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get RemoveApiToken affected rows: %w", err)
+	}
+	if affected == 0 {
+		return domain.ErrApiTokenNotFound
+	}
+
+	return nil
+}
+
+func (s *Store) SaveSession(ctx context.Context, session domain.Session) (domain.Session, error) {
+	session.CreatedAt = now()
+	query, args, err := s.sq.Insert("sessions").
+		Columns("id", "userId", "refreshTokenHash", "userAgent", "ip", "expiresAt", "createdAt").
+		Values(session.ID, session.UserID, session.RefreshTokenHash, session.UserAgent, session.IP, session.ExpiresAt.UTC(), session.CreatedAt).
+		ToSql()
+	if err != nil {
+		return session, fmt.Errorf("failed to build SaveSession query: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+		return session, fmt.Errorf("failed to exec SaveSession: %w", err)
+	}
+
+	return session, nil
+}
+
+// RotateSession replaces the refresh token of an active session and prolongs it,
+// any rotated refresh token given again revokes the session and returns domain.ErrRefreshTokenReused
+func (s *Store) RotateSession(ctx context.Context, refreshTokenHash, newRefreshTokenHash string, expiresAt time.Time) (domain.Session, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return domain.Session{}, fmt.Errorf("failed to begin RotateSession transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query, args, err := s.sq.Select("s.id", "s.currentWorkspace", "s.userAgent", "s.ip", "s.expiresAt", "s.revokedAt", "s.createdAt", "u.id", "u.email", "u.displayName").
+		From("sessions s").
+		Join("users u ON s.userId = u.id").
+		Where(sq.Eq{"s.refreshTokenHash": refreshTokenHash}).
+		Suffix("FOR UPDATE").
+		ToSql()
+	if err != nil {
+		return domain.Session{}, fmt.Errorf("failed to build RotateSession select query: %w", err)
+	}
+
+	var session domain.Session
+	var revokedAt sql.NullTime
+	err = tx.QueryRowContext(ctx, query, args...).Scan(
+		&session.ID,
+		&session.CurrentWorkspace,
+		&session.UserAgent,
+		&session.IP,
+		&session.ExpiresAt,
+		&revokedAt,
+		&session.CreatedAt,
+		&session.User.ID,
+		&session.User.Email,
+		&session.User.DisplayName,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.Session{}, s.revokeReusedSession(ctx, tx, refreshTokenHash)
+	}
+	if err != nil {
+		return domain.Session{}, fmt.Errorf("failed to scan RotateSession session: %w", err)
+	}
+	if revokedAt.Valid || !session.ExpiresAt.After(now()) {
+		return domain.Session{}, domain.ErrSessionNotFound
+	}
+
+	session.UserID = session.User.ID
+	session.RefreshTokenHash = newRefreshTokenHash
+	session.RefreshedAt = now()
+	session.ExpiresAt = expiresAt.UTC()
+	query, args, err = s.sq.Update("sessions").
+		Set("refreshTokenHash", newRefreshTokenHash).
+		Set("refreshedAt", session.RefreshedAt).
+		Set("expiresAt", session.ExpiresAt).
+		Where(sq.Eq{"id": session.ID}).
+		ToSql()
+	if err != nil {
+		return domain.Session{}, fmt.Errorf("failed to build RotateSession update query: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return domain.Session{}, fmt.Errorf("failed to exec RotateSession update: %w", err)
+	}
+
+	query, args, err = s.sq.Insert("sessionRefreshTokens").
+		Columns("tokenHash", "sessionId", "createdAt").
+		Values(refreshTokenHash, session.ID, session.RefreshedAt).
+		ToSql()
+	if err != nil {
+		return domain.Session{}, fmt.Errorf("failed to build RotateSession insert query: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return domain.Session{}, fmt.Errorf("failed to exec RotateSession insert: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return domain.Session{}, fmt.Errorf("failed to commit RotateSession transaction: %w", err)
+	}
+
+	return session, nil
+}
+
+// revokeReusedSession revokes a session any of its rotated refresh tokens belongs to,
+// it gives domain.ErrSessionNotFound if the token has never been issued
+func (s *Store) revokeReusedSession(ctx context.Context, tx *sql.Tx, refreshTokenHash string) error {
+	query, args, err := s.sq.Update("sessions").
+		Set("revokedAt", sq.Expr("COALESCE(revokedAt, ?)", now())).
+		Where("id IN (SELECT sessionId FROM sessionRefreshTokens WHERE tokenHash = ?)", refreshTokenHash).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build revokeReusedSession query: %w", err)
+	}
+
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to exec revokeReusedSession: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get revokeReusedSession affected rows: %w", err)
+	}
+	if affected == 0 {
+		return domain.ErrSessionNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit revokeReusedSession transaction: %w", err)
+	}
+
+	return domain.ErrRefreshTokenReused
+}
+
+func (s *Store) SessionIsActive(ctx context.Context, sessionID string) (bool, error) {
+	query, args, err := s.sq.Select("1").
+		From("sessions").
+		Where(sq.Eq{"id": sessionID, "revokedAt": nil}).
+		Where(sq.Gt{"expiresAt": now()}).
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("failed to build SessionIsActive query: %w", err)
+	}
+
+	var one int
+	if err := s.db.QueryRowContext(ctx, query, args...).Scan(&one); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to scan SessionIsActive: %w", err)
+	}
+
+	return true, nil
+}
+
+// GetSessions gives the active sessions of the user
+func (s *Store) GetSessions(ctx context.Context, userID string) ([]domain.Session, error) {
+	query, args, err := s.sq.Select("id", "currentWorkspace", "userAgent", "ip", "expiresAt", "refreshedAt", "createdAt").
+		From("sessions").
+		Where(sq.Eq{"userId": userID, "revokedAt": nil}).
+		Where(sq.Gt{"expiresAt": now()}).
+		OrderBy("createdAt DESC").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build GetSessions query: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query GetSessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []domain.Session{}
+	for rows.Next() {
+		session := domain.Session{UserID: userID}
+		var refreshedAt sql.NullTime
+		if err := rows.Scan(&session.ID, &session.CurrentWorkspace, &session.UserAgent, &session.IP, &session.ExpiresAt, &refreshedAt, &session.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan GetSessions row: %w", err)
+		}
+		session.RefreshedAt = refreshedAt.Time
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate GetSessions rows: %w", err)
+	}
+
+	return sessions, nil
+}
+
+func (s *Store) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	query, args, err := s.sq.Update("sessions").
+		Set("revokedAt", now()).
+		Where(sq.Eq{"id": sessionID, "userId": userID, "revokedAt": nil}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build RevokeSession query: %w", err)
+	}
+
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to exec RevokeSession: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get RevokeSession affected rows: %w", err)
+	}
+	if affected == 0 {
+		return domain.ErrSessionNotFound
+	}
+
+	return nil
+}
+
+func (s *Store) RevokeSessions(ctx context.Context, userID string) error {
+	query, args, err := s.sq.Update("sessions").
+		Set("revokedAt", now()).
+		Where(sq.Eq{"userId": userID, "revokedAt": nil}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build RevokeSessions query: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to exec RevokeSessions: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) SetSessionWorkspace(ctx context.Context, sessionID, workspaceID string) error {
+	query, args, err := s.sq.Update("sessions").
+		Set("currentWorkspace", workspaceID).
+		Where(sq.Eq{"id": sessionID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build SetSessionWorkspace query: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to exec SetSessionWorkspace: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) SaveAuditEvent(ctx context.Context, event domain.AuditEvent) error {
+	target, err := json.Marshal(event.Target)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit event target to json: %w", err)
+	}
+
+	query, args, err := s.sq.Insert("auditEvents").
+		Columns("id", "workspaceId", "actorId", "actorName", "apiTokenId", "action", "target", "status", "ip", "userAgent", "createdAt").
+		Values(event.ID, event.WorkspaceID, event.ActorID, event.ActorName, event.ApiTokenID, event.Action, string(target), event.Status, event.IP, event.UserAgent, now()).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build SaveAuditEvent query: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to exec SaveAuditEvent: %w", err)
+	}
+
+	return nil
+}
+
+// GetAuditEvents gives a page of the workspace events, the latest first
+func (s *Store) GetAuditEvents(ctx context.Context, workspaceID string, filter domain.AuditFilter) ([]domain.AuditEvent, error) {
+	q := s.sq.Select("id", "actorId", "actorName", "apiTokenId", "action", "target", "status", "ip", "userAgent", "createdAt").
+		From("auditEvents").
+		Where(sq.Eq{"workspaceId": workspaceID})
+	if filter.Action != "" {
+		q = q.Where(sq.Eq{"action": filter.Action})
+	}
+	if filter.ActorID != "" {
+		q = q.Where(sq.Eq{"actorId": filter.ActorID})
+	}
+	if filter.RepoID != "" {
+		q = q.Where(sq.Expr("target->>'repoID' = ?", filter.RepoID))
+	}
+	if !filter.Since.IsZero() {
+		q = q.Where(sq.GtOrEq{"createdAt": filter.Since.UTC()})
+	}
+	if !filter.Until.IsZero() {
+		q = q.Where(sq.Lt{"createdAt": filter.Until.UTC()})
+	}
+	if filter.Before != "" {
+		q = q.Where(sq.Lt{"id": filter.Before})
+	}
+	query, args, err := q.OrderBy("id DESC").Limit(uint64(filter.Limit)).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build GetAuditEvents query: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query GetAuditEvents: %w", err)
+	}
+	defer rows.Close()
+
+	events := []domain.AuditEvent{}
+	for rows.Next() {
+		event := domain.AuditEvent{WorkspaceID: workspaceID}
+		var target []byte
+		if err := rows.Scan(&event.ID, &event.ActorID, &event.ActorName, &event.ApiTokenID, &event.Action, &target, &event.Status, &event.IP, &event.UserAgent, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan GetAuditEvents row: %w", err)
+		}
+		if err := json.Unmarshal(target, &event.Target); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal audit event target: %w", err)
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate GetAuditEvents rows: %w", err)
+	}
+
+	return events, nil
+}
+
+// SaveBuildLogs keeps the progress messages of the deployments in a single insert, the payloads are made a valid postgres text
+func (s *Store) SaveBuildLogs(ctx context.Context, logs []domain.BuildLog) ([]domain.BuildLog, error) {
+	q := s.sq.Insert("buildLogs").
+		Columns("deploymentId", "payload", "level", "final", "errorCode", "deployment", "createdAt")
+	for i := range logs {
+		logs[i].Payload = strings.ToValidUTF8(strings.ReplaceAll(logs[i].Payload, "\x00", ""), "")
+		var deployment []byte
+		if logs[i].Deployment.ID != "" {
+			var err error
+			deployment, err = json.Marshal(logs[i].Deployment)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal build log deployment: %w", err)
+			}
+		}
+		q = q.Values(logs[i].DeploymentID, logs[i].Payload, int(logs[i].Level), logs[i].Final, logs[i].ErrorCode, deployment, logs[i].CreatedAt.UTC())
+	}
+	query, args, err := q.Suffix("RETURNING id").ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build SaveBuildLogs query: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return nil, domain.ErrDeploymentNotFound
+		}
+		return nil, fmt.Errorf("failed to exec SaveBuildLogs: %w", err)
+	}
+	defer rows.Close()
+
+	ids := make([]int64, 0, len(logs))
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan SaveBuildLogs row: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		if isForeignKeyViolation(err) {
+			return nil, domain.ErrDeploymentNotFound
+		}
+		return nil, fmt.Errorf("failed to iterate SaveBuildLogs rows: %w", err)
+	}
+	if len(ids) != len(logs) {
+		return nil, fmt.Errorf("failed to save build logs, %d of %d are saved", len(ids), len(logs))
+	}
+	// the ids are given by a sequence in the order of the values
+	slices.Sort(ids)
+	for i := range logs {
+		logs[i].ID = ids[i]
+	}
+
+	return logs, nil
+}
+
+// isForeignKeyViolation tells a row referring to a missing one, e.g. a build log of a removed deployment
+func isForeignKeyViolation(err error) bool {
+	var pgErr pgx.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23503"
+}
+
+// GetBuildLogs gives the logs of a deployment written after the given log id in the order they're written
+func (s *Store) GetBuildLogs(ctx context.Context, deploymentID string, after int64) ([]domain.BuildLog, error) {
+	query, args, err := s.sq.Select("id", "deploymentId", "payload", "level", "final", "errorCode", "deployment", "createdAt").
+		From("buildLogs").
+		Where(sq.Eq{"deploymentId": deploymentID}).
+		Where(sq.Gt{"id": after}).
+		OrderBy("id").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build GetBuildLogs query: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query GetBuildLogs: %w", err)
+	}
+	defer rows.Close()
+
+	logs := []domain.BuildLog{}
+	for rows.Next() {
+		var log domain.BuildLog
+		var level int
+		var deployment []byte
+		if err := rows.Scan(&log.ID, &log.DeploymentID, &log.Payload, &level, &log.Final, &log.ErrorCode, &deployment, &log.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan GetBuildLogs row: %w", err)
+		}
+		log.Level = slog.Level(level)
+		if deployment != nil {
+			if err := json.Unmarshal(deployment, &log.Deployment); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal build log deployment: %w", err)
+			}
+		}
+		logs = append(logs, log)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate GetBuildLogs rows: %w", err)
+	}
+
+	return logs, nil
+}
+
+// SearchBuildLogs gives a page of the workspace logs matching the full-text query, the latest first
+func (s *Store) SearchBuildLogs(ctx context.Context, workspaceID string, filter domain.BuildLogFilter) ([]domain.BuildLog, error) {
+	q := s.sq.Select("l.id", "l.deploymentId", "d.repoId", "d.environment", "l.payload", "l.level", "l.final", "l.errorCode", "l.createdAt").
+		From("buildLogs l").
+		Join("deployments d ON l.deploymentId = d.id").
+		Join("installedRepos r ON d.repoId = r.id").
+		Where(sq.Eq{"r.workspaceId": workspaceID}).
+		Where(sq.Expr("l.payloadSearch @@ websearch_to_tsquery('simple', ?)", filter.Query))
+	if filter.RepoID != "" {
+		q = q.Where(sq.Eq{"d.repoId": filter.RepoID})
+	}
+	if filter.DeploymentID != "" {
+		q = q.Where(sq.Eq{"l.deploymentId": filter.DeploymentID})
+	}
+	if !filter.Since.IsZero() {
+		q = q.Where(sq.GtOrEq{"l.createdAt": filter.Since.UTC()})
+	}
+	if !filter.Until.IsZero() {
+		q = q.Where(sq.Lt{"l.createdAt": filter.Until.UTC()})
+	}
+	if filter.Before != 0 {
+		q = q.Where(sq.Lt{"l.id": filter.Before})
+	}
+	query, args, err := q.OrderBy("l.id DESC").Limit(uint64(filter.Limit)).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build SearchBuildLogs query: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query SearchBuildLogs: %w", err)
+	}
+	defer rows.Close()
+
+	logs := []domain.BuildLog{}
+	for rows.Next() {
+		var log domain.BuildLog
+		var level int
+		if err := rows.Scan(&log.ID, &log.DeploymentID, &log.RepoID, &log.Environment, &log.Payload, &level, &log.Final, &log.ErrorCode, &log.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan SearchBuildLogs row: %w", err)
+		}
+		log.Level = slog.Level(level)
+		logs = append(logs, log)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate SearchBuildLogs rows: %w", err)
+	}
+
+	return logs, nil
+}
+
+// RemoveBuildLogs removes at most limit logs written before the given time, a short statement never locks the table long
+func (s *Store) RemoveBuildLogs(ctx context.Context, before time.Time, limit int) (int, error) {
+	query, args, err := s.sq.Delete("buildLogs").
+		// the subquery keeps the question placeholders, the outer query numbers them
+		Where(sq.Expr("id IN (?)", sq.Select("id").
+			From("buildLogs").
+			Where(sq.Lt{"createdAt": before.UTC()}).
+			Limit(uint64(limit)))).
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build RemoveBuildLogs query: %w", err)
+	}
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to exec RemoveBuildLogs: %w", err)
+	}
+	removed, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get RemoveBuildLogs affected rows: %w", err)
+	}
+
+	return int(removed), nil
+}
+
+func (s *Store) GetWorkspaceByUserDisplayName(ctx context.Context, userDisplayName string) (domain.Workspace, error) {
+	query, args, err := s.sq.Select("w.id", "w.name", "w.githubOrgName", "wu.role", "w.namespace").
+		From("workspaces w").
+		Join("workspaceUsers wu ON w.id = wu.workspaceId").
+		Join("users u ON wu.userId = u.id AND w.personalOf = u.id").
+		Where(sq.Eq{"u.displayName": userDisplayName}).
 		ToSql()
 	if err != nil {
 		return domain.Workspace{}, fmt.Errorf("failed to build GetWorkspaceByUserDisplayName query: %w", err)
@@ -1059,12 +3320,13 @@ func (s *Store) GetWorkspaceByUserDisplayName(ctx context.Context, userDisplayNa
 
 	var workspace domain.Workspace
 	var githubOrgName string
-	if err := s.db.QueryRowContext(ctx, query, args...).Scan(&workspace.ID, &workspace.Name, &githubOrgName, &workspace.Role); err != nil {
+	if err := s.db.QueryRowContext(ctx, query, args...).Scan(&workspace.ID, &workspace.Name, &githubOrgName, &workspace.Role, &workspace.Namespace); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return workspace, domain.ErrWorkspaceNotFound
 		}
 		return workspace, fmt.Errorf("failed to scan GetWorkspaceByUserDisplayName: %w", err)
 	}
+	workspace.Personal = true
 
 	if githubOrgName != "" {
 		workspace.GithubOrgName = githubOrgName
@@ -1076,12 +3338,11 @@ func (s *Store) GetWorkspaceByUserDisplayName(ctx context.Context, userDisplayNa
 // createDefaultWorkspaceForUser creates a default workspace for a user within an existing transaction
 func (s *Store) createDefaultWorkspaceForUser(ctx context.Context, tx *sql.Tx, userID string) (domain.Workspace, error) {
 	workspaceID := xid.New().String()
-	workspaceName := xid.New().String()
 
 	// Create the workspace
 	workspaceQuery, workspaceArgs, err := s.sq.Insert("workspaces").
-		Columns("id", "name", "githubOrgName").
-		Values(workspaceID, personalWorkspaceName, "").
+		Columns("id", "name", "githubOrgName", "namespace", "personalOf").
+		Values(workspaceID, personalWorkspaceName, "", personalWorkspaceName, userID).
 		ToSql()
 	if err != nil {
 		return domain.Workspace{}, fmt.Errorf("failed to build workspace query: %w", err)
@@ -1093,7 +3354,7 @@ func (s *Store) createDefaultWorkspaceForUser(ctx context.Context, tx *sql.Tx, u
 	// Link user to workspace
 	userWorkspaceQuery, userWorkspaceArgs, err := s.sq.Insert("workspaceUsers").
 		Columns("workspaceId", "userId", "role").
-		Values(workspaceID, userID, "admin").
+		Values(workspaceID, userID, domain.RoleOwner).
 		ToSql()
 	if err != nil {
 		return domain.Workspace{}, fmt.Errorf("failed to build workspace user query: %w", err)
@@ -1103,8 +3364,10 @@ func (s *Store) createDefaultWorkspaceForUser(ctx context.Context, tx *sql.Tx, u
 	}
 
 	return domain.Workspace{
-		ID:   workspaceID,
-		Name: workspaceName,
-		Role: "admin",
+		ID:        workspaceID,
+		Name:      personalWorkspaceName,
+		Role:      domain.RoleOwner,
+		Personal:  true,
+		Namespace: personalWorkspaceName,
 	}, nil
 }
@@ -1,6 +1,8 @@
 package resources
 
 import (
+	"net/http"
+
 	"github.com/dennypenta/vel"
 	"github.com/treenq/treenq/src/domain"
 )
@@ -18,31 +20,131 @@ func NewRouter(handlers *domain.Handler, auth, githubAuth vel.Middleware, middle
 		Method:      "GET",
 		OperationID: "auth",
 	}, handlers.GithubAuthHandler)
-	vel.RegisterGet(router, "authCallback", handlers.GithubCallbackHandler)
+	vel.RegisterGet(router, "authCallback", handlers.GithubCallbackHandler, handlers.Audit)
 
 	// vcs webhooks
 	vel.RegisterPost(router, "githubWebhook", handlers.GithubWebhook, githubAuth)
 
+	// allow authenticates a user and authorizes the user role in the current workspace
+	allow := func(permission domain.Permission) vel.Middleware {
+		authorize := handlers.Authorize(permission)
+		return func(h http.Handler) http.Handler {
+			return auth(authorize(h))
+		}
+	}
+
+	// audit is allow plus recording the handled request to the audit log, it's meant for the mutating apis,
+	// the audit goes before the authorization, so the forbidden attempts are recorded too
+	audit := func(permission domain.Permission) vel.Middleware {
+		authorize := handlers.Authorize(permission)
+		return func(h http.Handler) http.Handler {
+			return auth(handlers.Audit(authorize(h)))
+		}
+	}
+	// authAudit is auth plus recording the handled request to the audit log, it's meant for the apis needing no role
+	authAudit := func(h http.Handler) http.Handler {
+		return auth(handlers.Audit(h))
+	}
+
 	// treenq api
-	vel.RegisterPost(router, "logout", handlers.Logout, auth).SetSpec(vel.Spec{
-		Description: "the api cleans cookies and logs out a user",
+	vel.RegisterPost(router, "refreshToken", handlers.RefreshToken, handlers.Audit).SetSpec(vel.Spec{
+		Description: "the api issues a new auth token for a session and rotates its refresh token, a reused refresh token revokes the session",
+	})
+	vel.RegisterPost(router, "logout", handlers.Logout, authAudit).SetSpec(vel.Spec{
+		Description: "the api revokes the current session, cleans cookies and logs out a user",
 	})
+	vel.RegisterPost(router, "getSessions", handlers.GetSessions, auth)
+	vel.RegisterPost(router, "revokeSession", handlers.RevokeSession, authAudit)
+	vel.RegisterPost(router, "revokeAllSessions", handlers.RevokeAllSessions, authAudit)
 	vel.RegisterPost(router, "info", handlers.Info, auth)
 	vel.RegisterPost(router, "getProfile", handlers.GetProfile, auth)
-	vel.RegisterPost(router, "getRepos", handlers.GetRepos, auth)
-	vel.RegisterPost(router, "getBranches", handlers.GetBranches, auth)
-	vel.RegisterPost(router, "syncGithubApp", handlers.SyncGithubApp, auth)
-	vel.RegisterPost(router, "connectRepoBranch", handlers.ConnectBranch, auth)
-	vel.RegisterPost(router, "deploy", handlers.Deploy, auth)
-	vel.RegisterPost(router, "getDeployment", handlers.GetDeployment, auth)
-	vel.RegisterGet(router, "getBuildProgress", handlers.GetBuildProgress, auth)
-	vel.RegisterGet(router, "getLogs", handlers.GetLogs, auth)
-	vel.RegisterPost(router, "getDeployments", handlers.GetDeployments, auth)
-	vel.RegisterPost(router, "setSecret", handlers.SetSecret, auth)
-	vel.RegisterPost(router, "getSecrets", handlers.GetSecrets, auth)
-	vel.RegisterPost(router, "revealSecret", handlers.RevealSecret, auth)
-	vel.RegisterPost(router, "removeSecret", handlers.RemoveSecret, auth)
-	vel.RegisterPost(router, "getWorkloadStats", handlers.GetWorkloadStats, auth)
+	vel.RegisterPost(router, "createWorkspace", handlers.CreateWorkspace, authAudit)
+	vel.RegisterPost(router, "getWorkspaces", handlers.GetWorkspaces, auth)
+	vel.RegisterPost(router, "switchWorkspace", handlers.SwitchWorkspace, authAudit).SetSpec(vel.Spec{
+		Description: "the api reissues the auth token with the memberships of the user making the given workspace current",
+	})
+	vel.RegisterPost(router, "renameWorkspace", handlers.RenameWorkspace, audit(domain.PermissionManageWorkspace))
+	vel.RegisterPost(router, "removeWorkspace", handlers.RemoveWorkspace, audit(domain.PermissionManageWorkspace))
+	vel.RegisterPost(router, "getRepos", handlers.GetRepos, allow(domain.PermissionRead))
+	vel.RegisterPost(router, "getBranches", handlers.GetBranches, allow(domain.PermissionRead))
+	vel.RegisterPost(router, "syncGithubApp", handlers.SyncGithubApp, audit(domain.PermissionDeploy))
+	vel.RegisterPost(router, "connectRepoBranch", handlers.ConnectBranch, audit(domain.PermissionManageSettings))
+	vel.RegisterPost(router, "setRepoProtection", handlers.SetRepoProtection, audit(domain.PermissionManageSettings))
+	vel.RegisterPost(router, "setRepoSecretRestart", handlers.SetRepoSecretRestart, audit(domain.PermissionManageSettings))
+	vel.RegisterPost(router, "deploy", handlers.Deploy, audit(domain.PermissionDeploy))
+	vel.RegisterPost(router, "planDeployment", handlers.PlanDeployment, allow(domain.PermissionDeploy)).SetSpec(vel.Spec{
+		Description: "the api shows the changes a deployment of a branch or a sha makes without building or applying anything",
+	})
+	vel.RegisterPost(router, "promoteDeployment", handlers.PromoteDeployment, audit(domain.PermissionDeploy)).SetSpec(vel.Spec{
+		Description: "the api deploys the image of a done deployment to another environment of the repo without rebuilding it",
+	})
+	vel.RegisterPost(router, "approveDeployment", handlers.ApproveDeployment, audit(domain.PermissionApprove)).SetSpec(vel.Spec{
+		Description: "the api lets a deployment awaiting approval proceed, the approver must be a workspace admin or owner",
+	})
+	vel.RegisterPost(router, "getDeployment", handlers.GetDeployment, allow(domain.PermissionRead))
+	vel.RegisterGet(router, "getBuildProgress", handlers.GetBuildProgress, allow(domain.PermissionRead))
+	vel.RegisterGet(router, "getLogs", handlers.GetLogs, allow(domain.PermissionRead))
+	vel.RegisterPost(router, "searchBuildLogs", handlers.SearchBuildLogs, allow(domain.PermissionRead)).SetSpec(vel.Spec{
+		Description: "the api gives a page of the workspace build logs matching a full-text query, the latest first",
+	})
+	vel.RegisterGet(router, "downloadBuildLogs", handlers.DownloadBuildLogs, allow(domain.PermissionRead)).SetSpec(vel.Spec{
+		Description: "the api gives the build logs of a deployment as plain text",
+	})
+	vel.RegisterPost(router, "getDeployments", handlers.GetDeployments, allow(domain.PermissionRead))
+	vel.RegisterPost(router, "setSecret", handlers.SetSecret, audit(domain.PermissionWriteSecrets))
+	vel.RegisterPost(router, "getSecrets", handlers.GetSecrets, allow(domain.PermissionRead))
+	vel.RegisterPost(router, "revealSecret", handlers.RevealSecret, audit(domain.PermissionRevealSecrets))
+	vel.RegisterPost(router, "removeSecret", handlers.RemoveSecret, audit(domain.PermissionWriteSecrets))
+	vel.RegisterPost(router, "getSecretVersions", handlers.GetSecretVersions, allow(domain.PermissionRead))
+	vel.RegisterPost(router, "rollbackSecret", handlers.RollbackSecret, audit(domain.PermissionWriteSecrets))
+	vel.RegisterPost(router, "importSecrets", handlers.ImportSecrets, audit(domain.PermissionWriteSecrets))
+	vel.RegisterPost(router, "exportSecrets", handlers.ExportSecrets, audit(domain.PermissionRevealSecrets))
+
+	vel.RegisterPost(router, "createSecretGroup", handlers.CreateSecretGroup, audit(domain.PermissionWriteSecrets))
+	vel.RegisterPost(router, "getSecretGroups", handlers.GetSecretGroups, allow(domain.PermissionRead))
+	vel.RegisterPost(router, "removeSecretGroup", handlers.RemoveSecretGroup, audit(domain.PermissionWriteSecrets))
+	vel.RegisterPost(router, "setGroupSecret", handlers.SetGroupSecret, audit(domain.PermissionWriteSecrets))
+	vel.RegisterPost(router, "removeGroupSecret", handlers.RemoveGroupSecret, audit(domain.PermissionWriteSecrets))
+	vel.RegisterPost(router, "attachSecretGroup", handlers.AttachSecretGroup, audit(domain.PermissionWriteSecrets))
+	vel.RegisterPost(router, "detachSecretGroup", handlers.DetachSecretGroup, audit(domain.PermissionWriteSecrets))
+	vel.RegisterPost(router, "getAppEnv", handlers.GetAppEnv, allow(domain.PermissionRead))
+	vel.RegisterPost(router, "getWorkloadStats", handlers.GetWorkloadStats, allow(domain.PermissionRead))
+	vel.RegisterPost(router, "createEnvironment", handlers.CreateEnvironment, audit(domain.PermissionManageSettings))
+	vel.RegisterPost(router, "getEnvironments", handlers.GetEnvironments, allow(domain.PermissionRead))
+	vel.RegisterPost(router, "updateEnvironment", handlers.UpdateEnvironment, audit(domain.PermissionManageSettings))
+	vel.RegisterPost(router, "removeEnvironment", handlers.RemoveEnvironment, audit(domain.PermissionManageSettings)).SetSpec(vel.Spec{
+		Description: "the api removes an environment namespace with the running app and the environment secrets",
+	})
+	vel.RegisterPost(router, "addCluster", handlers.AddCluster, audit(domain.PermissionManageSettings))
+	vel.RegisterPost(router, "getClusters", handlers.GetClusters, allow(domain.PermissionRead))
+	vel.RegisterPost(router, "removeCluster", handlers.RemoveCluster, audit(domain.PermissionManageSettings))
+	vel.RegisterPost(router, "setRepoCluster", handlers.SetRepoCluster, audit(domain.PermissionManageSettings))
+	vel.RegisterPost(router, "checkCluster", handlers.CheckCluster, allow(domain.PermissionRead))
+	vel.RegisterPost(router, "setRegistryCredentials", handlers.SetRegistryCredentials, audit(domain.PermissionManageSettings))
+	vel.RegisterPost(router, "getRegistryCredentials", handlers.GetRegistryCredentials, allow(domain.PermissionRead))
+	vel.RegisterPost(router, "removeRegistryCredentials", handlers.RemoveRegistryCredentials, audit(domain.PermissionManageSettings))
+	vel.RegisterPost(router, "setSecretStore", handlers.SetSecretStore, audit(domain.PermissionManageSettings)).SetSpec(vel.Spec{
+		Description: "the api selects the store of the workspace repo secret values, the kind can be changed only while the workspace has no repo secrets",
+	})
+	vel.RegisterPost(router, "getSecretStore", handlers.GetSecretStore, allow(domain.PermissionRead))
+	vel.RegisterPost(router, "inviteMember", handlers.InviteMember, audit(domain.PermissionManageMembers)).SetSpec(vel.Spec{
+		Description: "the api gives a signed expiring token the invitee passes to acceptInvitation",
+	})
+	vel.RegisterPost(router, "acceptInvitation", handlers.AcceptInvitation, authAudit)
+	vel.RegisterPost(router, "getMembers", handlers.GetMembers, allow(domain.PermissionRead))
+	vel.RegisterPost(router, "updateMemberRole", handlers.UpdateMemberRole, audit(domain.PermissionManageMembers))
+	vel.RegisterPost(router, "removeMember", handlers.RemoveMember, audit(domain.PermissionManageMembers))
+	vel.RegisterPost(router, "createApiToken", handlers.CreateApiToken, audit(domain.PermissionManageApiTokens)).SetSpec(vel.Spec{
+		Description: "the api issues a personal token limited to the current workspace and the given operations, the token is returned only once",
+	})
+	vel.RegisterPost(router, "getApiTokens", handlers.GetApiTokens, allow(domain.PermissionRead))
+	vel.RegisterPost(router, "revokeApiToken", handlers.RevokeApiToken, audit(domain.PermissionManageApiTokens))
+	vel.RegisterPost(router, "getAuditLog", handlers.GetAuditLog, allow(domain.PermissionReadAuditLog)).SetSpec(vel.Spec{
+		Description: "the api gives a page of the workspace audit events filtered by action, actor, repo and time, the latest first",
+	})
+	vel.RegisterGet(router, "exportAuditLog", handlers.ExportAuditLog, allow(domain.PermissionReadAuditLog)).SetSpec(vel.Spec{
+		Description: "the api streams the filtered workspace audit events as json lines",
+	})
 
 	return router
 }
@@ -1,4 +1,4 @@
-// Package auth implements the OAuth2 protocol for authenticating users through Github.
+// Package auth implements the OAuth2 protocol for authenticating users through Github or a generic OpenID Connect provider.
 // This package can be used as a reference implementation of an OAuth2 provider for Goth.
 package auth
 
@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -50,13 +51,13 @@ type GithubOauthProvider struct {
 	tokenCache *cache.Cache[string, string] // userDisplayName -> token
 }
 
-func (p *GithubOauthProvider) AuthUrl(state string) string {
-	url := p.config.AuthCodeURL(state)
+func (p *GithubOauthProvider) AuthUrl(state, verifier string) string {
+	url := p.config.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier))
 	return url
 }
 
-func (p *GithubOauthProvider) ExchangeUser(ctx context.Context, code string) (domain.UserInfo, error) {
-	token, err := p.config.Exchange(ctx, code)
+func (p *GithubOauthProvider) ExchangeUser(ctx context.Context, code, verifier string) (domain.UserInfo, error) {
+	token, err := p.config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
 	if err != nil {
 		return domain.UserInfo{}, fmt.Errorf("failed to exchange github code to token: %w", err)
 	}
@@ -67,7 +68,7 @@ func (p *GithubOauthProvider) ExchangeUser(ctx context.Context, code string) (do
 	}
 
 	// Cache the GitHub access token for 15 minutes
-	p.tokenCache.Set(userInfo.DisplayName, token.AccessToken, cache.WithExpiration(15*time.Minute))
+	p.tokenCache.Set(userInfo.Subject, token.AccessToken, cache.WithExpiration(15*time.Minute))
 
 	return userInfo, nil
 }
@@ -106,6 +107,9 @@ func (p *GithubOauthProvider) FetchUser(ctx context.Context, token string) (doma
 	user = domain.UserInfo{
 		Email:       resp.Email,
 		DisplayName: resp.Login,
+		Provider:    domain.GithubProvider,
+		Subject:     strconv.Itoa(resp.ID),
+		Login:       resp.Login,
 	}
 
 	if user.Email == "" {
@@ -158,10 +162,10 @@ func (p *GithubOauthProvider) getPrivateMail(ctx context.Context, token string)
 	return email, ErrNoVerifiedGitHubPrimaryEmail
 }
 
-// GetUserGithubToken retrieves the cached GitHub token for a user
+// GetUserGithubToken retrieves the cached GitHub token for a GitHub user id
 // Returns domain.ErrUnauthorized if token is expired or not found
-func (p *GithubOauthProvider) GetUserGithubToken(userDisplayName string) (string, error) {
-	token, ok := p.tokenCache.Get(userDisplayName)
+func (p *GithubOauthProvider) GetUserGithubToken(githubID string) (string, error) {
+	token, ok := p.tokenCache.Get(githubID)
 	if !ok {
 		return "", domain.ErrUnauthorized
 	}
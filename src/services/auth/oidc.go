@@ -0,0 +1,237 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/treenq/treenq/pkg/auth"
+	"github.com/treenq/treenq/src/domain"
+	"golang.org/x/oauth2"
+)
+
+// ErrNoIDToken is returned if the token response of the provider has no id_token
+var ErrNoIDToken = errors.New("no id_token in the token response")
+
+// OidcConfig configures a generic OpenID Connect provider, e.g. Keycloak
+type OidcConfig struct {
+	// IssuerURL is the issuer the discovery document is fetched from, {IssuerURL}/.well-known/openid-configuration
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	// the claims of the id token or the userinfo mapped to domain.UserInfo
+	EmailClaim         string
+	EmailVerifiedClaim string
+	DisplayNameClaim   string
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+}
+
+// OidcProvider logs in the users of an OpenID Connect provider using the authorization code flow with PKCE,
+// only the users having a verified email are accepted, so they are linked to the existing users by the email
+type OidcProvider struct {
+	client    *http.Client
+	config    *oauth2.Config
+	claims    OidcConfig
+	discovery oidcDiscovery
+
+	mu   sync.Mutex
+	keys map[string]*rsa.PublicKey
+}
+
+// NewOidc discovers the provider endpoints by its issuer url
+func NewOidc(ctx context.Context, client *http.Client, conf OidcConfig) (*OidcProvider, error) {
+	p := &OidcProvider{
+		client: client,
+		claims: conf,
+		keys:   make(map[string]*rsa.PublicKey),
+	}
+
+	wellKnown := strings.TrimSuffix(conf.IssuerURL, "/") + "/.well-known/openid-configuration"
+	if err := p.getJson(ctx, wellKnown, "", &p.discovery); err != nil {
+		return nil, fmt.Errorf("failed to discover oidc provider: %w", err)
+	}
+	if p.discovery.Issuer != strings.TrimSuffix(conf.IssuerURL, "/") && p.discovery.Issuer != conf.IssuerURL {
+		return nil, fmt.Errorf("oidc issuer %s doesn't match the configured %s", p.discovery.Issuer, conf.IssuerURL)
+	}
+
+	p.config = &oauth2.Config{
+		ClientID:     conf.ClientID,
+		ClientSecret: conf.ClientSecret,
+		RedirectURL:  conf.RedirectURL,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  p.discovery.AuthorizationEndpoint,
+			TokenURL: p.discovery.TokenEndpoint,
+		},
+		Scopes: conf.Scopes,
+	}
+
+	return p, nil
+}
+
+func (p *OidcProvider) AuthUrl(state, verifier string) string {
+	return p.config.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier))
+}
+
+func (p *OidcProvider) ExchangeUser(ctx context.Context, code, verifier string) (domain.UserInfo, error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.client)
+	token, err := p.config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return domain.UserInfo{}, fmt.Errorf("failed to exchange oidc code to token: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return domain.UserInfo{}, ErrNoIDToken
+	}
+	claims, err := p.verifyIDToken(ctx, rawIDToken)
+	if err != nil {
+		return domain.UserInfo{}, fmt.Errorf("failed to verify id token: %w", err)
+	}
+
+	// the providers may keep the profile claims out of the id token
+	if p.discovery.UserinfoEndpoint != "" {
+		var userInfo map[string]any
+		if err := p.getJson(ctx, p.discovery.UserinfoEndpoint, token.AccessToken, &userInfo); err != nil {
+			return domain.UserInfo{}, fmt.Errorf("failed to get oidc userinfo: %w", err)
+		}
+		if userInfo["sub"] != claims["sub"] {
+			return domain.UserInfo{}, errors.New("oidc userinfo subject doesn't match the id token")
+		}
+		for k, v := range userInfo {
+			if _, ok := claims[k]; !ok {
+				claims[k] = v
+			}
+		}
+	}
+
+	return p.mapClaims(claims)
+}
+
+// mapClaims gives a user of the claims, the display name falls back to the email name,
+// the user is identified by the issuer and the subject
+func (p *OidcProvider) mapClaims(claims map[string]any) (domain.UserInfo, error) {
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return domain.UserInfo{}, errors.New("no sub claim found")
+	}
+	email, _ := claims[p.claims.EmailClaim].(string)
+	if email == "" {
+		return domain.UserInfo{}, fmt.Errorf("no %s claim found", p.claims.EmailClaim)
+	}
+
+	verified := false
+	switch v := claims[p.claims.EmailVerifiedClaim].(type) {
+	case bool:
+		verified = v
+	case string:
+		verified = v == "true"
+	}
+	if !verified {
+		return domain.UserInfo{}, domain.ErrEmailNotVerified
+	}
+
+	displayName, _ := claims[p.claims.DisplayNameClaim].(string)
+	if displayName == "" {
+		displayName, _, _ = strings.Cut(email, "@")
+	}
+
+	return domain.UserInfo{
+		Email:       email,
+		DisplayName: displayName,
+		Provider:    "oidc:" + p.discovery.Issuer,
+		Subject:     subject,
+	}, nil
+}
+
+func (p *OidcProvider) verifyIDToken(ctx context.Context, rawIDToken string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.publicKey(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithIssuer(p.discovery.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// publicKey gives the provider key by its id, the keys are fetched again once an unknown key is met,
+// so the provider may rotate them
+func (p *OidcProvider) publicKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	var jwks auth.Jwks
+	if err := p.getJson(ctx, p.discovery.JwksURI, "", &jwks); err != nil {
+		return nil, fmt.Errorf("failed to get oidc jwks: %w", err)
+	}
+	keys := make(map[string]*rsa.PublicKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			return nil, err
+		}
+		keys[jwk.Kid] = key
+	}
+	p.keys = keys
+
+	key, ok := p.keys[kid]
+	if !ok {
+		return nil, auth.ErrUnknownKey
+	}
+	return key, nil
+}
+
+func (p *OidcProvider) getJson(ctx context.Context, url, accessToken string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded with %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// GetUserGithubToken always gives domain.ErrNoGithubAccount, the oidc users have no github token
+func (p *OidcProvider) GetUserGithubToken(githubID string) (string, error) {
+	return "", domain.ErrNoGithubAccount
+}
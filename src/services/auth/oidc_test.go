@@ -0,0 +1,203 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/treenq/treenq/pkg/auth"
+	"github.com/treenq/treenq/src/domain"
+	"golang.org/x/oauth2"
+)
+
+// oidcStandIn is a minimal OpenID Connect provider issuing the id tokens with the given claims
+type oidcStandIn struct {
+	*httptest.Server
+	issuer *auth.JwtIssuer
+	// challenges keeps a PKCE challenge by the code
+	challenges map[string]string
+	claims     map[string]any
+	userInfo   map[string]any
+}
+
+func newOidcStandIn(t *testing.T) *oidcStandIn {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	public, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+
+	s := &oidcStandIn{challenges: make(map[string]string)}
+	mux := http.NewServeMux()
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	s.issuer = auth.NewJwtIssuer(
+		s.URL,
+		pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public}),
+		time.Minute,
+	).WithKeyRotation("k1", nil, 0)
+
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                s.URL,
+			AuthorizationEndpoint: s.URL + "/auth",
+			TokenEndpoint:         s.URL + "/token",
+			UserinfoEndpoint:      s.URL + "/userinfo",
+			JwksURI:               s.URL + "/jwks",
+		})
+	})
+	mux.Handle("GET /jwks", auth.NewJwksHandler(s.issuer))
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		challenge, ok := s.challenges[r.FormValue("code")]
+		sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if !ok || challenge != base64.RawURLEncoding.EncodeToString(sum[:]) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		idToken, err := s.issuer.GenerateJwtToken(s.claims)
+		require.NoError(t, err)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   60,
+			"id_token":     idToken,
+		})
+	})
+	mux.HandleFunc("GET /userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(s.userInfo)
+	})
+
+	return s
+}
+
+// authorize does what the provider does on the user login, it gives a code bound to the challenge of the auth url
+func (s *oidcStandIn) authorize(t *testing.T, authUrl string) string {
+	u, err := url.Parse(authUrl)
+	require.NoError(t, err)
+	require.Equal(t, s.URL+"/auth", u.Scheme+"://"+u.Host+u.Path)
+	require.Equal(t, "S256", u.Query().Get("code_challenge_method"))
+
+	code := rand.Text()
+	s.challenges[code] = u.Query().Get("code_challenge")
+	return code
+}
+
+func TestOidcProvider(t *testing.T) {
+	ctx := context.Background()
+	standIn := newOidcStandIn(t)
+	conf := OidcConfig{
+		IssuerURL:          standIn.URL,
+		ClientID:           "treenq",
+		ClientSecret:       "secret",
+		RedirectURL:        "http://localhost:8000/authCallback",
+		Scopes:             []string{"openid", "email", "profile"},
+		EmailClaim:         "email",
+		EmailVerifiedClaim: "email_verified",
+		DisplayNameClaim:   "preferred_username",
+	}
+	provider, err := NewOidc(ctx, standIn.Client(), conf)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name     string
+		claims   map[string]any
+		userInfo map[string]any
+		verifier string
+		user     domain.UserInfo
+		failed   bool
+		err      error
+	}{
+		{
+			name:     "id token claims",
+			claims:   map[string]any{"aud": "treenq", "sub": "1", "email": "john@company.com", "email_verified": true, "preferred_username": "john"},
+			userInfo: map[string]any{"sub": "1"},
+			user:     domain.UserInfo{Email: "john@company.com", DisplayName: "john", Provider: "oidc:" + standIn.URL, Subject: "1"},
+		},
+		{
+			name:     "userinfo claims",
+			claims:   map[string]any{"aud": "treenq", "sub": "1", "email": "john@company.com", "email_verified": "true"},
+			userInfo: map[string]any{"sub": "1", "preferred_username": "johnny"},
+			user:     domain.UserInfo{Email: "john@company.com", DisplayName: "johnny", Provider: "oidc:" + standIn.URL, Subject: "1"},
+		},
+		{
+			name:     "display name falls back to email",
+			claims:   map[string]any{"aud": "treenq", "sub": "1", "email": "john@company.com", "email_verified": true},
+			userInfo: map[string]any{"sub": "1"},
+			user:     domain.UserInfo{Email: "john@company.com", DisplayName: "john", Provider: "oidc:" + standIn.URL, Subject: "1"},
+		},
+		{
+			name:     "email not verified",
+			claims:   map[string]any{"aud": "treenq", "sub": "1", "email": "john@company.com", "email_verified": false},
+			userInfo: map[string]any{"sub": "1"},
+			failed:   true,
+			err:      domain.ErrEmailNotVerified,
+		},
+		{
+			name:     "no subject",
+			claims:   map[string]any{"aud": "treenq", "email": "john@company.com", "email_verified": true},
+			userInfo: map[string]any{},
+			failed:   true,
+		},
+		{
+			name:     "another audience",
+			claims:   map[string]any{"aud": "another", "sub": "1", "email": "john@company.com", "email_verified": true},
+			userInfo: map[string]any{"sub": "1"},
+			failed:   true,
+			err:      jwt.ErrTokenInvalidAudience,
+		},
+		{
+			name:     "another user info",
+			claims:   map[string]any{"aud": "treenq", "sub": "1", "email": "john@company.com", "email_verified": true},
+			userInfo: map[string]any{"sub": "2"},
+			failed:   true,
+		},
+		{
+			name:     "wrong verifier",
+			claims:   map[string]any{"aud": "treenq", "sub": "1", "email": "john@company.com", "email_verified": true},
+			verifier: "wrong",
+			failed:   true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			standIn.claims = tc.claims
+			standIn.userInfo = tc.userInfo
+
+			verifier := oauth2.GenerateVerifier()
+			code := standIn.authorize(t, provider.AuthUrl("state", verifier))
+			if tc.verifier != "" {
+				verifier = tc.verifier
+			}
+
+			user, err := provider.ExchangeUser(ctx, code, verifier)
+			if tc.failed {
+				require.Error(t, err)
+				if tc.err != nil {
+					assert.ErrorIs(t, err, tc.err)
+				}
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.user, user)
+		})
+	}
+}
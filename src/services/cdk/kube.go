@@ -4,9 +4,11 @@ import (
 	"bufio"
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
 	"strings"
 	"sync"
 	"time"
@@ -22,6 +24,8 @@ import (
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer/yaml"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/dynamic"
@@ -32,8 +36,32 @@ import (
 
 const (
 	defaultReplicas = 1
+
+	// fieldManager owns the fields of the applied objects using server-side apply
+	fieldManager = "treenq"
+	// ownerLabel marks every generated object with the repo id it belongs to,
+	// the objects labelled by it and missing in the desired set are pruned
+	ownerLabel = "tq/owner"
+	// secretsChecksumAnnotation is set on the pod template,
+	// a changed checksum of the app secrets rolls the pods out
+	secretsChecksumAnnotation = "tq/secrets-checksum"
+	// injectedEnvScript runs the image command given as the arguments with the injected values,
+	// the env file given as $0 prepends NAME=value arguments for env, the command is required so the values are never printed
+	injectedEnvScript = `[ "$#" -gt 0 ] && . "$0" && exec env "$@"`
+
+	// rolloutPollInterval is how often the state of a rolling out deployment is checked
+	rolloutPollInterval = 2 * time.Second
 )
 
+// prunableResources are the namespaced kinds generated for an app,
+// objects of these kinds are deleted once they are removed from the app definition
+var prunableResources = []schema.GroupVersionResource{
+	{Group: "", Version: "v1", Resource: "secrets"},
+	{Group: "apps", Version: "v1", Resource: "deployments"},
+	{Group: "", Version: "v1", Resource: "services"},
+	{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"},
+}
+
 type Kube struct {
 	host           string
 	dockerRegistry string
@@ -50,8 +78,11 @@ func NewKube(
 // DefineApp generates a Kubernetes manifest string for an application.
 // It calls generateKubeResources to create Kubernetes objects and then serializes them to YAML.
 // The ctx parameter is currently unused but kept for potential future use (e.g. logging, cancellation).
-func (k *Kube) DefineApp(_ context.Context, id string, nsName string, app tqsdk.Space, image domain.Image, secretKeys []string) (string, error) {
-	resources := k.generateKubeResources(id, nsName, app, image, secretKeys)
+func (k *Kube) DefineApp(_ context.Context, id string, nsName string, app tqsdk.Space, image domain.Image, secrets domain.AppSecrets, pullCredentials []domain.RegistryCredentials) (string, error) {
+	resources, err := k.generateKubeResources(id, nsName, app, image, secrets, pullCredentials)
+	if err != nil {
+		return "", err
+	}
 
 	var finalYamlElements []string
 	for _, res := range resources {
@@ -75,31 +106,67 @@ func secretName(repoID, key string) string {
 	return repoID + "-" + strings.ToLower(key)
 }
 
+// groupSecretName is a secret object holding the values of the attached secret groups,
+// the dot separator never clashes with a secret key object name
+func groupSecretName(repoID string) string {
+	return repoID + ".secret-groups"
+}
+
+// Namespace gives the namespace an app is deployed to
+func (k *Kube) Namespace(id, nsName string) string {
+	return ns(nsName, id)
+}
+
+// AppURL gives the public url of an app exposed by the ingress
+func (k *Kube) AppURL(id string) string {
+	return "https://" + k.appHost(id)
+}
+
+func (k *Kube) appHost(id string) string {
+	return id + "." + k.host
+}
+
 // generateKubeResources creates the Kubernetes resource objects for an application.
-func (k *Kube) generateKubeResources(id, nsName string, app tqsdk.Space, image domain.Image, secretKeys []string) []any {
+// pullCredentials are added to the registry secret next to the treenq registry, used to pull images from external registries.
+// The env precedence is defined by domain.ResolveEnv, the group secrets are rendered as a secret object of the app.
+// The secrets checksum annotates the pod template, so the pods are restarted once the secrets are changed.
+// The injected repo secrets and group secrets are left out of the env and the secret objects,
+// the container sources the injected env file and runs the image command with the values instead.
+func (k *Kube) generateKubeResources(id, nsName string, app tqsdk.Space, image domain.Image, secrets domain.AppSecrets, pullCredentials []domain.RegistryCredentials) ([]any, error) {
 	fullNsName := ns(nsName, id)
 	labels := map[string]string{"tq/name": app.Service.Name}
+	ownerLabels := map[string]string{ownerLabel: id}
 
 	// 1. Namespace
 	namespace := &corev1.Namespace{
 		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Namespace"},
 		ObjectMeta: metav1.ObjectMeta{
-			Name: fullNsName,
+			Name:   fullNsName,
+			Labels: ownerLabels,
 		},
 	}
 
 	// 2. Registry Secret
 	registrySecretName := "registry-credentials"
-	authStr := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", k.userName, k.userPassword)))
-	dockerConfigJSON := fmt.Sprintf(`{"auths":{"%s":{"auth":"%s"}}}`, k.dockerRegistry, authStr)
+	auths := map[string]dockerAuth{
+		k.dockerRegistry: {Auth: basicAuth(k.userName, k.userPassword)},
+	}
+	for _, creds := range pullCredentials {
+		auths[creds.Registry] = dockerAuth{Auth: basicAuth(creds.Username, creds.Password)}
+	}
+	dockerConfigJSON, err := json.Marshal(dockerConfig{Auths: auths})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal docker config: %w", err)
+	}
 	registrySecret := &corev1.Secret{
 		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      registrySecretName,
 			Namespace: fullNsName,
+			Labels:    ownerLabels,
 		},
 		StringData: map[string]string{
-			".dockerconfigjson": dockerConfigJSON,
+			".dockerconfigjson": string(dockerConfigJSON),
 		},
 		Type: corev1.SecretTypeDockerConfigJson,
 	}
@@ -110,21 +177,41 @@ func (k *Kube) generateKubeResources(id, nsName string, app tqsdk.Space, image d
 		replicas = int32(app.Service.Replicas)
 	}
 
+	groupValues := make(map[string]string, len(secrets.Groups))
+	for _, secret := range secrets.Groups {
+		groupValues[secret.GroupID+"/"+secret.Key] = string(secret.Value)
+	}
 	var envVars []corev1.EnvVar
-	for key, value := range app.Service.RuntimeEnvs {
-		envVars = append(envVars, corev1.EnvVar{Name: key, Value: value})
-	}
-	for _, key := range secretKeys {
-		secretObjNameForRef := secretName(id, key)
-		envVars = append(envVars, corev1.EnvVar{
-			Name: strings.ToUpper(key),
-			ValueFrom: &corev1.EnvVarSource{
-				SecretKeyRef: &corev1.SecretKeySelector{
-					LocalObjectReference: corev1.LocalObjectReference{Name: secretObjNameForRef},
-					Key:                  key,
+	groupSecretData := make(map[string]string)
+	for _, env := range domain.ResolveEnv(secrets.Groups, app.Service.RuntimeEnvs, secrets.Keys) {
+		if env.Overridden || (secrets.Injection != nil && env.Source != domain.EnvSourceRuntimeEnv) {
+			continue
+		}
+		switch env.Source {
+		case domain.EnvSourceRuntimeEnv:
+			envVars = append(envVars, corev1.EnvVar{Name: env.Name, Value: env.Value})
+		case domain.EnvSourceSecret:
+			envVars = append(envVars, corev1.EnvVar{
+				Name: env.Name,
+				ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: secretName(id, env.Key)},
+						Key:                  env.Key,
+					},
 				},
-			},
-		})
+			})
+		case domain.EnvSourceSecretGroup:
+			groupSecretData[env.Name] = groupValues[env.GroupID+"/"+env.Key]
+			envVars = append(envVars, corev1.EnvVar{
+				Name: env.Name,
+				ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: groupSecretName(id)},
+						Key:                  env.Name,
+					},
+				},
+			})
+		}
 	}
 
 	computeRes := app.Service.ComputationResource
@@ -146,11 +233,26 @@ func (k *Kube) generateKubeResources(id, nsName string, app tqsdk.Space, image d
 		ephemeralStorageReqStr = fmt.Sprintf("%dGi", computeRes.DiskGibs)
 	}
 
+	var podAnnotations map[string]string
+	var command, args []string
+	if secrets.Injection != nil {
+		podAnnotations = maps.Clone(secrets.Injection.Annotations)
+		command = []string{"/bin/sh", "-c", injectedEnvScript, secrets.Injection.EnvFile}
+		args = secrets.Injection.Command
+	}
+	if secrets.Checksum != "" {
+		if podAnnotations == nil {
+			podAnnotations = make(map[string]string, 1)
+		}
+		podAnnotations[secretsChecksumAnnotation] = secrets.Checksum
+	}
+
 	deployment := &appsv1.Deployment{
 		TypeMeta: metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      app.Service.Name,
 			Namespace: fullNsName,
+			Labels:    ownerLabels,
 		},
 		Spec: appsv1.DeploymentSpec{
 			Replicas: int32Ptr(replicas),
@@ -159,18 +261,21 @@ func (k *Kube) generateKubeResources(id, nsName string, app tqsdk.Space, image d
 			},
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Labels: labels,
+					Labels:      labels,
+					Annotations: podAnnotations,
 				},
 				Spec: corev1.PodSpec{
 					Containers: []corev1.Container{{
 						Name:            app.Service.Name,
-						Image:           image.FullPath(),
+						Image:           image.Reference(),
 						ImagePullPolicy: corev1.PullAlways,
 						Ports: []corev1.ContainerPort{{
 							Name:          "http",
 							ContainerPort: int32(app.Service.HttpPort),
 						}},
-						Env: envVars,
+						Command: command,
+						Args:    args,
+						Env:     envVars,
 						Resources: corev1.ResourceRequirements{
 							Requests: corev1.ResourceList{
 								corev1.ResourceCPU:              resource.MustParse(cpuReqStr),
@@ -213,6 +318,7 @@ func (k *Kube) generateKubeResources(id, nsName string, app tqsdk.Space, image d
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      app.Service.Name,
 			Namespace: fullNsName,
+			Labels:    ownerLabels,
 		},
 		Spec: corev1.ServiceSpec{
 			Ports: []corev1.ServicePort{{
@@ -229,7 +335,7 @@ func (k *Kube) generateKubeResources(id, nsName string, app tqsdk.Space, image d
 	// 5. Ingress
 	ingressName := "ingress"
 	pathTypePrefix := networkingv1.PathTypePrefix
-	ingressRuleHost := id + "." + k.host
+	ingressRuleHost := k.appHost(id)
 	ingressTLSHost := k.host
 
 	ingress := &networkingv1.Ingress{
@@ -237,6 +343,7 @@ func (k *Kube) generateKubeResources(id, nsName string, app tqsdk.Space, image d
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      ingressName,
 			Namespace: fullNsName,
+			Labels:    ownerLabels,
 			Annotations: map[string]string{
 				"cert-manager.io/cluster-issuer": "letsencrypt",
 			},
@@ -267,7 +374,32 @@ func (k *Kube) generateKubeResources(id, nsName string, app tqsdk.Space, image d
 			}},
 		},
 	}
-	return []any{namespace, registrySecret, deployment, service, ingress}
+	resources := []any{namespace, registrySecret}
+	if len(groupSecretData) > 0 {
+		resources = append(resources, &corev1.Secret{
+			TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      groupSecretName(id),
+				Namespace: fullNsName,
+				Labels:    ownerLabels,
+			},
+			StringData: groupSecretData,
+			Type:       corev1.SecretTypeOpaque,
+		})
+	}
+	return append(resources, deployment, service, ingress), nil
+}
+
+type dockerConfig struct {
+	Auths map[string]dockerAuth `json:"auths"`
+}
+
+type dockerAuth struct {
+	Auth string `json:"auth"`
+}
+
+func basicAuth(username, password string) string {
+	return base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
 }
 
 // Helper functions for pointer types
@@ -275,8 +407,9 @@ func int32Ptr(i int32) *int32 { return &i }
 func int64Ptr(i int64) *int64 { return &i }
 func boolPtr(b bool) *bool    { return &b }
 
+// Apply applies the objects of the given manifest using server-side apply,
+// then the objects owned by the same app and missing in the manifest are pruned.
 func (k *Kube) Apply(ctx context.Context, rawConig, data string) error {
-	decoder := yaml.NewDecodingSerializer(unstructured.UnstructuredJSONScheme) // Stays yaml for this generic Apply func
 	conf, err := clientcmd.RESTConfigFromKubeConfig([]byte(rawConig))
 	if err != nil {
 		return err
@@ -287,6 +420,12 @@ func (k *Kube) Apply(ctx context.Context, rawConig, data string) error {
 		return fmt.Errorf("failed to create dynamic client: %w", err)
 	}
 
+	return k.apply(ctx, dynamicClient, decodeObjects(data))
+}
+
+func decodeObjects(data string) []*unstructured.Unstructured {
+	decoder := yaml.NewDecodingSerializer(unstructured.UnstructuredJSONScheme) // Stays yaml for this generic Apply func
+
 	dataChunks := strings.Split(data, "---")
 	var validObjs []*unstructured.Unstructured // Initialize empty slice
 
@@ -296,7 +435,7 @@ func (k *Kube) Apply(ctx context.Context, rawConig, data string) error {
 			continue
 		}
 		var obj unstructured.Unstructured
-		_, _, err = decoder.Decode([]byte(trimmedChunk), nil, &obj)
+		_, _, err := decoder.Decode([]byte(trimmedChunk), nil, &obj)
 		if err != nil {
 			// If there's an error decoding (e.g. empty or malformed), skip this chunk.
 			// This can happen with comments or empty lines between '---'
@@ -311,32 +450,109 @@ func (k *Kube) Apply(ctx context.Context, rawConig, data string) error {
 		validObjs = append(validObjs, &obj)
 	}
 
-	for _, obj := range validObjs {
+	return validObjs
+}
+
+// objectKey identifies an object among the applied ones
+type objectKey struct {
+	gvr       schema.GroupVersionResource
+	namespace string
+	name      string
+}
+
+// ownerScope is a namespace holding the objects of a single owner
+type ownerScope struct {
+	namespace string
+	owner     string
+}
+
+// ownership gives the keys of the objects to apply and the scopes they are owned in
+func ownership(objs []*unstructured.Unstructured) (map[objectKey]struct{}, map[ownerScope]struct{}) {
+	desired := make(map[objectKey]struct{}, len(objs))
+	scopes := make(map[ownerScope]struct{})
+
+	for _, obj := range objs {
+		gvr, _ := meta.UnsafeGuessKindToResource(obj.GroupVersionKind())
+		desired[objectKey{gvr: gvr, namespace: obj.GetNamespace(), name: obj.GetName()}] = struct{}{}
+		if owner := obj.GetLabels()[ownerLabel]; owner != "" && obj.GetNamespace() != "" {
+			scopes[ownerScope{namespace: obj.GetNamespace(), owner: owner}] = struct{}{}
+		}
+	}
+
+	return desired, scopes
+}
+
+func (k *Kube) apply(ctx context.Context, dynamicClient dynamic.Interface, objs []*unstructured.Unstructured) error {
+	for _, obj := range objs {
 		gvr, _ := meta.UnsafeGuessKindToResource(obj.GroupVersionKind())
 		resourceClient := dynamicClient.Resource(gvr).Namespace(obj.GetNamespace())
 
-		_, err = resourceClient.Create(ctx, obj, metav1.CreateOptions{})
-		if errors.IsAlreadyExists(err) {
-			// Attempt to get the existing object to retrieve its ResourceVersion for Update
-			existingObj, getErr := resourceClient.Get(ctx, obj.GetName(), metav1.GetOptions{})
-			if getErr != nil {
-				return fmt.Errorf("failed to get existing object for update: %w", getErr)
-			}
-			obj.SetResourceVersion(existingObj.GetResourceVersion())
+		_, err := resourceClient.Apply(ctx, obj.GetName(), obj, metav1.ApplyOptions{
+			FieldManager: fieldManager,
+			Force:        true,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to apply %s %s: %w", obj.GetKind(), obj.GetName(), err)
+		}
+	}
 
-			_, err = resourceClient.Update(ctx, obj, metav1.UpdateOptions{})
-			if err != nil {
-				return fmt.Errorf("failed to update object: %w", err)
-			}
-		} else if err != nil {
-			return fmt.Errorf("failed to create object: %w", err)
+	desired, scopes := ownership(objs)
+	for scope := range scopes {
+		if err := k.prune(ctx, dynamicClient, scope, desired); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// prune deletes the objects labelled by the scope owner which are not in the desired set,
+// e.g. an ingress of a service which became a worker
+func (k *Kube) prune(ctx context.Context, dynamicClient dynamic.Interface, scope ownerScope, desired map[objectKey]struct{}) error {
+	stale, err := k.staleObjects(ctx, dynamicClient, scope, desired)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range stale {
+		err := dynamicClient.Resource(obj.gvr).Namespace(obj.namespace).Delete(ctx, obj.name, metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to prune %s %s: %w", obj.gvr.Resource, obj.name, err)
 		}
 	}
 
 	return nil
 }
 
-func (k *Kube) StreamLogs(ctx context.Context, rawConfig, repoID, spaceName string, logChan chan<- domain.ProgressMessage) error {
+// staleObject is a live object not present in the desired set anymore
+type staleObject struct {
+	objectKey
+	kind string
+}
+
+func (k *Kube) staleObjects(ctx context.Context, dynamicClient dynamic.Interface, scope ownerScope, desired map[objectKey]struct{}) ([]staleObject, error) {
+	selector := labels.SelectorFromSet(labels.Set{ownerLabel: scope.owner}).String()
+
+	var stale []staleObject
+	for _, gvr := range prunableResources {
+		list, err := dynamicClient.Resource(gvr).Namespace(scope.namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", gvr.Resource, err)
+		}
+
+		for _, item := range list.Items {
+			key := objectKey{gvr: gvr, namespace: scope.namespace, name: item.GetName()}
+			if _, ok := desired[key]; ok {
+				continue
+			}
+			stale = append(stale, staleObject{objectKey: key, kind: item.GetKind()})
+		}
+	}
+
+	return stale, nil
+}
+
+func (k *Kube) StreamLogs(ctx context.Context, rawConfig, repoID, spaceName string, positions domain.LogPositions, logChan chan<- domain.ProgressMessage) error {
 	conf, err := clientcmd.RESTConfigFromKubeConfig([]byte(rawConfig))
 	if err != nil {
 		return err
@@ -366,11 +582,18 @@ func (k *Kube) StreamLogs(ctx context.Context, rawConfig, repoID, spaceName stri
 			defer wg.Done()
 
 			pod := pods.Items[i]
-			req := clientset.CoreV1().Pods(fullNsName).GetLogs(pod.Name, &corev1.PodLogOptions{
+			opts := &corev1.PodLogOptions{
 				Follow:     true,
 				TailLines:  int64Ptr(100),
 				Timestamps: true,
-			})
+			}
+			// the since time is precise to a second, the lines given already are skipped
+			since := positions.Since(pod.Name)
+			if !since.IsZero() {
+				opts.TailLines = nil
+				opts.SinceTime = &metav1.Time{Time: since}
+			}
+			req := clientset.CoreV1().Pods(fullNsName).GetLogs(pod.Name, opts)
 
 			stream, err := req.Stream(ctx)
 			if err != nil {
@@ -386,13 +609,17 @@ func (k *Kube) StreamLogs(ctx context.Context, rawConfig, repoID, spaceName stri
 			scanner := bufio.NewScanner(stream)
 			for scanner.Scan() {
 				line := scanner.Text()
+				lineTime := logLineTime(line)
+				if _, ok := positions[pod.Name]; ok && !lineTime.After(since) {
+					continue
+				}
 
 				select {
 				case logChan <- domain.ProgressMessage{
-					Timestamp: time.Now(),
+					Timestamp: lineTime,
 					Level:     slog.LevelInfo,
 					Payload:   line,
-					Final:     false,
+					Pod:       pod.Name,
 				}:
 				case <-ctx.Done():
 					return
@@ -414,6 +641,122 @@ func (k *Kube) StreamLogs(ctx context.Context, rawConfig, repoID, spaceName stri
 	return nil
 }
 
+// logLineTime gives the time a line is prefixed with by the kubelet, the current time if it's not
+func logLineTime(line string) time.Time {
+	prefix, _, _ := strings.Cut(line, " ")
+	t, err := time.Parse(time.RFC3339Nano, prefix)
+	if err != nil {
+		return time.Now()
+	}
+	return t
+}
+
+// WaitRollout reports the progress of the app deployment rollout until all of its replicas are updated and available.
+// It fails once the deployment exceeds its progress deadline.
+func (k *Kube) WaitRollout(ctx context.Context, rawConfig, repoID, spaceName string, progressChan chan<- domain.ProgressMessage) error {
+	conf, err := clientcmd.RESTConfigFromKubeConfig([]byte(rawConfig))
+	if err != nil {
+		return fmt.Errorf("failed to create kube config from raw config: %w", err)
+	}
+
+	clientset, err := kubernetes.NewForConfig(conf)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	namespaceName := ns(spaceName, repoID)
+	ticker := time.NewTicker(rolloutPollInterval)
+	defer ticker.Stop()
+
+	var lastState string
+	for {
+		deployments, err := clientset.AppsV1().Deployments(namespaceName).List(ctx, metav1.ListOptions{
+			LabelSelector: labels.SelectorFromSet(labels.Set{ownerLabel: repoID}).String(),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list deployments: %w", err)
+		}
+		if len(deployments.Items) == 0 {
+			return domain.ErrNoPodsRunning
+		}
+
+		deployment := deployments.Items[0]
+		done, state, err := rolloutState(deployment)
+		if err != nil {
+			return err
+		}
+		if state != lastState {
+			lastState = state
+			select {
+			case progressChan <- domain.ProgressMessage{
+				Payload:   state,
+				Level:     slog.LevelInfo,
+				Timestamp: time.Now(),
+			}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if done {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// rolloutState describes the rollout progress of a deployment the same way kubectl rollout status does
+func rolloutState(deployment appsv1.Deployment) (bool, string, error) {
+	if deployment.Generation > deployment.Status.ObservedGeneration {
+		return false, "waiting for the deployment spec update to be observed", nil
+	}
+	for _, cond := range deployment.Status.Conditions {
+		if cond.Type == appsv1.DeploymentProgressing && cond.Reason == "ProgressDeadlineExceeded" {
+			return false, "", fmt.Errorf("deployment %s exceeded its progress deadline", deployment.Name)
+		}
+	}
+
+	replicas := int32(defaultReplicas)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	status := deployment.Status
+	switch {
+	case status.UpdatedReplicas < replicas:
+		return false, fmt.Sprintf("%d of %d updated replicas are rolled out", status.UpdatedReplicas, replicas), nil
+	case status.Replicas > status.UpdatedReplicas:
+		return false, fmt.Sprintf("%d old replicas are pending termination", status.Replicas-status.UpdatedReplicas), nil
+	case status.AvailableReplicas < status.UpdatedReplicas:
+		return false, fmt.Sprintf("%d of %d updated replicas are available", status.AvailableReplicas, status.UpdatedReplicas), nil
+	}
+	return true, fmt.Sprintf("rolled out %d replicas", replicas), nil
+}
+
+// CheckConnection verifies the cluster is reachable with the given config and gives its Kubernetes version
+func (k *Kube) CheckConnection(ctx context.Context, rawConfig string) (string, error) {
+	conf, err := clientcmd.RESTConfigFromKubeConfig([]byte(rawConfig))
+	if err != nil {
+		return "", fmt.Errorf("invalid kube config: %w", err)
+	}
+	conf.Timeout = 10 * time.Second
+
+	clientset, err := kubernetes.NewForConfig(conf)
+	if err != nil {
+		return "", fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	version, err := clientset.Discovery().ServerVersion()
+	if err != nil {
+		return "", fmt.Errorf("failed to reach the cluster: %w", err)
+	}
+
+	return version.GitVersion, nil
+}
+
 func (k *Kube) RemoveNamespace(ctx context.Context, kubeConfig, id, spaceName string) error {
 	namespaceName := ns(spaceName, id)
 	config, err := clientcmd.RESTConfigFromKubeConfig([]byte(kubeConfig))
@@ -478,6 +821,8 @@ func (k *Kube) GetWorkloadStats(ctx context.Context, kubeConfig, repoID, spaceNa
 	for _, pod := range pods.Items {
 		version := "unknown"
 		if img := pod.Spec.Containers[0].Image; img != "" {
+			// images are pinned by digest, the tag is still a readable version
+			img, _, _ = strings.Cut(img, "@")
 			parts := strings.Split(img, ":")
 			if len(parts) > 1 {
 				version = parts[len(parts)-1]
@@ -3,11 +3,30 @@ package cdk
 import (
 	"context"
 	_ "embed"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	tqsdk "github.com/treenq/treenq/pkg/sdk"
 	"github.com/treenq/treenq/src/domain"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 //go:embed testdata/app.yaml
@@ -35,8 +54,372 @@ func TestAppDefinition(t *testing.T) {
 		Registry:   "registry:5000",
 		Repository: "treenq",
 		Tag:        "0.0.1",
-	}, secretKeys)
+	}, domain.AppSecrets{Keys: secretKeys, Checksum: "4f1c2b"}, nil)
 
 	assert.Equal(t, appYaml, res)
 	assert.NoError(t, err)
 }
+
+func TestAppDefinitionPinnedByDigest(t *testing.T) {
+	k := NewKube("treenq.com", "registry:5000", "testuser", "testpassword")
+	ctx := context.Background()
+	res, err := k.DefineApp(ctx, "id-1234", "space", tqsdk.Space{
+		Service: tqsdk.Service{
+			Name:     "simple-app",
+			HttpPort: 8000,
+			Replicas: 1,
+			ComputationResource: tqsdk.ComputationResource{
+				CpuUnits:   250,
+				MemoryMibs: 512,
+				DiskGibs:   1,
+			},
+		},
+	}, domain.Image{
+		Registry:   "registry:5000",
+		Repository: "treenq",
+		Tag:        "0.0.1",
+		Digest:     "sha256:9b2a0d2f3c5e2b1b7b6c1f4c1d2e3f4a5b6c7d8e9f0a1b2c3d4e5f6a7b8c9d0e",
+	}, domain.AppSecrets{}, nil)
+
+	assert.NoError(t, err)
+	assert.Contains(t, res, "image: registry:5000/treenq:0.0.1@sha256:9b2a0d2f3c5e2b1b7b6c1f4c1d2e3f4a5b6c7d8e9f0a1b2c3d4e5f6a7b8c9d0e\n")
+}
+
+func TestAppDefinitionEnvPrecedence(t *testing.T) {
+	k := NewKube("treenq.com", "registry:5000", "testuser", "testpassword")
+	groupSecrets := []domain.GroupSecret{
+		{GroupID: "g1", Group: "shared", Key: "SENTRY_DSN", Value: []byte("https://sentry")},
+		{GroupID: "g1", Group: "shared", Key: "DB_URL", Value: []byte("postgres://shared")},
+		{GroupID: "g1", Group: "shared", Key: "LOG_LEVEL", Value: []byte("debug")},
+		// a later group overrides an earlier one
+		{GroupID: "g2", Group: "prod", Key: "SENTRY_DSN", Value: []byte("https://sentry-prod")},
+	}
+	res, err := k.DefineApp(context.Background(), "id-1234", "space", tqsdk.Space{
+		Service: tqsdk.Service{
+			Name:        "simple-app",
+			RuntimeEnvs: map[string]string{"LOG_LEVEL": "info"},
+			HttpPort:    8000,
+		},
+	}, domain.Image{Registry: "registry:5000", Repository: "treenq", Tag: "0.0.1"}, domain.AppSecrets{Keys: []string{"DB_URL"}, Groups: groupSecrets}, nil)
+	require.NoError(t, err)
+
+	objs := decodeObjects(res)
+	var env []any
+	var groupSecret *unstructured.Unstructured
+	for _, obj := range objs {
+		switch {
+		case obj.GetKind() == "Deployment":
+			containers, _, _ := unstructured.NestedSlice(obj.Object, "spec", "template", "spec", "containers")
+			env = containers[0].(map[string]any)["env"].([]any)
+		case obj.GetKind() == "Secret" && obj.GetName() == "id-1234.secret-groups":
+			groupSecret = obj
+		}
+	}
+
+	require.Len(t, env, 3, "every variable must be defined once")
+	assert.Equal(t, map[string]any{"name": "SENTRY_DSN", "valueFrom": map[string]any{"secretKeyRef": map[string]any{"name": "id-1234.secret-groups", "key": "SENTRY_DSN"}}}, env[0])
+	assert.Equal(t, map[string]any{"name": "LOG_LEVEL", "value": "info"}, env[1], "a runtime env overrides a group secret")
+	assert.Equal(t, map[string]any{"name": "DB_URL", "valueFrom": map[string]any{"secretKeyRef": map[string]any{"name": "id-1234-db_url", "key": "DB_URL"}}}, env[2], "a repo secret overrides a group secret")
+
+	require.NotNil(t, groupSecret, "the group secrets must be rendered as a secret object")
+	assert.Equal(t, "id-1234", groupSecret.GetLabels()[ownerLabel])
+	data, _, _ := unstructured.NestedStringMap(groupSecret.Object, "stringData")
+	assert.Equal(t, map[string]string{"SENTRY_DSN": "https://sentry-prod"}, data, "only the applied group values are rendered")
+}
+
+func TestAppDefinitionInjectedSecrets(t *testing.T) {
+	k := NewKube("treenq.com", "registry:5000", "testuser", "testpassword")
+	injection := &domain.SecretInjection{
+		Annotations: map[string]string{
+			"vault.hashicorp.com/agent-inject": "true",
+			"vault.hashicorp.com/role":         "treenq-apps",
+		},
+		EnvFile: "/vault/secrets/env",
+		Command: []string{"/app/server", "--port", "8000"},
+	}
+	res, err := k.DefineApp(context.Background(), "id-1234", "space", tqsdk.Space{
+		Service: tqsdk.Service{
+			Name:        "simple-app",
+			RuntimeEnvs: map[string]string{"LOG_LEVEL": "info", "DB_URL": "postgres://local"},
+			HttpPort:    8000,
+		},
+	}, domain.Image{Registry: "registry:5000", Repository: "treenq", Tag: "0.0.1"}, domain.AppSecrets{
+		Keys:      []string{"DB_URL"},
+		Groups:    []domain.GroupSecret{{GroupID: "g1", Group: "shared", Key: "SENTRY_DSN", Value: []byte("https://sentry")}},
+		Checksum:  "4f1c2b",
+		Injection: injection,
+	}, nil)
+	require.NoError(t, err)
+
+	var deployment *unstructured.Unstructured
+	for _, obj := range decodeObjects(res) {
+		switch {
+		case obj.GetKind() == "Deployment":
+			deployment = obj
+		case obj.GetKind() == "Secret" && obj.GetName() == "id-1234.secret-groups":
+			t.Fatal("the injected group secrets must not be rendered as a secret object")
+		}
+	}
+	require.NotNil(t, deployment)
+
+	containers, _, _ := unstructured.NestedSlice(deployment.Object, "spec", "template", "spec", "containers")
+	container := containers[0].(map[string]any)
+	assert.Equal(t, []any{map[string]any{"name": "LOG_LEVEL", "value": "info"}}, container["env"], "the injected secrets must not refer to the kubernetes secrets and the runtime env overridden by a secret must be left out")
+	assert.Equal(t, []any{"/bin/sh", "-c", injectedEnvScript, "/vault/secrets/env"}, container["command"], "the container must source the injected env file")
+	assert.Equal(t, []any{"/app/server", "--port", "8000"}, container["args"], "the image command must be run with the injected env")
+
+	annotations, _, _ := unstructured.NestedStringMap(deployment.Object, "spec", "template", "metadata", "annotations")
+	assert.Equal(t, map[string]string{
+		"vault.hashicorp.com/agent-inject": "true",
+		"vault.hashicorp.com/role":         "treenq-apps",
+		secretsChecksumAnnotation:          "4f1c2b",
+	}, annotations)
+	assert.Len(t, injection.Annotations, 2, "the given injection annotations must not be changed")
+}
+
+func TestInjectedEnvScript(t *testing.T) {
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, "env")
+	// the lines are rendered by the vault agent, a value keeps the quotes and a name may contain a dot
+	script := "set -- 'DB_URL=postgres://it'\\''s' \"$@\"\nset -- 'SENTRY.DSN=https://sentry' \"$@\"\n"
+	require.NoError(t, os.WriteFile(envFile, []byte(script), 0o600))
+
+	out, err := exec.Command("/bin/sh", "-c", injectedEnvScript, envFile, "env").Output()
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "DB_URL=postgres://it's\n")
+	assert.Contains(t, string(out), "SENTRY.DSN=https://sentry\n")
+
+	out, err = exec.Command("/bin/sh", "-c", injectedEnvScript, envFile).Output()
+	assert.Error(t, err, "a missing command must fail")
+	assert.Empty(t, out, "the values must never be printed")
+}
+
+// newFakeDynamicClient gives a fake client that handles server-side apply as create or update,
+// the default object tracker applies only to existing objects
+func newFakeDynamicClient(t *testing.T, objs ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	t.Helper()
+	client := dynamicfake.NewSimpleDynamicClient(scheme.Scheme, objs...)
+	client.PrependReactor("patch", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patchAction := action.(k8stesting.PatchAction)
+		if patchAction.GetPatchType() != types.ApplyPatchType {
+			return false, nil, nil
+		}
+
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(patchAction.GetPatch()); err != nil {
+			return true, nil, err
+		}
+		tracker := client.Tracker()
+		gvr, ns := patchAction.GetResource(), patchAction.GetNamespace()
+		_, err := tracker.Get(gvr, ns, obj.GetName())
+		if errors.IsNotFound(err) {
+			return true, obj, tracker.Create(gvr, obj, ns)
+		}
+		if err != nil {
+			return true, nil, err
+		}
+		return true, obj, tracker.Update(gvr, obj, ns)
+	})
+	return client
+}
+
+func testAppObjects(t *testing.T, k *Kube, app tqsdk.Space) []*unstructured.Unstructured {
+	t.Helper()
+	return testAppObjectsWithSecrets(t, k, app, nil)
+}
+
+func testAppObjectsWithSecrets(t *testing.T, k *Kube, app tqsdk.Space, secretKeys []string) []*unstructured.Unstructured {
+	t.Helper()
+	res, err := k.DefineApp(context.Background(), "id-1234", "space", app, domain.Image{
+		Registry:   "registry:5000",
+		Repository: "treenq",
+		Tag:        "0.0.1",
+	}, domain.AppSecrets{Keys: secretKeys}, nil)
+	require.NoError(t, err)
+	return decodeObjects(res)
+}
+
+var (
+	deploymentsGVR = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	ingressesGVR   = schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"}
+	secretsGVR     = schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+)
+
+func TestAppAddress(t *testing.T) {
+	k := NewKube("treenq.com", "registry:5000", "testuser", "testpassword")
+
+	assert.Equal(t, "space-id-1234-staging", k.Namespace("id-1234-staging", "space"))
+	assert.Equal(t, "https://id-1234-staging.treenq.com", k.AppURL("id-1234-staging"))
+}
+
+func TestApply(t *testing.T) {
+	k := NewKube("treenq.com", "registry:5000", "testuser", "testpassword")
+	ctx := context.Background()
+	client := newFakeDynamicClient(t)
+	app := tqsdk.Space{
+		Service: tqsdk.Service{
+			Name:     "simple-app",
+			HttpPort: 8000,
+			Replicas: 1,
+		},
+	}
+
+	require.NoError(t, k.apply(ctx, client, testAppObjects(t, k, app)))
+
+	deployment, err := client.Resource(deploymentsGVR).Namespace("space-id-1234").Get(ctx, "simple-app", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "id-1234", deployment.GetLabels()[ownerLabel])
+	replicas, _, _ := unstructured.NestedInt64(deployment.Object, "spec", "replicas")
+	assert.Equal(t, int64(1), replicas)
+
+	app.Service.Replicas = 3
+	require.NoError(t, k.apply(ctx, client, testAppObjects(t, k, app)))
+
+	deployment, err = client.Resource(deploymentsGVR).Namespace("space-id-1234").Get(ctx, "simple-app", metav1.GetOptions{})
+	require.NoError(t, err)
+	replicas, _, _ = unstructured.NestedInt64(deployment.Object, "spec", "replicas")
+	assert.Equal(t, int64(3), replicas)
+
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "patch" {
+			assert.Equal(t, types.ApplyPatchType, action.(k8stesting.PatchAction).GetPatchType())
+		}
+		assert.NotEqual(t, "create", action.GetVerb())
+		assert.NotEqual(t, "update", action.GetVerb())
+	}
+}
+
+func TestApplyPrunesRemovedObjects(t *testing.T) {
+	k := NewKube("treenq.com", "registry:5000", "testuser", "testpassword")
+	ctx := context.Background()
+	userSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "id-1234-token", Namespace: "space-id-1234"},
+	}
+	otherAppIngress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ingress",
+			Namespace: "space-id-5678",
+			Labels:    map[string]string{ownerLabel: "id-5678"},
+		},
+	}
+	client := newFakeDynamicClient(t, userSecret, otherAppIngress)
+	app := tqsdk.Space{
+		Service: tqsdk.Service{
+			Name:     "simple-app",
+			HttpPort: 8000,
+			Replicas: 1,
+		},
+	}
+
+	objs := testAppObjects(t, k, app)
+	require.NoError(t, k.apply(ctx, client, objs))
+	_, err := client.Resource(ingressesGVR).Namespace("space-id-1234").Get(ctx, "ingress", metav1.GetOptions{})
+	require.NoError(t, err)
+
+	// the app has no ingress anymore, e.g. it became a worker
+	withoutIngress := make([]*unstructured.Unstructured, 0, len(objs))
+	for _, obj := range objs {
+		if obj.GetKind() != "Ingress" {
+			withoutIngress = append(withoutIngress, obj)
+		}
+	}
+	require.NoError(t, k.apply(ctx, client, withoutIngress))
+
+	_, err = client.Resource(ingressesGVR).Namespace("space-id-1234").Get(ctx, "ingress", metav1.GetOptions{})
+	assert.True(t, errors.IsNotFound(err), "removed ingress must be pruned, got %v", err)
+
+	_, err = client.Resource(deploymentsGVR).Namespace("space-id-1234").Get(ctx, "simple-app", metav1.GetOptions{})
+	assert.NoError(t, err)
+	_, err = client.Resource(secretsGVR).Namespace("space-id-1234").Get(ctx, "registry-credentials", metav1.GetOptions{})
+	assert.NoError(t, err)
+	_, err = client.Resource(secretsGVR).Namespace("space-id-1234").Get(ctx, "id-1234-token", metav1.GetOptions{})
+	assert.NoError(t, err, "objects without the owner label must be kept")
+	_, err = client.Resource(ingressesGVR).Namespace("space-id-5678").Get(ctx, "ingress", metav1.GetOptions{})
+	assert.NoError(t, err, "objects of another owner must be kept")
+}
+
+func TestRolloutState(t *testing.T) {
+	deployment := func(status appsv1.DeploymentStatus) appsv1.Deployment {
+		return appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "simple-app", Generation: 2},
+			Spec:       appsv1.DeploymentSpec{Replicas: int32Ptr(2)},
+			Status:     status,
+		}
+	}
+
+	for _, tc := range []struct {
+		name   string
+		status appsv1.DeploymentStatus
+		done   bool
+		state  string
+	}{
+		{
+			name:   "spec not observed",
+			status: appsv1.DeploymentStatus{ObservedGeneration: 1, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 2},
+			state:  "waiting for the deployment spec update to be observed",
+		},
+		{
+			name:   "updating",
+			status: appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 1, AvailableReplicas: 2},
+			state:  "1 of 2 updated replicas are rolled out",
+		},
+		{
+			name:   "old replicas terminating",
+			status: appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 2, AvailableReplicas: 2},
+			state:  "1 old replicas are pending termination",
+		},
+		{
+			name:   "updated replicas starting",
+			status: appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 1},
+			state:  "1 of 2 updated replicas are available",
+		},
+		{
+			name:   "rolled out",
+			status: appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 2},
+			done:   true,
+			state:  "rolled out 2 replicas",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			done, state, err := rolloutState(deployment(tc.status))
+			require.NoError(t, err)
+			assert.Equal(t, tc.done, done)
+			assert.Equal(t, tc.state, state)
+		})
+	}
+
+	_, _, err := rolloutState(deployment(appsv1.DeploymentStatus{
+		ObservedGeneration: 2,
+		Conditions: []appsv1.DeploymentCondition{{
+			Type:   appsv1.DeploymentProgressing,
+			Reason: "ProgressDeadlineExceeded",
+		}},
+	}))
+	assert.Error(t, err, "a stuck rollout must fail")
+}
+
+func TestLogLineTime(t *testing.T) {
+	line := "2026-10-19T09:57:17.123456789Z server started"
+	assert.Equal(t, time.Date(2026, 10, 19, 9, 57, 17, 123456789, time.UTC), logLineTime(line).UTC())
+
+	before := time.Now()
+	assert.False(t, logLineTime("server started").Before(before), "a line without a time must be given the current time")
+}
+
+func TestLogPositions(t *testing.T) {
+	first := time.Date(2026, 10, 19, 9, 57, 17, 123456789, time.UTC)
+	second := first.Add(time.Second)
+	positions := domain.LogPositions{"app-7d9f-b": second, "app-7d9f-a": first}
+
+	id := positions.String()
+	assert.Equal(t, "app-7d9f-a@"+strconv.FormatInt(first.UnixNano(), 10)+",app-7d9f-b@"+strconv.FormatInt(second.UnixNano(), 10), id)
+	assert.Equal(t, positions, domain.ParseLogPositions(id), "a pod position must be resumed as it's given")
+
+	assert.Equal(t, second, positions.Since("app-7d9f-b"))
+	assert.Equal(t, first, positions.Since("app-7d9f-c"), "a new pod must be followed from the earliest position")
+	assert.True(t, domain.LogPositions{}.Since("app-7d9f-a").IsZero())
+
+	for _, invalid := range []string{"", "1700000000000000000", "app@", "app@x", "@1"} {
+		assert.Empty(t, domain.ParseLogPositions(invalid), invalid)
+	}
+}
@@ -0,0 +1,199 @@
+package cdk
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/treenq/treenq/src/domain"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// ignoredMetadataFields are set by the api server and change on every write,
+// they say nothing about the app definition
+var ignoredMetadataFields = []string{
+	"managedFields",
+	"resourceVersion",
+	"generation",
+	"uid",
+	"creationTimestamp",
+	"selfLink",
+}
+
+// Plan compares the objects of the given manifest to the live ones,
+// the changes are computed by the server-side dry run, so the api server defaults don't appear as a change.
+func (k *Kube) Plan(ctx context.Context, rawConfig, data string) (domain.DeploymentPlan, error) {
+	conf, err := clientcmd.RESTConfigFromKubeConfig([]byte(rawConfig))
+	if err != nil {
+		return domain.DeploymentPlan{}, err
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(conf)
+	if err != nil {
+		return domain.DeploymentPlan{}, fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+
+	return k.plan(ctx, dynamicClient, decodeObjects(data))
+}
+
+func (k *Kube) plan(ctx context.Context, dynamicClient dynamic.Interface, objs []*unstructured.Unstructured) (domain.DeploymentPlan, error) {
+	plan := domain.DeploymentPlan{
+		Added:   []domain.ObjectDiff{},
+		Changed: []domain.ObjectDiff{},
+		Removed: []domain.ObjectDiff{},
+	}
+
+	for _, obj := range objs {
+		gvr, _ := meta.UnsafeGuessKindToResource(obj.GroupVersionKind())
+		resourceClient := dynamicClient.Resource(gvr).Namespace(obj.GetNamespace())
+		objDiff := domain.ObjectDiff{
+			Kind:      obj.GetKind(),
+			Namespace: obj.GetNamespace(),
+			Name:      obj.GetName(),
+		}
+
+		live, err := resourceClient.Get(ctx, obj.GetName(), metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			plan.Added = append(plan.Added, objDiff)
+			continue
+		}
+		if err != nil {
+			return domain.DeploymentPlan{}, fmt.Errorf("failed to get live %s %s: %w", obj.GetKind(), obj.GetName(), err)
+		}
+
+		applied, err := resourceClient.Apply(ctx, obj.GetName(), obj, metav1.ApplyOptions{
+			FieldManager: fieldManager,
+			Force:        true,
+			DryRun:       []string{metav1.DryRunAll},
+		})
+		if err != nil {
+			return domain.DeploymentPlan{}, fmt.Errorf("failed to dry run %s %s: %w", obj.GetKind(), obj.GetName(), err)
+		}
+
+		objDiff.Fields = diffObjects(obj.GetKind(), live.Object, applied.Object)
+		if len(objDiff.Fields) > 0 {
+			plan.Changed = append(plan.Changed, objDiff)
+		}
+	}
+
+	desired, scopes := ownership(objs)
+	for scope := range scopes {
+		stale, err := k.staleObjects(ctx, dynamicClient, scope, desired)
+		if err != nil {
+			return domain.DeploymentPlan{}, err
+		}
+		for _, obj := range stale {
+			plan.Removed = append(plan.Removed, domain.ObjectDiff{
+				Kind:      obj.kind,
+				Namespace: obj.namespace,
+				Name:      obj.name,
+			})
+		}
+	}
+
+	return plan, nil
+}
+
+// diffObjects gives the changed fields between the live object and the one it's going to become,
+// the status and the server managed metadata are ignored.
+func diffObjects(kind string, live, desired map[string]any) []domain.FieldDiff {
+	live = withoutServerFields(live)
+	desired = withoutServerFields(desired)
+
+	var fields []domain.FieldDiff
+	diffValues("", live, desired, &fields)
+
+	// secret values must not leak through a plan
+	if kind == "Secret" {
+		for i := range fields {
+			if isSecretDataPath(fields[i].Path) {
+				fields[i].Old = nil
+				fields[i].New = nil
+			}
+		}
+	}
+
+	return fields
+}
+
+func withoutServerFields(obj map[string]any) map[string]any {
+	obj = runtime.DeepCopyJSON(obj)
+	delete(obj, "status")
+	if metadata, ok := obj["metadata"].(map[string]any); ok {
+		for _, field := range ignoredMetadataFields {
+			delete(metadata, field)
+		}
+	}
+	return obj
+}
+
+func isSecretDataPath(path string) bool {
+	return path == "data" || path == "stringData" ||
+		strings.HasPrefix(path, "data.") || strings.HasPrefix(path, "stringData.")
+}
+
+func diffValues(path string, old, new any, fields *[]domain.FieldDiff) {
+	oldMap, oldIsMap := old.(map[string]any)
+	newMap, newIsMap := new.(map[string]any)
+	if oldIsMap && newIsMap {
+		keys := make([]string, 0, len(oldMap)+len(newMap))
+		for key := range oldMap {
+			keys = append(keys, key)
+		}
+		for key := range newMap {
+			if _, ok := oldMap[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		slices.Sort(keys)
+
+		for _, key := range keys {
+			fieldPath := key
+			if path != "" {
+				fieldPath = path + "." + key
+			}
+			oldValue, oldOk := oldMap[key]
+			newValue, newOk := newMap[key]
+			switch {
+			case !newOk:
+				*fields = append(*fields, domain.FieldDiff{Path: fieldPath, Change: domain.FieldRemoved, Old: oldValue})
+			case !oldOk:
+				*fields = append(*fields, domain.FieldDiff{Path: fieldPath, Change: domain.FieldAdded, New: newValue})
+			default:
+				diffValues(fieldPath, oldValue, newValue, fields)
+			}
+		}
+		return
+	}
+
+	oldList, oldIsList := old.([]any)
+	newList, newIsList := new.([]any)
+	if oldIsList && newIsList {
+		for i := 0; i < max(len(oldList), len(newList)); i++ {
+			itemPath := path + "[" + strconv.Itoa(i) + "]"
+			switch {
+			case i >= len(newList):
+				*fields = append(*fields, domain.FieldDiff{Path: itemPath, Change: domain.FieldRemoved, Old: oldList[i]})
+			case i >= len(oldList):
+				*fields = append(*fields, domain.FieldDiff{Path: itemPath, Change: domain.FieldAdded, New: newList[i]})
+			default:
+				diffValues(itemPath, oldList[i], newList[i], fields)
+			}
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(old, new) {
+		*fields = append(*fields, domain.FieldDiff{Path: path, Change: domain.FieldChanged, Old: old, New: new})
+	}
+}
@@ -0,0 +1,94 @@
+package cdk
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+	"github.com/treenq/treenq/src/domain"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestPlanNewApp(t *testing.T) {
+	k := NewKube("treenq.com", "registry:5000", "testuser", "testpassword")
+	ctx := context.Background()
+	client := newFakeDynamicClient(t)
+
+	plan, err := k.plan(ctx, client, testAppObjects(t, k, tqsdk.Space{
+		Service: tqsdk.Service{Name: "simple-app", HttpPort: 8000, Replicas: 1},
+	}))
+	require.NoError(t, err)
+
+	assert.Equal(t, []domain.ObjectDiff{
+		{Kind: "Namespace", Name: "space-id-1234"},
+		{Kind: "Secret", Namespace: "space-id-1234", Name: "registry-credentials"},
+		{Kind: "Deployment", Namespace: "space-id-1234", Name: "simple-app"},
+		{Kind: "Service", Namespace: "space-id-1234", Name: "simple-app"},
+		{Kind: "Ingress", Namespace: "space-id-1234", Name: "ingress"},
+	}, plan.Added)
+	assert.Empty(t, plan.Changed)
+	assert.Empty(t, plan.Removed)
+}
+
+func TestPlanChangedApp(t *testing.T) {
+	k := NewKube("treenq.com", "registry:5000", "testuser", "testpassword")
+	ctx := context.Background()
+	client := newFakeDynamicClient(t)
+	app := tqsdk.Space{
+		Service: tqsdk.Service{Name: "simple-app", HttpPort: 8000, Replicas: 2},
+	}
+	require.NoError(t, k.apply(ctx, client, testAppObjects(t, k, app)))
+
+	app.Service.Replicas = 4
+	objs := make([]*unstructured.Unstructured, 0)
+	for _, obj := range testAppObjectsWithSecrets(t, k, app, []string{"TOKEN"}) {
+		// the app has no ingress anymore
+		if obj.GetKind() != "Ingress" {
+			objs = append(objs, obj)
+		}
+	}
+
+	plan, err := k.plan(ctx, client, objs)
+	require.NoError(t, err)
+
+	assert.Empty(t, plan.Added)
+	assert.Equal(t, []domain.ObjectDiff{
+		{Kind: "Ingress", Namespace: "space-id-1234", Name: "ingress"},
+	}, plan.Removed)
+	require.Len(t, plan.Changed, 1)
+	assert.Equal(t, "Deployment", plan.Changed[0].Kind)
+	assert.Equal(t, []domain.FieldDiff{
+		{Path: "spec.replicas", Change: domain.FieldChanged, Old: int64(2), New: int64(4)},
+		{Path: "spec.template.spec.containers[0].env", Change: domain.FieldAdded, New: []any{
+			map[string]any{
+				"name": "TOKEN",
+				"valueFrom": map[string]any{
+					"secretKeyRef": map[string]any{
+						"key":  "TOKEN",
+						"name": "id-1234-token",
+					},
+				},
+			},
+		}},
+	}, plan.Changed[0].Fields)
+}
+
+func TestPlanHidesSecretValues(t *testing.T) {
+	live := map[string]any{
+		"kind":     "Secret",
+		"metadata": map[string]any{"name": "registry-credentials", "resourceVersion": "1"},
+		"data":     map[string]any{".dockerconfigjson": "b2xk"},
+	}
+	desired := map[string]any{
+		"kind":     "Secret",
+		"metadata": map[string]any{"name": "registry-credentials", "resourceVersion": "2"},
+		"data":     map[string]any{".dockerconfigjson": "bmV3"},
+	}
+
+	assert.Equal(t, []domain.FieldDiff{
+		{Path: "data..dockerconfigjson", Change: domain.FieldChanged},
+	}, diffObjects("Secret", live, desired))
+}
@@ -134,3 +134,13 @@ func (k *Kube) RemoveSecret(ctx context.Context, rawConfig string, space, repoID
 
 	return nil
 }
+
+// StoreGroupSecrets keeps nothing, the group values are a secret object of the app definition
+func (k *Kube) StoreGroupSecrets(ctx context.Context, rawConfig string, space, repoID string, values map[string]string) error {
+	return nil
+}
+
+// InjectSecrets gives no injection, the app env refers to the Kubernetes secrets of the repo
+func (k *Kube) InjectSecrets(space, repoID string, envs []domain.EnvSource) *domain.SecretInjection {
+	return nil
+}
@@ -0,0 +1,196 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/treenq/treenq/src/domain"
+)
+
+const defaultMount = "secret"
+
+// the annotations of the Vault Agent Injector, https://developer.hashicorp.com/vault/docs/platform/k8s/injector/annotations
+const (
+	injectAnnotation          = "vault.hashicorp.com/agent-inject"
+	roleAnnotation            = "vault.hashicorp.com/role"
+	prePopulateOnlyAnnotation = "vault.hashicorp.com/agent-pre-populate-only"
+	injectSecretAnnotation    = "vault.hashicorp.com/agent-inject-secret-env"
+	injectTemplateAnnotation  = "vault.hashicorp.com/agent-inject-template-env"
+)
+
+// envFile is a path the Vault Agent renders the env template to
+const envFile = "/vault/secrets/env"
+
+// groupSecretsKey is a secret keeping the group values of an app, a secret key starts with a letter, so it never clashes
+const groupSecretsKey = ".secret-groups"
+
+// quoteValue quotes a template value for the shell, a single quote closes the quoted string, escapes itself and opens it again
+const quoteValue = `replaceAll "'" "'\\''"`
+
+// Store keeps the repo secret values in a Vault KV v2 secrets engine, a secret per key,
+// and the group values of an app in a single secret.
+// The kubeconfig is ignored, the Vault Agent Injector renders the values in the app pods as a shell script,
+// the app command is run with them as its env, so the values never reach the cluster etcd.
+type Store struct {
+	client *http.Client
+	conf   domain.VaultConfig
+}
+
+func NewStore(client *http.Client, conf domain.VaultConfig) *Store {
+	if conf.Mount == "" {
+		conf.Mount = defaultMount
+	}
+	conf.Address = strings.TrimSuffix(conf.Address, "/")
+	return &Store{client: client, conf: conf}
+}
+
+type kvData struct {
+	Data map[string]string `json:"data"`
+}
+
+type kvResponse struct {
+	Data kvData `json:"data"`
+}
+
+func (s *Store) StoreSecret(ctx context.Context, _ string, nsName, appID, key, value string) error {
+	return s.write(ctx, nsName, appID, key, map[string]string{"value": value})
+}
+
+// StoreGroupSecrets writes the group values as a single secret of the app, the data is keyed by the env names
+func (s *Store) StoreGroupSecrets(ctx context.Context, rawConfig string, nsName, appID string, values map[string]string) error {
+	if len(values) == 0 {
+		return s.RemoveSecret(ctx, rawConfig, nsName, appID, groupSecretsKey)
+	}
+	return s.write(ctx, nsName, appID, groupSecretsKey, values)
+}
+
+func (s *Store) write(ctx context.Context, nsName, appID, key string, data map[string]string) error {
+	body, err := json.Marshal(kvData{Data: data})
+	if err != nil {
+		return fmt.Errorf("failed to encode vault secret: %w", err)
+	}
+
+	resp, err := s.do(ctx, http.MethodPost, s.url("data", nsName, appID, key), body)
+	if err != nil {
+		return fmt.Errorf("failed to write vault secret %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("vault responded with %d on write of secret %s", resp.StatusCode, key)
+	}
+	return nil
+}
+
+func (s *Store) GetSecret(ctx context.Context, _ string, nsName, appID, key string) (string, error) {
+	resp, err := s.do(ctx, http.MethodGet, s.url("data", nsName, appID, key), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to read vault secret %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", domain.ErrSecretNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault responded with %d on read of secret %s", resp.StatusCode, key)
+	}
+
+	var secret kvResponse
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return "", fmt.Errorf("failed to decode vault secret %s: %w", key, err)
+	}
+	value, ok := secret.Data.Data["value"]
+	if !ok {
+		return "", domain.ErrSecretNotFound
+	}
+	return value, nil
+}
+
+// RemoveSecret removes every version of the secret with its metadata
+func (s *Store) RemoveSecret(ctx context.Context, _ string, nsName, appID, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, s.url("metadata", nsName, appID, key), nil)
+	if err != nil {
+		return fmt.Errorf("failed to remove vault secret %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("vault responded with %d on removal of secret %s", resp.StatusCode, key)
+	}
+	return nil
+}
+
+// InjectSecrets renders every env as a line of the shell script /vault/secrets/env,
+// a line prepends a single quoted NAME=value argument, so the value is kept as is and the name may contain any secret key character.
+// The agent renders the script once the pod starts, the pods are restarted by the secrets checksum instead.
+func (s *Store) InjectSecrets(nsName, appID string, envs []domain.EnvSource) *domain.SecretInjection {
+	if len(envs) == 0 {
+		return nil
+	}
+
+	var tmpl strings.Builder
+	for _, env := range envs {
+		switch env.Source {
+		case domain.EnvSourceSecret:
+			fmt.Fprintf(&tmpl, "{{ with secret %q }}set -- '%s={{ .Data.data.value | %s }}' \"$@\"\n{{ end }}", s.kvPath(nsName, appID, env.Key), env.Name, quoteValue)
+		case domain.EnvSourceSecretGroup:
+			fmt.Fprintf(&tmpl, "{{ with secret %q }}set -- '%s={{ index .Data.data %q | %s }}' \"$@\"\n{{ end }}", s.kvPath(nsName, appID, groupSecretsKey), env.Name, env.Name, quoteValue)
+		}
+	}
+
+	secret := envs[0].Key
+	if envs[0].Source == domain.EnvSourceSecretGroup {
+		secret = groupSecretsKey
+	}
+	return &domain.SecretInjection{
+		Annotations: map[string]string{
+			injectAnnotation:          "true",
+			roleAnnotation:            s.conf.Role,
+			prePopulateOnlyAnnotation: "true",
+			injectSecretAnnotation:    s.kvPath(nsName, appID, secret),
+			injectTemplateAnnotation:  tmpl.String(),
+		},
+		EnvFile: envFile,
+	}
+}
+
+// kvPath is a path of the secret data the agent reads, {mount}/data/{secretPath}
+func (s *Store) kvPath(nsName, appID, key string) string {
+	return path.Join(s.conf.Mount, "data", s.secretPath(nsName, appID, key))
+}
+
+// secretPath is a path of the secret relative to the mount, {prefix}/{appID}/{key}, the prefix is the workspace namespace by default
+func (s *Store) secretPath(nsName, appID, key string) string {
+	prefix := s.conf.PathPrefix
+	if prefix == "" {
+		prefix = nsName
+	}
+	return path.Join(prefix, appID, key)
+}
+
+func (s *Store) url(api, nsName, appID, key string) string {
+	return s.conf.Address + "/v1/" + path.Join(s.conf.Mount, api, s.secretPath(nsName, appID, key))
+}
+
+func (s *Store) do(ctx context.Context, method, url string, body []byte) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", s.conf.Token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return s.client.Do(req)
+}
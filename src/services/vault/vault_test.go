@@ -0,0 +1,165 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/treenq/treenq/src/domain"
+)
+
+const testToken = "s.test-token"
+
+// kvStandIn is a minimal Vault KV v2 engine mounted at the given path, it keeps the secret data by the path
+type kvStandIn struct {
+	*httptest.Server
+	mu      sync.Mutex
+	secrets map[string]map[string]string
+}
+
+func newKvStandIn(t *testing.T, mount string) *kvStandIn {
+	s := &kvStandIn{secrets: make(map[string]map[string]string)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != testToken {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		dataPrefix, metadataPrefix := "/v1/"+mount+"/data/", "/v1/"+mount+"/metadata/"
+		switch {
+		case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, dataPrefix):
+			var body kvData
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			s.secrets[strings.TrimPrefix(r.URL.Path, dataPrefix)] = body.Data
+			json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"version": 1}})
+		case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, dataPrefix):
+			data, ok := s.secrets[strings.TrimPrefix(r.URL.Path, dataPrefix)]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(kvResponse{Data: kvData{Data: data}})
+		case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, metadataPrefix):
+			delete(s.secrets, strings.TrimPrefix(r.URL.Path, metadataPrefix))
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestStoreSecrets(t *testing.T) {
+	vault := newKvStandIn(t, "secret")
+	store := NewStore(vault.Client(), domain.VaultConfig{Address: vault.URL + "/", Role: "treenq-apps", Token: testToken})
+	ctx := context.Background()
+
+	_, err := store.GetSecret(ctx, "", "ws-1", "app-1", "DB_URL")
+	assert.ErrorIs(t, err, domain.ErrSecretNotFound, "a missing secret must be not found")
+
+	require.NoError(t, store.StoreSecret(ctx, "", "ws-1", "app-1", "DB_URL", "postgres://db"))
+	assert.Equal(t, map[string]string{"value": "postgres://db"}, vault.secrets["ws-1/app-1/DB_URL"], "the secret must be kept under the namespace by default")
+
+	value, err := store.GetSecret(ctx, "", "ws-1", "app-1", "DB_URL")
+	require.NoError(t, err)
+	assert.Equal(t, "postgres://db", value)
+
+	require.NoError(t, store.StoreSecret(ctx, "", "ws-1", "app-1", "DB_URL", "postgres://new"))
+	value, err = store.GetSecret(ctx, "", "ws-1", "app-1", "DB_URL")
+	require.NoError(t, err)
+	assert.Equal(t, "postgres://new", value, "a stored secret must be overwritten")
+
+	require.NoError(t, store.RemoveSecret(ctx, "", "ws-1", "app-1", "DB_URL"))
+	_, err = store.GetSecret(ctx, "", "ws-1", "app-1", "DB_URL")
+	assert.ErrorIs(t, err, domain.ErrSecretNotFound)
+	require.NoError(t, store.RemoveSecret(ctx, "", "ws-1", "app-1", "DB_URL"), "a missing secret removal must be ok")
+}
+
+func TestStoreSecretsMountAndPrefix(t *testing.T) {
+	vault := newKvStandIn(t, "kv/apps")
+	store := NewStore(vault.Client(), domain.VaultConfig{Address: vault.URL, Mount: "kv/apps", PathPrefix: "treenq/prod", Token: testToken})
+
+	require.NoError(t, store.StoreSecret(context.Background(), "", "ws-1", "app-1", "API_KEY", "key"))
+	assert.Contains(t, vault.secrets, "treenq/prod/app-1/API_KEY")
+}
+
+func TestStoreSecretsForbidden(t *testing.T) {
+	vault := newKvStandIn(t, "secret")
+	store := NewStore(vault.Client(), domain.VaultConfig{Address: vault.URL, Token: "s.wrong"})
+	ctx := context.Background()
+
+	assert.Error(t, store.StoreSecret(ctx, "", "ws-1", "app-1", "DB_URL", "postgres://db"))
+	_, err := store.GetSecret(ctx, "", "ws-1", "app-1", "DB_URL")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, domain.ErrSecretNotFound, "a denied read must not look like a missing secret")
+	assert.Error(t, store.RemoveSecret(ctx, "", "ws-1", "app-1", "DB_URL"))
+}
+
+func TestStoreGroupSecrets(t *testing.T) {
+	vault := newKvStandIn(t, "secret")
+	store := NewStore(vault.Client(), domain.VaultConfig{Address: vault.URL, Token: testToken})
+	ctx := context.Background()
+
+	values := map[string]string{"SENTRY_DSN": "https://sentry", "LOG.LEVEL": "debug"}
+	require.NoError(t, store.StoreGroupSecrets(ctx, "", "ws-1", "app-1", values))
+	assert.Equal(t, values, vault.secrets["ws-1/app-1/.secret-groups"], "the group values must be kept as a single secret of the app")
+
+	require.NoError(t, store.StoreGroupSecrets(ctx, "", "ws-1", "app-1", nil))
+	assert.NotContains(t, vault.secrets, "ws-1/app-1/.secret-groups", "no values must remove the group secret")
+	require.NoError(t, store.StoreGroupSecrets(ctx, "", "ws-1", "app-1", nil), "a missing group secret removal must be ok")
+}
+
+func TestInjectSecrets(t *testing.T) {
+	store := NewStore(http.DefaultClient, domain.VaultConfig{Address: "https://vault.example.com", Role: "treenq-apps", Token: testToken})
+
+	assert.Nil(t, store.InjectSecrets("ws-1", "app-1", nil), "an app without secrets must not be injected")
+
+	envs := []domain.EnvSource{
+		{Name: "SENTRY_DSN", Source: domain.EnvSourceSecretGroup, Key: "sentry_dsn", GroupID: "g1", Group: "shared"},
+		{Name: "DB_URL", Source: domain.EnvSourceSecret, Key: "DB_URL"},
+	}
+	injection := store.InjectSecrets("ws-1", "app-1", envs)
+	require.NotNil(t, injection)
+	assert.Equal(t, "/vault/secrets/env", injection.EnvFile)
+	assert.Empty(t, injection.Command, "the store doesn't know the image command")
+	assert.Equal(t, map[string]string{
+		"vault.hashicorp.com/agent-inject":              "true",
+		"vault.hashicorp.com/role":                      "treenq-apps",
+		"vault.hashicorp.com/agent-pre-populate-only":   "true",
+		"vault.hashicorp.com/agent-inject-secret-env":   "secret/data/ws-1/app-1/.secret-groups",
+		"vault.hashicorp.com/agent-inject-template-env": injection.Annotations["vault.hashicorp.com/agent-inject-template-env"],
+	}, injection.Annotations)
+
+	// the agent template is rendered with the stand-ins of the consul-template functions it uses
+	secrets := map[string]map[string]any{
+		"secret/data/ws-1/app-1/.secret-groups": {"SENTRY_DSN": "https://sentry"},
+		"secret/data/ws-1/app-1/DB_URL":         {"value": "postgres://it's"},
+	}
+	tmpl, err := template.New("env").Funcs(template.FuncMap{
+		"secret": func(path string) map[string]any {
+			return map[string]any{"Data": map[string]any{"data": secrets[path]}}
+		},
+		"replaceAll": func(old, new, s string) string {
+			return strings.ReplaceAll(s, old, new)
+		},
+	}).Parse(injection.Annotations["vault.hashicorp.com/agent-inject-template-env"])
+	require.NoError(t, err)
+	var rendered strings.Builder
+	require.NoError(t, tmpl.Execute(&rendered, nil))
+	assert.Equal(t, `set -- 'SENTRY_DSN=https://sentry' "$@"
+set -- 'DB_URL=postgres://it'\''s' "$@"
+`, rendered.String(), "every value must be a single quoted argument")
+}
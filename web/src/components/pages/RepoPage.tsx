@@ -1,6 +1,7 @@
 import { Button } from '@/components/ui/Button'
 import { Tabs, TabsContent, TabsList, TabsTrigger } from '@/components/ui/Tabs'
 import Deploy from '@/components/widgets/Deploy'
+import EnvSources from '@/components/widgets/EnvSources'
 import Secrets from '@/components/widgets/Secrets'
 import { useNavigate } from '@solidjs/router'
 
@@ -35,6 +36,7 @@ export default function RepoPage() {
           </TabsContent>
           <TabsContent value="secrets">
             <Secrets repoID={repoID} />
+            <EnvSources repoID={repoID} />
           </TabsContent>
         </Tabs>
       </div>
@@ -0,0 +1,66 @@
+import { Badge } from '@/components/ui/Badge'
+import {
+  Table,
+  TableBody,
+  TableCell,
+  TableHead,
+  TableHeader,
+  TableRow,
+} from '@/components/ui/Table'
+import { type EnvSource, httpClient } from '@/services/client'
+import { createResource, For, Show } from 'solid-js'
+
+type EnvSourcesProps = { repoID: string }
+
+const sourceLabel = (env: EnvSource) => {
+  switch (env.source) {
+    case 'secretGroup':
+      return `group ${env.group}`
+    case 'runtimeEnv':
+      return 'tq.json'
+    default:
+      return 'secret'
+  }
+}
+
+// EnvSources shows the variables the next deployment gets and where each of them comes from,
+// the secret groups are overridden by tq.json runtime envs and the repo secrets
+const EnvSources = ({ repoID }: EnvSourcesProps) => {
+  const [appEnv] = createResource(repoID, async (repoID) => {
+    const res = await httpClient.getAppEnv({ repoID })
+    if ('error' in res) return
+    return res.data
+  })
+
+  return (
+    <Show when={appEnv()?.envs.length}>
+      <h3 class="mt-8 mb-2 text-lg font-semibold">Environment</h3>
+      <Table>
+        <TableHeader>
+          <TableRow>
+            <TableHead class="w-sm">Name</TableHead>
+            <TableHead class="w-3xl">Value</TableHead>
+            <TableHead class="w-3xs">Source</TableHead>
+          </TableRow>
+        </TableHeader>
+        <TableBody>
+          <For each={appEnv()?.envs}>
+            {(env) => (
+              <TableRow classList={{ 'opacity-50 line-through': env.overridden }}>
+                <TableCell>{env.name}</TableCell>
+                <TableCell>{env.source === 'runtimeEnv' ? env.value : '******'}</TableCell>
+                <TableCell>
+                  <Badge variant={env.overridden ? 'outline' : 'secondary'}>
+                    {sourceLabel(env)}
+                  </Badge>
+                </TableCell>
+              </TableRow>
+            )}
+          </For>
+        </TableBody>
+      </Table>
+    </Show>
+  )
+}
+
+export default EnvSources
@@ -107,6 +107,35 @@ export type RevealSecretResponse = { value: string }
 
 export type RemoveSecretRequest = { repoID: string; key: string }
 
+// deployment restarts the app with the changed secrets, it's missing if the app isn't restarted
+export type SecretChangeResponse = { deployment?: Deployment }
+
+export type GetAppEnvRequest = { repoID: string }
+
+export type EnvSourceKind = 'secretGroup' | 'runtimeEnv' | 'secret'
+
+export type EnvSource = {
+  name: string
+  source: EnvSourceKind
+  key?: string
+  groupID?: string
+  group?: string
+  value?: string
+  overridden: boolean
+}
+
+export type SecretGroup = {
+  id: string
+  name: string
+  keys: string[]
+  createdAt: string
+}
+
+export type GetAppEnvResponse = {
+  groups: SecretGroup[]
+  envs: EnvSource[]
+}
+
 export type GetBuildProgressMessage = {
   message: BuildProgressMessage
 }
@@ -114,6 +143,7 @@ export type GetBuildProgressMessage = {
 export type TLevelMessage = 'INFO' | 'DEBUG' | 'ERROR'
 
 export type BuildProgressMessage = {
+  id?: number
   payload: string
   level: TLevelMessage
   final: boolean
@@ -251,7 +281,7 @@ class HttpClient {
     return await this.post('getDeployments', req)
   }
 
-  async setSecret(req: SetSecretRequest): Promise<Result<void>> {
+  async setSecret(req: SetSecretRequest): Promise<Result<SecretChangeResponse>> {
     return await this.post('setSecret', req)
   }
 
@@ -263,10 +293,14 @@ class HttpClient {
     return await this.post('revealSecret', req)
   }
 
-  async removeSecret(req: RemoveSecretRequest): Promise<Result<void>> {
+  async removeSecret(req: RemoveSecretRequest): Promise<Result<SecretChangeResponse>> {
     return await this.post('removeSecret', req)
   }
 
+  async getAppEnv(req: GetAppEnvRequest): Promise<Result<GetAppEnvResponse>> {
+    return await this.post('getAppEnv', req)
+  }
+
   async getDeployment(req: GetDeploymentRequest): Promise<Result<GetDeploymentResponse>> {
     return await this.post('getDeployment', req)
   }